@@ -3,25 +3,34 @@ package main
 import (
 	"context"
 	"fmt"
+	"os"
 
 	"github.com/mydecisive/mdai-data-core/audit"
-	datacorepublisher "github.com/mydecisive/mdai-data-core/eventing/publisher"
 	datacorekube "github.com/mydecisive/mdai-data-core/kube"
 	"github.com/mydecisive/mdai-data-core/service"
 	"github.com/mydecisive/mdai-data-core/valkey"
 	"github.com/mydecisive/mdai-gateway/internal/adapter"
+	"github.com/mydecisive/mdai-gateway/internal/auth"
+	"github.com/mydecisive/mdai-gateway/internal/config"
+	"github.com/mydecisive/mdai-gateway/internal/metrics"
+	"github.com/mydecisive/mdai-gateway/internal/nats"
 	"github.com/mydecisive/mdai-gateway/internal/opamp"
 	"github.com/mydecisive/mdai-gateway/internal/server"
+	"github.com/mydecisive/mdai-gateway/internal/tracing"
 	"go.uber.org/zap"
-	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
 const publisherClientName = "publisher-mdai-gateway"
 
-func initDependencies(ctx context.Context) (deps server.HandlerDeps, cleanup func()) { //nolint:nonamedreturns
+func initDependencies(ctx context.Context) (deps server.HandlerDeps, cleanup func()) { //nolint:nonamedreturns,funlen
 	sys, app, teardown := service.InitLogger(ctx, serviceName)
 
+	cfg, err := config.Load(os.Getenv(config.FileEnvVarKey))
+	if err != nil {
+		app.Fatal("failed to load configuration", zap.Error(err))
+	}
+
 	valkeyClient, err := valkey.Init(ctx, app, valkey.NewConfig())
 	if err != nil {
 		app.Fatal("failed to initialize valkey client", zap.Error(err))
@@ -29,24 +38,57 @@ func initDependencies(ctx context.Context) (deps server.HandlerDeps, cleanup fun
 
 	auditAdapter := audit.NewAuditAdapter(app, valkeyClient)
 
-	publisher, err := datacorepublisher.NewPublisher(ctx, app, publisherClientName)
+	shutdownTracing, err := tracing.Setup(ctx, app, serviceName)
+	if err != nil {
+		app.Fatal("failed to set up tracing", zap.Error(err))
+	}
+
+	publisher, err := nats.NewEventPublisher(ctx, app, publisherClientName)
 	if err != nil {
 		app.Fatal("failed to start NATS publisher", zap.Error(err))
 	}
 
-	cmController, err := startConfigMapControllerWithClient(app, []string{datacorekube.ManualEnvConfigMapType}, corev1.NamespaceAll)
+	clientset, err := datacorekube.NewK8sClient(app)
+	if err != nil {
+		app.Fatal("failed to create Kubernetes client", zap.Error(err))
+	}
+
+	cmController, err := startConfigMapController(app, clientset, []string{datacorekube.ManualEnvConfigMapType}, cfg.ConfigMaps.Namespace)
 	if err != nil {
 		app.Fatal("failed to start config map controller", zap.Error(err))
 	}
 
-	deduper := adapter.NewDeduper()
+	deduper := adapter.NewDeduper(adapter.WithTTL(cfg.Deduper.TTL))
+
+	if cfg.Features.Metrics {
+		if err := metrics.RegisterDeduperSize(deduper.Len); err != nil {
+			app.Fatal("failed to register deduper metrics", zap.Error(err))
+		}
+		if err := metrics.RegisterManualVariables(cmController.GetAllHubsToDataMap); err != nil {
+			app.Fatal("failed to register manual variable metrics", zap.Error(err))
+		}
+	}
 
-	opampServer, err := opamp.NewOpAMPControlServer(app, auditAdapter, publisher)
+	var opampServer *opamp.OpAMPControlServer
+	if cfg.Features.OpAMP {
+		opampServer, err = opamp.NewOpAMPControlServer(app, cfg.OpAMP, auditAdapter, publisher)
+		if err != nil {
+			app.Fatal("failed to start OpAMP server", zap.Error(err))
+		}
+		if cfg.Features.Metrics {
+			if err := metrics.RegisterOpAMPConnectedAgents(opampServer.ConnectedAgents); err != nil {
+				app.Fatal("failed to register OpAMP metrics", zap.Error(err))
+			}
+		}
+	}
+
+	authenticator, authorizer, err := newAuth(cfg, clientset, cmController)
 	if err != nil {
-		app.Fatal("failed to start OpAMP server", zap.Error(err))
+		app.Fatal("failed to configure authentication", zap.Error(err))
 	}
 
 	deps = server.HandlerDeps{
+		Config:              cfg,
 		Logger:              app,
 		ValkeyClient:        valkeyClient,
 		EventPublisher:      publisher,
@@ -54,13 +96,24 @@ func initDependencies(ctx context.Context) (deps server.HandlerDeps, cleanup fun
 		AuditAdapter:        auditAdapter,
 		Deduper:             deduper,
 		OpAMPServer:         opampServer,
+		Authenticator:       authenticator,
+		Authorizer:          authorizer,
+		VarWatcher:          publisher,
+		StreamsDone:         nil,
 	}
 
+	// Called once the HTTP server has drained: flush pending NATS publishes before closing
+	// Valkey, which the audit writes of those publishes still depend on.
 	cleanup = func() {
 		app.Info("Closing client connections...")
+		if err := publisher.Close(); err != nil {
+			app.Error("failed to drain NATS publisher", zap.Error(err))
+		}
 		valkeyClient.Close()
-		_ = publisher.Close()
 		cmController.Stop()
+		if err := shutdownTracing(context.Background()); err != nil {
+			app.Error("failed to flush traces", zap.Error(err))
+		}
 		sys.Info("Cleanup complete.")
 		teardown()
 	}
@@ -86,15 +139,53 @@ func startConfigMapController(
 	return controller, nil
 }
 
-func startConfigMapControllerWithClient(
-	logger *zap.Logger,
-	configMapTypes []string,
-	namespace string,
-) (*datacorekube.ConfigMapController, error) {
-	clientset, err := datacorekube.NewK8sClient(logger)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+// newAuth builds the authenticators and the authorizer selected by cfg. The authenticator is nil when
+// authentication is disabled.
+func newAuth(
+	cfg config.Config,
+	clientset kubernetes.Interface,
+	cmController *datacorekube.ConfigMapController,
+) (auth.Authenticator, auth.Authorizer, error) { //nolint:ireturn
+	var authenticators auth.Chain
+	if cfg.TLS.Enabled() && cfg.TLS.ClientAuth != config.ClientAuthNone {
+		authenticators = append(authenticators, auth.ClientCertificateAuthenticator{})
+	}
+	if cfg.Auth.CredentialsFile != "" {
+		static, err := auth.LoadStaticAuthenticator(cfg.Auth.CredentialsFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		authenticators = append(authenticators, static)
+	}
+	if cfg.Auth.Kubernetes.TokenReview {
+		authenticators = append(authenticators, auth.NewTokenReviewAuthenticator(clientset, cfg.Auth.Kubernetes.Audiences, cfg.Auth.Kubernetes.CacheTTL))
 	}
 
-	return startConfigMapController(logger, clientset, configMapTypes, namespace)
+	var authorizer auth.Authorizer = auth.NewPolicy(cfg.Auth.Rules)
+	if cfg.Auth.Kubernetes.SubjectAccessReview {
+		authorizer = auth.NewSubjectAccessReviewAuthorizer(clientset, cfg.Auth.Kubernetes.ResourceGroup, hubNamespaceResolver(cmController))
+	}
+
+	if len(authenticators) == 0 {
+		return nil, authorizer, nil
+	}
+	return authenticators, authorizer, nil
+}
+
+// hubNamespaceResolver looks up the namespace of a hub from its manual variables ConfigMap.
+func hubNamespaceResolver(cmController *datacorekube.ConfigMapController) auth.NamespaceResolver {
+	return func(hubName string) (string, error) {
+		objs, err := cmController.CmInformer.Informer().GetIndexer().ByIndex(datacorekube.ByHub, hubName)
+		if err != nil {
+			return "", err
+		}
+		if len(objs) == 0 {
+			return "", auth.ErrUnknownHub
+		}
+		configMap, err := cmController.GetConfigMapByHubName(hubName)
+		if err != nil {
+			return "", err
+		}
+		return configMap.Namespace, nil
+	}
 }
@@ -2,35 +2,77 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"net"
 	"net/http"
+	"os/signal"
+	"syscall"
 
-	"github.com/mydecisive/mdai-data-core/helpers"
 	"github.com/mydecisive/mdai-gateway/internal/server"
+	"github.com/mydecisive/mdai-gateway/internal/tlsutil"
 	"go.uber.org/zap"
 )
 
 const serviceName = "github.com/mydecisive/mdai-gateway"
 
 func main() {
+	// Handlers publish with this context, so it is not cancelled on signal;
+	// otherwise in-flight publishes would be aborted instead of drained.
 	ctx := context.Background()
 
 	deps, cleanup := initDependencies(ctx)
-	defer cleanup()
+	streamsCtx, endStreams := context.WithCancel(ctx)
+	deps.StreamsDone = streamsCtx.Done()
 
 	router := server.NewRouter(ctx, deps)
 
-	httpPort := helpers.GetEnvVariableWithDefault(httpPortEnvVarKey, defaultHTTPPort)
-	deps.Logger.Info("Starting server", zap.String("address", ":"+httpPort))
-
+	httpCfg := deps.Config.HTTP
 	httpServer := &http.Server{
-		Addr:              ":" + httpPort,
+		Addr:              httpCfg.ListenAddress,
 		Handler:           router,
-		ReadHeaderTimeout: defaultReadHeaderTimeout,
-		ReadTimeout:       defaultReadTimeout,
-		WriteTimeout:      defaultWriteTimeout,
-		IdleTimeout:       defaultIdleTimeout,
-		ConnContext:       deps.OpAMPServer.ConnContext,
+		ReadHeaderTimeout: httpCfg.ReadHeaderTimeout,
+		ReadTimeout:       httpCfg.ReadTimeout,
+		WriteTimeout:      httpCfg.WriteTimeout,
+		IdleTimeout:       httpCfg.IdleTimeout,
+	}
+	// Shutdown waits for in-flight requests, which watch streams never finish on their own.
+	httpServer.RegisterOnShutdown(endStreams)
+
+	var drainers []drainFunc
+	if deps.OpAMPServer != nil {
+		httpServer.ConnContext = deps.OpAMPServer.ConnContext
+		drainers = append(drainers, deps.OpAMPServer.Stop)
 	}
 
-	deps.Logger.Fatal("failed to start server", zap.Error(httpServer.ListenAndServe()))
+	ln, err := (&net.ListenConfig{}).Listen(ctx, "tcp", httpServer.Addr)
+	if err != nil {
+		deps.Logger.Fatal("failed to listen", zap.String("address", httpServer.Addr), zap.Error(err))
+	}
+
+	signalCtx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+
+	reverter := server.NewReverter(deps)
+	go reverter.Run(signalCtx)
+	drainers = append(drainers, reverter.Stop)
+	scheduler := server.NewScheduler(deps)
+	go scheduler.Run(signalCtx)
+	drainers = append(drainers, scheduler.Stop)
+
+	if tlsCfg := deps.Config.TLS; tlsCfg.Enabled() {
+		reloader, err := tlsutil.NewReloader(deps.Logger, tlsCfg)
+		if err != nil {
+			deps.Logger.Fatal("failed to load TLS certificates", zap.Error(err))
+		}
+		go reloader.Run(signalCtx)
+		ln = tls.NewListener(ln, reloader.TLSConfig())
+	}
+	deps.Logger.Info("Starting server", zap.String("address", ln.Addr().String()), zap.Bool("tls", deps.Config.TLS.Enabled()))
+
+	serveErr := serve(signalCtx, deps.Logger, httpServer, ln, httpCfg.ShutdownTimeout, drainers...)
+	stop()
+
+	cleanup()
+	if serveErr != nil {
+		deps.Logger.Fatal("server exited with error", zap.Error(serveErr))
+	}
 }
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// drainFunc stops a component that holds in-flight work once the HTTP server no longer accepts requests.
+type drainFunc func(ctx context.Context) error
+
+// serve runs srv on ln until ctx is done. It then stops accepting new requests and waits up to
+// shutdownTimeout for in-flight handlers and every drain function to finish.
+func serve(ctx context.Context, logger *zap.Logger, srv *http.Server, ln net.Listener, shutdownTimeout time.Duration, drainers ...drainFunc) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Info("Shutting down server", zap.Duration("timeout", shutdownTimeout))
+
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+	defer cancel()
+
+	errs := []error{srv.Shutdown(shutdownCtx)}
+	for _, drain := range drainers {
+		errs = append(errs, drain(shutdownCtx))
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		errs = append(errs, err)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	logger.Info("Server stopped")
+	return nil
+}
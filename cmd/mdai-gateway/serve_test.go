@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type serveResult struct {
+	err error
+}
+
+func startServe(t *testing.T, ctx context.Context, handler http.Handler, shutdownTimeout time.Duration, drainers ...drainFunc) (string, <-chan serveResult) {
+	t.Helper()
+
+	ln, err := (&net.ListenConfig{}).Listen(t.Context(), "tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: time.Second}
+	done := make(chan serveResult, 1)
+	go func() {
+		done <- serveResult{err: serve(ctx, zap.NewNop(), srv, ln, shutdownTimeout, drainers...)}
+	}()
+
+	return "http://" + ln.Addr().String(), done
+}
+
+func slowHandler(started chan<- struct{}, delay time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		close(started)
+		time.Sleep(delay)
+		_, _ = io.WriteString(w, "done")
+	})
+}
+
+func get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	return http.DefaultClient.Do(req)
+}
+
+func TestServe_DrainsInFlightRequestOnSignal(t *testing.T) {
+	ctx, stop := signal.NotifyContext(t.Context(), syscall.SIGTERM)
+	defer stop()
+
+	started := make(chan struct{})
+	drained := false
+	url, done := startServe(t, ctx, slowHandler(started, 300*time.Millisecond), 5*time.Second, func(context.Context) error {
+		drained = true
+		return nil
+	})
+
+	type response struct {
+		body string
+		err  error
+	}
+	responses := make(chan response, 1)
+	go func() {
+		resp, err := get(t.Context(), url)
+		if err != nil {
+			responses <- response{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		responses <- response{body: string(body), err: err}
+	}()
+
+	<-started
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+
+	select {
+	case result := <-done:
+		require.NoError(t, result.err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return after SIGTERM")
+	}
+	assert.True(t, drained, "drain functions must run during shutdown")
+
+	resp := <-responses
+	require.NoError(t, resp.err)
+	assert.Equal(t, "done", resp.body)
+
+	// The listener is closed, so new requests are refused.
+	_, err := get(t.Context(), url) //nolint:bodyclose
+	require.Error(t, err)
+}
+
+func TestServe_ShutdownDeadlineExceeded(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+
+	started := make(chan struct{})
+	url, done := startServe(t, ctx, slowHandler(started, 2*time.Second), 50*time.Millisecond)
+
+	go func() {
+		resp, err := get(t.Context(), url)
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+	}()
+
+	<-started
+	cancel()
+
+	select {
+	case result := <-done:
+		require.ErrorIs(t, result.err, context.DeadlineExceeded)
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return after the shutdown deadline")
+	}
+}
+
+func TestServe_DrainError(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	drainErr := errors.New("drain failed")
+
+	_, done := startServe(t, ctx, http.NotFoundHandler(), time.Second, func(context.Context) error {
+		return drainErr
+	})
+	cancel()
+
+	result := <-done
+	require.ErrorIs(t, result.err, drainErr)
+}
@@ -5,27 +5,92 @@ import (
 	"time"
 )
 
+// DefaultDeduperTTL matches the default Alertmanager repeat interval.
+const DefaultDeduperTTL = 12 * time.Hour
+
+type dedupEntry struct {
+	changeTime time.Time
+	seenAt     time.Time
+}
+
 type Deduper struct {
-	mu   sync.Mutex
-	last map[string]time.Time // TODO add TTL, default 12h equal to the Alertmanager configuration
+	mu        sync.Mutex
+	last      map[string]dedupEntry
+	ttl       time.Duration
+	now       func() time.Time
+	lastSweep time.Time
 }
 
-func NewDeduper() *Deduper { return &Deduper{last: make(map[string]time.Time)} }
+type DeduperOption func(*Deduper)
+
+// WithTTL sets how long a fingerprint is remembered after its last update. Zero disables expiry.
+func WithTTL(ttl time.Duration) DeduperOption {
+	return func(d *Deduper) {
+		d.ttl = ttl
+	}
+}
+
+func NewDeduper(opts ...DeduperOption) *Deduper {
+	d := &Deduper{
+		last: make(map[string]dedupEntry),
+		ttl:  DefaultDeduperTTL,
+		now:  time.Now,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
 
 // UpdateIfNewer checks the stored time for key and, if changeTime is strictly newer.
 func (d *Deduper) UpdateIfNewer(fingerprint string, changeTime time.Time) (bool, time.Time) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
-	if prev, ok := d.last[fingerprint]; ok && !changeTime.After(prev) {
+
+	now := d.now()
+	d.sweepExpired(now)
+
+	if prev, ok := d.lookup(fingerprint, now); ok && !changeTime.After(prev) {
 		return false, prev
 	}
-	d.last[fingerprint] = changeTime
+	d.last[fingerprint] = dedupEntry{changeTime: changeTime, seenAt: now}
 	return true, changeTime
 }
 
 func (d *Deduper) PeekLast(key string) (time.Time, bool) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
-	t, ok := d.last[key]
-	return t, ok
+	return d.lookup(key, d.now())
+}
+
+// Len returns the number of remembered fingerprints, including expired ones not swept yet.
+func (d *Deduper) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.last)
+}
+
+func (d *Deduper) lookup(key string, now time.Time) (time.Time, bool) {
+	entry, ok := d.last[key]
+	if !ok || d.expired(entry, now) {
+		return time.Time{}, false
+	}
+	return entry.changeTime, true
+}
+
+func (d *Deduper) expired(entry dedupEntry, now time.Time) bool {
+	return d.ttl > 0 && now.Sub(entry.seenAt) >= d.ttl
+}
+
+// sweepExpired drops expired fingerprints at most once per TTL to keep updates cheap.
+func (d *Deduper) sweepExpired(now time.Time) {
+	if d.ttl <= 0 || now.Sub(d.lastSweep) < d.ttl {
+		return
+	}
+	d.lastSweep = now
+	for key, entry := range d.last {
+		if d.expired(entry, now) {
+			delete(d.last, key)
+		}
+	}
 }
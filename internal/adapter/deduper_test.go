@@ -147,3 +147,39 @@ func TestDeduper_Concurrent_MultipleKeys(t *testing.T) {
 		require.Equal(t, base.Add(time.Duration(n-1)*time.Nanosecond), lastSeen)
 	}
 }
+
+func TestDeduper_TTL(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	deduper := NewDeduper(WithTTL(time.Hour))
+	deduper.now = func() time.Time { return now }
+
+	changeTime := now.Add(-time.Minute)
+	assert.True(t, isNewer(deduper, "fp", changeTime))
+	assert.False(t, isNewer(deduper, "fp", changeTime))
+
+	// Once the TTL elapses the fingerprint is forgotten, so the same change is accepted again.
+	now = now.Add(time.Hour)
+	_, ok := deduper.PeekLast("fp")
+	assert.False(t, ok)
+	assert.True(t, isNewer(deduper, "fp", changeTime))
+
+	// Expired fingerprints are swept on update.
+	assert.True(t, isNewer(deduper, "other", changeTime))
+	now = now.Add(2 * time.Hour)
+	assert.True(t, isNewer(deduper, "other", changeTime))
+	assert.Equal(t, 1, deduper.Len())
+}
+
+func TestDeduper_NoTTL(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	deduper := NewDeduper(WithTTL(0))
+	deduper.now = func() time.Time { return now }
+
+	assert.True(t, isNewer(deduper, "fp", now))
+	now = now.Add(24 * 365 * time.Hour)
+	assert.False(t, isNewer(deduper, "fp", now.Add(-time.Hour*24*366)))
+}
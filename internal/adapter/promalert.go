@@ -10,6 +10,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/mydecisive/mdai-data-core/eventing"
 	"github.com/mydecisive/mdai-data-core/eventing/config"
+	"github.com/mydecisive/mdai-gateway/internal/metrics"
 	"github.com/prometheus/alertmanager/template"
 	"go.uber.org/zap"
 )
@@ -48,6 +49,7 @@ func (w *PromAlertWrapper) ToMdaiEvents() ([]EventPerSubject, int, error) {
 		changeTime := changeTime(alert)
 		if isNewer, lastTime := w.deduper.UpdateIfNewer(alert.Fingerprint, changeTime); !isNewer {
 			skipped++
+			metrics.DeduperSkippedAlerts.Inc()
 			w.Logger.Info(
 				"Skipping stale alert",
 				zap.String("alert_name", alert.Annotations[AlertName]),
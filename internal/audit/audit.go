@@ -2,10 +2,14 @@ package audit
 
 import (
 	"context"
+	"maps"
 	"strconv"
 	"time"
 
 	"github.com/mydecisive/mdai-data-core/eventing"
+	"github.com/mydecisive/mdai-gateway/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -13,6 +17,24 @@ type Inserter interface {
 	InsertAuditLogEventFromMap(ctx context.Context, eventMap map[string]string) error
 }
 
+type fieldsContextKey struct{}
+
+// WithFields adds fields to every audit entry recorded with the returned context, e.g. the caller and the
+// authorization decision behind a variable write.
+func WithFields(ctx context.Context, fields map[string]string) context.Context {
+	merged := maps.Clone(fieldsFromContext(ctx))
+	if merged == nil {
+		merged = make(map[string]string, len(fields))
+	}
+	maps.Copy(merged, fields)
+	return context.WithValue(ctx, fieldsContextKey{}, merged)
+}
+
+func fieldsFromContext(ctx context.Context) map[string]string {
+	fields, _ := ctx.Value(fieldsContextKey{}).(map[string]string)
+	return fields
+}
+
 func RecordAuditEventFromMdaiEvent(ctx context.Context, logger *zap.Logger, auditAdapter Inserter, event eventing.MdaiEvent, success bool) error {
 	eventMap := map[string]string{
 		"id":              event.ID,
@@ -25,6 +47,37 @@ func RecordAuditEventFromMdaiEvent(ctx context.Context, logger *zap.Logger, audi
 		"hub_name":        event.HubName,
 		"publish_success": strconv.FormatBool(success),
 	}
+	for key, value := range fieldsFromContext(ctx) {
+		if _, reserved := eventMap[key]; !reserved {
+			eventMap[key] = value
+		}
+	}
 	logger.Info("AUDIT: Published event from Prometheus alert", zap.String("mdai-logstream", "audit"), zap.Any("mdaiEvent", eventMap))
-	return auditAdapter.InsertAuditLogEventFromMap(ctx, eventMap)
+
+	ctx, span := tracing.Tracer().Start(ctx, "audit insert", trace.WithAttributes(
+		attribute.String("mdai.event.id", event.ID),
+		attribute.Bool("mdai.publish_success", success),
+	))
+	err := auditAdapter.InsertAuditLogEventFromMap(ctx, eventMap)
+	tracing.End(span, err)
+	return err
+}
+
+// RecordAuditEntry records an action of the gateway itself that publishes no event, e.g. cancelling a pending revert.
+// Like for events, the fields of ctx are added without overriding those of entry.
+func RecordAuditEntry(ctx context.Context, logger *zap.Logger, auditAdapter Inserter, entry map[string]string) error {
+	entryMap := maps.Clone(entry)
+	for key, value := range fieldsFromContext(ctx) {
+		if _, reserved := entryMap[key]; !reserved {
+			entryMap[key] = value
+		}
+	}
+	logger.Info("AUDIT: Recorded gateway action", zap.String("mdai-logstream", "audit"), zap.Any("mdaiEvent", entryMap))
+
+	ctx, span := tracing.Tracer().Start(ctx, "audit insert", trace.WithAttributes(
+		attribute.String("mdai.event.id", entryMap["id"]),
+	))
+	err := auditAdapter.InsertAuditLogEventFromMap(ctx, entryMap)
+	tracing.End(span, err)
+	return err
 }
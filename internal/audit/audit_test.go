@@ -7,6 +7,7 @@ import (
 	"github.com/mydecisive/mdai-data-core/eventing"
 	"github.com/mydecisive/mdai-gateway/mocks"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest/observer"
@@ -41,7 +42,7 @@ func TestRecordAuditEventFromMdaiEvent(t *testing.T) {
 		"publish_success": "true",
 	}
 
-	mockAudit.On("InsertAuditLogEventFromMap", t.Context(), expectedMap).Return(nil).Once()
+	mockAudit.On("InsertAuditLogEventFromMap", mock.Anything, expectedMap).Return(nil).Once()
 
 	err := RecordAuditEventFromMdaiEvent(t.Context(), logger, mockAudit, event, true)
 	require.NoError(t, err)
@@ -62,3 +63,37 @@ func TestRecordAuditEventFromMdaiEvent(t *testing.T) {
 	assert.Equal(t, "event_name", eventMap["name"])
 	assert.Equal(t, "true", eventMap["publish_success"])
 }
+
+func TestRecordAuditEventFromMdaiEvent_ContextFields(t *testing.T) {
+	mockAudit := &mocks.MockAuditAdapter{}
+	event := eventing.MdaiEvent{
+		ID:        "id1",
+		Name:      "var.add",
+		Timestamp: time.Date(2025, 7, 19, 12, 0, 0, 0, time.UTC),
+		HubName:   "hub",
+	}
+
+	ctx := WithFields(t.Context(), map[string]string{"caller": "team-a", "hub_name": "ignored"})
+	ctx = WithFields(ctx, map[string]string{"authz_rule": "team-a-writes"})
+
+	mockAudit.On("InsertAuditLogEventFromMap", mock.Anything, mock.MatchedBy(func(eventMap map[string]string) bool {
+		return eventMap["caller"] == "team-a" && eventMap["authz_rule"] == "team-a-writes" && eventMap["hub_name"] == "hub"
+	})).Return(nil).Once()
+
+	require.NoError(t, RecordAuditEventFromMdaiEvent(ctx, zap.NewNop(), mockAudit, event, true))
+	mockAudit.AssertExpectations(t)
+}
+
+func TestRecordAuditEntry(t *testing.T) {
+	mockAudit := &mocks.MockAuditAdapter{}
+	ctx := WithFields(t.Context(), map[string]string{"caller": "team-a", "name": "ignored"})
+
+	mockAudit.On("InsertAuditLogEventFromMap", mock.Anything, map[string]string{
+		"id":     "revert-1",
+		"name":   "var.revert_cancelled",
+		"caller": "team-a",
+	}).Return(nil).Once()
+
+	require.NoError(t, RecordAuditEntry(ctx, zap.NewNop(), mockAudit, map[string]string{"id": "revert-1", "name": "var.revert_cancelled"}))
+	mockAudit.AssertExpectations(t)
+}
@@ -0,0 +1,156 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	datacoreaudit "github.com/mydecisive/mdai-data-core/audit"
+	"github.com/mydecisive/mdai-data-core/eventing"
+	"github.com/valkey-io/valkey-go"
+)
+
+// scanBatchSize is how many audit history entries ScanHubVarEvents and ScanVarEvents read at a time.
+const scanBatchSize = 500
+
+// eventFields are the fields RecordAuditEventFromMdaiEvent records from the event itself.
+var eventFields = []string{"id", "name", "timestamp", "payload", "source", "sourceId", "correlation_id", "hub_name", "publish_success"}
+
+// AuditedEvent is a published event as recorded in the audit history, with the other fields recorded along with it,
+// e.g. the caller of a variable write or the revert it performs.
+type AuditedEvent struct {
+	// StreamID is the ID of the audit history entry.
+	StreamID string
+	Event    eventing.MdaiEvent
+	Fields   map[string]string
+}
+
+// ScanVarEvents passes the variable events audited from start to end, stream IDs or "-" and "+", to yield, in the order
+// they were audited, until yield returns false. start is excluded when prefixed with "(". The history is read
+// scanBatchSize entries at a time, so only as much of it is read as yield asks for. Events that failed to publish and
+// entries recording actions of the gateway itself are left out.
+func ScanVarEvents(ctx context.Context, client valkey.Client, start, end string, yield func(AuditedEvent) bool) error {
+	for {
+		entries, err := client.Do(ctx, client.B().Xrange().Key(datacoreaudit.MdaiHubEventHistoryStreamName).
+			Start(start).End(end).Count(scanBatchSize).Build()).AsXRange()
+		if err != nil {
+			return fmt.Errorf("failed to read audit history: %w", err)
+		}
+		for _, entry := range entries {
+			event, ok := publishedVarEvent(entry)
+			if ok && !yield(event) {
+				return nil
+			}
+		}
+		if len(entries) < scanBatchSize {
+			return nil
+		}
+		start = "(" + entries[len(entries)-1].ID
+	}
+}
+
+// TimeStreamID returns the incomplete stream ID of the millisecond t falls in, which bounds a range of the audit
+// history to include the entries added in that millisecond, as its start or its end.
+func TimeStreamID(t time.Time) string {
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
+
+// Horizon returns the time of the oldest entry kept in the audit history when older entries were trimmed by the audit
+// retention, or the zero time when every entry ever audited is still there. Changes before the horizon are unknown.
+func Horizon(ctx context.Context, client valkey.Client) (time.Time, error) {
+	info, err := client.Do(ctx, client.B().XinfoStream().Key(datacoreaudit.MdaiHubEventHistoryStreamName).Build()).AsMap()
+	if err != nil {
+		if valkeyErr, ok := valkey.IsValkeyErr(err); ok && strings.Contains(valkeyErr.Error(), "no such key") {
+			return time.Time{}, nil
+		}
+		return time.Time{}, fmt.Errorf("failed to read audit history info: %w", err)
+	}
+	lengthField, addedField, firstField := info["length"], info["entries-added"], info["recorded-first-entry-id"]
+	length, err := lengthField.AsInt64()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read audit history length: %w", err)
+	}
+	added, err := addedField.AsInt64()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read audit history entries added: %w", err)
+	}
+	if added <= length {
+		return time.Time{}, nil
+	}
+	first, err := firstField.ToString()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read audit history first entry: %w", err)
+	}
+	return StreamIDTime(first)
+}
+
+// StreamIDTime returns the time an audit history entry was added at, from its stream ID.
+func StreamIDTime(id string) (time.Time, error) {
+	millis, seq, _ := strings.Cut(id, "-")
+	ms, err := strconv.ParseInt(millis, 10, 64)
+	if err == nil && seq != "" {
+		_, err = strconv.ParseUint(seq, 10, 64)
+	}
+	if err != nil || ms < 0 {
+		return time.Time{}, fmt.Errorf("invalid stream ID %q", id)
+	}
+	return time.UnixMilli(ms).UTC(), nil
+}
+
+// ScanHubVarEvents passes the variable events of a hub audited up to end, a stream ID or "+", to yield, newest first,
+// until yield returns false. end is excluded when prefixed with "(". The history is read scanBatchSize entries at a
+// time, so only as much of it is read as yield asks for. Like for ScanVarEvents, events that failed to publish
+// are left out.
+func ScanHubVarEvents(ctx context.Context, client valkey.Client, hubName, end string, yield func(AuditedEvent) bool) error {
+	for {
+		entries, err := client.Do(ctx, client.B().Xrevrange().Key(datacoreaudit.MdaiHubEventHistoryStreamName).
+			End(end).Start("-").Count(scanBatchSize).Build()).AsXRange()
+		if err != nil {
+			return fmt.Errorf("failed to read audit history: %w", err)
+		}
+		for _, entry := range entries {
+			event, ok := publishedVarEvent(entry)
+			if ok && event.Event.HubName == hubName && !yield(event) {
+				return nil
+			}
+		}
+		if len(entries) < scanBatchSize {
+			return nil
+		}
+		end = "(" + entries[len(entries)-1].ID
+	}
+}
+
+// publishedVarEvent rebuilds the variable event an audit history entry records, reporting false when the entry is not
+// one or the event failed to publish.
+func publishedVarEvent(entry valkey.XRangeEntry) (AuditedEvent, bool) {
+	fields := entry.FieldValues
+	if !strings.HasPrefix(fields["name"], string(eventing.VarEventType)+".") || fields["publish_success"] != "true" {
+		return AuditedEvent{}, false
+	}
+	timestamp, _ := time.Parse(time.RFC3339, fields["timestamp"])
+	event := AuditedEvent{
+		StreamID: entry.ID,
+		Event: eventing.MdaiEvent{
+			ID:            fields["id"],
+			Name:          fields["name"],
+			Version:       1,
+			Timestamp:     timestamp,
+			Payload:       fields["payload"],
+			Source:        fields["source"],
+			SourceID:      fields["sourceId"],
+			CorrelationID: fields["correlation_id"],
+			HubName:       fields["hub_name"],
+		},
+		Fields: make(map[string]string),
+	}
+	for key, value := range fields {
+		if !slices.Contains(eventFields, key) {
+			event.Fields[key] = value
+		}
+	}
+	return event, true
+}
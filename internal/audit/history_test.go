@@ -0,0 +1,136 @@
+package audit
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valkey-io/valkey-go"
+	valkeymock "github.com/valkey-io/valkey-go/mock"
+	"go.uber.org/mock/gomock"
+)
+
+func xrangeEntry(id string, fields ...string) valkey.ValkeyMessage {
+	values := make([]valkey.ValkeyMessage, len(fields))
+	for i, field := range fields {
+		values[i] = valkeymock.ValkeyBlobString(field)
+	}
+	return valkeymock.ValkeyArray(valkeymock.ValkeyBlobString(id), valkeymock.ValkeyArray(values...))
+}
+
+func TestScanVarEvents(t *testing.T) {
+	client := valkeymock.NewClient(gomock.NewController(t))
+	since := time.Date(2025, 7, 19, 12, 0, 0, 0, time.UTC)
+
+	// A full batch is followed by the next one, read from after its last entry.
+	batch := make([]valkey.ValkeyMessage, scanBatchSize)
+	for i := range batch {
+		batch[i] = xrangeEntry(strconv.Itoa(1752926400000+i)+"-0", "id", "e"+strconv.Itoa(i), "name", "alert_firing", "publish_success", "true")
+	}
+	batch[0] = xrangeEntry("1752926400000-0", "id", "e1", "name", "var.add", "timestamp", "2025-07-19T12:00:00Z", "payload", `{"variableRef":"data_set"}`,
+		"source", "manual_variables_api", "sourceId", "", "correlation_id", "c1", "hub_name", "mdaihub-sample", "publish_success", "true")
+	batch[1] = xrangeEntry("1752926400001-0", "id", "e2", "name", "var.add", "publish_success", "false")
+	batch[2] = xrangeEntry("1752926400002-0", "id", "e3", "name", "var.revert_cancelled", "hub_name", "mdaihub-sample")
+	client.EXPECT().Do(gomock.Any(), valkeymock.Match("XRANGE", "mdai_hub_event_history", "1752926400000", "+", "COUNT", "500")).
+		Return(valkeymock.Result(valkeymock.ValkeyArray(batch...)))
+	client.EXPECT().Do(gomock.Any(), valkeymock.Match("XRANGE", "mdai_hub_event_history", "(1752926400499-0", "+", "COUNT", "500")).
+		Return(valkeymock.Result(valkeymock.ValkeyArray(
+			xrangeEntry("1752926500000-0", "id", "e4", "name", "var.set", "hub_name", "mdaihub-second", "publish_success", "true"),
+		)))
+
+	var events []AuditedEvent
+	require.NoError(t, ScanVarEvents(t.Context(), client, TimeStreamID(since), "+", func(event AuditedEvent) bool {
+		events = append(events, event)
+		return true
+	}))
+	require.Len(t, events, 2)
+	assert.Equal(t, "e1", events[0].Event.ID)
+	assert.Equal(t, "var.add", events[0].Event.Name)
+	assert.Equal(t, "mdaihub-sample", events[0].Event.HubName)
+	assert.Equal(t, "c1", events[0].Event.CorrelationID)
+	assert.Equal(t, `{"variableRef":"data_set"}`, events[0].Event.Payload)
+	assert.True(t, since.Equal(events[0].Event.Timestamp))
+	assert.Equal(t, "e4", events[1].Event.ID)
+
+	// Nothing more is read once yield is done.
+	client.EXPECT().Do(gomock.Any(), valkeymock.Match("XRANGE", "mdai_hub_event_history", "1752926400000", "+", "COUNT", "500")).
+		Return(valkeymock.Result(valkeymock.ValkeyArray(batch...)))
+	events = nil
+	require.NoError(t, ScanVarEvents(t.Context(), client, TimeStreamID(since), "+", func(event AuditedEvent) bool {
+		events = append(events, event)
+		return false
+	}))
+	assert.Len(t, events, 1)
+}
+
+func TestScanHubVarEvents(t *testing.T) {
+	client := valkeymock.NewClient(gomock.NewController(t))
+
+	// A full batch is followed by the next one, read from before its last entry.
+	batch := make([]valkey.ValkeyMessage, scanBatchSize)
+	for i := range batch {
+		batch[i] = xrangeEntry(strconv.Itoa(1752926400000-i)+"-0", "id", "e"+strconv.Itoa(i), "name", "var.add",
+			"hub_name", "mdaihub-second", "publish_success", "true")
+	}
+	batch[0] = xrangeEntry("1752926400000-0", "id", "e1", "name", "var.add", "hub_name", "mdaihub-sample", "publish_success", "true",
+		"caller", "alice", "request_id", "req-1")
+	client.EXPECT().Do(gomock.Any(), valkeymock.Match("XREVRANGE", "mdai_hub_event_history", "1752926400000", "-", "COUNT", "500")).
+		Return(valkeymock.Result(valkeymock.ValkeyArray(batch...)))
+	client.EXPECT().Do(gomock.Any(), valkeymock.Match("XREVRANGE", "mdai_hub_event_history", "(1752926399501-0", "-", "COUNT", "500")).
+		Return(valkeymock.Result(valkeymock.ValkeyArray(
+			xrangeEntry("1752926300001-0", "id", "e2", "name", "var.add", "hub_name", "mdaihub-sample", "publish_success", "false"),
+			xrangeEntry("1752926300000-0", "id", "e3", "name", "var.add", "hub_name", "mdaihub-sample", "publish_success", "true"),
+		)))
+
+	var events []AuditedEvent
+	require.NoError(t, ScanHubVarEvents(t.Context(), client, "mdaihub-sample", "1752926400000", func(event AuditedEvent) bool {
+		events = append(events, event)
+		return true
+	}))
+	require.Len(t, events, 2)
+	assert.Equal(t, "e1", events[0].Event.ID)
+	assert.Equal(t, "1752926400000-0", events[0].StreamID)
+	assert.Equal(t, map[string]string{"caller": "alice", "request_id": "req-1"}, events[0].Fields)
+	assert.Equal(t, "e3", events[1].Event.ID)
+
+	// Nothing more is read once yield is done.
+	client.EXPECT().Do(gomock.Any(), valkeymock.Match("XREVRANGE", "mdai_hub_event_history", "+", "-", "COUNT", "500")).
+		Return(valkeymock.Result(valkeymock.ValkeyArray(batch...)))
+	events = nil
+	require.NoError(t, ScanHubVarEvents(t.Context(), client, "mdaihub-sample", "+", func(event AuditedEvent) bool {
+		events = append(events, event)
+		return false
+	}))
+	assert.Len(t, events, 1)
+}
+
+func TestHorizon(t *testing.T) {
+	client := valkeymock.NewClient(gomock.NewController(t))
+	info := func(length, added int64) valkey.ValkeyResult {
+		return valkeymock.Result(valkeymock.ValkeyMap(map[string]valkey.ValkeyMessage{
+			"length":                  valkeymock.ValkeyInt64(length),
+			"entries-added":           valkeymock.ValkeyInt64(added),
+			"recorded-first-entry-id": valkeymock.ValkeyBlobString("1752926400000-3"),
+		}))
+	}
+	xinfo := valkeymock.Match("XINFO", "STREAM", "mdai_hub_event_history")
+
+	// Nothing was trimmed.
+	client.EXPECT().Do(gomock.Any(), xinfo).Return(info(4, 4))
+	horizon, err := Horizon(t.Context(), client)
+	require.NoError(t, err)
+	assert.True(t, horizon.IsZero())
+
+	client.EXPECT().Do(gomock.Any(), xinfo).Return(info(4, 10))
+	horizon, err = Horizon(t.Context(), client)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 7, 19, 12, 0, 0, 0, time.UTC), horizon)
+
+	// Nothing was audited yet.
+	client.EXPECT().Do(gomock.Any(), xinfo).Return(valkeymock.Result(valkeymock.ValkeyError("ERR no such key")))
+	horizon, err = Horizon(t.Context(), client)
+	require.NoError(t, err)
+	assert.True(t, horizon.IsZero())
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// ErrInvalidCredentials is returned when a request carries credentials that do not match any known caller.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Identity describes an authenticated caller.
+type Identity struct {
+	Name   string
+	Method string
+	// Groups are only known for identities issued by an external authority such as the Kubernetes API server.
+	Groups []string
+}
+
+// Authenticator identifies the caller of a request. It returns ok=false without an error when the
+// request carries no credentials it understands, so authenticators can be chained.
+type Authenticator interface {
+	Authenticate(r *http.Request) (identity Identity, ok bool, err error)
+}
+
+// Authorizer decides whether identity may perform action on hubName/varName. Anonymous callers are passed with
+// authenticated=false.
+type Authorizer interface {
+	Authorize(ctx context.Context, identity Identity, authenticated bool, action, hubName, varName string) (Decision, error)
+}
+
+// Decision is the outcome of an authorization check. Rule describes what granted access and is empty when no
+// authorization is enforced.
+type Decision struct {
+	Allowed bool
+	Rule    string
+}
+
+type identityContextKey struct{}
+
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityContextKey{}, identity)
+}
+
+// IdentityFromContext returns the caller attached by Middleware, if any.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityContextKey{}).(Identity)
+	return identity, ok
+}
+
+// Chain tries each authenticator in order and returns the first identity found. Credentials rejected by
+// one authenticator are offered to the next, since API keys and bearer tokens may be validated by different backends.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(r *http.Request) (Identity, bool, error) {
+	var rejected error
+	for _, authenticator := range c {
+		identity, ok, err := authenticator.Authenticate(r)
+		switch {
+		case errors.Is(err, ErrInvalidCredentials):
+			rejected = err
+		case err != nil || ok:
+			return identity, ok, err
+		}
+	}
+	return Identity{}, false, rejected
+}
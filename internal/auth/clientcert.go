@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+)
+
+const MethodClientCertificate = "client-certificate"
+
+// ClientCertificateAuthenticator identifies callers by the TLS client certificate verified during the handshake.
+type ClientCertificateAuthenticator struct{}
+
+func (ClientCertificateAuthenticator) Authenticate(r *http.Request) (Identity, bool, error) {
+	if r.TLS == nil {
+		return Identity{}, false, nil
+	}
+	identity, ok := IdentityFromTLS(*r.TLS)
+	return identity, ok, nil
+}
+
+// IdentityFromTLS returns the subject of a verified client certificate. The common name is used when present,
+// so rules can match it directly; otherwise the full distinguished name is.
+func IdentityFromTLS(state tls.ConnectionState) (Identity, bool) {
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return Identity{}, false
+	}
+
+	subject := state.VerifiedChains[0][0].Subject
+	name := subject.CommonName
+	if name == "" {
+		name = subject.String()
+	}
+	return Identity{Name: name, Method: MethodClientCertificate}, true
+}
+
+// IdentityFromConn returns the verified client certificate identity of a TLS connection, e.g. an OpAMP agent's.
+func IdentityFromConn(conn net.Conn) (Identity, bool) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return Identity{}, false
+	}
+	return IdentityFromTLS(tlsConn.ConnectionState())
+}
@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	MethodKubernetes = "kubernetes"
+
+	// HubVariablesResource and HubVariablesSubresource form the virtual resource checked by SubjectAccessReview,
+	// so access can be granted with a Role rule on mdaihubs/variables.
+	HubVariablesResource    = "mdaihubs"
+	HubVariablesSubresource = "variables"
+)
+
+// tokenCacheMaxEntries bounds the tokens a TokenReviewAuthenticator remembers; more are reviewed every time.
+const tokenCacheMaxEntries = 4096
+
+// TokenReviewAuthenticator validates bearer tokens, typically ServiceAccount tokens, with the Kubernetes TokenReview API.
+// Accepted tokens are remembered by their SHA-256 hash for cacheTTL, or until they expire if that is sooner, so
+// clients sending many requests, e.g. reconnecting watch streams, do not cost a review each.
+type TokenReviewAuthenticator struct {
+	clientset kubernetes.Interface
+	audiences []string
+	cacheTTL  time.Duration
+	now       func() time.Time
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]reviewedToken
+}
+
+type reviewedToken struct {
+	identity Identity
+	expires  time.Time
+}
+
+func NewTokenReviewAuthenticator(clientset kubernetes.Interface, audiences []string, cacheTTL time.Duration) *TokenReviewAuthenticator {
+	return &TokenReviewAuthenticator{
+		clientset: clientset,
+		audiences: audiences,
+		cacheTTL:  cacheTTL,
+		now:       time.Now,
+		mu:        sync.Mutex{},
+		cache:     make(map[[sha256.Size]byte]reviewedToken),
+	}
+}
+
+func (a *TokenReviewAuthenticator) Authenticate(r *http.Request) (Identity, bool, error) {
+	token, ok := BearerToken(r)
+	if !ok {
+		return Identity{}, false, nil
+	}
+	key := sha256.Sum256([]byte(token))
+	if identity, ok := a.cached(key); ok {
+		return identity, true, nil
+	}
+
+	review, err := a.clientset.AuthenticationV1().TokenReviews().Create(r.Context(), &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Token:     token,
+			Audiences: a.audiences,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return Identity{}, false, fmt.Errorf("create TokenReview: %w", err)
+	}
+	if !review.Status.Authenticated {
+		return Identity{}, false, ErrInvalidCredentials
+	}
+
+	identity := Identity{
+		Name:   review.Status.User.Username,
+		Method: MethodKubernetes,
+		Groups: review.Status.User.Groups,
+	}
+	a.remember(key, identity, tokenExpiry(token))
+	return identity, true, nil
+}
+
+func (a *TokenReviewAuthenticator) cached(key [sha256.Size]byte) (Identity, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	reviewed, ok := a.cache[key]
+	if !ok || !a.now().Before(reviewed.expires) {
+		return Identity{}, false
+	}
+	return reviewed.identity, true
+}
+
+// remember caches an accepted token for cacheTTL, or until expiry when that is sooner and known.
+func (a *TokenReviewAuthenticator) remember(key [sha256.Size]byte, identity Identity, expiry time.Time) {
+	if a.cacheTTL <= 0 {
+		return
+	}
+	now := a.now()
+	expires := now.Add(a.cacheTTL)
+	if !expiry.IsZero() && expiry.Before(expires) {
+		expires = expiry
+	}
+	if !now.Before(expires) {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.cache) >= tokenCacheMaxEntries {
+		for cachedKey, reviewed := range a.cache {
+			if !now.Before(reviewed.expires) {
+				delete(a.cache, cachedKey)
+			}
+		}
+		if len(a.cache) >= tokenCacheMaxEntries {
+			return
+		}
+	}
+	a.cache[key] = reviewedToken{identity: identity, expires: expires}
+}
+
+// tokenExpiry reads the exp claim of a JWT, such as a ServiceAccount token, without verifying it: the token was just
+// accepted by TokenReview. It returns the zero time when the token has none.
+func tokenExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
+
+// ErrUnknownHub is returned by a NamespaceResolver for hubs without manual variables. Access to them is denied
+// rather than failed, so callers cannot probe which hubs exist.
+var ErrUnknownHub = errors.New("unknown hub")
+
+// NamespaceResolver returns the namespace a hub's manual variables live in.
+type NamespaceResolver func(hubName string) (string, error)
+
+// SubjectAccessReviewAuthorizer authorizes variable access with Kubernetes RBAC. Reads map to the "get" verb and
+// writes to "update" on mdaihubs/variables, named after the hub, in the hub's namespace.
+type SubjectAccessReviewAuthorizer struct {
+	clientset        kubernetes.Interface
+	group            string
+	resolveNamespace NamespaceResolver
+}
+
+func NewSubjectAccessReviewAuthorizer(clientset kubernetes.Interface, group string, resolveNamespace NamespaceResolver) *SubjectAccessReviewAuthorizer {
+	return &SubjectAccessReviewAuthorizer{
+		clientset:        clientset,
+		group:            group,
+		resolveNamespace: resolveNamespace,
+	}
+}
+
+// HubScoped reports true: RBAC grants access to all variables of a hub at once.
+func (a *SubjectAccessReviewAuthorizer) HubScoped() bool {
+	return true
+}
+
+func (a *SubjectAccessReviewAuthorizer) Authorize(ctx context.Context, identity Identity, authenticated bool, action, hubName, _ string) (Decision, error) {
+	if !authenticated {
+		return Decision{Allowed: false}, nil
+	}
+
+	namespace, err := a.resolveNamespace(hubName)
+	if errors.Is(err, ErrUnknownHub) {
+		return Decision{Allowed: false}, nil
+	}
+	if err != nil {
+		return Decision{}, fmt.Errorf("resolve namespace of hub %s: %w", hubName, err)
+	}
+
+	verb := "get"
+	if action == ActionWrite {
+		verb = "update"
+	}
+
+	review, err := a.clientset.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   identity.Name,
+			Groups: identity.Groups,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace:   namespace,
+				Verb:        verb,
+				Group:       a.group,
+				Resource:    HubVariablesResource,
+				Subresource: HubVariablesSubresource,
+				Name:        hubName,
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return Decision{}, fmt.Errorf("create SubjectAccessReview: %w", err)
+	}
+	if !review.Status.Allowed {
+		return Decision{Allowed: false}, nil
+	}
+
+	rule := "rbac"
+	if review.Status.Reason != "" {
+		rule += ": " + review.Status.Reason
+	}
+	return Decision{Allowed: true, Rule: rule}, nil
+}
@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newTokenReviewClientset(t *testing.T) *fake.Clientset {
+	t.Helper()
+
+	clientset := fake.NewClientset()
+	clientset.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview) //nolint:forcetypeassert
+		switch review.Spec.Token {
+		case "sa-token":
+			assert.Equal(t, []string{"mdai-gateway"}, review.Spec.Audiences)
+			review.Status = authenticationv1.TokenReviewStatus{
+				Authenticated: true,
+				User: authenticationv1.UserInfo{
+					Username: "system:serviceaccount:mdai:ops",
+					Groups:   []string{"system:serviceaccounts", "system:serviceaccounts:mdai"},
+				},
+			}
+		case "broken":
+			return true, nil, errors.New("apiserver unavailable")
+		default:
+			review.Status = authenticationv1.TokenReviewStatus{Authenticated: false}
+		}
+		return true, review, nil
+	})
+	return clientset
+}
+
+func TestTokenReviewAuthenticator(t *testing.T) {
+	authenticator := NewTokenReviewAuthenticator(newTokenReviewClientset(t), []string{"mdai-gateway"}, 0)
+
+	newRequest := func(token string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return req
+	}
+
+	identity, ok, err := authenticator.Authenticate(newRequest("sa-token"))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, Identity{
+		Name:   "system:serviceaccount:mdai:ops",
+		Method: MethodKubernetes,
+		Groups: []string{"system:serviceaccounts", "system:serviceaccounts:mdai"},
+	}, identity)
+
+	_, ok, err = authenticator.Authenticate(newRequest("expired"))
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.False(t, ok)
+
+	_, _, err = authenticator.Authenticate(newRequest("broken"))
+	require.ErrorContains(t, err, "apiserver unavailable")
+
+	_, ok, err = authenticator.Authenticate(newRequest(""))
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestTokenReviewAuthenticator_Cache(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	// A JWT whose exp claim is 5 seconds from now; its signature is not checked by the cache.
+	claims := base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, `{"exp":%d}`, now.Add(5*time.Second).Unix()))
+	jwt := "header." + claims + ".signature"
+
+	reviews := 0
+	clientset := fake.NewClientset()
+	clientset.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		reviews++
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview) //nolint:forcetypeassert
+		review.Status = authenticationv1.TokenReviewStatus{
+			Authenticated: review.Spec.Token != "expired",
+			User:          authenticationv1.UserInfo{Username: "system:serviceaccount:mdai:ops"},
+		}
+		return true, review, nil
+	})
+	authenticator := NewTokenReviewAuthenticator(clientset, nil, 10*time.Second)
+	authenticator.now = func() time.Time { return now }
+
+	authenticate := func(token string) error {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		req.Header.Set("Authorization", "Bearer "+token)
+		_, _, err := authenticator.Authenticate(req)
+		return err
+	}
+
+	require.NoError(t, authenticate("opaque"))
+	require.NoError(t, authenticate("opaque"))
+	require.NoError(t, authenticate(jwt))
+	require.NoError(t, authenticate(jwt))
+	assert.Equal(t, 2, reviews, "accepted tokens are reviewed once")
+
+	// The JWT expired before the cache TTL ran out, the opaque token is trusted until then.
+	now = now.Add(6 * time.Second)
+	require.NoError(t, authenticate("opaque"))
+	require.NoError(t, authenticate(jwt))
+	assert.Equal(t, 3, reviews)
+
+	now = now.Add(5 * time.Second)
+	require.NoError(t, authenticate("opaque"))
+	assert.Equal(t, 4, reviews)
+
+	// Rejected tokens are not cached.
+	require.ErrorIs(t, authenticate("expired"), ErrInvalidCredentials)
+	require.ErrorIs(t, authenticate("expired"), ErrInvalidCredentials)
+	assert.Equal(t, 6, reviews)
+}
+
+func TestSubjectAccessReviewAuthorizer(t *testing.T) {
+	var reviewed []authorizationv1.ResourceAttributes
+	clientset := fake.NewClientset()
+	clientset.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview) //nolint:forcetypeassert
+		reviewed = append(reviewed, *review.Spec.ResourceAttributes)
+		allowed := review.Spec.User == "system:serviceaccount:mdai:ops" || review.Spec.ResourceAttributes.Verb == "get"
+		review.Status = authorizationv1.SubjectAccessReviewStatus{Allowed: allowed}
+		if allowed {
+			review.Status.Reason = `RBAC: allowed by RoleBinding "hub-editors/mdai"`
+		}
+		return true, review, nil
+	})
+
+	authorizer := NewSubjectAccessReviewAuthorizer(clientset, "hub.mydecisive.ai", func(hubName string) (string, error) {
+		if hubName != "mdaihub-sample" {
+			return "", ErrUnknownHub
+		}
+		return "mdai", nil
+	})
+	ops := Identity{Name: "system:serviceaccount:mdai:ops", Method: MethodKubernetes}
+	viewer := Identity{Name: "system:serviceaccount:mdai:viewer", Method: MethodKubernetes}
+
+	decision, err := authorizer.Authorize(t.Context(), ops, true, ActionWrite, "mdaihub-sample", "manual_filter")
+	require.NoError(t, err)
+	assert.Equal(t, Decision{Allowed: true, Rule: `rbac: RBAC: allowed by RoleBinding "hub-editors/mdai"`}, decision)
+	assert.Equal(t, authorizationv1.ResourceAttributes{
+		Namespace:   "mdai",
+		Verb:        "update",
+		Group:       "hub.mydecisive.ai",
+		Resource:    HubVariablesResource,
+		Subresource: HubVariablesSubresource,
+		Name:        "mdaihub-sample",
+	}, reviewed[0])
+
+	decision, err = authorizer.Authorize(t.Context(), viewer, true, ActionWrite, "mdaihub-sample", "manual_filter")
+	require.NoError(t, err)
+	assert.False(t, decision.Allowed)
+
+	decision, err = authorizer.Authorize(t.Context(), viewer, true, ActionRead, "mdaihub-sample", "manual_filter")
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed)
+
+	decision, err = authorizer.Authorize(t.Context(), ops, true, ActionWrite, "mdaihub-unknown", "manual_filter")
+	require.NoError(t, err)
+	assert.False(t, decision.Allowed)
+
+	decision, err = authorizer.Authorize(t.Context(), Identity{}, false, ActionRead, "mdaihub-sample", "manual_filter")
+	require.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Len(t, reviewed, 3, "unknown hubs and anonymous callers must not reach the API server")
+}
@@ -0,0 +1,52 @@
+package auth
+
+import "context"
+
+// HubScoped is implemented by Authorizers whose decisions depend on the hub but not on the variable, such as
+// SubjectAccessReviewAuthorizer.
+type HubScoped interface {
+	HubScoped() bool
+}
+
+// Memo caches the decisions of an Authorizer for a caller checking many variables in one go, e.g. a request listing
+// them, so each is only asked for once: per action and hub when the Authorizer is HubScoped, per variable otherwise.
+// Failures are not cached. A Memo is not safe for concurrent use and never forgets a decision, so it must not outlive
+// the request it is made for.
+type Memo struct {
+	authorizer Authorizer
+	hubScoped  bool
+	decisions  map[memoKey]Decision
+}
+
+type memoKey struct {
+	identity      string
+	authenticated bool
+	action        string
+	hubName       string
+	varName       string
+}
+
+func NewMemo(authorizer Authorizer) *Memo {
+	scoped, ok := authorizer.(HubScoped)
+	return &Memo{
+		authorizer: authorizer,
+		hubScoped:  ok && scoped.HubScoped(),
+		decisions:  make(map[memoKey]Decision),
+	}
+}
+
+func (m *Memo) Authorize(ctx context.Context, identity Identity, authenticated bool, action, hubName, varName string) (Decision, error) {
+	key := memoKey{identity: identity.Name, authenticated: authenticated, action: action, hubName: hubName, varName: varName}
+	if m.hubScoped {
+		key.varName = ""
+	}
+	if decision, ok := m.decisions[key]; ok {
+		return decision, nil
+	}
+	decision, err := m.authorizer.Authorize(ctx, identity, authenticated, action, hubName, varName)
+	if err != nil {
+		return decision, err
+	}
+	m.decisions[key] = decision
+	return decision, nil
+}
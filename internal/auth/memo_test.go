@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingAuthorizer struct {
+	hubScoped bool
+	calls     int
+}
+
+func (a *countingAuthorizer) HubScoped() bool {
+	return a.hubScoped
+}
+
+func (a *countingAuthorizer) Authorize(_ context.Context, _ Identity, _ bool, _, hubName, _ string) (Decision, error) {
+	a.calls++
+	if hubName == "broken" {
+		return Decision{}, errors.New("unavailable")
+	}
+	return Decision{Allowed: hubName == "mdaihub-sample", Rule: "counted"}, nil
+}
+
+func TestMemo(t *testing.T) {
+	ops := Identity{Name: "ops", Method: MethodAPIKey}
+	check := func(t *testing.T, memo *Memo, action, hubName, varName string) Decision {
+		t.Helper()
+		decision, err := memo.Authorize(t.Context(), ops, true, action, hubName, varName)
+		require.NoError(t, err)
+		return decision
+	}
+
+	t.Run("hub scoped", func(t *testing.T) {
+		authorizer := &countingAuthorizer{hubScoped: true, calls: 0}
+		memo := NewMemo(authorizer)
+		assert.True(t, check(t, memo, ActionRead, "mdaihub-sample", "a").Allowed)
+		assert.True(t, check(t, memo, ActionRead, "mdaihub-sample", "b").Allowed)
+		assert.False(t, check(t, memo, ActionRead, "mdaihub-other", "a").Allowed)
+		assert.False(t, check(t, memo, ActionRead, "mdaihub-other", "b").Allowed)
+		check(t, memo, ActionWrite, "mdaihub-sample", "a")
+		assert.Equal(t, 3, authorizer.calls)
+	})
+
+	t.Run("per variable", func(t *testing.T) {
+		authorizer := &countingAuthorizer{hubScoped: false, calls: 0}
+		memo := NewMemo(authorizer)
+		check(t, memo, ActionRead, "mdaihub-sample", "a")
+		check(t, memo, ActionRead, "mdaihub-sample", "a")
+		check(t, memo, ActionRead, "mdaihub-sample", "b")
+		assert.Equal(t, 2, authorizer.calls)
+	})
+
+	t.Run("failures are not cached", func(t *testing.T) {
+		authorizer := &countingAuthorizer{hubScoped: true, calls: 0}
+		memo := NewMemo(authorizer)
+		for range 2 {
+			_, err := memo.Authorize(t.Context(), ops, true, ActionRead, "broken", "a")
+			require.Error(t, err)
+		}
+		assert.Equal(t, 2, authorizer.calls)
+	})
+}
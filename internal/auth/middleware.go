@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mydecisive/mdai-gateway/internal/httputil"
+	"github.com/mydecisive/mdai-gateway/internal/requestid"
+	"go.uber.org/zap"
+)
+
+// Middleware attaches the caller identity to the request context. Requests with invalid credentials are always
+// rejected with 401; requests without credentials are rejected only when required is set.
+func Middleware(authenticator Authenticator, required bool, logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if authenticator == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, ok, err := authenticator.Authenticate(r)
+			switch {
+			case errors.Is(err, ErrInvalidCredentials):
+				unauthorized(w, logger, httputil.CodeInvalidCredentials, "invalid credentials")
+				return
+			case err != nil:
+				requestid.Logger(r.Context(), logger).Error("Failed to authenticate request", zap.String("path", r.URL.Path), zap.Error(err))
+				httputil.WriteProblem(w, logger, http.StatusInternalServerError, httputil.CodeInternal, "authentication failed")
+				return
+			case !ok && required:
+				unauthorized(w, logger, httputil.CodeAuthenticationRequired, "authentication required")
+				return
+			case ok:
+				r = r.WithContext(WithIdentity(r.Context(), identity))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func unauthorized(w http.ResponseWriter, logger *zap.Logger, code, detail string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="mdai-gateway"`)
+	httputil.WriteProblem(w, logger, http.StatusUnauthorized, code, detail)
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type authenticatorFunc func(r *http.Request) (Identity, bool, error)
+
+func (f authenticatorFunc) Authenticate(r *http.Request) (Identity, bool, error) {
+	return f(r)
+}
+
+func identityEcho() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, _ := IdentityFromContext(r.Context())
+		_, _ = w.Write([]byte(identity.Name))
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	authenticator := newTestStaticAuthenticator(t)
+
+	tests := []struct {
+		name     string
+		required bool
+		headers  map[string]string
+		status   int
+		body     string
+	}{
+		{
+			name:     "required and authenticated",
+			required: true,
+			headers:  map[string]string{APIKeyHeader: "am-key"},
+			status:   http.StatusOK,
+			body:     "alertmanager",
+		},
+		{
+			name:     "required and anonymous",
+			required: true,
+			status:   http.StatusUnauthorized,
+			body:     `{"type":"urn:mdai-gateway:problem:authentication_required","title":"Unauthorized","status":401,"detail":"authentication required","code":"authentication_required"}`,
+		},
+		{
+			name:   "optional and anonymous",
+			status: http.StatusOK,
+		},
+		{
+			name:    "optional and identified",
+			headers: map[string]string{"Authorization": "Bearer ui-token"},
+			status:  http.StatusOK,
+			body:    "ops-ui",
+		},
+		{
+			name:    "optional with invalid credentials",
+			headers: map[string]string{APIKeyHeader: "nope"},
+			status:  http.StatusUnauthorized,
+			body:    `{"type":"urn:mdai-gateway:problem:invalid_credentials","title":"Unauthorized","status":401,"detail":"invalid credentials","code":"invalid_credentials"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", http.NoBody)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			rr := httptest.NewRecorder()
+
+			Middleware(authenticator, tt.required, zap.NewNop())(identityEcho()).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.status, rr.Code)
+			if tt.status == http.StatusUnauthorized {
+				assert.JSONEq(t, tt.body, rr.Body.String())
+				assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+				assert.Equal(t, `Bearer realm="mdai-gateway"`, rr.Header().Get("WWW-Authenticate"))
+			} else {
+				assert.Equal(t, tt.body, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestMiddleware_AuthenticatorError(t *testing.T) {
+	failing := authenticatorFunc(func(*http.Request) (Identity, bool, error) {
+		return Identity{}, false, errors.New("backend unavailable")
+	})
+	rr := httptest.NewRecorder()
+
+	Middleware(failing, false, zap.NewNop())(identityEcho()).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.JSONEq(t, `{"type":"urn:mdai-gateway:problem:internal_error","title":"Internal Server Error","status":500,"detail":"authentication failed","code":"internal_error"}`, rr.Body.String())
+}
+
+func TestMiddleware_NoAuthenticator(t *testing.T) {
+	rr := httptest.NewRecorder()
+
+	Middleware(nil, false, zap.NewNop())(identityEcho()).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestChain(t *testing.T) {
+	rejecting := authenticatorFunc(func(*http.Request) (Identity, bool, error) {
+		return Identity{}, false, ErrInvalidCredentials
+	})
+	accepting := authenticatorFunc(func(*http.Request) (Identity, bool, error) {
+		return Identity{Name: "svc", Method: "test"}, true, nil
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+
+	identity, ok, err := Chain{rejecting, accepting}.Authenticate(req)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "svc", identity.Name)
+
+	_, ok, err = Chain{rejecting}.Authenticate(req)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.False(t, ok)
+}
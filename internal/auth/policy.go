@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"context"
+	"path"
+	"slices"
+
+	"github.com/mydecisive/mdai-gateway/internal/config"
+)
+
+const (
+	ActionRead  = config.ActionRead
+	ActionWrite = config.ActionWrite
+)
+
+// Policy decides which identities may read or write which hub variables.
+type Policy struct {
+	rules []config.AuthRule
+}
+
+// NewPolicy builds a policy from validated configuration rules. A policy without rules allows every caller.
+func NewPolicy(rules []config.AuthRule) *Policy {
+	return &Policy{rules: rules}
+}
+
+// Enabled reports whether the policy restricts access at all.
+func (p *Policy) Enabled() bool {
+	return p != nil && len(p.rules) > 0
+}
+
+// Authorize checks whether identity may perform action on hubName/varName. The first matching rule wins;
+// anonymous callers never match a rule, so they are denied as soon as any rule is configured.
+func (p *Policy) Authorize(_ context.Context, identity Identity, authenticated bool, action, hubName, varName string) (Decision, error) {
+	if !p.Enabled() {
+		return Decision{Allowed: true}, nil
+	}
+	if !authenticated {
+		return Decision{Allowed: false}, nil
+	}
+
+	for _, rule := range p.rules {
+		if slices.Contains(rule.Actions, action) &&
+			matchAny(rule.Identities, identity.Name) &&
+			matchAny(rule.Hubs, hubName) &&
+			matchAny(rule.Variables, varName) {
+			return Decision{Allowed: true, Rule: rule.Name}, nil
+		}
+	}
+	return Decision{Allowed: false}, nil
+}
+
+func matchAny(patterns []string, name string) bool {
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		matched, _ := path.Match(pattern, name) // patterns are validated when the configuration is loaded
+		return matched
+	})
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/mydecisive/mdai-gateway/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy_Authorize(t *testing.T) {
+	policy := NewPolicy([]config.AuthRule{
+		{
+			Name:       "team-a-writes",
+			Identities: []string{"team-a"},
+			Hubs:       []string{"mdaihub-a"},
+			Variables:  []string{"*"},
+			Actions:    []string{ActionRead, ActionWrite},
+		},
+		{
+			Name:       "everyone-reads",
+			Identities: []string{"*"},
+			Hubs:       []string{"*"},
+			Variables:  []string{"*"},
+			Actions:    []string{ActionRead},
+		},
+	})
+	teamA := Identity{Name: "team-a", Method: MethodAPIKey}
+	teamB := Identity{Name: "team-b", Method: MethodAPIKey}
+
+	tests := []struct {
+		name          string
+		identity      Identity
+		authenticated bool
+		action        string
+		hub           string
+		expected      Decision
+	}{
+		{"team a writes own hub", teamA, true, ActionWrite, "mdaihub-a", Decision{Allowed: true, Rule: "team-a-writes"}},
+		{"team a writes other hub", teamA, true, ActionWrite, "mdaihub-b", Decision{Allowed: false}},
+		{"team b reads any hub", teamB, true, ActionRead, "mdaihub-a", Decision{Allowed: true, Rule: "everyone-reads"}},
+		{"team b writes", teamB, true, ActionWrite, "mdaihub-a", Decision{Allowed: false}},
+		{"anonymous reads", Identity{}, false, ActionRead, "mdaihub-a", Decision{Allowed: false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := policy.Authorize(t.Context(), tt.identity, tt.authenticated, tt.action, tt.hub, "manual_filter")
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, decision)
+		})
+	}
+}
+
+func TestPolicy_Disabled(t *testing.T) {
+	var nilPolicy *Policy
+	for _, policy := range []*Policy{nilPolicy, NewPolicy(nil)} {
+		assert.False(t, policy.Enabled())
+		decision, err := policy.Authorize(t.Context(), Identity{}, false, ActionWrite, "hub", "var")
+		require.NoError(t, err)
+		assert.Equal(t, Decision{Allowed: true}, decision)
+	}
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	APIKeyHeader = "X-API-Key"
+
+	MethodAPIKey      = "api-key"
+	MethodBearerToken = "bearer-token"
+
+	bearerPrefix = "Bearer "
+)
+
+// Credential maps a secret to the identity of the caller presenting it.
+type Credential struct {
+	Identity string `yaml:"identity"`
+	Secret   string `yaml:"secret"`
+}
+
+// CredentialsFile is the format of the mounted file holding static API keys and bearer tokens.
+type CredentialsFile struct {
+	APIKeys      []Credential `yaml:"apiKeys"`
+	BearerTokens []Credential `yaml:"bearerTokens"`
+}
+
+// StaticAuthenticator accepts a fixed set of API keys (X-API-Key header) and bearer tokens (Authorization header).
+type StaticAuthenticator struct {
+	apiKeys      []Credential
+	bearerTokens []Credential
+}
+
+// LoadStaticAuthenticator reads API keys and bearer tokens from the YAML file at path.
+func LoadStaticAuthenticator(path string) (*StaticAuthenticator, error) {
+	data, err := os.ReadFile(path) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("read credentials file: %w", err)
+	}
+
+	var file CredentialsFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse credentials file %s: %w", path, err)
+	}
+
+	return NewStaticAuthenticator(file)
+}
+
+func NewStaticAuthenticator(file CredentialsFile) (*StaticAuthenticator, error) {
+	var errs []error
+	for i, c := range file.APIKeys {
+		errs = append(errs, validateCredential(fmt.Sprintf("apiKeys[%d]", i), c))
+	}
+	for i, c := range file.BearerTokens {
+		errs = append(errs, validateCredential(fmt.Sprintf("bearerTokens[%d]", i), c))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	return &StaticAuthenticator{
+		apiKeys:      file.APIKeys,
+		bearerTokens: file.BearerTokens,
+	}, nil
+}
+
+func validateCredential(field string, c Credential) error {
+	switch {
+	case c.Identity == "":
+		return fmt.Errorf("%s.identity must not be empty", field)
+	case c.Secret == "":
+		return fmt.Errorf("%s.secret must not be empty", field)
+	default:
+		return nil
+	}
+}
+
+func (a *StaticAuthenticator) Authenticate(r *http.Request) (Identity, bool, error) {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return match(a.apiKeys, key, MethodAPIKey)
+	}
+	if token, ok := BearerToken(r); ok {
+		return match(a.bearerTokens, token, MethodBearerToken)
+	}
+	return Identity{}, false, nil
+}
+
+// BearerToken extracts the token from an "Authorization: Bearer <token>" header.
+func BearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) <= len(bearerPrefix) || !strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+		return "", false
+	}
+	return strings.TrimSpace(header[len(bearerPrefix):]), true
+}
+
+// match compares secret against every credential in constant time so response timing does not leak which one matched.
+func match(credentials []Credential, secret, method string) (Identity, bool, error) {
+	var found *Credential
+	for i := range credentials {
+		if subtle.ConstantTimeCompare([]byte(credentials[i].Secret), []byte(secret)) == 1 && found == nil {
+			found = &credentials[i]
+		}
+	}
+	if found == nil {
+		return Identity{}, false, ErrInvalidCredentials
+	}
+	return Identity{Name: found.Identity, Method: method}, true, nil
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStaticAuthenticator(t *testing.T) *StaticAuthenticator {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "credentials.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+apiKeys:
+  - identity: alertmanager
+    secret: am-key
+bearerTokens:
+  - identity: ops-ui
+    secret: ui-token
+`), 0o600))
+
+	authenticator, err := LoadStaticAuthenticator(path)
+	require.NoError(t, err)
+	return authenticator
+}
+
+func TestStaticAuthenticator(t *testing.T) {
+	authenticator := newTestStaticAuthenticator(t)
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		identity Identity
+		ok       bool
+		err      error
+	}{
+		{
+			name:     "api key",
+			headers:  map[string]string{APIKeyHeader: "am-key"},
+			identity: Identity{Name: "alertmanager", Method: MethodAPIKey},
+			ok:       true,
+		},
+		{
+			name:     "bearer token",
+			headers:  map[string]string{"Authorization": "bearer ui-token"},
+			identity: Identity{Name: "ops-ui", Method: MethodBearerToken},
+			ok:       true,
+		},
+		{
+			name:    "api key used as bearer token",
+			headers: map[string]string{"Authorization": "Bearer am-key"},
+			err:     ErrInvalidCredentials,
+		},
+		{
+			name:    "unknown api key",
+			headers: map[string]string{APIKeyHeader: "nope"},
+			err:     ErrInvalidCredentials,
+		},
+		{
+			name:    "basic auth is ignored",
+			headers: map[string]string{"Authorization": "Basic dXNlcjpwYXNz"},
+		},
+		{
+			name: "no credentials",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+
+			identity, ok, err := authenticator.Authenticate(req)
+			require.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.identity, identity)
+		})
+	}
+}
+
+func TestNewStaticAuthenticator_InvalidCredentials(t *testing.T) {
+	_, err := NewStaticAuthenticator(CredentialsFile{
+		APIKeys:      []Credential{{Identity: "", Secret: "key"}},
+		BearerTokens: []Credential{{Identity: "ui", Secret: ""}},
+	})
+	require.EqualError(t, err, "apiKeys[0].identity must not be empty\nbearerTokens[0].secret must not be empty")
+}
+
+func TestLoadStaticAuthenticator_MissingFile(t *testing.T) {
+	_, err := LoadStaticAuthenticator(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
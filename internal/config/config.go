@@ -0,0 +1,517 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mydecisive/mdai-gateway/internal/adapter"
+	"gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// FileEnvVarKey points to an optional YAML configuration file. Environment variables override its values.
+const FileEnvVarKey = "CONFIG_FILE"
+
+const (
+	ActionRead  = "read"
+	ActionWrite = "write"
+
+	ClientAuthNone    = "none"
+	ClientAuthRequest = "request"
+	ClientAuthRequire = "require"
+
+	HealthCheckValkey     = "valkey"
+	HealthCheckNATS       = "nats"
+	HealthCheckConfigMaps = "configmaps"
+	HealthCheckOpAMP      = "opamp"
+)
+
+// HealthChecks lists every readiness check, in report order.
+var HealthChecks = []string{HealthCheckValkey, HealthCheckNATS, HealthCheckConfigMaps, HealthCheckOpAMP}
+
+// legacyHTTPPortEnvVarKey is kept for deployments that only set the port.
+const legacyHTTPPortEnvVarKey = "HTTP_PORT"
+
+// legacyEnvVarKeys maps names kept from before the configuration file to the variables they stand for. They apply
+// only when the current name is not set.
+var legacyEnvVarKeys = map[string]string{
+	"SHUTDOWN_TIMEOUT": "HTTP_SHUTDOWN_TIMEOUT",
+}
+
+type Config struct {
+	HTTP       HTTP       `yaml:"http"       env:"HTTP"`
+	Limits     Limits     `yaml:"limits"     env:"LIMITS"`
+	Deduper    Deduper    `yaml:"deduper"    env:"DEDUPER"`
+	ConfigMaps ConfigMaps `yaml:"configMaps" env:"CONFIGMAPS"`
+	OpAMP      OpAMP      `yaml:"opamp"      env:"OPAMP"`
+	Features   Features   `yaml:"features"   env:"FEATURES"`
+	Auth       Auth       `yaml:"auth"       env:"AUTH"`
+	TLS        TLS        `yaml:"tls"        env:"TLS"`
+	Health     Health     `yaml:"health"     env:"HEALTH"`
+	Reverts    Reverts    `yaml:"reverts"    env:"REVERTS"`
+	Schedules  Schedules  `yaml:"schedules"  env:"SCHEDULES"`
+}
+
+// Reverts configures temporary variable writes, which are undone automatically once their TTL expires.
+type Reverts struct {
+	// PollInterval is how often due reverts are looked up and published.
+	PollInterval time.Duration `yaml:"pollInterval" env:"POLL_INTERVAL"`
+	// MaxTTL caps the TTL a write may ask for.
+	MaxTTL time.Duration `yaml:"maxTtl" env:"MAX_TTL"`
+}
+
+// Schedules configures recurring variable changes, which are published at the transitions of their schedule.
+type Schedules struct {
+	// PollInterval is how often due transitions are looked up and published. It bounds how late a transition fires.
+	PollInterval time.Duration `yaml:"pollInterval" env:"POLL_INTERVAL"`
+}
+
+// Health configures the /readyz checks. Every check is always run and reported; only the Required ones make the
+// gateway unready when they fail.
+type Health struct {
+	Required []string      `yaml:"required" env:"REQUIRED"`
+	Timeout  time.Duration `yaml:"timeout"  env:"TIMEOUT"`
+}
+
+// TLS enables HTTPS on the shared HTTP and OpAMP listener. Files are reloaded when they change.
+type TLS struct {
+	CertFile string `yaml:"certFile" env:"CERT_FILE"`
+	KeyFile  string `yaml:"keyFile"  env:"KEY_FILE"`
+	// ClientCAFile verifies client certificates; verified certificates identify the caller.
+	ClientCAFile string `yaml:"clientCAFile" env:"CLIENT_CA_FILE"`
+	// ClientAuth is "none", "request" (verify if presented) or "require".
+	ClientAuth     string        `yaml:"clientAuth"     env:"CLIENT_AUTH"`
+	ReloadInterval time.Duration `yaml:"reloadInterval" env:"RELOAD_INTERVAL"`
+}
+
+func (t TLS) Enabled() bool {
+	return t.CertFile != ""
+}
+
+type HTTP struct {
+	ListenAddress     string        `yaml:"listenAddress"     env:"LISTEN_ADDRESS"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout" env:"READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `yaml:"readTimeout"       env:"READ_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"writeTimeout"      env:"WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idleTimeout"       env:"IDLE_TIMEOUT"`
+	// ShutdownTimeout bounds how long in-flight requests may take to drain on SIGTERM.
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT"`
+}
+
+type Limits struct {
+	AlertBodyMaxBytes    int64 `yaml:"alertBodyMaxBytes"    env:"ALERT_BODY_MAX_BYTES"`
+	VariableBodyMaxBytes int64 `yaml:"variableBodyMaxBytes" env:"VARIABLE_BODY_MAX_BYTES"`
+	// BatchMaxEntries caps the number of updates in one POST /variables/batch request.
+	BatchMaxEntries int `yaml:"batchMaxEntries" env:"BATCH_MAX_ENTRIES"`
+	// ValuesPageMaxHubs caps the number of hubs in one page of GET /variables/values.
+	ValuesPageMaxHubs int `yaml:"valuesPageMaxHubs" env:"VALUES_PAGE_MAX_HUBS"`
+	// HistoryMaxEntries caps the number of changes in one page of GET /variables/history.
+	HistoryMaxEntries int `yaml:"historyMaxEntries" env:"HISTORY_MAX_ENTRIES"`
+}
+
+type Deduper struct {
+	// TTL is how long an alert fingerprint is remembered. Zero keeps fingerprints forever.
+	TTL time.Duration `yaml:"ttl" env:"TTL"`
+}
+
+type ConfigMaps struct {
+	// Namespace to watch for manual variable ConfigMaps. Empty watches all namespaces.
+	Namespace string `yaml:"namespace" env:"WATCH_NAMESPACE"`
+}
+
+type OpAMP struct {
+	EnableCompression bool `yaml:"enableCompression" env:"ENABLE_COMPRESSION"`
+}
+
+type Features struct {
+	OpAMP    bool `yaml:"opamp"    env:"OPAMP_ENABLED"`
+	AuditAPI bool `yaml:"auditApi" env:"AUDIT_API_ENABLED"`
+	Metrics  bool `yaml:"metrics"  env:"METRICS_ENABLED"`
+}
+
+// Auth selects which route groups reject unauthenticated callers. Callers presenting credentials are
+// identified on every route once an authenticator is configured.
+type Auth struct {
+	// CredentialsFile holds static API keys and bearer tokens.
+	CredentialsFile  string `yaml:"credentialsFile"  env:"CREDENTIALS_FILE"`
+	RequireForReads  bool   `yaml:"requireForReads"  env:"REQUIRE_FOR_READS"`
+	RequireForWrites bool   `yaml:"requireForWrites" env:"REQUIRE_FOR_WRITES"`
+	RequireForAlerts bool   `yaml:"requireForAlerts" env:"REQUIRE_FOR_ALERTS"`
+	// Rules restrict which identities may read or write which hub variables. Empty allows every caller.
+	Rules      []AuthRule     `yaml:"rules"`
+	Kubernetes AuthKubernetes `yaml:"kubernetes" env:"KUBERNETES"`
+}
+
+type AuthKubernetes struct {
+	// TokenReview validates bearer tokens, e.g. ServiceAccount tokens, with the Kubernetes TokenReview API.
+	TokenReview bool     `yaml:"tokenReview" env:"TOKEN_REVIEW"`
+	Audiences   []string `yaml:"audiences"   env:"AUDIENCES"`
+	// CacheTTL is how long a token accepted by TokenReview is trusted without asking again, never past its expiry.
+	// Zero asks on every request.
+	CacheTTL time.Duration `yaml:"cacheTtl" env:"CACHE_TTL"`
+	// SubjectAccessReview authorizes variable access with RBAC on the mdaihubs/variables virtual resource
+	// of ResourceGroup instead of Rules.
+	SubjectAccessReview bool   `yaml:"subjectAccessReview" env:"SUBJECT_ACCESS_REVIEW"`
+	ResourceGroup       string `yaml:"resourceGroup"       env:"RESOURCE_GROUP"`
+}
+
+// AuthRule grants the listed actions to callers whose identity matches one of Identities on variables matching
+// Hubs and Variables. Patterns use path.Match glob syntax, e.g. "mdaihub-a" and "*".
+type AuthRule struct {
+	Name       string   `yaml:"name"`
+	Identities []string `yaml:"identities"`
+	Hubs       []string `yaml:"hubs"`
+	Variables  []string `yaml:"variables"`
+	// Actions are "read" and/or "write".
+	Actions []string `yaml:"actions"`
+}
+
+// Enabled reports whether any credential-based authenticator is configured.
+func (a Auth) Enabled() bool {
+	return a.CredentialsFile != "" || a.Kubernetes.TokenReview
+}
+
+// AuthenticationEnabled reports whether callers can be identified at all, by credentials or client certificates.
+func (c Config) AuthenticationEnabled() bool {
+	return c.Auth.Enabled() || (c.TLS.Enabled() && c.TLS.ClientAuth != ClientAuthNone)
+}
+
+func Default() Config {
+	return Config{
+		HTTP: HTTP{
+			ListenAddress:     ":8081",
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       10 * time.Second,
+			WriteTimeout:      10 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			ShutdownTimeout:   25 * time.Second,
+		},
+		Limits: Limits{
+			AlertBodyMaxBytes:    10 << 20, // 10 MiB
+			VariableBodyMaxBytes: 1 << 20,  // 1 MiB
+			BatchMaxEntries:      100,
+			ValuesPageMaxHubs:    20,
+			HistoryMaxEntries:    100,
+		},
+		Deduper: Deduper{
+			TTL: adapter.DefaultDeduperTTL,
+		},
+		ConfigMaps: ConfigMaps{
+			Namespace: corev1.NamespaceAll,
+		},
+		OpAMP: OpAMP{
+			EnableCompression: false,
+		},
+		Features: Features{
+			OpAMP:    true,
+			AuditAPI: true,
+			Metrics:  true,
+		},
+		Auth: Auth{
+			CredentialsFile:  "",
+			RequireForReads:  false,
+			RequireForWrites: false,
+			RequireForAlerts: false,
+			Rules:            nil,
+			Kubernetes: AuthKubernetes{
+				TokenReview:         false,
+				Audiences:           nil,
+				CacheTTL:            10 * time.Second,
+				SubjectAccessReview: false,
+				ResourceGroup:       "hub.mydecisive.ai",
+			},
+		},
+		TLS: TLS{
+			CertFile:       "",
+			KeyFile:        "",
+			ClientCAFile:   "",
+			ClientAuth:     ClientAuthNone,
+			ReloadInterval: 30 * time.Second,
+		},
+		Health: Health{
+			Required: slices.Clone(HealthChecks),
+			Timeout:  2 * time.Second,
+		},
+		Reverts: Reverts{
+			PollInterval: 5 * time.Second,
+			MaxTTL:       7 * 24 * time.Hour,
+		},
+		Schedules: Schedules{
+			PollInterval: 10 * time.Second,
+		},
+	}
+}
+
+// Load builds the configuration from defaults, the YAML file at path (if not empty) and environment overrides, then validates it.
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path) //nolint:gosec
+		if err != nil {
+			return Config{}, fmt.Errorf("read config file: %w", err)
+		}
+		if err := decodeYAML(data, &cfg); err != nil {
+			return Config{}, fmt.Errorf("parse config file %s: %w", path, err)
+		}
+	}
+
+	if err := applyEnv(&cfg); err != nil {
+		return Config{}, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return cfg, nil
+}
+
+func decodeYAML(data []byte, cfg *Config) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// applyEnv overrides cfg with the environment variables named by the env tags, joined with those of the enclosing
+// sections, e.g. HTTP_READ_TIMEOUT. Only full names are read, never a bare READ_TIMEOUT, so unrelated variables of the
+// pod cannot change the configuration. Fields without an env tag, like the auth rules, are only read from the file.
+func applyEnv(cfg *Config) error {
+	if port, ok := os.LookupEnv(legacyHTTPPortEnvVarKey); ok && port != "" {
+		cfg.HTTP.ListenAddress = ":" + port
+	}
+	if err := applyEnvFields("", reflect.ValueOf(cfg).Elem()); err != nil {
+		return fmt.Errorf("read environment overrides: %w", err)
+	}
+	return nil
+}
+
+func applyEnvFields(prefix string, v reflect.Value) error {
+	for i := range v.NumField() {
+		field := v.Type().Field(i)
+		name := field.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+		if field.Type.Kind() == reflect.Struct {
+			if err := applyEnvFields(name, v.Field(i)); err != nil {
+				return err
+			}
+			continue
+		}
+		value, ok := lookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setEnvValue(v.Field(i), value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// lookupEnv reads an environment variable, falling back to the legacy name standing for it.
+func lookupEnv(name string) (string, bool) {
+	if value, ok := os.LookupEnv(name); ok {
+		return value, true
+	}
+	for legacy, current := range legacyEnvVarKeys {
+		if current == name {
+			return os.LookupEnv(legacy)
+		}
+	}
+	return "", false
+}
+
+func setEnvValue(field reflect.Value, value string) error {
+	switch field.Interface().(type) {
+	case time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	case []string:
+		var items []string
+		for item := range strings.SplitSeq(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+		return nil
+	}
+	switch field.Kind() { //nolint:exhaustive
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+func (c Config) Validate() error {
+	var errs []error
+
+	if c.HTTP.ListenAddress == "" {
+		errs = append(errs, errors.New("http.listenAddress must not be empty"))
+	}
+	for _, timeout := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"http.readHeaderTimeout", c.HTTP.ReadHeaderTimeout},
+		{"http.readTimeout", c.HTTP.ReadTimeout},
+		{"http.writeTimeout", c.HTTP.WriteTimeout},
+		{"http.idleTimeout", c.HTTP.IdleTimeout},
+		{"http.shutdownTimeout", c.HTTP.ShutdownTimeout},
+	} {
+		if timeout.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive, got %s", timeout.name, timeout.value))
+		}
+	}
+	if c.Limits.AlertBodyMaxBytes <= 0 {
+		errs = append(errs, fmt.Errorf("limits.alertBodyMaxBytes must be positive, got %d", c.Limits.AlertBodyMaxBytes))
+	}
+	if c.Limits.VariableBodyMaxBytes <= 0 {
+		errs = append(errs, fmt.Errorf("limits.variableBodyMaxBytes must be positive, got %d", c.Limits.VariableBodyMaxBytes))
+	}
+	if c.Limits.BatchMaxEntries <= 0 {
+		errs = append(errs, fmt.Errorf("limits.batchMaxEntries must be positive, got %d", c.Limits.BatchMaxEntries))
+	}
+	if c.Limits.ValuesPageMaxHubs <= 0 {
+		errs = append(errs, fmt.Errorf("limits.valuesPageMaxHubs must be positive, got %d", c.Limits.ValuesPageMaxHubs))
+	}
+	if c.Limits.HistoryMaxEntries <= 0 {
+		errs = append(errs, fmt.Errorf("limits.historyMaxEntries must be positive, got %d", c.Limits.HistoryMaxEntries))
+	}
+	if c.Deduper.TTL < 0 {
+		errs = append(errs, fmt.Errorf("deduper.ttl must not be negative, got %s", c.Deduper.TTL))
+	}
+	if !c.AuthenticationEnabled() && (c.Auth.RequireForReads || c.Auth.RequireForWrites || c.Auth.RequireForAlerts) {
+		errs = append(errs, errors.New("auth.credentialsFile, auth.kubernetes.tokenReview or tls.clientAuth must be set when authentication is required"))
+	}
+	if !c.AuthenticationEnabled() && (len(c.Auth.Rules) > 0 || c.Auth.Kubernetes.SubjectAccessReview) {
+		errs = append(errs, errors.New("auth.credentialsFile, auth.kubernetes.tokenReview or tls.clientAuth must be set when authorization is configured"))
+	}
+	if c.Auth.Kubernetes.SubjectAccessReview && len(c.Auth.Rules) > 0 {
+		errs = append(errs, errors.New("auth.rules and auth.kubernetes.subjectAccessReview are mutually exclusive"))
+	}
+	if c.Auth.Kubernetes.CacheTTL < 0 {
+		errs = append(errs, fmt.Errorf("auth.kubernetes.cacheTtl must not be negative, got %s", c.Auth.Kubernetes.CacheTTL))
+	}
+	if c.Auth.Kubernetes.SubjectAccessReview && c.Auth.Kubernetes.ResourceGroup == "" {
+		errs = append(errs, errors.New("auth.kubernetes.resourceGroup must not be empty"))
+	}
+
+	if c.Reverts.PollInterval <= 0 {
+		errs = append(errs, fmt.Errorf("reverts.pollInterval must be positive, got %s", c.Reverts.PollInterval))
+	}
+	if c.Reverts.MaxTTL <= 0 {
+		errs = append(errs, fmt.Errorf("reverts.maxTtl must be positive, got %s", c.Reverts.MaxTTL))
+	}
+	if c.Schedules.PollInterval <= 0 {
+		errs = append(errs, fmt.Errorf("schedules.pollInterval must be positive, got %s", c.Schedules.PollInterval))
+	}
+
+	errs = append(errs, c.TLS.validate(), c.Health.validate())
+	for i, rule := range c.Auth.Rules {
+		errs = append(errs, rule.validate(fmt.Sprintf("auth.rules[%d]", i)))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (t TLS) validate() error {
+	var errs []error
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		errs = append(errs, errors.New("tls.certFile and tls.keyFile must be set together"))
+	}
+	switch t.ClientAuth {
+	case ClientAuthNone:
+	case ClientAuthRequest, ClientAuthRequire:
+		if !t.Enabled() || t.ClientCAFile == "" {
+			errs = append(errs, fmt.Errorf("tls.clientAuth %q requires tls.certFile, tls.keyFile and tls.clientCAFile", t.ClientAuth))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("tls.clientAuth must be one of %q, %q or %q, got %q", ClientAuthNone, ClientAuthRequest, ClientAuthRequire, t.ClientAuth))
+	}
+	if t.Enabled() && t.ReloadInterval <= 0 {
+		errs = append(errs, fmt.Errorf("tls.reloadInterval must be positive, got %s", t.ReloadInterval))
+	}
+	return errors.Join(errs...)
+}
+
+func (h Health) validate() error {
+	var errs []error
+	for _, name := range h.Required {
+		if !slices.Contains(HealthChecks, name) {
+			errs = append(errs, fmt.Errorf("health.required: unknown check %q, expected one of %q", name, HealthChecks))
+		}
+	}
+	if h.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("health.timeout must be positive, got %s", h.Timeout))
+	}
+	return errors.Join(errs...)
+}
+
+func (r AuthRule) validate(field string) error {
+	var errs []error
+	if r.Name == "" {
+		errs = append(errs, fmt.Errorf("%s.name must not be empty", field))
+	}
+	for _, patterns := range []struct {
+		name   string
+		values []string
+	}{
+		{"identities", r.Identities},
+		{"hubs", r.Hubs},
+		{"variables", r.Variables},
+	} {
+		if len(patterns.values) == 0 {
+			errs = append(errs, fmt.Errorf("%s.%s must not be empty", field, patterns.name))
+		}
+		for _, pattern := range patterns.values {
+			if _, err := path.Match(pattern, ""); err != nil {
+				errs = append(errs, fmt.Errorf("%s.%s: invalid pattern %q: %w", field, patterns.name, pattern, err))
+			}
+		}
+	}
+	if len(r.Actions) == 0 {
+		errs = append(errs, fmt.Errorf("%s.actions must not be empty", field))
+	}
+	for _, action := range r.Actions {
+		if action != ActionRead && action != ActionWrite {
+			errs = append(errs, fmt.Errorf("%s.actions: unknown action %q, expected %q or %q", field, action, ActionRead, ActionWrite))
+		}
+	}
+	return errors.Join(errs...)
+}
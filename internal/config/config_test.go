@@ -0,0 +1,187 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.Equal(t, Default(), cfg)
+}
+
+func TestLoad_FileAndEnvOverrides(t *testing.T) {
+	path := writeConfigFile(t, `
+http:
+  listenAddress: ":9090"
+  shutdownTimeout: 5s
+limits:
+  alertBodyMaxBytes: 2048
+deduper:
+  ttl: 1h
+configMaps:
+  namespace: mdai
+features:
+  auditApi: false
+`)
+	t.Setenv("HTTP_READ_TIMEOUT", "3s")
+	t.Setenv("DEDUPER_TTL", "30m")
+	t.Setenv("FEATURES_METRICS_ENABLED", "false")
+	t.Setenv("HEALTH_REQUIRED", "valkey,nats")
+	t.Setenv("REVERTS_MAX_TTL", "24h")
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, ":9090", cfg.HTTP.ListenAddress)
+	assert.Equal(t, 5*time.Second, cfg.HTTP.ShutdownTimeout)
+	assert.Equal(t, 3*time.Second, cfg.HTTP.ReadTimeout)
+	assert.Equal(t, Default().HTTP.WriteTimeout, cfg.HTTP.WriteTimeout)
+	assert.Equal(t, int64(2048), cfg.Limits.AlertBodyMaxBytes)
+	assert.Equal(t, 30*time.Minute, cfg.Deduper.TTL)
+	assert.Equal(t, "mdai", cfg.ConfigMaps.Namespace)
+	assert.False(t, cfg.Features.AuditAPI)
+	assert.True(t, cfg.Features.OpAMP)
+	assert.False(t, cfg.Features.Metrics)
+	assert.Equal(t, []string{HealthCheckValkey, HealthCheckNATS}, cfg.Health.Required)
+	assert.Equal(t, Default().Health.Timeout, cfg.Health.Timeout)
+	assert.Equal(t, 24*time.Hour, cfg.Reverts.MaxTTL)
+}
+
+func TestLoad_LegacyEnv(t *testing.T) {
+	t.Setenv("HTTP_PORT", "8082")
+	t.Setenv("SHUTDOWN_TIMEOUT", "7s")
+
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.Equal(t, ":8082", cfg.HTTP.ListenAddress)
+	assert.Equal(t, 7*time.Second, cfg.HTTP.ShutdownTimeout)
+}
+
+func TestLoad_EnvFullNamesOnly(t *testing.T) {
+	t.Setenv("READ_TIMEOUT", "1s")
+	// Fields without an env tag are not read from the environment.
+	t.Setenv("AUTH_RULES", "anything")
+	t.Setenv("MAX_TTL", "1m")
+	t.Setenv("HTTP_SHUTDOWN_TIMEOUT", "9s")
+	t.Setenv("SHUTDOWN_TIMEOUT", "7s")
+	t.Setenv("AUTH_KUBERNETES_AUDIENCES", "gateway, mdai")
+
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.Equal(t, Default().HTTP.ReadTimeout, cfg.HTTP.ReadTimeout)
+	assert.Equal(t, Default().Reverts.MaxTTL, cfg.Reverts.MaxTTL)
+	assert.Equal(t, 9*time.Second, cfg.HTTP.ShutdownTimeout)
+	assert.Equal(t, []string{"gateway", "mdai"}, cfg.Auth.Kubernetes.Audiences)
+	assert.Empty(t, cfg.Auth.Rules)
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		env      map[string]string
+		expected string
+	}{
+		{
+			name:     "unknown field",
+			file:     "http:\n  port: 8081\n",
+			expected: "field port not found",
+		},
+		{
+			name:     "malformed env",
+			env:      map[string]string{"HTTP_IDLE_TIMEOUT": "forever"},
+			expected: "read environment overrides",
+		},
+		{
+			name:     "auth required without credentials",
+			env:      map[string]string{"AUTH_REQUIRE_FOR_WRITES": "true"},
+			expected: "auth.credentialsFile, auth.kubernetes.tokenReview or tls.clientAuth must be set when authentication is required",
+		},
+		{
+			name: "invalid auth rule",
+			file: "auth:\n  credentialsFile: /tmp/creds.yaml\n  rules:\n    - name: bad\n      identities: [\"[\"]\n      hubs: [\"*\"]\n      variables: [\"*\"]\n      actions: [\"delete\"]\n",
+			expected: "auth.rules[0].identities: invalid pattern \"[\": syntax error in pattern\n" +
+				"auth.rules[0].actions: unknown action \"delete\", expected \"read\" or \"write\"",
+		},
+		{
+			name: "rules with subject access review",
+			env: map[string]string{
+				"AUTH_KUBERNETES_TOKEN_REVIEW":          "true",
+				"AUTH_KUBERNETES_SUBJECT_ACCESS_REVIEW": "true",
+			},
+			file:     "auth:\n  rules:\n    - name: all\n      identities: [\"*\"]\n      hubs: [\"*\"]\n      variables: [\"*\"]\n      actions: [read]\n",
+			expected: "auth.rules and auth.kubernetes.subjectAccessReview are mutually exclusive",
+		},
+		{
+			name:     "client auth without CA",
+			env:      map[string]string{"TLS_CERT_FILE": "tls.crt", "TLS_KEY_FILE": "tls.key", "TLS_CLIENT_AUTH": "require"},
+			expected: `tls.clientAuth "require" requires tls.certFile, tls.keyFile and tls.clientCAFile`,
+		},
+		{
+			name:     "cert without key",
+			env:      map[string]string{"TLS_CERT_FILE": "tls.crt"},
+			expected: "tls.certFile and tls.keyFile must be set together",
+		},
+		{
+			name:     "unknown health check",
+			file:     "health:\n  required: [valkey, redis]\n",
+			expected: `health.required: unknown check "redis", expected one of ["valkey" "nats" "configmaps" "opamp"]`,
+		},
+		{
+			name:     "non-positive schedule poll interval",
+			env:      map[string]string{"SCHEDULES_POLL_INTERVAL": "0s"},
+			expected: "schedules.pollInterval must be positive, got 0s",
+		},
+		{
+			name:     "non-positive values page size",
+			env:      map[string]string{"LIMITS_VALUES_PAGE_MAX_HUBS": "0"},
+			expected: "limits.valuesPageMaxHubs must be positive, got 0",
+		},
+		{
+			name:     "non-positive history page size",
+			env:      map[string]string{"LIMITS_HISTORY_MAX_ENTRIES": "-1"},
+			expected: "limits.historyMaxEntries must be positive, got -1",
+		},
+		{
+			name: "invalid values",
+			file: "http:\n  readTimeout: 0s\nlimits:\n  alertBodyMaxBytes: -1\ndeduper:\n  ttl: -1h\n",
+			expected: "invalid configuration: http.readTimeout must be positive, got 0s\n" +
+				"limits.alertBodyMaxBytes must be positive, got -1\n" +
+				"deduper.ttl must not be negative, got -1h0m0s",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			path := ""
+			if tt.file != "" {
+				path = writeConfigFile(t, tt.file)
+			}
+
+			_, err := Load(path)
+			require.ErrorContains(t, err, tt.expected)
+		})
+	}
+}
+
+func TestLoad_MissingFile(t *testing.T) {
+	_, err := Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
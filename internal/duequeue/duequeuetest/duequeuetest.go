@@ -0,0 +1,42 @@
+package duequeuetest
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+
+	"github.com/valkey-io/valkey-go"
+	valkeymock "github.com/valkey-io/valkey-go/mock"
+	"go.uber.org/mock/gomock"
+)
+
+// Script matches a Lua script of a duequeue.Queue run on the given keys and arguments, whichever script it is.
+type Script []string
+
+func (m Script) Matches(x any) bool {
+	cmd, ok := x.(valkey.Completed)
+	if !ok {
+		return false
+	}
+	args := cmd.Commands()
+	return len(args) > 3 && args[0] == "EVALSHA" && slices.Equal(args[3:], m)
+}
+
+func (m Script) String() string {
+	return "EVALSHA on " + strings.Join(m, " ")
+}
+
+// ExpectPut decodes the record stored by the next duequeue.Queue.Put into stored.
+func ExpectPut(client *valkeymock.Client, stored any) {
+	client.EXPECT().DoMulti(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, cmds ...valkey.Completed) []valkey.ValkeyResult {
+			hset := cmds[0].Commands()
+			_ = json.Unmarshal([]byte(hset[len(hset)-1]), stored)
+			results := make([]valkey.ValkeyResult, len(cmds))
+			for i := range results {
+				results[i] = valkeymock.Result(valkeymock.ValkeyInt64(1))
+			}
+			return results
+		}).Times(1)
+}
@@ -0,0 +1,42 @@
+package duequeue
+
+import (
+	"context"
+	"time"
+)
+
+// Poller calls poll every interval, e.g. to handle the items of a Queue as they come due.
+type Poller struct {
+	interval time.Duration
+	poll     func(ctx context.Context, now time.Time)
+	done     chan struct{}
+}
+
+func NewPoller(interval time.Duration, poll func(ctx context.Context, now time.Time)) *Poller {
+	return &Poller{interval: interval, poll: poll, done: make(chan struct{})}
+}
+
+// Run polls until ctx is done. A poll in progress then is finished, with a context that is not cancelled.
+func (p *Poller) Run(ctx context.Context) {
+	defer close(p.done)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.poll(context.WithoutCancel(ctx), time.Now())
+		}
+	}
+}
+
+// Stop waits for Run to return, e.g. for an item in progress to be handled.
+func (p *Poller) Stop(ctx context.Context) error {
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
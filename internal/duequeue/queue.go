@@ -0,0 +1,196 @@
+package duequeue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// Lease is how long an item claimed by Claim is held by the replica that claimed it before another may claim it.
+const Lease = time.Minute
+
+var ErrNotFound = errors.New("not found")
+
+var (
+	// removeScript deletes the item ARGV[1], returning its record, or nil when there is none.
+	removeScript = valkey.NewLuaScript(`
+if redis.call('ZREM', KEYS[2], ARGV[1]) == 0 then
+	return false
+end
+local record = redis.call('HGET', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[3], ARGV[1])
+return record`)
+	// claimScript moves the item ARGV[1] from the score ARGV[2] to the end of its lease ARGV[3], returning its record
+	// and the time it was due at, or nil when its score is not ARGV[2] any more. The due time is kept in KEYS[3] for
+	// when the lease expires and the item is claimed again.
+	claimScript = valkey.NewLuaScript(`
+if tonumber(redis.call('ZSCORE', KEYS[2], ARGV[1])) ~= tonumber(ARGV[2]) then
+	return false
+end
+local record = redis.call('HGET', KEYS[1], ARGV[1])
+if not record then
+	redis.call('ZREM', KEYS[2], ARGV[1])
+	redis.call('HDEL', KEYS[3], ARGV[1])
+	return false
+end
+local at = redis.call('HGET', KEYS[3], ARGV[1])
+if not at then
+	at = ARGV[2]
+	redis.call('HSET', KEYS[3], ARGV[1], at)
+end
+redis.call('ZADD', KEYS[2], ARGV[3], ARGV[1])
+return {record, at}`)
+	// releaseScript ends the lease ARGV[2] of the item ARGV[1], making it due at ARGV[3], or deleting it when ARGV[3]
+	// is empty. It returns 0 when the item is not held under that lease any more.
+	releaseScript = valkey.NewLuaScript(`
+if tonumber(redis.call('ZSCORE', KEYS[2], ARGV[1])) ~= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('HDEL', KEYS[3], ARGV[1])
+if ARGV[3] == '' then
+	redis.call('ZREM', KEYS[2], ARGV[1])
+	redis.call('HDEL', KEYS[1], ARGV[1])
+else
+	redis.call('ZADD', KEYS[2], ARGV[3], ARGV[1])
+end
+return 1`)
+)
+
+// Claim is an item held by the replica that claimed it until Until. At is when the item was due.
+type Claim struct {
+	ID     string
+	Record string
+	At     time.Time
+	Until  time.Time
+}
+
+// Queue stores records by ID in Valkey, each due at a time, so they survive restarts and are shared by every gateway
+// replica. Records live in a hash at key and due times in a sorted set at key/due, scored in Unix milliseconds; while
+// an item is claimed its score is the end of the lease and the time it was due is kept in a hash at key/claimed.
+type Queue struct {
+	client valkey.Client
+	// name is what the records are, e.g. "pending revert", for error messages.
+	name string
+	keys []string
+}
+
+func New(client valkey.Client, key, name string) *Queue {
+	return &Queue{client: client, name: name, keys: []string{key, key + "/due", key + "/claimed"}}
+}
+
+// Put stores record under id, replacing any record with the same ID and a claim on it, due at at.
+func (q *Queue) Put(ctx context.Context, id string, record []byte, at time.Time) error {
+	for _, resp := range q.client.DoMulti(ctx,
+		q.client.B().Hset().Key(q.keys[0]).FieldValue().FieldValue(id, string(record)).Build(),
+		q.client.B().Zadd().Key(q.keys[1]).ScoreMember().ScoreMember(float64(at.UnixMilli()), id).Build(),
+		q.client.B().Hdel().Key(q.keys[2]).Field(id).Build(),
+	) {
+		if err := resp.Error(); err != nil {
+			return fmt.Errorf("failed to store %s %s: %w", q.name, id, err)
+		}
+	}
+	return nil
+}
+
+// Records returns every record, in no particular order.
+func (q *Queue) Records(ctx context.Context) ([]string, error) {
+	records, err := q.client.Do(ctx, q.client.B().Hvals().Key(q.keys[0]).Build()).AsStrSlice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %ss: %w", q.name, err)
+	}
+	return records, nil
+}
+
+func (q *Queue) Get(ctx context.Context, id string) (string, error) {
+	record, err := q.client.Do(ctx, q.client.B().Hget().Key(q.keys[0]).Field(id).Build()).ToString()
+	if valkey.IsValkeyNil(err) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s %s: %w", q.name, id, err)
+	}
+	return record, nil
+}
+
+// Remove deletes an item and returns its record. Only one caller wins when several remove the same item
+// concurrently; the others get ErrNotFound.
+func (q *Queue) Remove(ctx context.Context, id string) (string, error) {
+	record, err := removeScript.Exec(ctx, q.client, q.keys, []string{id}).ToString()
+	if valkey.IsValkeyNil(err) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to remove %s %s: %w", q.name, id, err)
+	}
+	return record, nil
+}
+
+// Claim claims the items due at now, including those whose lease expired. With several gateway replicas polling the
+// same queue each item is claimed by one of them, which holds it until now plus Lease and then calls Done or Release.
+// An item neither is called for, e.g. because the gateway stopped in between, is claimed again once its lease
+// expires: items are handled at least once, and more than once if handling one outlasts its lease.
+func (q *Queue) Claim(ctx context.Context, now time.Time) ([]Claim, error) {
+	scores, err := q.client.Do(ctx, q.client.B().Zrangebyscore().Key(q.keys[1]).Min("-inf").Max(formatMillis(now)).Withscores().Build()).AsZScores()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list due %ss: %w", q.name, err)
+	}
+	until := now.Add(Lease).Truncate(time.Millisecond)
+	var claims []Claim
+	var errs []error
+	for _, score := range scores {
+		claimed, err := claimScript.Exec(ctx, q.client, q.keys, []string{
+			score.Member, strconv.FormatInt(int64(score.Score), 10), formatMillis(until),
+		}).ToArray()
+		if valkey.IsValkeyNil(err) {
+			continue // claimed by another replica or removed
+		}
+		if err == nil && len(claimed) != 2 {
+			err = fmt.Errorf("unexpected reply of %d elements", len(claimed))
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to claim %s %s: %w", q.name, score.Member, err))
+			continue
+		}
+		record, err := claimed[0].ToString()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to claim %s %s: %w", q.name, score.Member, err))
+			continue
+		}
+		at, err := claimed[1].AsInt64()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to claim %s %s: %w", q.name, score.Member, err))
+			continue
+		}
+		claims = append(claims, Claim{ID: score.Member, Record: record, At: time.UnixMilli(at).UTC(), Until: until})
+	}
+	return claims, errors.Join(errs...)
+}
+
+// Done deletes a claimed item once it is handled. It reports false, leaving the queue alone, when the claim is no
+// longer held: the item was removed or replaced, or claimed again after the lease expired.
+func (q *Queue) Done(ctx context.Context, c Claim) (bool, error) {
+	return q.release(ctx, c, "")
+}
+
+// Release ends a claim, making the item due at at. It reports false, leaving the queue alone, when the claim is no
+// longer held.
+func (q *Queue) Release(ctx context.Context, c Claim, at time.Time) (bool, error) {
+	return q.release(ctx, c, formatMillis(at))
+}
+
+func (q *Queue) release(ctx context.Context, c Claim, at string) (bool, error) {
+	released, err := releaseScript.Exec(ctx, q.client, q.keys, []string{c.ID, formatMillis(c.Until), at}).AsInt64()
+	if err != nil {
+		return false, fmt.Errorf("failed to release %s %s: %w", q.name, c.ID, err)
+	}
+	return released == 1, nil
+}
+
+func formatMillis(t time.Time) string {
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
@@ -0,0 +1,100 @@
+package duequeue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mydecisive/mdai-gateway/internal/duequeue/duequeuetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valkey-io/valkey-go"
+	valkeymock "github.com/valkey-io/valkey-go/mock"
+	"go.uber.org/mock/gomock"
+)
+
+const (
+	recordsKey = "gateway/things"
+	dueKey     = "gateway/things/due"
+	claimedKey = "gateway/things/claimed"
+)
+
+func TestQueue_Put(t *testing.T) {
+	client := valkeymock.NewClient(gomock.NewController(t))
+	at := time.Date(2025, 7, 19, 12, 0, 0, 0, time.UTC)
+
+	client.EXPECT().DoMulti(gomock.Any(),
+		valkeymock.Match("HSET", recordsKey, "t1", `{"n":1}`),
+		valkeymock.Match("ZADD", dueKey, "1752926400000", "t1"),
+		valkeymock.Match("HDEL", claimedKey, "t1"),
+	).Return([]valkey.ValkeyResult{
+		valkeymock.Result(valkeymock.ValkeyInt64(1)),
+		valkeymock.Result(valkeymock.ValkeyInt64(1)),
+		valkeymock.Result(valkeymock.ValkeyInt64(0)),
+	})
+
+	require.NoError(t, New(client, recordsKey, "thing").Put(t.Context(), "t1", []byte(`{"n":1}`), at))
+}
+
+func TestQueue_Remove(t *testing.T) {
+	client := valkeymock.NewClient(gomock.NewController(t))
+	queue := New(client, recordsKey, "thing")
+	remove := duequeuetest.Script{recordsKey, dueKey, claimedKey, "t1"}
+
+	client.EXPECT().Do(gomock.Any(), remove).Return(valkeymock.Result(valkeymock.ValkeyBlobString(`{"n":1}`)))
+	record, err := queue.Remove(t.Context(), "t1")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"n":1}`, record)
+
+	// Another caller removed it first.
+	client.EXPECT().Do(gomock.Any(), remove).Return(valkeymock.Result(valkeymock.ValkeyNil()))
+	_, err = queue.Remove(t.Context(), "t1")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestQueue_Claim(t *testing.T) {
+	client := valkeymock.NewClient(gomock.NewController(t))
+	now := time.Date(2025, 7, 19, 12, 0, 0, 0, time.UTC)
+
+	client.EXPECT().Do(gomock.Any(), valkeymock.Match("ZRANGEBYSCORE", dueKey, "-inf", "1752926400000", "WITHSCORES")).
+		Return(valkeymock.Result(valkeymock.ValkeyArray(
+			valkeymock.ValkeyBlobString("t1"), valkeymock.ValkeyBlobString("1752926400000"),
+			valkeymock.ValkeyBlobString("t2"), valkeymock.ValkeyBlobString("1752926300000"),
+			valkeymock.ValkeyBlobString("t3"), valkeymock.ValkeyBlobString("1752926100000"),
+		)))
+	client.EXPECT().Do(gomock.Any(), duequeuetest.Script{recordsKey, dueKey, claimedKey, "t1", "1752926400000", "1752926460000"}).
+		Return(valkeymock.Result(valkeymock.ValkeyArray(valkeymock.ValkeyBlobString(`{"n":1}`), valkeymock.ValkeyBlobString("1752926400000"))))
+	// t2 was claimed by another replica.
+	client.EXPECT().Do(gomock.Any(), duequeuetest.Script{recordsKey, dueKey, claimedKey, "t2", "1752926300000", "1752926460000"}).
+		Return(valkeymock.Result(valkeymock.ValkeyNil()))
+	// The lease of t3 expired; it is claimed again and keeps the time it was due.
+	client.EXPECT().Do(gomock.Any(), duequeuetest.Script{recordsKey, dueKey, claimedKey, "t3", "1752926100000", "1752926460000"}).
+		Return(valkeymock.Result(valkeymock.ValkeyArray(valkeymock.ValkeyBlobString(`{"n":3}`), valkeymock.ValkeyBlobString("1752926040000"))))
+
+	claims, err := New(client, recordsKey, "thing").Claim(t.Context(), now)
+	require.NoError(t, err)
+	until := now.Add(Lease)
+	assert.Equal(t, []Claim{
+		{ID: "t1", Record: `{"n":1}`, At: now, Until: until},
+		{ID: "t3", Record: `{"n":3}`, At: now.Add(-6 * time.Minute), Until: until},
+	}, claims)
+}
+
+func TestQueue_Release(t *testing.T) {
+	client := valkeymock.NewClient(gomock.NewController(t))
+	queue := New(client, recordsKey, "thing")
+	now := time.Date(2025, 7, 19, 12, 0, 0, 0, time.UTC)
+	claim := Claim{ID: "t1", Record: `{"n":1}`, At: now, Until: now.Add(Lease)}
+
+	client.EXPECT().Do(gomock.Any(), duequeuetest.Script{recordsKey, dueKey, claimedKey, "t1", "1752926460000", ""}).
+		Return(valkeymock.Result(valkeymock.ValkeyInt64(1)))
+	held, err := queue.Done(t.Context(), claim)
+	require.NoError(t, err)
+	assert.True(t, held)
+
+	// The item was replaced or claimed again in the meantime.
+	client.EXPECT().Do(gomock.Any(), duequeuetest.Script{recordsKey, dueKey, claimedKey, "t1", "1752926460000", "1752930000000"}).
+		Return(valkeymock.Result(valkeymock.ValkeyInt64(0)))
+	held, err = queue.Release(t.Context(), claim, now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, held)
+}
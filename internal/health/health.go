@@ -0,0 +1,124 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mydecisive/mdai-gateway/internal/httputil"
+	"go.uber.org/zap"
+)
+
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+
+	StatusReady   = "ready"
+	StatusUnready = "unready"
+)
+
+// Checker is implemented by dependencies that can report their own health, e.g. the NATS publisher.
+type Checker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+// Check is a named readiness check.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// CheckResult is the outcome of one check. Required checks make the gateway unready when they fail.
+type CheckResult struct {
+	Status   string `json:"status"`
+	Required bool   `json:"required"`
+	Error    string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// Readiness runs every check concurrently and reports unready if a required one fails.
+type Readiness struct {
+	logger   *zap.Logger
+	timeout  time.Duration
+	required []string
+	checks   []Check
+}
+
+// NewReadiness returns a Readiness running checks with timeout. Only failures of checks named in required
+// make the gateway unready; the others are reported but tolerated.
+func NewReadiness(logger *zap.Logger, timeout time.Duration, required []string, checks ...Check) *Readiness {
+	return &Readiness{
+		logger:   logger,
+		timeout:  timeout,
+		required: required,
+		checks:   checks,
+	}
+}
+
+func (r *Readiness) Run(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	results := make([]CheckResult, len(r.checks))
+	var wg sync.WaitGroup
+	for i, check := range r.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = CheckResult{
+				Status:   StatusOK,
+				Required: slices.Contains(r.required, check.Name),
+				Error:    "",
+			}
+			if err := check.Run(ctx); err != nil {
+				results[i].Status = StatusError
+				results[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+
+	report := Report{
+		Status: StatusReady,
+		Checks: make(map[string]CheckResult, len(r.checks)),
+	}
+	for i, check := range r.checks {
+		result := results[i]
+		report.Checks[check.Name] = result
+		if result.Status != StatusOK {
+			r.logger.Warn("Readiness check failed", zap.String("check", check.Name), zap.Bool("required", result.Required), zap.String("error", result.Error))
+			if result.Required {
+				report.Status = StatusUnready
+			}
+		}
+	}
+	return report
+}
+
+// Handler serves the readiness report as JSON, with 503 Service Unavailable when unready.
+func (r *Readiness) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		report := r.Run(req.Context())
+		status := http.StatusOK
+		if report.Status != StatusReady {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		httputil.WriteJSONResponse(w, r.logger, status, report)
+	})
+}
+
+// LivenessHandler reports that the process is serving requests. It checks no dependencies, so an outage of
+// Valkey or NATS does not get the pod restarted.
+func LivenessHandler(logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		httputil.WriteJSONResponse(w, logger, http.StatusOK, map[string]string{"status": StatusOK})
+	})
+}
@@ -0,0 +1,72 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestReadiness(t *testing.T) {
+	ok := Check{Name: "ok", Run: func(context.Context) error { return nil }}
+	failing := Check{Name: "failing", Run: func(context.Context) error { return errors.New("down") }}
+	hanging := Check{Name: "hanging", Run: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+
+	tests := []struct {
+		name     string
+		required []string
+		checks   []Check
+		status   int
+		expected Report
+	}{
+		{
+			name:     "all healthy",
+			required: []string{"ok"},
+			checks:   []Check{ok},
+			status:   http.StatusOK,
+			expected: Report{Status: StatusReady, Checks: map[string]CheckResult{
+				"ok": {Status: StatusOK, Required: true, Error: ""},
+			}},
+		},
+		{
+			name:     "optional failure",
+			required: []string{"ok"},
+			checks:   []Check{ok, failing},
+			status:   http.StatusOK,
+			expected: Report{Status: StatusReady, Checks: map[string]CheckResult{
+				"ok":      {Status: StatusOK, Required: true, Error: ""},
+				"failing": {Status: StatusError, Required: false, Error: "down"},
+			}},
+		},
+		{
+			name:     "required check times out",
+			required: []string{"ok", "hanging"},
+			checks:   []Check{ok, hanging},
+			status:   http.StatusServiceUnavailable,
+			expected: Report{Status: StatusUnready, Checks: map[string]CheckResult{
+				"ok":      {Status: StatusOK, Required: true, Error: ""},
+				"hanging": {Status: StatusError, Required: true, Error: context.DeadlineExceeded.Error()},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			readiness := NewReadiness(zap.NewNop(), 10*time.Millisecond, tt.required, tt.checks...)
+			assert.Equal(t, tt.expected, readiness.Run(t.Context()))
+
+			rr := httptest.NewRecorder()
+			readiness.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", http.NoBody))
+			assert.Equal(t, tt.status, rr.Code)
+			assert.Equal(t, "no-store", rr.Header().Get("Cache-Control"))
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package httputil
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// ProblemTypePrefix namespaces the type URI of every problem; the machine-readable code is appended to it.
+const ProblemTypePrefix = "urn:mdai-gateway:problem:"
+
+// Machine-readable problem codes. Clients should branch on these rather than on detail messages.
+const (
+	CodeInvalidRequest          = "invalid_request"
+	CodeMissingParameter        = "missing_parameter"
+	CodeInvalidJSON             = "invalid_json"
+	CodeInvalidValue            = "invalid_value"
+	CodeUnsupportedVariableType = "unsupported_variable_type"
+	CodeUnsupportedOperation    = "unsupported_operation"
+	CodeBodyTooLarge            = "body_too_large"
+	CodeUnsupportedMediaType    = "unsupported_media_type"
+	CodeAuthenticationRequired  = "authentication_required"
+	CodeInvalidCredentials      = "invalid_credentials"
+	CodeForbidden               = "forbidden"
+	CodeNoManualVariables       = "no_manual_variables"
+	CodeHubNotFound             = "hub_not_found"
+	CodeVariableNotFound        = "variable_not_found"
+	CodeRevertNotFound          = "revert_not_found"
+	CodeScheduleNotFound        = "schedule_not_found"
+	CodeEventNotFound           = "event_not_found"
+	CodePublishFailed           = "publish_failed"
+	CodeInvalidBatch            = "invalid_batch"
+	CodeInvalidSchedule         = "invalid_schedule"
+	CodeInvalidSnapshot         = "invalid_snapshot"
+	CodePreconditionFailed      = "precondition_failed"
+	CodeHistoryIncomplete       = "history_incomplete"
+	CodeTooManyMissedEvents     = "too_many_missed_events"
+	CodeInvalidStoredValue      = "invalid_stored_value"
+	CodeInternal                = "internal_error"
+)
+
+// Problem is an RFC 7807 error body extended with a machine-readable code. Errors lists the failing items of
+// requests that carry several, such as a batch update.
+type Problem struct {
+	Type   string        `json:"type"`
+	Title  string        `json:"title"`
+	Status int           `json:"status"`
+	Detail string        `json:"detail,omitempty"`
+	Code   string        `json:"code"`
+	Errors []ProblemItem `json:"errors,omitempty"`
+}
+
+// ProblemItem is the error of the request item at Index.
+type ProblemItem struct {
+	Index  int    `json:"index"`
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+// Error is a CodedError for failures detected by the handlers themselves.
+type Error struct {
+	Status int
+	Code   string
+	Detail string
+}
+
+func (e Error) Error() string     { return e.Detail }
+func (e Error) HTTPStatus() int   { return e.Status }
+func (e Error) ErrorCode() string { return e.Code }
+
+func NewError(status int, code, detail string) Error {
+	return Error{Status: status, Code: code, Detail: detail}
+}
+
+// CodedError is implemented by errors that know which problem they should be reported as,
+// such as manualvariables.HTTPError and valkey.ValidationError.
+type CodedError interface {
+	error
+	HTTPStatus() int
+	ErrorCode() string
+}
+
+// NewProblem builds a problem whose type URI is derived from code.
+func NewProblem(status int, code, detail string) Problem {
+	return Problem{
+		Type:   ProblemTypePrefix + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+		Errors: nil,
+	}
+}
+
+// internalErrorDetail stands in for the message of errors without a code, which may expose internals to the caller.
+const internalErrorDetail = "internal error"
+
+// ProblemFromError maps err to a problem. Errors without a CodedError in their chain are reported as internal errors
+// with a generic detail.
+func ProblemFromError(err error) Problem {
+	var coded CodedError
+	if errors.As(err, &coded) {
+		return NewProblem(coded.HTTPStatus(), coded.ErrorCode(), err.Error())
+	}
+	return NewProblem(http.StatusInternalServerError, CodeInternal, internalErrorDetail)
+}
+
+// WriteProblem writes an application/problem+json error response.
+func WriteProblem(w http.ResponseWriter, logger *zap.Logger, status int, code, detail string) {
+	writeProblem(w, logger, NewProblem(status, code, detail))
+}
+
+// WriteProblemItems writes a problem listing the errors of individual request items.
+func WriteProblemItems(w http.ResponseWriter, logger *zap.Logger, status int, code, detail string, items []ProblemItem) {
+	problem := NewProblem(status, code, detail)
+	problem.Errors = items
+	writeProblem(w, logger, problem)
+}
+
+// WriteError writes err as an application/problem+json response, see ProblemFromError. Errors without a code are
+// logged, since the response does not carry their message.
+func WriteError(w http.ResponseWriter, logger *zap.Logger, err error) {
+	if coded := CodedError(nil); !errors.As(err, &coded) {
+		logger.Error("Internal error", zap.Error(err))
+	}
+	writeProblem(w, logger, ProblemFromError(err))
+}
+
+func writeProblem(w http.ResponseWriter, logger *zap.Logger, problem Problem) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(problem.Status)
+
+	if err := json.NewEncoder(w).Encode(problem); err != nil {
+		logger.Error("failed to write response body: %v", zap.Error(err))
+	}
+}
@@ -0,0 +1,75 @@
+package httputil
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type testCodedError struct{}
+
+func (testCodedError) Error() string     { return "hub not found" }
+func (testCodedError) HTTPStatus() int   { return http.StatusNotFound }
+func (testCodedError) ErrorCode() string { return CodeHubNotFound }
+
+func TestWriteProblem(t *testing.T) {
+	rr := httptest.NewRecorder()
+
+	WriteProblem(rr, zap.NewNop(), http.StatusForbidden, CodeForbidden, "not allowed")
+
+	assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.JSONEq(t, `{"type":"urn:mdai-gateway:problem:forbidden","title":"Forbidden","status":403,"detail":"not allowed","code":"forbidden"}`, rr.Body.String())
+}
+
+func TestWriteProblemItems(t *testing.T) {
+	rr := httptest.NewRecorder()
+
+	WriteProblemItems(rr, zap.NewNop(), http.StatusBadRequest, CodeInvalidBatch, "1 of 2 entries are invalid", []ProblemItem{
+		{Index: 1, Code: CodeInvalidValue, Detail: "int expected"},
+	})
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.JSONEq(t, `{"type":"urn:mdai-gateway:problem:invalid_batch","title":"Bad Request","status":400,"detail":"1 of 2 entries are invalid","code":"invalid_batch",`+
+		`"errors":[{"index":1,"code":"invalid_value","detail":"int expected"}]}`, rr.Body.String())
+}
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "coded error",
+			err:  testCodedError{},
+			want: `{"type":"urn:mdai-gateway:problem:hub_not_found","title":"Not Found","status":404,"detail":"hub not found","code":"hub_not_found"}`,
+		},
+		{
+			name: "wrapped coded error",
+			err:  fmt.Errorf("lookup: %w", testCodedError{}),
+			want: `{"type":"urn:mdai-gateway:problem:hub_not_found","title":"Not Found","status":404,"detail":"lookup: hub not found","code":"hub_not_found"}`,
+		},
+		{
+			name: "plain error",
+			err:  errors.New("connection refused"),
+			want: `{"type":"urn:mdai-gateway:problem:internal_error","title":"Internal Server Error","status":500,"detail":"internal error","code":"internal_error"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+
+			WriteError(rr, zap.NewNop(), tt.err)
+
+			assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+			assert.JSONEq(t, tt.want, rr.Body.String())
+		})
+	}
+}
@@ -3,6 +3,7 @@ package httputil
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
 
 	"go.uber.org/zap"
 )
@@ -12,6 +13,7 @@ type PrometheusAlertResponse struct {
 	Total      int    `json:"total"`
 	Successful int    `json:"successful"`
 	Skipped    int    `json:"skipped"`
+	Failed     int    `json:"failed,omitempty"`
 }
 
 func WriteJSONResponse(w http.ResponseWriter, logger *zap.Logger, status int, response any) {
@@ -22,3 +24,15 @@ func WriteJSONResponse(w http.ResponseWriter, logger *zap.Logger, status int, re
 		logger.Error("failed to write response body: %v", zap.Error(err))
 	}
 }
+
+// ETagMatches reports whether an If-Match header value matches etag. "*" matches any etag, and entity tags are
+// compared strongly, so weak tags never match.
+func ETagMatches(ifMatch, etag string) bool {
+	for candidate := range strings.SplitSeq(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -55,3 +55,22 @@ func TestWriteJSONResponse_ErrorEncoding(t *testing.T) {
 	assert.Equal(t, "failed to write response body: %v", logs[0].Message)
 	assert.Contains(t, logs[0].ContextMap()["error"].(string), "json: unsupported type: chan int")
 }
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		ifMatch string
+		want    bool
+	}{
+		{ifMatch: `"abc"`, want: true},
+		{ifMatch: `"xyz", "abc"`, want: true},
+		{ifMatch: `*`, want: true},
+		{ifMatch: `"xyz"`, want: false},
+		{ifMatch: `W/"abc"`, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ifMatch, func(t *testing.T) {
+			assert.Equal(t, tt.want, ETagMatches(tt.ifMatch, `"abc"`))
+		})
+	}
+}
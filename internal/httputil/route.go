@@ -0,0 +1,48 @@
+package httputil
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Route holds the pattern of the route a request matched. The http.ServeMux only stores it on the request it is
+// handed, so middleware wrapping the mux gets a Route from TrackRoute, which RecordRoute fills in once the mux ran.
+type Route struct {
+	pattern string
+}
+
+type routeContextKey struct{}
+
+// TrackRoute returns r carrying a Route for RecordRoute to fill in, sharing the one r carries already, if any.
+func TrackRoute(r *http.Request) (*http.Request, *Route) {
+	if route, ok := r.Context().Value(routeContextKey{}).(*Route); ok {
+		return r, route
+	}
+	route := &Route{pattern: ""}
+	return r.WithContext(context.WithValue(r.Context(), routeContextKey{}, route)), route
+}
+
+// RecordRoute wraps an http.ServeMux, storing the pattern it matched in the Route of the request. It must be the
+// innermost wrapper, since the mux sets the pattern on the request handed to it.
+func RecordRoute(mux http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r)
+		if route, ok := r.Context().Value(routeContextKey{}).(*Route); ok {
+			route.pattern = r.Pattern
+		}
+	})
+}
+
+// Pattern returns the matched pattern, e.g. "GET /variables/list", or "" when the request matched no route.
+func (r *Route) Pattern() string {
+	return r.pattern
+}
+
+// Path returns the matched pattern without its method, e.g. "/variables/list".
+func (r *Route) Path() string {
+	if _, path, ok := strings.Cut(r.pattern, " "); ok {
+		return path
+	}
+	return r.pattern
+}
@@ -0,0 +1,33 @@
+package httputil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordRoute(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /variables/hub/{hubName}", func(http.ResponseWriter, *http.Request) {})
+
+	// Middleware further out shares the Route of the middleware it wraps, whatever requests those pass on.
+	var outer, inner *Route
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, outer = TrackRoute(r)
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r, inner = TrackRoute(r.WithContext(r.Context()))
+			RecordRoute(mux).ServeHTTP(w, r)
+		}).ServeHTTP(w, r)
+	})
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/variables/hub/mdaihub-sample", http.NoBody))
+	assert.Same(t, outer, inner)
+	assert.Equal(t, "GET /variables/hub/{hubName}", outer.Pattern())
+	assert.Equal(t, "/variables/hub/{hubName}", outer.Path())
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nope", http.NoBody))
+	assert.Empty(t, outer.Pattern())
+	assert.Empty(t, outer.Path())
+}
@@ -3,7 +3,9 @@ package manualvariables
 type HTTPError struct {
 	Msg    string
 	Status int
+	Code   string
 }
 
-func (e HTTPError) Error() string   { return e.Msg }
-func (e HTTPError) HTTPStatus() int { return e.Status }
+func (e HTTPError) Error() string     { return e.Msg }
+func (e HTTPError) HTTPStatus() int   { return e.Status }
+func (e HTTPError) ErrorCode() string { return e.Code }
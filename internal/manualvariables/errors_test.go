@@ -7,8 +7,9 @@ import (
 )
 
 func TestHTTPError(t *testing.T) {
-	err := HTTPError{Msg: "not found", Status: 404}
+	err := HTTPError{Msg: "not found", Status: 404, Code: "hub_not_found"}
 
 	assert.Equal(t, "not found", err.Error())
 	assert.Equal(t, 404, err.HTTPStatus())
+	assert.Equal(t, "hub_not_found", err.ErrorCode())
 }
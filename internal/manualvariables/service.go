@@ -3,16 +3,17 @@ package manualvariables
 import (
 	"net/http"
 
+	"github.com/mydecisive/mdai-gateway/internal/httputil"
 	"github.com/mydecisive/mdai-gateway/internal/valkey"
 )
 
 type ByHub map[string]map[string]string
 
 var (
-	ErrMissingQueryParams     = HTTPError{"missing hub or variable name", http.StatusBadRequest}
-	ErrNoManualVariablesFound = HTTPError{"no hubs with manual variables found", http.StatusNotFound}
-	ErrHubNotFound            = HTTPError{"hub not found", http.StatusNotFound}
-	ErrVariableNotFound       = HTTPError{"variable not found", http.StatusNotFound}
+	ErrMissingQueryParams     = HTTPError{"missing hub or variable name", http.StatusBadRequest, httputil.CodeMissingParameter}
+	ErrNoManualVariablesFound = HTTPError{"no hubs with manual variables found", http.StatusNotFound, httputil.CodeNoManualVariables}
+	ErrHubNotFound            = HTTPError{"hub not found", http.StatusNotFound, httputil.CodeHubNotFound}
+	ErrVariableNotFound       = HTTPError{"variable not found", http.StatusNotFound, httputil.CodeVariableNotFound}
 )
 
 func GetVarType(hubName string, varName string, hubsVariables ByHub) (valkey.VariableType, error) {
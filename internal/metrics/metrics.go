@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "mdai_gateway"
+
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// Registry holds every gateway metric along with the Go runtime and process collectors. It is kept apart from the
+// default registry so dependencies cannot leak their own metrics into /metrics.
+var Registry = newRegistry()
+
+var (
+	HTTPRequests = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests handled, by route pattern, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	HTTPRequestDuration = promauto.With(Registry).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of HTTP requests, by route pattern and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	EventsPublished = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "events",
+		Name:      "published_total",
+		Help:      "MdaiEvents published to NATS, by event source, hub and result (success or failure).",
+	}, []string{"source", "hub", "result"})
+
+	AuditInsertFailures = promauto.With(Registry).NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "audit",
+		Name:      "insert_failures_total",
+		Help:      "Audit entries that could not be written to Valkey.",
+	})
+
+	DeduperSkippedAlerts = promauto.With(Registry).NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "deduper",
+		Name:      "skipped_alerts_total",
+		Help:      "Alertmanager alerts skipped because a newer change of the same fingerprint was already processed.",
+	})
+
+	OpAMPCustomMessages = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "opamp",
+		Name:      "custom_messages_total",
+		Help:      "OpAMP custom messages received, by capability.",
+	}, []string{"capability"})
+)
+
+func newRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return registry
+}
+
+// Handler serves the metrics in Registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// RegisterDeduperSize exposes the number of alert fingerprints tracked by the deduper, as reported by size.
+func RegisterDeduperSize(size func() int) error {
+	return Registry.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "deduper",
+		Name:      "entries",
+		Help:      "Alert fingerprints currently tracked by the deduper.",
+	}, func() float64 {
+		return float64(size())
+	}))
+}
+
+// RegisterOpAMPConnectedAgents exposes the number of connected OpAMP agents, as reported by count.
+func RegisterOpAMPConnectedAgents(count func() int) error {
+	return Registry.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "opamp",
+		Name:      "connected_agents",
+		Help:      "OpAMP agents that sent a message recently.",
+	}, func() float64 {
+		return float64(count())
+	}))
+}
+
+// RegisterManualVariables exposes the number of hubs and manual variables per hub found in the ConfigMaps returned by
+// list, which is evaluated on every scrape.
+func RegisterManualVariables(list func() (map[string]map[string]string, error)) error {
+	return Registry.Register(newManualVariablesCollector(list))
+}
+
+type manualVariablesCollector struct {
+	list      func() (map[string]map[string]string, error)
+	hubs      *prometheus.Desc
+	variables *prometheus.Desc
+}
+
+func newManualVariablesCollector(list func() (map[string]map[string]string, error)) *manualVariablesCollector {
+	return &manualVariablesCollector{
+		list: list,
+		hubs: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "manual_variables", "hubs"),
+			"Hubs with manual variables.",
+			nil, nil,
+		),
+		variables: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "manual_variables", "count"),
+			"Manual variables defined for a hub.",
+			[]string{"hub"}, nil,
+		),
+	}
+}
+
+func (c *manualVariablesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hubs
+	ch <- c.variables
+}
+
+func (c *manualVariablesCollector) Collect(ch chan<- prometheus.Metric) {
+	hubs, err := c.list()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.hubs, err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.hubs, prometheus.GaugeValue, float64(len(hubs)))
+	for hub, variables := range hubs {
+		ch <- prometheus.MustNewConstMetric(c.variables, prometheus.GaugeValue, float64(len(variables)), hub)
+	}
+}
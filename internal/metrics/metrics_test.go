@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mydecisive/mdai-gateway/internal/httputil"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /variables/list/hub/{hubName}", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("GET /healthy", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+	// Middleware in between may hand the mux a request of its own, like tracing.Middleware does.
+	recorded := httputil.RecordRoute(mux)
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorded.ServeHTTP(w, r.WithContext(r.Context()))
+	}))
+
+	notFound := HTTPRequests.WithLabelValues("/variables/list/hub/{hubName}", http.MethodGet, "404")
+	ok := HTTPRequests.WithLabelValues("/healthy", http.MethodGet, "200")
+	unmatched := HTTPRequests.WithLabelValues(unmatchedRoute, http.MethodGet, "404")
+	before := []float64{testutil.ToFloat64(notFound), testutil.ToFloat64(ok), testutil.ToFloat64(unmatched)}
+
+	for _, path := range []string{"/variables/list/hub/a", "/variables/list/hub/b", "/healthy", "/nope"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, http.NoBody))
+	}
+
+	assert.InDelta(t, before[0]+2, testutil.ToFloat64(notFound), 0)
+	assert.InDelta(t, before[1]+1, testutil.ToFloat64(ok), 0)
+	assert.InDelta(t, before[2]+1, testutil.ToFloat64(unmatched), 0)
+}
+
+func TestManualVariablesCollector(t *testing.T) {
+	collector := newManualVariablesCollector(func() (map[string]map[string]string, error) {
+		return map[string]map[string]string{
+			"hub-a": {"x": "int", "y": "set"},
+			"hub-b": {"z": "map"},
+		}, nil
+	})
+
+	expected := `
+# HELP mdai_gateway_manual_variables_count Manual variables defined for a hub.
+# TYPE mdai_gateway_manual_variables_count gauge
+mdai_gateway_manual_variables_count{hub="hub-a"} 2
+mdai_gateway_manual_variables_count{hub="hub-b"} 1
+# HELP mdai_gateway_manual_variables_hubs Hubs with manual variables.
+# TYPE mdai_gateway_manual_variables_hubs gauge
+mdai_gateway_manual_variables_hubs 2
+`
+	require.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected)))
+}
+
+func TestManualVariablesCollector_Error(t *testing.T) {
+	collector := newManualVariablesCollector(func() (map[string]map[string]string, error) {
+		return nil, errors.New("informer not synced")
+	})
+
+	_, err := testutil.CollectAndLint(collector)
+	require.ErrorContains(t, err, "informer not synced")
+}
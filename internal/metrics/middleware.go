@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mydecisive/mdai-gateway/internal/httputil"
+)
+
+// unmatchedRoute labels requests that did not match any route, so arbitrary paths do not create new series.
+const unmatchedRoute = "unmatched"
+
+// Middleware records request counts and latency by route pattern, so the http.ServeMux it wraps must be wrapped in
+// httputil.RecordRoute.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := httputil.NewStatusRecorder(w)
+		r, matched := httputil.TrackRoute(r)
+
+		next.ServeHTTP(recorder, r)
+
+		// The method is already a label of its own.
+		route := matched.Path()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		HTTPRequests.WithLabelValues(route, r.Method, strconv.Itoa(recorder.Status())).Inc()
+		HTTPRequestDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
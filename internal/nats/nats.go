@@ -8,7 +8,7 @@ import (
 )
 
 func Init(ctx context.Context, logger *zap.Logger, clientName string) publisher.Publisher { //nolint:ireturn
-	eventPublisher, err := publisher.NewPublisher(ctx, logger, clientName)
+	eventPublisher, err := NewEventPublisher(ctx, logger, clientName)
 	if err != nil {
 		logger.Fatal("initialising event publisher: %v", zap.Error(err))
 	}
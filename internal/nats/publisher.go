@@ -0,0 +1,134 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/mydecisive/mdai-data-core/eventing"
+	"github.com/mydecisive/mdai-data-core/eventing/config"
+	"github.com/mydecisive/mdai-data-core/eventing/publisher"
+	"github.com/mydecisive/mdai-gateway/internal/health"
+	natsio "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.opentelemetry.io/otel"
+	"go.uber.org/zap"
+)
+
+// EventPublisher publishes MdaiEvents to JetStream with the same subjects and headers as the mdai-data-core
+// publisher, and additionally carries the W3C trace context of ctx (traceparent and tracestate headers) so consumers
+// such as the operator can continue the trace. The data-core publisher builds and sends its message in one step and
+// exposes neither a way to add headers nor its connection, which WatchVars and CheckHealth need, so it cannot be
+// wrapped; TestNewMsg_MatchesDataCore keeps the messages of both alike.
+type EventPublisher struct {
+	cfg    config.Config
+	logger *zap.Logger
+	conn   *natsio.Conn
+	js     jetstream.JetStream
+}
+
+var (
+	_ publisher.Publisher = (*EventPublisher)(nil)
+	_ health.Checker      = (*EventPublisher)(nil)
+)
+
+func NewEventPublisher(ctx context.Context, logger *zap.Logger, clientName string) (*EventPublisher, error) {
+	logger.Info("Initializing NATS publisher", zap.String("client_name", clientName))
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Logger = logger
+	cfg.ClientName = clientName
+
+	ctx, cancel := context.WithTimeout(ctx, config.NewSubscriberContextTimeout)
+	defer cancel()
+
+	conn, js, err := config.Connect(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the stream is set up here; consumer groups are created by the subscribers.
+	if err := config.EnsureStream(ctx, js, cfg); err != nil {
+		_ = conn.Drain()
+		return nil, fmt.Errorf("ensure stream: %w", err)
+	}
+
+	return &EventPublisher{cfg: cfg, logger: logger, conn: conn, js: js}, nil
+}
+
+func (p *EventPublisher) Publish(ctx context.Context, event eventing.MdaiEvent, subject eventing.MdaiEventSubject) error {
+	msg, err := newMsg(ctx, p.cfg.Subject, event, subject)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.js.PublishMsg(ctx, msg)
+	return err
+}
+
+// CheckHealth reports an error unless the NATS connection is established; publishes fail or buffer while it
+// reconnects.
+func (p *EventPublisher) CheckHealth(context.Context) error {
+	if status := p.conn.Status(); status != natsio.CONNECTED {
+		return fmt.Errorf("NATS connection is %s", status)
+	}
+	return nil
+}
+
+func (p *EventPublisher) Close() error {
+	if p.conn != nil && !p.conn.IsClosed() {
+		return p.conn.Drain()
+	}
+	return nil
+}
+
+func newMsg(ctx context.Context, prefix string, event eventing.MdaiEvent, subject eventing.MdaiEventSubject) (*natsio.Msg, error) {
+	event.ApplyDefaults()
+	if subject.Type == "" {
+		return nil, errors.New("subject is required")
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &natsio.Msg{
+		Subject: subject.PrefixedString(prefix),
+		Data:    data,
+		Header: natsio.Header{
+			"name":          []string{event.Name},
+			"source":        []string{event.Source},
+			"hubName":       []string{event.HubName},
+			natsio.MsgIdHdr: []string{event.ID},
+		},
+	}
+	if event.CorrelationID != "" {
+		msg.Header.Set("correlationId", event.CorrelationID)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier(msg.Header))
+	return msg, nil
+}
+
+// headerCarrier adapts NATS headers, whose keys are case-sensitive, to the OpenTelemetry propagators. Unlike
+// propagation.HeaderCarrier it keeps the lowercase "traceparent" key from the W3C specification.
+type headerCarrier natsio.Header
+
+func (c headerCarrier) Get(key string) string {
+	return natsio.Header(c).Get(key)
+}
+
+func (c headerCarrier) Set(key, value string) {
+	natsio.Header(c).Set(key, value)
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,84 @@
+package nats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mydecisive/mdai-data-core/eventing"
+	"github.com/mydecisive/mdai-data-core/eventing/publisher"
+	natsio "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+func TestNewMsg(t *testing.T) {
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(previous) })
+
+	spanCtx := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x01},
+		SpanID:     trace.SpanID{0x02},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(t.Context(), spanCtx)
+
+	event := eventing.MdaiEvent{
+		ID:            "id-1",
+		Name:          "var.set",
+		Source:        "manual",
+		HubName:       "hub",
+		CorrelationID: "corr-1",
+	}
+	subject := eventing.MdaiEventSubject{Type: eventing.VarEventType, Path: "hub.var"}
+
+	msg, err := newMsg(ctx, "eventing", event, subject)
+	require.NoError(t, err)
+
+	assert.Equal(t, "eventing."+subject.String(), msg.Subject)
+	assert.Equal(t, "id-1", msg.Header.Get("Nats-Msg-Id"))
+	assert.Equal(t, "hub", msg.Header.Get("hubName"))
+	assert.Equal(t, "corr-1", msg.Header.Get("correlationId"))
+	assert.Equal(t, "00-01000000000000000000000000000000-0200000000000000-01", msg.Header.Get("traceparent"))
+
+	_, err = newMsg(ctx, "eventing", event, eventing.MdaiEventSubject{})
+	require.Error(t, err)
+}
+
+// TestNewMsg_MatchesDataCore publishes the same event with the data-core publisher and EventPublisher, which must
+// send the same message but for the trace context.
+func TestNewMsg_MatchesDataCore(t *testing.T) {
+	p := newTestPublisher(t)
+	dataCore, err := publisher.NewPublisher(t.Context(), zap.NewNop(), "data-core-test")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = dataCore.Close() })
+
+	subject := eventing.MdaiEventSubject{Type: eventing.VarEventType, Path: "mdaihub-sample.data_string"}
+	sub, err := p.conn.SubscribeSync(subject.PrefixedString(p.cfg.Subject))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = sub.Unsubscribe() })
+	require.NoError(t, p.conn.Flush())
+
+	event, err := eventing.NewMdaiEvent("mdaihub-sample", "data_string", "string", "set", "on")
+	require.NoError(t, err)
+	event.CorrelationID = "corr-1"
+	require.NoError(t, dataCore.Publish(t.Context(), *event, subject))
+	// The data-core publisher fills in defaults on its own copy of the event.
+	event.ApplyDefaults()
+	require.NoError(t, p.Publish(t.Context(), *event, subject))
+
+	next := func() *natsio.Msg {
+		t.Helper()
+		msg, err := sub.NextMsg(5 * time.Second)
+		require.NoError(t, err)
+		return msg
+	}
+	want, got := next(), next()
+	assert.Equal(t, want.Subject, got.Subject)
+	assert.JSONEq(t, string(want.Data), string(got.Data))
+	assert.Equal(t, want.Header, got.Header)
+}
@@ -6,9 +6,15 @@ import (
 	"strconv"
 
 	"github.com/mydecisive/mdai-data-core/audit"
+	"github.com/mydecisive/mdai-data-core/eventing"
 	"github.com/mydecisive/mdai-data-core/eventing/publisher"
 	"github.com/mydecisive/mdai-gateway/internal/adapter"
 	auditutils "github.com/mydecisive/mdai-gateway/internal/audit"
+	"github.com/mydecisive/mdai-gateway/internal/metrics"
+	"github.com/mydecisive/mdai-gateway/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -20,9 +26,16 @@ func PublishEvents(ctx context.Context, logger *zap.Logger, p publisher.Publishe
 
 	for _, eventPerSubject := range eventsPerSubjects {
 		event := eventPerSubject.Event
-		err := p.Publish(ctx, event, eventPerSubject.Subject)
+		err := publish(ctx, p, event, eventPerSubject.Subject)
+
+		result := metrics.ResultSuccess
+		if err != nil {
+			result = metrics.ResultFailure
+		}
+		metrics.EventsPublished.WithLabelValues(event.Source, event.HubName, result).Inc()
 
 		if auditErr := auditutils.RecordAuditEventFromMdaiEvent(ctx, logger, auditAdapter, event, err == nil); auditErr != nil {
+			metrics.AuditInsertFailures.Inc()
 			logger.Error("Failed to write audit event for automation step",
 				zap.String("hubName", event.HubName),
 				zap.String("name", event.Name),
@@ -47,3 +60,22 @@ func PublishEvents(ctx context.Context, logger *zap.Logger, p publisher.Publishe
 
 	return successCount, errors.Join(errs...)
 }
+
+// publish sends event within a producer span, whose context the publisher can propagate to consumers.
+func publish(ctx context.Context, p publisher.Publisher, event eventing.MdaiEvent, subject eventing.MdaiEventSubject) error {
+	ctx, span := tracing.Tracer().Start(ctx, "publish "+subject.String(),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("nats"),
+			semconv.MessagingDestinationName(subject.String()),
+			semconv.MessagingMessageID(event.ID),
+			attribute.String("mdai.event.name", event.Name),
+			attribute.String("mdai.event.source", event.Source),
+			attribute.String("mdai.hub_name", event.HubName),
+			attribute.String("mdai.correlation_id", event.CorrelationID),
+		),
+	)
+	err := p.Publish(ctx, event, subject)
+	tracing.End(span, err)
+	return err
+}
@@ -16,6 +16,11 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/valkey-io/valkey-go"
 	valkeymock "github.com/valkey-io/valkey-go/mock"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 	"go.uber.org/mock/gomock"
 	"go.uber.org/zap"
 )
@@ -142,7 +147,9 @@ func TestPublishEvents(t *testing.T) {
 		ctx, cancel := context.WithCancel(t.Context())
 		cancel() // cancel immediately
 
-		mockPub.On("Publish", ctx, event, subject).Return(ctx.Err()).Once()
+		mockPub.On("Publish", mock.MatchedBy(func(c context.Context) bool {
+			return errors.Is(c.Err(), context.Canceled)
+		}), event, subject).Return(ctx.Err()).Once()
 
 		success, err := PublishEvents(ctx, logger, mockPub, []adapter.EventPerSubject{{Event: event, Subject: subject}}, auditAdapter)
 		require.ErrorIs(t, err, context.Canceled)
@@ -150,4 +157,26 @@ func TestPublishEvents(t *testing.T) {
 
 		mockPub.AssertExpectations(t)
 	})
+
+	t.Run("traced", func(t *testing.T) {
+		exporter := tracetest.NewInMemoryExporter()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+		otel.SetTracerProvider(provider)
+		t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+		mockPub := &mocks.MockPublisher{}
+		mockPub.On("Publish", mock.MatchedBy(func(c context.Context) bool {
+			return trace.SpanContextFromContext(c).IsValid()
+		}), event, subject).Return(nil).Once()
+
+		_, err := PublishEvents(ctx, logger, mockPub, []adapter.EventPerSubject{{Event: event, Subject: subject}}, auditAdapter)
+		require.NoError(t, err)
+		mockPub.AssertExpectations(t)
+
+		names := make([]string, 0, 2)
+		for _, span := range exporter.GetSpans() {
+			names = append(names, span.Name)
+		}
+		assert.ElementsMatch(t, []string{"publish " + subject.String(), "audit insert"}, names)
+	})
 }
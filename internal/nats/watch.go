@@ -0,0 +1,77 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/mydecisive/mdai-data-core/eventing"
+	"github.com/mydecisive/mdai-data-core/eventing/config"
+	natsio "github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+// watchBuffer is how many variable events a watcher may fall behind before its watch is ended.
+const watchBuffer = 256
+
+// WatchVars streams the variable events published from now on for hubName and varName, either of which may be empty
+// to match any. It subscribes to the subjects of the events without consuming them from the stream, which is a work
+// queue for the operator. The channel is closed when ctx is done, or early when the receiver falls behind by more
+// than watchBuffer events.
+func (p *EventPublisher) WatchVars(ctx context.Context, hubName, varName string) (<-chan eventing.MdaiEvent, error) {
+	events := make(chan eventing.MdaiEvent, watchBuffer)
+	var (
+		mu     sync.Mutex
+		closed bool
+	)
+	// stop is called with mu held.
+	stop := func(sub *natsio.Subscription) {
+		if closed {
+			return
+		}
+		closed = true
+		_ = sub.Unsubscribe()
+		close(events)
+	}
+
+	sub, err := p.conn.Subscribe(varsFilterSubject(p.cfg.Subject, hubName, varName), func(msg *natsio.Msg) {
+		var event eventing.MdaiEvent
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			p.logger.Warn("Skipping undecodable variable event", zap.String("subject", msg.Subject), zap.Error(err))
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return
+		}
+		select {
+		case events <- event:
+		default:
+			p.logger.Warn("Ending variable watch that fell behind", zap.Int("buffer", watchBuffer))
+			stop(msg.Sub)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	context.AfterFunc(ctx, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		stop(sub)
+	})
+	return events, nil
+}
+
+// varsFilterSubject matches the subjects variable events are published to, as built by the handlers.
+func varsFilterSubject(prefix, hubName, varName string) string {
+	hubToken, varToken := "*", "*"
+	if hubName != "" {
+		hubToken = config.SafeToken(hubName)
+	}
+	if varName != "" {
+		varToken = config.SafeToken(varName)
+	}
+	return eventing.NewMdaiEventSubject(eventing.VarEventType, hubToken+"."+varToken).PrefixedString(prefix)
+}
@@ -0,0 +1,74 @@
+package nats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mydecisive/mdai-data-core/eventing"
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestPublisher(t *testing.T) *EventPublisher {
+	t.Helper()
+	ns, err := natsserver.NewServer(&natsserver.Options{JetStream: true, StoreDir: t.TempDir(), Port: -1})
+	require.NoError(t, err)
+	go ns.Start()
+	require.True(t, ns.ReadyForConnections(5*time.Second), "nats-server did not start")
+	t.Cleanup(ns.Shutdown)
+	t.Setenv("NATS_URL", ns.ClientURL())
+
+	p, err := NewEventPublisher(t.Context(), zap.NewNop(), "watch-test")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = p.Close() })
+	return p
+}
+
+func publishVar(t *testing.T, p *EventPublisher, varName, value string) {
+	t.Helper()
+	event, err := eventing.NewMdaiEvent("mdaihub-sample", varName, "string", "add", value)
+	require.NoError(t, err)
+	require.NoError(t, p.Publish(t.Context(), *event, eventing.MdaiEventSubject{Type: eventing.VarEventType, Path: "mdaihub-sample." + varName}))
+}
+
+func receive(t *testing.T, events <-chan eventing.MdaiEvent) eventing.MdaiEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "no variable event received")
+		return eventing.MdaiEvent{}
+	}
+}
+
+func TestWatchVars(t *testing.T) {
+	p := newTestPublisher(t)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	events, err := p.WatchVars(ctx, "mdaihub-sample", "data_string")
+	require.NoError(t, err)
+
+	publishVar(t, p, "other", "ignored")
+	publishVar(t, p, "data_string", "first")
+	first := receive(t, events)
+	assert.Equal(t, "mdaihub-sample", first.HubName)
+	assert.Contains(t, first.Payload, `"first"`)
+
+	cancel()
+	select {
+	case _, ok := <-events:
+		assert.False(t, ok)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "watch was not stopped")
+	}
+}
+
+func TestVarsFilterSubject(t *testing.T) {
+	assert.Equal(t, "eventing.var.*.*", varsFilterSubject("eventing", "", ""))
+	assert.Equal(t, "eventing.var.mdaihub-sample.*", varsFilterSubject("eventing", "mdaihub-sample", ""))
+	assert.Equal(t, "eventing.var.mdaihub-sample.data_string", varsFilterSubject("eventing", "mdaihub-sample", "data_string"))
+}
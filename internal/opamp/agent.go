@@ -2,6 +2,7 @@ package opamp
 
 import (
 	"sync"
+	"time"
 )
 
 type opAMPAgentInfo struct {
@@ -14,14 +15,36 @@ type opAMPAgentInfo struct {
 type opAMPConnectedAgents struct {
 	mu          sync.Mutex
 	agentInfoes map[string]opAMPAgentInfo
+	lastSeen    map[string]time.Time
 }
 
 func newOpAMPConnectedAgents() *opAMPConnectedAgents {
 	return &opAMPConnectedAgents{
 		agentInfoes: make(map[string]opAMPAgentInfo),
+		lastSeen:    make(map[string]time.Time),
 	}
 }
 
+func (ca *opAMPConnectedAgents) touch(id string, now time.Time) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	ca.lastSeen[id] = now
+}
+
+// countActive returns the number of agents seen after since and forgets the others.
+func (ca *opAMPConnectedAgents) countActive(since time.Time) int {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	for id, seen := range ca.lastSeen {
+		if seen.Before(since) {
+			delete(ca.lastSeen, id)
+		}
+	}
+	return len(ca.lastSeen)
+}
+
 func (ca *opAMPConnectedAgents) setAgentDescription(id string, agent opAMPAgentInfo) {
 	ca.mu.Lock()
 	defer ca.mu.Unlock()
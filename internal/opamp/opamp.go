@@ -7,16 +7,27 @@ import (
 	"fmt"
 	"net/http"
 	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/mydecisive/mdai-data-core/audit"
 	"github.com/mydecisive/mdai-data-core/eventing"
 	"github.com/mydecisive/mdai-data-core/eventing/publisher"
 	"github.com/mydecisive/mdai-gateway/internal/adapter"
+	auditutils "github.com/mydecisive/mdai-gateway/internal/audit"
+	"github.com/mydecisive/mdai-gateway/internal/auth"
+	"github.com/mydecisive/mdai-gateway/internal/config"
+	"github.com/mydecisive/mdai-gateway/internal/metrics"
 	"github.com/mydecisive/mdai-gateway/internal/nats"
+	"github.com/mydecisive/mdai-gateway/internal/tracing"
 	"github.com/open-telemetry/opamp-go/protobufs"
 	"github.com/open-telemetry/opamp-go/server"
 	"github.com/open-telemetry/opamp-go/server/types"
 	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -29,6 +40,10 @@ const (
 	hubNameNonIdentifyingAttributeKey           = "hub_name"
 	instanceIDIdentifyingAttributeKey           = "service.instance.id"
 	replayStatusVariableNonIdentifyingAttribute = "replay_status_variable"
+
+	// agentActivityWindow is how long an agent counts as connected after its last message; OpAMP HTTP clients poll
+	// every 30 seconds by default.
+	agentActivityWindow = 2 * time.Minute
 )
 
 type OpAMPControlServer struct {
@@ -40,11 +55,55 @@ type OpAMPControlServer struct {
 	srv             server.OpAMPServer
 	logUnmarshaler  plog.ProtoUnmarshaler
 
+	inFlight *inFlightMessages
+	draining *atomic.Bool
+
 	HandlerFunc http.HandlerFunc
 	ConnContext server.ConnContext
 }
 
-func NewOpAMPControlServer(logger *zap.Logger, auditAdapter *audit.AuditAdapter, eventPublisher publisher.Publisher) (*OpAMPControlServer, error) {
+// inFlightMessages counts the messages being handled, so Stop can wait for them without holding up the messages agents
+// on accepted connections still send meanwhile.
+type inFlightMessages struct {
+	mu    sync.Mutex
+	count int
+	// idle is closed when count drops to zero, once Stop waits for it.
+	idle chan struct{}
+}
+
+func (m *inFlightMessages) start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.count++
+}
+
+func (m *inFlightMessages) done() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.count--
+	if m.count == 0 && m.idle != nil {
+		close(m.idle)
+		m.idle = nil
+	}
+}
+
+// drained returns a channel that is closed once no message is being handled.
+func (m *inFlightMessages) drained() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.idle != nil {
+		return m.idle
+	}
+	idle := make(chan struct{})
+	if m.count == 0 {
+		close(idle)
+	} else {
+		m.idle = idle
+	}
+	return idle
+}
+
+func NewOpAMPControlServer(logger *zap.Logger, cfg config.OpAMP, auditAdapter *audit.AuditAdapter, eventPublisher publisher.Publisher) (*OpAMPControlServer, error) {
 	opampServer := server.New(nil)
 	ctrl := &OpAMPControlServer{
 		logger:          logger,
@@ -53,10 +112,19 @@ func NewOpAMPControlServer(logger *zap.Logger, auditAdapter *audit.AuditAdapter,
 		connectedAgents: newOpAMPConnectedAgents(),
 		srv:             opampServer,
 		logUnmarshaler:  plog.ProtoUnmarshaler{},
+		inFlight:        &inFlightMessages{mu: sync.Mutex{}, count: 0, idle: nil},
+		draining:        &atomic.Bool{},
 	}
 	settings := server.Settings{
+		EnableCompression: cfg.EnableCompression,
 		Callbacks: types.Callbacks{
 			OnConnecting: func(r *http.Request) types.ConnectionResponse {
+				if ctrl.draining.Load() {
+					return types.ConnectionResponse{
+						Accept:         false,
+						HTTPStatusCode: http.StatusServiceUnavailable,
+					}
+				}
 				return types.ConnectionResponse{
 					Accept: true,
 					ConnectionCallbacks: types.ConnectionCallbacks{
@@ -72,17 +140,73 @@ func NewOpAMPControlServer(logger *zap.Logger, auditAdapter *audit.AuditAdapter,
 	return ctrl, err
 }
 
+// Stop rejects new OpAMP connections and waits for in-flight messages to be handled
+// before stopping the underlying OpAMP server, or until ctx is done.
+func (ctrl *OpAMPControlServer) Stop(ctx context.Context) error {
+	ctrl.draining.Store(true)
+
+	select {
+	case <-ctrl.inFlight.drained():
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for in-flight OpAMP messages: %w", ctx.Err())
+	}
+
+	return ctrl.srv.Stop(ctx)
+}
+
+// CheckHealth reports an error unless the OpAMP handler is attached and accepting agents.
+func (ctrl *OpAMPControlServer) CheckHealth(context.Context) error {
+	if ctrl.HandlerFunc == nil || ctrl.ConnContext == nil {
+		return errors.New("OpAMP server is not attached")
+	}
+	if ctrl.draining.Load() {
+		return errors.New("OpAMP server is draining")
+	}
+	return nil
+}
+
+// ConnectedAgents returns the number of agents that sent a message within the last agentActivityWindow. Agents poll
+// over plain HTTP, so there is no long-lived connection to count.
+func (ctrl *OpAMPControlServer) ConnectedAgents() int {
+	return ctrl.connectedAgents.countActive(time.Now().Add(-agentActivityWindow))
+}
+
 // TODO: Write tests for this if it sticks around in this form.
 func (ctrl *OpAMPControlServer) onMessage(ctx context.Context, conn types.Connection, msg *protobufs.AgentToServer) *protobufs.ServerToAgent {
+	ctrl.inFlight.start()
+	defer ctrl.inFlight.done()
+
 	uid := string(msg.GetInstanceUid())
+	ctrl.connectedAgents.touch(uid, time.Now())
+
+	ctx, span := tracing.Tracer().Start(ctx, "opamp message", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+	span.SetAttributes(attribute.String("opamp.instance_uid", fmt.Sprintf("%x", msg.GetInstanceUid())))
+	if msg.GetCustomMessage() != nil {
+		span.SetAttributes(attribute.String("opamp.custom_message.capability", msg.GetCustomMessage().GetCapability()))
+	}
+
+	// Agents connecting with a verified client certificate are recorded as the caller of the events they trigger.
+	if conn != nil {
+		if identity, ok := auth.IdentityFromConn(conn.Connection()); ok {
+			ctx = auth.WithIdentity(ctx, identity)
+			ctx = auditutils.WithFields(ctx, map[string]string{"caller": identity.Name})
+		}
+	}
 
 	if foundAgent, ok := harvestAgentInfoesFromAgentDescription(msg); ok {
 		ctrl.connectedAgents.setAgentDescription(uid, foundAgent)
 	}
 
+	if msg.GetCustomMessage() != nil {
+		metrics.OpAMPCustomMessages.WithLabelValues(msg.GetCustomMessage().GetCapability()).Inc()
+	}
+
 	if msg.GetCustomMessage() != nil && msg.GetCustomMessage().GetCapability() == s3ReceiverCapabilityKey {
 		if err := ctrl.handleS3ReceiverMessage(ctx, uid, msg); err != nil {
 			ctrl.logger.Warn("Failed to handle S3 receiver message", zap.Error(err))
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
 		}
 	}
 
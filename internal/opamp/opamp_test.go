@@ -2,10 +2,14 @@ package opamp
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/mydecisive/mdai-data-core/audit"
 	"github.com/mydecisive/mdai-data-core/eventing"
+	"github.com/mydecisive/mdai-gateway/internal/config"
 	"github.com/open-telemetry/opamp-go/protobufs"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -56,7 +60,7 @@ func setupMocks(t *testing.T) OpampDeps {
 		received: &[]map[string]string{},
 	}
 
-	opampServer, _ := NewOpAMPControlServer(zap.NewNop(), auditAdapter, eventPublisher)
+	opampServer, _ := NewOpAMPControlServer(zap.NewNop(), config.Default().OpAMP, auditAdapter, eventPublisher)
 
 	deps := OpampDeps{
 		MockPublisher: eventPublisher,
@@ -336,3 +340,37 @@ func TestDigForCompletionAndExecuteHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestStop(t *testing.T) {
+	deps := setupMocks(t)
+	opampServer := deps.OpAmpServer
+
+	// Simulate a message that is still being handled.
+	opampServer.inFlight.start()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, opampServer.Stop(ctx), context.DeadlineExceeded)
+
+	// Agents on accepted connections are still handled while draining.
+	assert.NotNil(t, opampServer.onMessage(t.Context(), nil, &protobufs.AgentToServer{}))
+
+	// New connections are rejected while draining.
+	rr := httptest.NewRecorder()
+	opampServer.HandlerFunc(rr, httptest.NewRequest(http.MethodPost, "/opamp", http.NoBody))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+	opampServer.inFlight.done()
+	require.NoError(t, opampServer.Stop(t.Context()))
+}
+
+func TestConnectedAgents_CountActive(t *testing.T) {
+	agents := newOpAMPConnectedAgents()
+	now := time.Now()
+
+	agents.touch("stale", now.Add(-time.Hour))
+	agents.touch("fresh", now)
+
+	assert.Equal(t, 1, agents.countActive(now.Add(-agentActivityWindow)))
+	assert.NotContains(t, agents.lastSeen, "stale")
+}
@@ -0,0 +1,81 @@
+package requestid
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	RequestIDHeader     = "X-Request-ID"
+	CorrelationIDHeader = "X-Correlation-ID"
+
+	// maxIDLength bounds caller-provided IDs, which end up in logs, audit records and event payloads.
+	maxIDLength = 128
+)
+
+// IDs identify a single HTTP request and the wider operation it belongs to. The correlation ID is shared by every
+// request and MdaiEvent of one operation, e.g. a UI click and the variable updates it triggers.
+type IDs struct {
+	RequestID     string
+	CorrelationID string
+}
+
+type idsContextKey struct{}
+
+func WithIDs(ctx context.Context, ids IDs) context.Context {
+	return context.WithValue(ctx, idsContextKey{}, ids)
+}
+
+// FromContext returns the IDs attached by Middleware, if any.
+func FromContext(ctx context.Context) (IDs, bool) {
+	ids, ok := ctx.Value(idsContextKey{}).(IDs)
+	return ids, ok
+}
+
+// Logger returns logger annotated with the request and correlation IDs from ctx.
+func Logger(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	ids, ok := FromContext(ctx)
+	if !ok {
+		return logger
+	}
+	return logger.With(zap.String("requestId", ids.RequestID), zap.String("correlationId", ids.CorrelationID))
+}
+
+// Middleware accepts the X-Request-ID and X-Correlation-ID headers of a request or generates them when they are
+// missing or malformed, attaches them to the request context and echoes them in the response. A request without a
+// correlation ID starts a new operation identified by its request ID.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids := IDs{
+			RequestID:     r.Header.Get(RequestIDHeader),
+			CorrelationID: r.Header.Get(CorrelationIDHeader),
+		}
+		if !valid(ids.RequestID) {
+			ids.RequestID = uuid.NewString()
+		}
+		if !valid(ids.CorrelationID) {
+			ids.CorrelationID = ids.RequestID
+		}
+
+		w.Header().Set(RequestIDHeader, ids.RequestID)
+		w.Header().Set(CorrelationIDHeader, ids.CorrelationID)
+
+		next.ServeHTTP(w, r.WithContext(WithIDs(r.Context(), ids)))
+	})
+}
+
+// valid accepts non-empty IDs made of printable ASCII without spaces, so they are safe to log and to use in headers.
+func valid(id string) bool {
+	if id == "" || len(id) > maxIDLength {
+		return false
+	}
+	for i := range len(id) {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
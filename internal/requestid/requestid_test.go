@@ -0,0 +1,93 @@
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name              string
+		headers           map[string]string
+		wantRequestID     string
+		wantCorrelationID string
+	}{
+		{
+			name:              "both provided",
+			headers:           map[string]string{RequestIDHeader: "req-1", CorrelationIDHeader: "ui-click-42"},
+			wantRequestID:     "req-1",
+			wantCorrelationID: "ui-click-42",
+		},
+		{
+			name:              "request ID starts a new correlation",
+			headers:           map[string]string{RequestIDHeader: "req-1"},
+			wantRequestID:     "req-1",
+			wantCorrelationID: "req-1",
+		},
+		{
+			name:              "correlation ID only",
+			headers:           map[string]string{CorrelationIDHeader: "ui-click-42"},
+			wantCorrelationID: "ui-click-42",
+		},
+		{
+			name:    "none provided",
+			headers: map[string]string{},
+		},
+		{
+			name:    "malformed IDs are replaced",
+			headers: map[string]string{RequestIDHeader: "bad id\x7f", CorrelationIDHeader: strings.Repeat("x", maxIDLength+1)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got IDs
+			handler := Middleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				var ok bool
+				got, ok = FromContext(r.Context())
+				require.True(t, ok)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if tt.wantRequestID != "" {
+				assert.Equal(t, tt.wantRequestID, got.RequestID)
+			} else {
+				assert.NoError(t, uuid.Validate(got.RequestID))
+			}
+			if tt.wantCorrelationID != "" {
+				assert.Equal(t, tt.wantCorrelationID, got.CorrelationID)
+			} else {
+				assert.Equal(t, got.RequestID, got.CorrelationID)
+			}
+			assert.Equal(t, got.RequestID, rr.Header().Get(RequestIDHeader))
+			assert.Equal(t, got.CorrelationID, rr.Header().Get(CorrelationIDHeader))
+		})
+	}
+}
+
+func TestLogger(t *testing.T) {
+	core, observed := observer.New(zap.InfoLevel)
+	logger := zap.New(core)
+
+	Logger(t.Context(), logger).Info("without IDs")
+	Logger(WithIDs(t.Context(), IDs{RequestID: "req-1", CorrelationID: "corr-1"}), logger).Info("with IDs")
+
+	logs := observed.All()
+	require.Len(t, logs, 2)
+	assert.Empty(t, logs[0].ContextMap())
+	assert.Equal(t, map[string]any{"requestId": "req-1", "correlationId": "corr-1"}, logs[1].ContextMap())
+}
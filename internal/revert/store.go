@@ -0,0 +1,131 @@
+package revert
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/mydecisive/mdai-gateway/internal/duequeue"
+	"github.com/valkey-io/valkey-go"
+)
+
+// key holds the pending reverts, see duequeue.Queue.
+const key = "gateway/pending-reverts"
+
+var ErrNotFound = errors.New("pending revert not found")
+
+// Revert is an update scheduled to undo a temporary variable write once its TTL expires.
+type Revert struct {
+	ID   string          `json:"id"`
+	Hub  string          `json:"hub"`
+	Var  string          `json:"var"`
+	Op   string          `json:"op"`
+	Data json.RawMessage `json:"data,omitempty"`
+	// EventID is the ID of the event published by the write being reverted.
+	EventID string `json:"eventId"`
+	// CorrelationID is that of the write; the revert event and its audit entry keep it.
+	CorrelationID string    `json:"correlationId"`
+	Caller        string    `json:"caller,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+	DueAt         time.Time `json:"dueAt"`
+}
+
+// Claim is a due revert claimed by Store.Due.
+type Claim struct {
+	Revert
+	claim duequeue.Claim
+}
+
+// Store keeps pending reverts in a duequeue.Queue, due at their DueAt.
+type Store struct {
+	queue *duequeue.Queue
+}
+
+func NewStore(client valkey.Client) *Store {
+	return &Store{queue: duequeue.New(client, key, "pending revert")}
+}
+
+func (s *Store) Add(ctx context.Context, r Revert) error {
+	record, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.queue.Put(ctx, r.ID, record, r.DueAt)
+}
+
+// List returns every pending revert, soonest first.
+func (s *Store) List(ctx context.Context) ([]Revert, error) {
+	records, err := s.queue.Records(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reverts := make([]Revert, 0, len(records))
+	for _, record := range records {
+		var r Revert
+		if err := json.Unmarshal([]byte(record), &r); err != nil {
+			return nil, fmt.Errorf("failed to decode pending revert: %w", err)
+		}
+		reverts = append(reverts, r)
+	}
+	slices.SortFunc(reverts, func(a, b Revert) int {
+		return cmp.Or(a.DueAt.Compare(b.DueAt), cmp.Compare(a.ID, b.ID))
+	})
+	return reverts, nil
+}
+
+func (s *Store) Get(ctx context.Context, id string) (Revert, error) {
+	return decode(s.queue.Get(ctx, id))
+}
+
+// Remove takes a pending revert out of the store, so it is not applied. Only one caller wins when several remove the
+// same revert concurrently; the others get ErrNotFound.
+func (s *Store) Remove(ctx context.Context, id string) (Revert, error) {
+	return decode(s.queue.Remove(ctx, id))
+}
+
+// Due claims the reverts due at now, see duequeue.Queue.Claim. The caller applies each and then calls Done, or Retry
+// if applying failed.
+func (s *Store) Due(ctx context.Context, now time.Time) ([]Claim, error) {
+	claims, err := s.queue.Claim(ctx, now)
+	due := make([]Claim, 0, len(claims))
+	var errs []error
+	for _, claim := range claims {
+		r, decodeErr := decode(claim.Record, nil)
+		if decodeErr != nil {
+			errs = append(errs, decodeErr)
+			continue
+		}
+		due = append(due, Claim{Revert: r, claim: claim})
+	}
+	return due, errors.Join(append(errs, err)...)
+}
+
+// Done removes a claimed revert once it is applied. It reports false when the revert was cancelled or claimed again
+// in the meantime.
+func (s *Store) Done(ctx context.Context, c Claim) (bool, error) {
+	return s.queue.Done(ctx, c.claim)
+}
+
+// Retry gives up a claim, making the revert due on the next poll.
+func (s *Store) Retry(ctx context.Context, c Claim) error {
+	_, err := s.queue.Release(ctx, c.claim, c.claim.At)
+	return err
+}
+
+func decode(record string, err error) (Revert, error) {
+	if errors.Is(err, duequeue.ErrNotFound) {
+		return Revert{}, ErrNotFound
+	}
+	if err != nil {
+		return Revert{}, err
+	}
+	var r Revert
+	if err := json.Unmarshal([]byte(record), &r); err != nil {
+		return Revert{}, fmt.Errorf("failed to decode pending revert: %w", err)
+	}
+	return r, nil
+}
@@ -0,0 +1,103 @@
+package revert
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mydecisive/mdai-gateway/internal/duequeue/duequeuetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	valkeymock "github.com/valkey-io/valkey-go/mock"
+	"go.uber.org/mock/gomock"
+)
+
+func newTestRevert(t *testing.T, id string, dueAt time.Time) (Revert, string) {
+	t.Helper()
+	r := Revert{
+		ID:            id,
+		Hub:           "mdaihub-sample",
+		Var:           "manual_filter",
+		Op:            "remove",
+		Data:          json.RawMessage(`["noisy-service"]`),
+		EventID:       "event-" + id,
+		CorrelationID: "incident-7",
+		Caller:        "oncall",
+		CreatedAt:     dueAt.Add(-2 * time.Hour),
+		DueAt:         dueAt,
+	}
+	record, err := json.Marshal(r)
+	require.NoError(t, err)
+	return r, string(record)
+}
+
+func TestStore_Add(t *testing.T) {
+	client := valkeymock.NewClient(gomock.NewController(t))
+	dueAt := time.Date(2025, 7, 19, 12, 0, 0, 0, time.UTC)
+	r, _ := newTestRevert(t, "r1", dueAt)
+
+	var stored Revert
+	duequeuetest.ExpectPut(client, &stored)
+
+	require.NoError(t, NewStore(client).Add(t.Context(), r))
+	assert.Equal(t, r, stored)
+}
+
+func TestStore_List(t *testing.T) {
+	client := valkeymock.NewClient(gomock.NewController(t))
+	now := time.Date(2025, 7, 19, 12, 0, 0, 0, time.UTC)
+	later, laterRecord := newTestRevert(t, "r2", now.Add(time.Hour))
+	sooner, soonerRecord := newTestRevert(t, "r1", now)
+
+	client.EXPECT().Do(gomock.Any(), valkeymock.Match("HVALS", key)).
+		Return(valkeymock.Result(valkeymock.ValkeyArray(valkeymock.ValkeyBlobString(laterRecord), valkeymock.ValkeyBlobString(soonerRecord))))
+
+	reverts, err := NewStore(client).List(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, []Revert{sooner, later}, reverts)
+}
+
+func TestStore_Remove(t *testing.T) {
+	client := valkeymock.NewClient(gomock.NewController(t))
+	r, record := newTestRevert(t, "r1", time.Date(2025, 7, 19, 12, 0, 0, 0, time.UTC))
+	store := NewStore(client)
+
+	t.Run("pending", func(t *testing.T) {
+		client.EXPECT().Do(gomock.Any(), duequeuetest.Script{key, key + "/due", key + "/claimed", "r1"}).Return(valkeymock.Result(valkeymock.ValkeyBlobString(record)))
+
+		removed, err := store.Remove(t.Context(), "r1")
+		require.NoError(t, err)
+		assert.Equal(t, r, removed)
+	})
+
+	t.Run("already removed", func(t *testing.T) {
+		client.EXPECT().Do(gomock.Any(), duequeuetest.Script{key, key + "/due", key + "/claimed", "r1"}).Return(valkeymock.Result(valkeymock.ValkeyNil()))
+
+		_, err := store.Remove(t.Context(), "r1")
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestStore_Get_NotFound(t *testing.T) {
+	client := valkeymock.NewClient(gomock.NewController(t))
+	client.EXPECT().Do(gomock.Any(), valkeymock.Match("HGET", key, "missing")).Return(valkeymock.Result(valkeymock.ValkeyNil()))
+
+	_, err := NewStore(client).Get(t.Context(), "missing")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestStore_Due(t *testing.T) {
+	client := valkeymock.NewClient(gomock.NewController(t))
+	now := time.Date(2025, 7, 19, 12, 0, 0, 0, time.UTC)
+	r, record := newTestRevert(t, "r1", now)
+
+	client.EXPECT().Do(gomock.Any(), valkeymock.Match("ZRANGEBYSCORE", key+"/due", "-inf", "1752926400000", "WITHSCORES")).
+		Return(valkeymock.Result(valkeymock.ValkeyArray(valkeymock.ValkeyBlobString("r1"), valkeymock.ValkeyBlobString("1752926400000"))))
+	client.EXPECT().Do(gomock.Any(), duequeuetest.Script{key, key + "/due", key + "/claimed", "r1", "1752926400000", "1752926460000"}).
+		Return(valkeymock.Result(valkeymock.ValkeyArray(valkeymock.ValkeyBlobString(record), valkeymock.ValkeyBlobString("1752926400000"))))
+
+	due, err := NewStore(client).Due(t.Context(), now)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, r, due[0].Revert)
+}
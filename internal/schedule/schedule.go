@@ -0,0 +1,254 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // schedules name IANA timezones, which the container image may not ship
+
+	"github.com/mydecisive/mdai-gateway/internal/valkey"
+	"github.com/robfig/cron/v3"
+)
+
+// maxCatchUp bounds how many missed firings of one transition Latest walks through, e.g. after a long outage.
+const maxCatchUp = 100_000
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Window is a recurring time range, e.g. weekdays from 09:00 to 18:00. A window whose end is not after its start
+// spans midnight and ends on the day after it starts.
+type Window struct {
+	// Days are "mon" to "sun"; empty means every day.
+	Days  []string `json:"days,omitempty"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+}
+
+// Transition applies its update each time Cron, a five-field cron expression, fires.
+type Transition struct {
+	Cron string `json:"cron"`
+	valkey.Update
+}
+
+// Spec is what callers declare: the variable to change and when. A schedule is either a Window, applying Inside when
+// it starts and Outside (if any) when it ends, or a list of cron Transitions.
+type Spec struct {
+	Name string `json:"name,omitempty"`
+	Hub  string `json:"hub"`
+	Var  string `json:"var"`
+	// Timezone is an IANA name such as "Europe/Berlin" that times are read in. Empty means UTC.
+	Timezone    string         `json:"timezone,omitempty"`
+	Window      *Window        `json:"window,omitempty"`
+	Inside      *valkey.Update `json:"inside,omitempty"`
+	Outside     *valkey.Update `json:"outside,omitempty"`
+	Transitions []Transition   `json:"transitions,omitempty"`
+}
+
+// Schedule is a stored Spec.
+type Schedule struct {
+	ID string `json:"id"`
+	Spec
+	// Caller created or last replaced the schedule; the events it publishes are audited on their behalf.
+	Caller    string    `json:"caller,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Plan is a validated Spec, ready to tell when its transitions fire.
+type Plan struct {
+	triggers []trigger
+}
+
+type trigger struct {
+	schedule cron.Schedule
+	update   valkey.Update
+}
+
+// Plan validates s and compiles its transitions. Errors describe what is wrong with the spec; whether the updates fit
+// the variable is left to the caller.
+func (s Spec) Plan() (*Plan, error) {
+	var errs []error
+	if s.Hub == "" || s.Var == "" {
+		errs = append(errs, errors.New("hub and var are required"))
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("unknown timezone %q", s.Timezone))
+		loc = time.UTC
+	}
+
+	transitions, err := s.transitions()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	plan := &Plan{triggers: make([]trigger, 0, len(transitions))}
+	now := time.Now()
+	for i, transition := range transitions {
+		parsed, err := parseCron(transition.Cron, loc)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("transitions[%d]: %w", i, err))
+			continue
+		}
+		if parsed.Next(now).IsZero() {
+			errs = append(errs, fmt.Errorf("transitions[%d]: cron %q never fires", i, transition.Cron))
+			continue
+		}
+		if transition.Command == "" {
+			errs = append(errs, fmt.Errorf("transitions[%d]: op is required", i))
+			continue
+		}
+		plan.triggers = append(plan.triggers, trigger{schedule: parsed, update: transition.Update})
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// transitions expands a Window into the transitions at its start and end.
+func (s Spec) transitions() ([]Transition, error) {
+	if s.Window == nil {
+		switch {
+		case s.Inside != nil || s.Outside != nil:
+			return nil, errors.New("inside and outside require a window")
+		case len(s.Transitions) == 0:
+			return nil, errors.New("either a window or transitions are required")
+		}
+		return s.Transitions, nil
+	}
+	if len(s.Transitions) > 0 {
+		return nil, errors.New("window and transitions are mutually exclusive")
+	}
+	if s.Inside == nil {
+		return nil, errors.New("a window requires the inside update")
+	}
+
+	days, err := parseDays(s.Window.Days)
+	if err != nil {
+		return nil, err
+	}
+	start, err := time.Parse("15:04", s.Window.Start)
+	if err != nil {
+		return nil, fmt.Errorf("invalid window start %q: expected HH:MM", s.Window.Start)
+	}
+	end, err := time.Parse("15:04", s.Window.End)
+	if err != nil {
+		return nil, fmt.Errorf("invalid window end %q: expected HH:MM", s.Window.End)
+	}
+	if start.Equal(end) {
+		return nil, errors.New("window start and end must differ")
+	}
+
+	endDays := days
+	if end.Before(start) && days != nil {
+		endDays = make([]time.Weekday, len(days))
+		for i, day := range days {
+			endDays[i] = (day + 1) % 7
+		}
+	}
+	transitions := []Transition{{Cron: dailyCron(start, days), Update: *s.Inside}}
+	if s.Outside != nil {
+		transitions = append(transitions, Transition{Cron: dailyCron(end, endDays), Update: *s.Outside})
+	}
+	return transitions, nil
+}
+
+func parseDays(names []string) ([]time.Weekday, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	days := make([]time.Weekday, 0, len(names))
+	for _, name := range names {
+		day, ok := weekdays[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown window day %q, expected mon, tue, wed, thu, fri, sat or sun", name)
+		}
+		days = append(days, day)
+	}
+	slices.Sort(days)
+	return slices.Compact(days), nil
+}
+
+// dailyCron fires at the hour and minute of at on days, or every day when days is nil.
+func dailyCron(at time.Time, days []time.Weekday) string {
+	dow := "*"
+	if days != nil {
+		fields := make([]string, len(days))
+		for i, day := range days {
+			fields[i] = strconv.Itoa(int(day))
+		}
+		dow = strings.Join(fields, ",")
+	}
+	return fmt.Sprintf("%d %d * * %s", at.Minute(), at.Hour(), dow)
+}
+
+func parseCron(expr string, loc *time.Location) (cron.Schedule, error) {
+	parsed, err := cron.ParseStandard(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron %q: %w", expr, err)
+	}
+	spec, ok := parsed.(*cron.SpecSchedule)
+	if !ok {
+		return nil, fmt.Errorf("invalid cron %q: @every is not supported", expr)
+	}
+	if spec.Location != time.Local {
+		return nil, fmt.Errorf("invalid cron %q: set the schedule timezone instead of CRON_TZ", expr)
+	}
+	spec.Location = loc
+	return spec, nil
+}
+
+// Updates returns the update of every transition.
+func (p *Plan) Updates() []valkey.Update {
+	updates := make([]valkey.Update, len(p.triggers))
+	for i, t := range p.triggers {
+		updates[i] = t.update
+	}
+	return updates
+}
+
+// Next returns the time of the first transition after after.
+func (p *Plan) Next(after time.Time) time.Time {
+	var next time.Time
+	for _, t := range p.triggers {
+		at := t.schedule.Next(after)
+		if !at.IsZero() && (next.IsZero() || at.Before(next)) {
+			next = at
+		}
+	}
+	return next
+}
+
+// Latest returns the update of the last transition firing after after and at or before until, and when it fires.
+// Earlier transitions in that range are superseded by it. When transitions fire at the same time the one declared
+// last wins.
+func (p *Plan) Latest(after, until time.Time) (valkey.Update, time.Time, bool) {
+	var (
+		latest   valkey.Update
+		latestAt time.Time
+		found    bool
+	)
+	for _, t := range p.triggers {
+		var last time.Time
+		at := t.schedule.Next(after)
+		for i := 0; !at.IsZero() && !at.After(until) && i < maxCatchUp; i++ {
+			last = at
+			at = t.schedule.Next(at)
+		}
+		if !last.IsZero() && !last.Before(latestAt) {
+			latest, latestAt, found = t.update, last, true
+		}
+	}
+	return latest, latestAt, found
+}
@@ -0,0 +1,174 @@
+package schedule
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mydecisive/mdai-gateway/internal/valkey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func update(data string) *valkey.Update {
+	return &valkey.Update{Command: valkey.CommandAdd, Data: json.RawMessage(data)}
+}
+
+func businessHours() Spec {
+	return Spec{
+		Name:        "business-hours-sampling",
+		Hub:         "mdaihub-sample",
+		Var:         "sampling_rate",
+		Timezone:    "Europe/Berlin",
+		Window:      &Window{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "18:00"},
+		Inside:      update(`10`),
+		Outside:     update(`100`),
+		Transitions: nil,
+	}
+}
+
+func TestPlan_Window(t *testing.T) {
+	plan, err := businessHours().Plan()
+	require.NoError(t, err)
+
+	saturday := time.Date(2025, 7, 19, 12, 0, 0, 0, time.UTC)
+	mondayStart := time.Date(2025, 7, 21, 7, 0, 0, 0, time.UTC) // 09:00 CEST
+	mondayEnd := time.Date(2025, 7, 21, 16, 0, 0, 0, time.UTC)
+	assert.True(t, mondayStart.Equal(plan.Next(saturday)))
+	assert.True(t, mondayEnd.Equal(plan.Next(mondayStart)))
+
+	inside, at, ok := plan.Latest(mondayStart.Add(-time.Millisecond), mondayStart.Add(time.Hour))
+	require.True(t, ok)
+	assert.True(t, mondayStart.Equal(at))
+	assert.JSONEq(t, `10`, string(inside.Data))
+
+	// Missed transitions are superseded by the last one.
+	outside, at, ok := plan.Latest(saturday, mondayEnd.Add(12*time.Hour))
+	require.True(t, ok)
+	assert.True(t, mondayEnd.Equal(at))
+	assert.JSONEq(t, `100`, string(outside.Data))
+
+	_, _, ok = plan.Latest(saturday, mondayStart.Add(-time.Second))
+	assert.False(t, ok)
+}
+
+func TestPlan_OvernightWindow(t *testing.T) {
+	spec := businessHours()
+	spec.Timezone = ""
+	spec.Window = &Window{Days: []string{"Fri"}, Start: "22:00", End: "06:00"}
+	plan, err := spec.Plan()
+	require.NoError(t, err)
+
+	fridayNight := time.Date(2025, 7, 25, 22, 30, 0, 0, time.UTC)
+	assert.True(t, time.Date(2025, 7, 26, 6, 0, 0, 0, time.UTC).Equal(plan.Next(fridayNight)))
+}
+
+func TestPlan_Transitions(t *testing.T) {
+	spec := Spec{
+		Name:     "",
+		Hub:      "mdaihub-sample",
+		Var:      "data_int",
+		Timezone: "",
+		Window:   nil,
+		Inside:   nil,
+		Outside:  nil,
+		Transitions: []Transition{
+			{Cron: "0 * * * *", Update: *update(`1`)},
+			{Cron: "0 0 * * *", Update: *update(`2`)},
+		},
+	}
+	plan, err := spec.Plan()
+	require.NoError(t, err)
+	assert.Len(t, plan.Updates(), 2)
+
+	// At midnight both fire; the one declared last wins.
+	midnight := time.Date(2025, 7, 20, 0, 0, 0, 0, time.UTC)
+	latest, _, ok := plan.Latest(midnight.Add(-time.Minute), midnight)
+	require.True(t, ok)
+	assert.JSONEq(t, `2`, string(latest.Data))
+}
+
+func TestPlan_Invalid(t *testing.T) {
+	testCases := []struct {
+		name     string
+		modify   func(*Spec)
+		expected string
+	}{
+		{
+			name:     "MissingVar",
+			modify:   func(s *Spec) { s.Var = "" },
+			expected: "hub and var are required",
+		},
+		{
+			name:     "UnknownTimezone",
+			modify:   func(s *Spec) { s.Timezone = "Mars/Olympus" },
+			expected: `unknown timezone "Mars/Olympus"`,
+		},
+		{
+			name:     "UnknownDay",
+			modify:   func(s *Spec) { s.Window.Days = []string{"someday"} },
+			expected: `unknown window day "someday", expected mon, tue, wed, thu, fri, sat or sun`,
+		},
+		{
+			name:     "InvalidStart",
+			modify:   func(s *Spec) { s.Window.Start = "9am" },
+			expected: `invalid window start "9am": expected HH:MM`,
+		},
+		{
+			name:     "EmptyWindow",
+			modify:   func(s *Spec) { s.Window.End = s.Window.Start },
+			expected: "window start and end must differ",
+		},
+		{
+			name:     "MissingInside",
+			modify:   func(s *Spec) { s.Inside = nil },
+			expected: "a window requires the inside update",
+		},
+		{
+			name:     "WindowAndTransitions",
+			modify:   func(s *Spec) { s.Transitions = []Transition{{Cron: "0 * * * *", Update: *update(`1`)}} },
+			expected: "window and transitions are mutually exclusive",
+		},
+		{
+			name:     "Nothing",
+			modify:   func(s *Spec) { s.Window, s.Inside, s.Outside = nil, nil, nil },
+			expected: "either a window or transitions are required",
+		},
+		{
+			name: "InvalidCron",
+			modify: func(s *Spec) {
+				s.Window, s.Inside, s.Outside = nil, nil, nil
+				s.Transitions = []Transition{{Cron: "every monday", Update: *update(`1`)}}
+			},
+			expected: `transitions[0]: invalid cron "every monday"`,
+		},
+		{
+			name: "NeverFires",
+			modify: func(s *Spec) {
+				s.Window, s.Inside, s.Outside = nil, nil, nil
+				s.Transitions = []Transition{{Cron: "0 0 30 2 *", Update: *update(`1`)}}
+			},
+			expected: `transitions[0]: cron "0 0 30 2 *" never fires`,
+		},
+		{
+			name: "Every",
+			modify: func(s *Spec) {
+				s.Window, s.Inside, s.Outside = nil, nil, nil
+				s.Transitions = []Transition{{Cron: "@every 1h", Update: *update(`1`)}}
+			},
+			expected: `transitions[0]: invalid cron "@every 1h": @every is not supported`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			spec := businessHours()
+			window := *spec.Window
+			spec.Window = &window
+			tc.modify(&spec)
+			_, err := spec.Plan()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.expected)
+		})
+	}
+}
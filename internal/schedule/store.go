@@ -0,0 +1,111 @@
+package schedule
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/mydecisive/mdai-gateway/internal/duequeue"
+	"github.com/valkey-io/valkey-go"
+)
+
+// key holds the schedules, see duequeue.Queue; a schedule is due at its next transition.
+const key = "gateway/schedules"
+
+var ErrNotFound = errors.New("schedule not found")
+
+// Due is a schedule whose next transition, at At, has come, claimed by Store.Due.
+type Due struct {
+	Schedule
+	At    time.Time
+	claim duequeue.Claim
+}
+
+// Store keeps schedules in a duequeue.Queue, due at their next transition.
+type Store struct {
+	queue *duequeue.Queue
+}
+
+func NewStore(client valkey.Client) *Store {
+	return &Store{queue: duequeue.New(client, key, "schedule")}
+}
+
+// Put stores s, replacing any schedule with the same ID, and sets its next transition to next.
+func (st *Store) Put(ctx context.Context, s Schedule, next time.Time) error {
+	record, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return st.queue.Put(ctx, s.ID, record, next)
+}
+
+// List returns every schedule, oldest first.
+func (st *Store) List(ctx context.Context) ([]Schedule, error) {
+	records, err := st.queue.Records(ctx)
+	if err != nil {
+		return nil, err
+	}
+	schedules := make([]Schedule, 0, len(records))
+	for _, record := range records {
+		var s Schedule
+		if err := json.Unmarshal([]byte(record), &s); err != nil {
+			return nil, fmt.Errorf("failed to decode schedule: %w", err)
+		}
+		schedules = append(schedules, s)
+	}
+	slices.SortFunc(schedules, func(a, b Schedule) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return schedules, nil
+}
+
+func (st *Store) Get(ctx context.Context, id string) (Schedule, error) {
+	return decode(st.queue.Get(ctx, id))
+}
+
+// Delete removes a schedule, so none of its transitions fire any more.
+func (st *Store) Delete(ctx context.Context, id string) error {
+	_, err := decode(st.queue.Remove(ctx, id))
+	return err
+}
+
+// Due claims the schedules whose next transition is at or before now, see duequeue.Queue.Claim. The caller fires
+// each transition and then calls Reschedule with the next one, or with the same one if firing failed.
+func (st *Store) Due(ctx context.Context, now time.Time) ([]Due, error) {
+	claims, err := st.queue.Claim(ctx, now)
+	due := make([]Due, 0, len(claims))
+	var errs []error
+	for _, claim := range claims {
+		s, decodeErr := decode(claim.Record, nil)
+		if decodeErr != nil {
+			errs = append(errs, decodeErr)
+			continue
+		}
+		due = append(due, Due{Schedule: s, At: claim.At, claim: claim})
+	}
+	return due, errors.Join(append(errs, err)...)
+}
+
+// Reschedule gives up the claim of a due schedule, setting its next transition to next. It reports false when the
+// schedule was deleted, replaced or claimed again in the meantime, leaving it alone.
+func (st *Store) Reschedule(ctx context.Context, due Due, next time.Time) (bool, error) {
+	return st.queue.Release(ctx, due.claim, next)
+}
+
+func decode(record string, err error) (Schedule, error) {
+	if errors.Is(err, duequeue.ErrNotFound) {
+		return Schedule{}, ErrNotFound
+	}
+	if err != nil {
+		return Schedule{}, err
+	}
+	var s Schedule
+	if err := json.Unmarshal([]byte(record), &s); err != nil {
+		return Schedule{}, fmt.Errorf("failed to decode schedule: %w", err)
+	}
+	return s, nil
+}
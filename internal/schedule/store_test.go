@@ -0,0 +1,80 @@
+package schedule
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mydecisive/mdai-gateway/internal/duequeue/duequeuetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valkey-io/valkey-go"
+	valkeymock "github.com/valkey-io/valkey-go/mock"
+	"go.uber.org/mock/gomock"
+)
+
+func newTestSchedule(t *testing.T, id string, createdAt time.Time) (Schedule, string) {
+	t.Helper()
+	s := Schedule{
+		ID:        id,
+		Spec:      businessHours(),
+		Caller:    "oncall",
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+	}
+	record, err := json.Marshal(s)
+	require.NoError(t, err)
+	return s, string(record)
+}
+
+func TestStore_Put(t *testing.T) {
+	client := valkeymock.NewClient(gomock.NewController(t))
+	s, record := newTestSchedule(t, "s1", time.Date(2025, 7, 19, 12, 0, 0, 0, time.UTC))
+	next := time.Date(2025, 7, 21, 7, 0, 0, 0, time.UTC)
+
+	client.EXPECT().DoMulti(gomock.Any(),
+		valkeymock.Match("HSET", key, "s1", record),
+		valkeymock.Match("ZADD", key+"/due", "1753081200000", "s1"),
+		valkeymock.Match("HDEL", key+"/claimed", "s1"),
+	).Return([]valkey.ValkeyResult{valkeymock.Result(valkeymock.ValkeyInt64(1)), valkeymock.Result(valkeymock.ValkeyInt64(1)), valkeymock.Result(valkeymock.ValkeyInt64(0))})
+
+	require.NoError(t, NewStore(client).Put(t.Context(), s, next))
+}
+
+func TestStore_List(t *testing.T) {
+	client := valkeymock.NewClient(gomock.NewController(t))
+	now := time.Date(2025, 7, 19, 12, 0, 0, 0, time.UTC)
+	newer, newerRecord := newTestSchedule(t, "s2", now)
+	older, olderRecord := newTestSchedule(t, "s1", now.Add(-time.Hour))
+
+	client.EXPECT().Do(gomock.Any(), valkeymock.Match("HVALS", key)).
+		Return(valkeymock.Result(valkeymock.ValkeyArray(valkeymock.ValkeyBlobString(newerRecord), valkeymock.ValkeyBlobString(olderRecord))))
+
+	schedules, err := NewStore(client).List(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, []Schedule{older, newer}, schedules)
+}
+
+func TestStore_Delete_NotFound(t *testing.T) {
+	client := valkeymock.NewClient(gomock.NewController(t))
+	client.EXPECT().Do(gomock.Any(), duequeuetest.Script{key, key + "/due", key + "/claimed", "missing"}).Return(valkeymock.Result(valkeymock.ValkeyNil()))
+
+	require.ErrorIs(t, NewStore(client).Delete(t.Context(), "missing"), ErrNotFound)
+}
+
+func TestStore_Due(t *testing.T) {
+	client := valkeymock.NewClient(gomock.NewController(t))
+	now := time.Date(2025, 7, 21, 7, 0, 5, 0, time.UTC)
+	s, record := newTestSchedule(t, "s1", now.Add(-time.Hour))
+
+	client.EXPECT().Do(gomock.Any(), valkeymock.Match("ZRANGEBYSCORE", key+"/due", "-inf", "1753081205000", "WITHSCORES")).
+		Return(valkeymock.Result(valkeymock.ValkeyArray(valkeymock.ValkeyBlobString("s1"), valkeymock.ValkeyBlobString("1753081200000"))))
+	client.EXPECT().Do(gomock.Any(), duequeuetest.Script{key, key + "/due", key + "/claimed", "s1", "1753081200000", "1753081265000"}).
+		Return(valkeymock.Result(valkeymock.ValkeyArray(valkeymock.ValkeyBlobString(record), valkeymock.ValkeyBlobString("1753081200000"))))
+
+	due, err := NewStore(client).Due(t.Context(), now)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, s, due[0].Schedule)
+	assert.Equal(t, time.Date(2025, 7, 21, 7, 0, 0, 0, time.UTC), due[0].At)
+}
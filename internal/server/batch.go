@@ -0,0 +1,338 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mydecisive/mdai-data-core/eventing"
+	auditutils "github.com/mydecisive/mdai-gateway/internal/audit"
+	"github.com/mydecisive/mdai-gateway/internal/auth"
+	"github.com/mydecisive/mdai-gateway/internal/httputil"
+	"github.com/mydecisive/mdai-gateway/internal/manualvariables"
+	"github.com/mydecisive/mdai-gateway/internal/requestid"
+	"github.com/mydecisive/mdai-gateway/internal/revert"
+	"github.com/mydecisive/mdai-gateway/internal/tracing"
+	"github.com/mydecisive/mdai-gateway/internal/valkey"
+	"go.uber.org/zap"
+)
+
+const (
+	BatchStatusPublished = "published"
+	BatchStatusFailed    = "failed"
+	// BatchStatusValidated marks the entries of a dry run, which are validated and previewed but not published.
+	BatchStatusValidated = "validated"
+)
+
+// BatchEntry is one variable update of a POST /variables/batch request. Op is a valkey.CommandType, e.g. "add" or
+// "remove", and Data has the same shape as the data of the single-variable endpoints; "clear" takes no data. TTL
+// optionally makes the update temporary, like the ttl of the single-variable endpoints.
+type BatchEntry struct {
+	Hub  string          `json:"hub"`
+	Var  string          `json:"var"`
+	Op   string          `json:"op"`
+	Data json.RawMessage `json:"data"`
+	TTL  string          `json:"ttl,omitempty"`
+}
+
+type BatchResult struct {
+	Index  int                 `json:"index"`
+	Hub    string              `json:"hub"`
+	Var    string              `json:"var"`
+	Op     string              `json:"op"`
+	Status string              `json:"status"`
+	Event  *eventing.MdaiEvent `json:"event,omitempty"`
+	Error  string              `json:"error,omitempty"`
+	Before any                 `json:"before,omitempty"`
+	After  any                 `json:"after,omitempty"`
+	Revert *revert.Revert      `json:"revert,omitempty"`
+}
+
+type BatchResponse struct {
+	CorrelationID string        `json:"correlationId"`
+	Successful    int           `json:"successful"`
+	Failed        int           `json:"failed"`
+	Results       []BatchResult `json:"results"`
+	DryRun        bool          `json:"dryRun,omitempty"`
+}
+
+// batchUpdate is a validated entry, ready to publish. before and after are only read for dry runs and temporary
+// updates.
+type batchUpdate struct {
+	entry    BatchEntry
+	varType  valkey.VariableType
+	payload  any
+	event    *eventing.MdaiEvent
+	decision auth.Decision
+	ttl      time.Duration
+	before   any
+	after    any
+	revert   *revert.Revert
+}
+
+// handleBatchVariables applies several variable updates at once. Every entry is authorized and validated before
+// anything is published, so a single bad entry rejects the whole batch. The events then share the request's
+// correlation ID and are published in order; publish failures are reported per entry. With ?dryRun=true nothing is
+// published and every entry is previewed instead, later entries for the same variable building on earlier ones.
+// Entries with a TTL get their revert scheduled before they are published.
+func handleBatchVariables(ctx context.Context, deps HandlerDeps) http.HandlerFunc { //nolint:funlen
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, deps.Config.Limits.VariableBodyMaxBytes)
+		defer r.Body.Close() //nolint:errcheck
+		logger := requestid.Logger(r.Context(), deps.Logger)
+
+		dryRun, err := dryRunRequested(r)
+		if err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+
+		var entries []BatchEntry
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&entries); err != nil {
+			var mbe *http.MaxBytesError
+			if errors.As(err, &mbe) {
+				httputil.WriteProblem(w, logger, http.StatusRequestEntityTooLarge, httputil.CodeBodyTooLarge, "request body too large (max "+formatByteSize(mbe.Limit)+")")
+				return
+			}
+			httputil.WriteProblem(w, logger, http.StatusBadRequest, httputil.CodeInvalidJSON, "invalid JSON format in request payload: expected a list of {hub, var, op, data} entries")
+			return
+		}
+		if len(entries) == 0 {
+			httputil.WriteProblem(w, logger, http.StatusBadRequest, httputil.CodeInvalidRequest, "batch must contain at least one entry")
+			return
+		}
+		if maxEntries := deps.Config.Limits.BatchMaxEntries; len(entries) > maxEntries {
+			httputil.WriteProblem(w, logger, http.StatusBadRequest, httputil.CodeInvalidRequest, fmt.Sprintf("batch has %d entries, max %d", len(entries), maxEntries))
+			return
+		}
+
+		decisions := make([]auth.Decision, len(entries))
+		var denied []httputil.ProblemItem
+		for i, entry := range entries {
+			if entry.Hub == "" || entry.Var == "" {
+				continue // reported by validation below
+			}
+			decision, err := checkAccess(r, deps, auth.ActionWrite, entry.Hub, entry.Var)
+			if err != nil {
+				problem := httputil.ProblemFromError(err)
+				if problem.Status != http.StatusForbidden {
+					httputil.WriteError(w, logger, err)
+					return
+				}
+				denied = append(denied, httputil.ProblemItem{Index: i, Code: problem.Code, Detail: problem.Detail})
+			}
+			decisions[i] = decision
+		}
+		if len(denied) > 0 {
+			httputil.WriteProblemItems(w, logger, http.StatusForbidden, httputil.CodeForbidden, fmt.Sprintf("%d of %d entries are not allowed", len(denied), len(entries)), denied)
+			return
+		}
+
+		hubsVariables, err := deps.ConfigMapController.GetAllHubsToDataMap()
+		if err != nil {
+			httputil.WriteProblem(w, logger, http.StatusInternalServerError, httputil.CodeInternal, "failed to fetch manual variables")
+			return
+		}
+
+		ids, _ := requestid.FromContext(r.Context())
+		updates := make([]batchUpdate, 0, len(entries))
+		var invalid []httputil.ProblemItem
+		for i, entry := range entries {
+			update, err := newBatchUpdate(entry, hubsVariables, ids.CorrelationID, deps.Config.Reverts.MaxTTL)
+			if err != nil {
+				problem := httputil.ProblemFromError(err)
+				invalid = append(invalid, httputil.ProblemItem{Index: i, Code: problem.Code, Detail: problem.Detail})
+				continue
+			}
+			update.decision = decisions[i]
+			updates = append(updates, update)
+		}
+		if len(invalid) > 0 {
+			httputil.WriteProblemItems(w, logger, http.StatusBadRequest, httputil.CodeInvalidBatch, fmt.Sprintf("%d of %d entries are invalid; nothing was published", len(invalid), len(entries)), invalid)
+			return
+		}
+
+		caller, _ := auth.IdentityFromContext(r.Context())
+		if err := previewUpdates(ctx, deps, updates, dryRun); err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+		for i := range updates {
+			update := &updates[i]
+			if update.ttl == 0 {
+				continue
+			}
+			pending, ok, err := newRevert(update.event, update.entry.Var, update.varType, valkey.CommandType(update.entry.Op), update.before, update.payload, caller.Name, update.ttl)
+			if err != nil {
+				httputil.WriteError(w, logger, err)
+				return
+			}
+			if ok {
+				update.revert = &pending
+			}
+		}
+
+		response := BatchResponse{
+			CorrelationID: ids.CorrelationID,
+			Successful:    0,
+			Failed:        0,
+			Results:       make([]BatchResult, 0, len(updates)),
+			DryRun:        dryRun,
+		}
+		if dryRun {
+			for i, update := range updates {
+				response.Results = append(response.Results, newBatchResult(i, update, BatchStatusValidated))
+				response.Successful++
+			}
+			httputil.WriteJSONResponse(w, logger, http.StatusOK, response)
+			return
+		}
+
+		publishUpdates(ctx, r, deps, updates, &response)
+
+		status := http.StatusCreated
+		if response.Failed > 0 {
+			status = http.StatusAccepted
+		}
+		httputil.WriteJSONResponse(w, logger, status, response)
+	}
+}
+
+// publishUpdates publishes updates in order, scheduling their reverts first, and records a result for each in
+// response.
+func publishUpdates(ctx context.Context, r *http.Request, deps HandlerDeps, updates []batchUpdate, response *BatchResponse) {
+	logger := requestid.Logger(r.Context(), deps.Logger)
+	caller, _ := auth.IdentityFromContext(r.Context())
+	ids, _ := requestid.FromContext(r.Context())
+
+	store := revert.NewStore(deps.ValkeyClient)
+	for i, update := range updates {
+		event := *update.event
+		subject := subjectFromVarsEvent(event, update.entry.Var)
+		publishCtx := auditutils.WithFields(tracing.WithSpanFrom(ctx, r.Context()), auditFields(caller, update.decision, ids))
+
+		logger.Info("Publishing MdaiEvent",
+			zap.String("id", event.ID),
+			zap.String("caller", caller.Name),
+			zap.String("name", event.Name),
+			zap.String("source", event.Source),
+			zap.String("subject", subject.String()),
+			zap.Int("batchIndex", i),
+		)
+
+		result := newBatchResult(i, update, BatchStatusPublished)
+		result.Before, result.After = nil, nil
+		if update.revert != nil {
+			if err := store.Add(ctx, *update.revert); err != nil {
+				logger.Error("Failed to schedule revert", zap.Int("batchIndex", i), zap.Error(err))
+				result.Status = BatchStatusFailed
+				result.Error = "failed to schedule revert; the entry was not published"
+				result.Revert = nil
+				response.Failed++
+				response.Results = append(response.Results, result)
+				continue
+			}
+		}
+		if err := publishVariableUpdate(publishCtx, logger, deps, event, subject, update.entry.Hub, update.entry.Var, nil); err != nil {
+			logger.Error("Failed to publish MdaiEvent", zap.Int("batchIndex", i), zap.Error(err))
+			discardRevert(ctx, logger, store, update.revert)
+			result.Status = BatchStatusFailed
+			result.Revert = nil
+			result.Error = fmt.Sprintf("failed to publish event: %v", err)
+			response.Failed++
+		} else {
+			response.Successful++
+		}
+		response.Results = append(response.Results, result)
+	}
+}
+
+// previewUpdates reads the current value of the variables in updates once and previews the updates in order, so
+// updates of the same variable build on each other. Unless all is set, only variables with a temporary update are
+// previewed, as their reverts need the value before.
+func previewUpdates(ctx context.Context, deps HandlerDeps, updates []batchUpdate, all bool) error {
+	temporary := make(map[string]bool)
+	for _, update := range updates {
+		if update.ttl > 0 {
+			temporary[update.entry.Hub+"/"+update.entry.Var] = true
+		}
+	}
+
+	client := valkey.NewAdapter(deps.ValkeyClient, deps.Logger)
+	values := make(map[string]any)
+	for i := range updates {
+		update := &updates[i]
+		key := update.entry.Hub + "/" + update.entry.Var
+		if !all && !temporary[key] {
+			continue
+		}
+		before, ok := values[key]
+		if !ok {
+			var err error
+			if before, err = valkey.GetValue(ctx, client, update.entry.Var, update.varType, update.entry.Hub); err != nil {
+				return err
+			}
+		}
+		after, err := valkey.Preview(update.varType, valkey.CommandType(update.entry.Op), before, update.payload)
+		if err != nil {
+			return fmt.Errorf("failed to preview entry %d: %w", i, err)
+		}
+		update.before, update.after = before, after
+		values[key] = after
+	}
+	return nil
+}
+
+func newBatchResult(index int, update batchUpdate, status string) BatchResult {
+	return BatchResult{
+		Index:  index,
+		Hub:    update.entry.Hub,
+		Var:    update.entry.Var,
+		Op:     update.entry.Op,
+		Status: status,
+		Event:  update.event,
+		Error:  "",
+		Before: update.before,
+		After:  update.after,
+		Revert: update.revert,
+	}
+}
+
+// newBatchUpdate validates entry against the manual variables of its hub and builds its event.
+func newBatchUpdate(entry BatchEntry, hubsVariables manualvariables.ByHub, correlationID string, maxTTL time.Duration) (batchUpdate, error) {
+	if entry.Hub == "" || entry.Var == "" {
+		return batchUpdate{}, manualvariables.ErrMissingQueryParams
+	}
+	varType, err := manualvariables.GetVarType(entry.Hub, entry.Var, hubsVariables)
+	if err != nil {
+		return batchUpdate{}, err
+	}
+	command := valkey.CommandType(entry.Op)
+	if entry.Data == nil && command != valkey.CommandClear {
+		return batchUpdate{}, httputil.NewError(http.StatusBadRequest, httputil.CodeInvalidRequest, "data is required")
+	}
+	ttl, err := parseTTL(entry.TTL, maxTTL)
+	if err != nil {
+		return batchUpdate{}, err
+	}
+	event, payload, err := newVariableEvent(entry.Hub, entry.Var, varType, command, entry.Data, correlationID)
+	if err != nil {
+		return batchUpdate{}, err
+	}
+	return batchUpdate{
+		entry:    entry,
+		varType:  varType,
+		payload:  payload,
+		event:    event,
+		decision: auth.Decision{},
+		ttl:      ttl,
+		before:   nil,
+		after:    nil,
+		revert:   nil,
+	}, nil
+}
@@ -0,0 +1,291 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mydecisive/mdai-data-core/eventing"
+	"github.com/mydecisive/mdai-gateway/internal/auth"
+	"github.com/mydecisive/mdai-gateway/internal/config"
+	"github.com/mydecisive/mdai-gateway/internal/duequeue/duequeuetest"
+	"github.com/mydecisive/mdai-gateway/internal/httputil"
+	"github.com/mydecisive/mdai-gateway/internal/requestid"
+	"github.com/mydecisive/mdai-gateway/internal/revert"
+	"github.com/mydecisive/mdai-gateway/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	valkeymock "github.com/valkey-io/valkey-go/mock"
+	"go.uber.org/mock/gomock"
+)
+
+func newBatchRequest(body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/variables/batch", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func TestHandleBatchVariables(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mux := NewRouter(t.Context(), deps)
+
+	deps.ValkeyClient.(*valkeymock.Client).EXPECT(). //nolint:forcetypeassert
+								Do(gomock.Any(), VersionBumpMatcher{}).
+								Return(valkeymock.Result(valkeymock.ValkeyInt64(1))).Times(4)
+	deps.ValkeyClient.(*valkeymock.Client).EXPECT(). //nolint:forcetypeassert
+								Do(gomock.Any(), XaddFieldsMatcher{"correlation_id": "incident-7", "request_id": "req-1"}).
+								Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(4)
+
+	req := newBatchRequest(`[
+		{"hub": "mdaihub-sample", "var": "data_set", "op": "add", "data": ["service-a"]},
+		{"hub": "mdaihub-sample", "var": "data_int", "op": "add", "data": 3},
+		{"hub": "mdaihub-sample", "var": "data_map", "op": "replace", "data": {"key": "value"}},
+		{"hub": "mdaihub-sample", "var": "data_string", "op": "clear"}
+	]`)
+	req.Header.Set(requestid.RequestIDHeader, "req-1")
+	req.Header.Set(requestid.CorrelationIDHeader, "incident-7")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+	var response BatchResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, "incident-7", response.CorrelationID)
+	assert.Equal(t, 4, response.Successful)
+	assert.Equal(t, 0, response.Failed)
+	require.Len(t, response.Results, 4)
+	for i, result := range response.Results {
+		assert.Equal(t, i, result.Index)
+		assert.Equal(t, BatchStatusPublished, result.Status)
+		require.NotNil(t, result.Event)
+		assert.Equal(t, "incident-7", result.Event.CorrelationID)
+	}
+
+	var payload eventing.VariablesActionPayload
+	require.NoError(t, json.Unmarshal([]byte(response.Results[1].Event.Payload), &payload))
+	assert.Equal(t, eventing.VariablesActionPayload{VariableRef: "data_int", DataType: "int", Operation: "add", Data: "3"}, payload)
+}
+
+func TestHandleBatchVariables_Invalid(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mux := NewRouter(t.Context(), deps)
+
+	// Nothing is published or audited when any entry is invalid.
+	deps.ValkeyClient.(*valkeymock.Client).EXPECT().Do(gomock.Any(), XaddMatcher{}).Times(0) //nolint:forcetypeassert
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+		detail string
+		items  []httputil.ProblemItem
+	}{
+		{
+			name:   "not a list",
+			body:   `{"hub": "mdaihub-sample"}`,
+			status: http.StatusBadRequest,
+			code:   httputil.CodeInvalidJSON,
+			detail: "invalid JSON format in request payload: expected a list of {hub, var, op, data} entries",
+		},
+		{
+			name:   "empty",
+			body:   `[]`,
+			status: http.StatusBadRequest,
+			code:   httputil.CodeInvalidRequest,
+			detail: "batch must contain at least one entry",
+		},
+		{
+			name: "invalid entries",
+			body: `[
+				{"hub": "mdaihub-sample", "var": "data_set", "op": "add", "data": ["ok"]},
+				{"hub": "mdaihub-sample", "var": "data_int", "op": "add", "data": "three"},
+				{"hub": "mdaihub-sample", "var": "missing", "op": "add", "data": "x"},
+				{"hub": "mdaihub-sample", "var": "data_string", "op": "append", "data": "x"},
+				{"hub": "mdaihub-sample", "var": "data_string", "op": "add"},
+				{"var": "data_string", "op": "add", "data": "x"}
+			]`,
+			status: http.StatusBadRequest,
+			code:   httputil.CodeInvalidBatch,
+			detail: "5 of 6 entries are invalid; nothing was published",
+			items: []httputil.ProblemItem{
+				{Index: 1, Code: httputil.CodeInvalidValue, Detail: "invalid request payload: int expected"},
+				{Index: 2, Code: httputil.CodeVariableNotFound, Detail: "variable not found"},
+				{Index: 3, Code: httputil.CodeUnsupportedOperation, Detail: `invalid request payload: unsupported command "append" for variable type "string"`},
+				{Index: 4, Code: httputil.CodeInvalidRequest, Detail: "data is required"},
+				{Index: 5, Code: httputil.CodeMissingParameter, Detail: "missing hub or variable name"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, newBatchRequest(tt.body))
+
+			expected := httputil.NewProblem(tt.status, tt.code, tt.detail)
+			expected.Errors = tt.items
+			var problem httputil.Problem
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &problem))
+			assert.Equal(t, tt.status, rr.Code)
+			assert.Equal(t, expected, problem)
+		})
+	}
+
+	t.Run("too many entries", func(t *testing.T) {
+		deps := deps
+		deps.Config.Limits.BatchMaxEntries = 1
+		rr := httptest.NewRecorder()
+		NewRouter(t.Context(), deps).ServeHTTP(rr, newBatchRequest(`[
+			{"hub": "mdaihub-sample", "var": "data_string", "op": "add", "data": "a"},
+			{"hub": "mdaihub-sample", "var": "data_string", "op": "add", "data": "b"}
+		]`))
+		assertProblem(t, rr, http.StatusBadRequest, httputil.CodeInvalidRequest, "batch has 2 entries, max 1")
+	})
+}
+
+func TestHandleBatchVariables_Authorization(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	authenticator, err := auth.NewStaticAuthenticator(auth.CredentialsFile{
+		APIKeys: []auth.Credential{{Identity: "team-a", Secret: "key-a"}},
+	})
+	require.NoError(t, err)
+	deps.Authenticator = authenticator
+	deps.Authorizer = auth.NewPolicy([]config.AuthRule{{
+		Name:       "team-a-strings",
+		Identities: []string{"team-a"},
+		Hubs:       []string{"*"},
+		Variables:  []string{"data_string"},
+		Actions:    []string{auth.ActionWrite},
+	}})
+	mux := NewRouter(t.Context(), deps)
+
+	deps.ValkeyClient.(*valkeymock.Client).EXPECT().Do(gomock.Any(), XaddMatcher{}).Times(0) //nolint:forcetypeassert
+
+	req := newBatchRequest(`[
+		{"hub": "mdaihub-sample", "var": "data_string", "op": "add", "data": "x"},
+		{"hub": "mdaihub-sample", "var": "data_set", "op": "add", "data": ["x"]}
+	]`)
+	req.Header.Set(auth.APIKeyHeader, "key-a")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	expected := httputil.NewProblem(http.StatusForbidden, httputil.CodeForbidden, "1 of 2 entries are not allowed")
+	expected.Errors = []httputil.ProblemItem{
+		{Index: 1, Code: httputil.CodeForbidden, Detail: `caller "team-a" may not write variable mdaihub-sample/data_set`},
+	}
+	var problem httputil.Problem
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &problem))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, expected, problem)
+}
+
+func TestHandleBatchVariables_PublishFailure(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mockPub := &mocks.MockPublisher{}
+	mockPub.On("Publish", mock.Anything, mock.Anything, eventing.MdaiEventSubject{Type: eventing.VarEventType, Path: "mdaihub-sample.data_string"}).Return(nil).Once()
+	mockPub.On("Publish", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("nats down")).Once()
+	deps.EventPublisher = mockPub
+	mux := NewRouter(t.Context(), deps)
+
+	deps.ValkeyClient.(*valkeymock.Client).EXPECT(). //nolint:forcetypeassert
+								Do(gomock.Any(), VersionBumpMatcher{}).
+								Return(valkeymock.Result(valkeymock.ValkeyInt64(1))).Times(2)
+	deps.ValkeyClient.(*valkeymock.Client).EXPECT(). //nolint:forcetypeassert
+								Do(gomock.Any(), XaddMatcher{}).
+								Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(2)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, newBatchRequest(`[
+		{"hub": "mdaihub-sample", "var": "data_string", "op": "add", "data": "x"},
+		{"hub": "mdaihub-sample", "var": "data_boolean", "op": "add", "data": true}
+	]`))
+	require.Equal(t, http.StatusAccepted, rr.Code, rr.Body.String())
+
+	var response BatchResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, 1, response.Successful)
+	assert.Equal(t, 1, response.Failed)
+	assert.Equal(t, BatchStatusPublished, response.Results[0].Status)
+	assert.Equal(t, BatchStatusFailed, response.Results[1].Status)
+	assert.Equal(t, "failed to publish event: nats down", response.Results[1].Error)
+	mockPub.AssertExpectations(t)
+}
+
+func TestHandleBatchVariables_DryRun(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mockPub := &mocks.MockPublisher{}
+	deps.EventPublisher = mockPub
+	mux := NewRouter(t.Context(), deps)
+
+	mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+	mockClient.EXPECT().Do(gomock.Any(), XaddMatcher{}).Times(0)
+	// Read once; the second entry builds on the preview of the first.
+	mockClient.EXPECT().
+		Do(gomock.Any(), valkeymock.Match("GET", "variable/mdaihub-sample/data_int")).
+		Return(valkeymock.Result(valkeymock.ValkeyBlobString("1"))).Times(1)
+
+	req := httptest.NewRequest(http.MethodPost, "/variables/batch?dryRun=true", bytes.NewBufferString(`[
+		{"hub": "mdaihub-sample", "var": "data_int", "op": "add", "data": 3},
+		{"hub": "mdaihub-sample", "var": "data_int", "op": "increment", "data": {"by": 2}}
+	]`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var response BatchResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.True(t, response.DryRun)
+	assert.Equal(t, 2, response.Successful)
+	require.Len(t, response.Results, 2)
+	for _, result := range response.Results {
+		assert.Equal(t, BatchStatusValidated, result.Status)
+		assert.NotNil(t, result.Event)
+	}
+	assert.Equal(t, "1", response.Results[0].Before)
+	assert.Equal(t, "3", response.Results[0].After)
+	assert.Equal(t, "3", response.Results[1].Before)
+	assert.Equal(t, "5", response.Results[1].After)
+	mockPub.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestHandleBatchVariables_TTL(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mux := NewRouter(t.Context(), deps)
+	mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	mockClient.EXPECT().
+		Do(gomock.Any(), valkeymock.Match("SMEMBERS", "variable/mdaihub-sample/data_set")).
+		Return(valkeymock.Result(valkeymock.ValkeyArray())).Times(1)
+	var stored revert.Revert
+	duequeuetest.ExpectPut(mockClient, &stored)
+	mockClient.EXPECT().Do(gomock.Any(), VersionBumpMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyInt64(1))).Times(2)
+	mockClient.EXPECT().Do(gomock.Any(), XaddMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(2)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, newBatchRequest(`[
+		{"hub": "mdaihub-sample", "var": "data_set", "op": "add", "data": ["noisy"], "ttl": "1h"},
+		{"hub": "mdaihub-sample", "var": "data_string", "op": "add", "data": "x"}
+	]`))
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+	var response BatchResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.NotNil(t, response.Results[0].Revert)
+	assert.Equal(t, stored.ID, response.Results[0].Revert.ID)
+	assert.Equal(t, "remove", stored.Op)
+	assert.JSONEq(t, `["noisy"]`, string(stored.Data))
+	assert.Equal(t, response.Results[0].Event.ID, stored.EventID)
+	assert.Nil(t, response.Results[1].Revert)
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/mydecisive/mdai-data-core/eventing"
+	"github.com/mydecisive/mdai-gateway/internal/httputil"
+	"github.com/mydecisive/mdai-gateway/internal/revert"
+	"github.com/mydecisive/mdai-gateway/internal/valkey"
+)
+
+// VariablePreview is the response of a variable write made with ?dryRun=true: the event that would have been
+// published, the value of the variable before and after the operator applies it and, for writes with a TTL, the
+// revert that would be scheduled.
+type VariablePreview struct {
+	DryRun  bool                `json:"dryRun"`
+	Event   *eventing.MdaiEvent `json:"event"`
+	Subject string              `json:"subject"`
+	Before  any                 `json:"before"`
+	After   any                 `json:"after"`
+	Revert  *revert.Revert      `json:"revert,omitempty"`
+}
+
+// dryRunRequested reports whether r asks for a dry run with the dryRun query parameter.
+func dryRunRequested(r *http.Request) (bool, error) {
+	return boolQuery(r, "dryRun")
+}
+
+// boolQuery reads an optional boolean query parameter, false when it is missing.
+func boolQuery(r *http.Request, name string) (bool, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, httputil.NewError(http.StatusBadRequest, httputil.CodeInvalidRequest, name+" must be a boolean")
+	}
+	return b, nil
+}
+
+func newVariablePreview(event *eventing.MdaiEvent, subject eventing.MdaiEventSubject, varType valkey.VariableType, command valkey.CommandType, current, payload any) (VariablePreview, error) {
+	after, err := valkey.Preview(varType, command, current, payload)
+	if err != nil {
+		return VariablePreview{}, fmt.Errorf("failed to preview %s: %w", command, err)
+	}
+	return VariablePreview{
+		DryRun:  true,
+		Event:   event,
+		Subject: subject.String(),
+		Before:  current,
+		After:   after,
+		Revert:  nil,
+	}, nil
+}
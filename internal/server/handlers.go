@@ -12,55 +12,81 @@ import (
 	"github.com/mydecisive/mdai-data-core/eventing"
 	"github.com/mydecisive/mdai-data-core/eventing/config"
 	"github.com/mydecisive/mdai-data-core/eventing/publisher"
-	datacore "github.com/mydecisive/mdai-data-core/variables"
 	"github.com/mydecisive/mdai-gateway/internal/adapter"
+	auditutils "github.com/mydecisive/mdai-gateway/internal/audit"
+	"github.com/mydecisive/mdai-gateway/internal/auth"
 	"github.com/mydecisive/mdai-gateway/internal/httputil"
 	"github.com/mydecisive/mdai-gateway/internal/manualvariables"
 	"github.com/mydecisive/mdai-gateway/internal/nats"
-	"github.com/mydecisive/mdai-gateway/internal/stringutil"
+	"github.com/mydecisive/mdai-gateway/internal/requestid"
+	"github.com/mydecisive/mdai-gateway/internal/revert"
+	"github.com/mydecisive/mdai-gateway/internal/tracing"
 	"github.com/mydecisive/mdai-gateway/internal/valkey"
 	"github.com/prometheus/alertmanager/notify/webhook"
 	"github.com/prometheus/alertmanager/template"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
+// handleListAllVariables lists the variables of every hub that the caller may read. Hubs where none are readable are
+// left out.
 func handleListAllVariables(_ context.Context, deps HandlerDeps) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		hubsVariables, err := deps.ConfigMapController.GetAllHubsToDataMap()
 		if err != nil {
-			httputil.WriteJSONResponse(w, deps.Logger, http.StatusInternalServerError, "failed to fetch manual variables")
+			httputil.WriteProblem(w, deps.Logger, http.StatusInternalServerError, httputil.CodeInternal, "failed to fetch manual variables")
 			return
 		}
 		if len(hubsVariables) == 0 {
-			httputil.WriteJSONResponse(w, deps.Logger, http.StatusNotFound, "no hubs with manual variables found")
+			httputil.WriteError(w, deps.Logger, manualvariables.ErrNoManualVariablesFound)
 			return
 		}
 
-		httputil.WriteJSONResponse(w, deps.Logger, http.StatusOK, hubsVariables)
+		access := newAccessFilter(r, deps)
+		listed := make(map[string]map[string]string, len(hubsVariables))
+		for hubName, hubVariables := range hubsVariables {
+			readable, err := access.readableVariables(hubName, hubVariables)
+			if err != nil {
+				httputil.WriteError(w, deps.Logger, err)
+				return
+			}
+			if len(readable) > 0 {
+				listed[hubName] = readable
+			}
+		}
+		httputil.WriteJSONResponse(w, deps.Logger, http.StatusOK, listed)
 	}
 }
 
+// handleListHubVariables lists the variables of a hub that the caller may read.
 func handleListHubVariables(_ context.Context, deps HandlerDeps) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		hubName := r.PathValue("hubName")
 		if hubName == "" {
-			http.Error(w, "hub name required", http.StatusBadRequest)
+			httputil.WriteProblem(w, deps.Logger, http.StatusBadRequest, httputil.CodeMissingParameter, "hub name required")
 			return
 		}
 		hubsVariables, err := deps.ConfigMapController.GetAllHubsToDataMap()
 		if err != nil {
-			httputil.WriteJSONResponse(w, deps.Logger, http.StatusInternalServerError, "failed to fetch manual variables")
+			httputil.WriteProblem(w, deps.Logger, http.StatusInternalServerError, httputil.CodeInternal, "failed to fetch manual variables")
 			return
 		}
 		if len(hubsVariables) == 0 {
-			httputil.WriteJSONResponse(w, deps.Logger, http.StatusNotFound, "no hubs with manual variables found")
+			httputil.WriteError(w, deps.Logger, manualvariables.ErrNoManualVariablesFound)
 			return
 		}
-		if hubVariables, exists := hubsVariables[hubName]; exists {
-			httputil.WriteJSONResponse(w, deps.Logger, http.StatusOK, hubVariables)
+		hubVariables, exists := hubsVariables[hubName]
+		if !exists {
+			httputil.WriteError(w, deps.Logger, manualvariables.ErrHubNotFound)
 			return
 		}
-		httputil.WriteJSONResponse(w, deps.Logger, http.StatusNotFound, "Hub not found")
+		readable, err := newAccessFilter(r, deps).readableVariables(hubName, hubVariables)
+		if err != nil {
+			httputil.WriteError(w, deps.Logger, err)
+			return
+		}
+		httputil.WriteJSONResponse(w, deps.Logger, http.StatusOK, readable)
 	}
 }
 
@@ -69,150 +95,250 @@ func handleGetVariables(ctx context.Context, deps HandlerDeps) http.HandlerFunc
 		hubName := r.PathValue("hubName")
 		varName := r.PathValue("varName")
 		if hubName == "" || varName == "" {
-			http.Error(w, "hub and var name required", http.StatusBadRequest)
+			httputil.WriteProblem(w, deps.Logger, http.StatusBadRequest, httputil.CodeMissingParameter, "hub and var name required")
+			return
+		}
+		raw, err := boolQuery(r, "raw")
+		if err != nil {
+			httputil.WriteError(w, deps.Logger, err)
+			return
+		}
+		if _, ok := authorize(w, r, deps, auth.ActionRead, hubName, varName); !ok {
 			return
 		}
 
 		hubsVariables, err := deps.ConfigMapController.GetAllHubsToDataMap()
 		if err != nil {
-			httputil.WriteJSONResponse(w, deps.Logger, http.StatusInternalServerError, "failed to fetch manual variables")
+			httputil.WriteProblem(w, deps.Logger, http.StatusInternalServerError, httputil.CodeInternal, "failed to fetch manual variables")
 			return
 		}
 		if len(hubsVariables) == 0 {
-			httputil.WriteJSONResponse(w, deps.Logger, http.StatusNotFound, "no hubs with manual variables found")
+			httputil.WriteError(w, deps.Logger, manualvariables.ErrNoManualVariablesFound)
 			return
 		}
 
 		varType, err := manualvariables.GetVarType(hubName, varName, hubsVariables)
 		if err != nil {
-			status := http.StatusInternalServerError
-			var httpErr manualvariables.HTTPError
-			if errors.As(err, &httpErr) {
-				status = httpErr.HTTPStatus()
-			}
-			httputil.WriteJSONResponse(w, deps.Logger, status, err.Error())
+			httputil.WriteError(w, deps.Logger, err)
+			return
+		}
+
+		valkeyValue, err := valkey.GetValue(ctx, valkey.NewAdapter(deps.ValkeyClient, deps.Logger), varName, varType, hubName)
+		if err != nil {
+			httputil.WriteError(w, deps.Logger, err)
 			return
 		}
 
-		valkeyValue, err := valkey.GetValue(ctx, datacore.NewValkeyAdapter(deps.ValkeyClient, deps.Logger), varName, varType, hubName)
+		version, err := valkey.Version(ctx, deps.ValkeyClient, hubName, varName)
 		if err != nil {
-			httputil.WriteJSONResponse(w, deps.Logger, http.StatusInternalServerError, err.Error())
+			httputil.WriteError(w, deps.Logger, err)
 			return
 		}
+		etag, err := valkey.ETag(varType, valkeyValue, version)
+		if err != nil {
+			httputil.WriteError(w, deps.Logger, err)
+			return
+		}
+		w.Header().Set("ETag", etag)
 
+		if !raw {
+			if valkeyValue, err = typedValue(hubName, varName, varType, valkeyValue); err != nil {
+				httputil.WriteError(w, deps.Logger, err)
+				return
+			}
+		}
 		response := map[string]any{varName: valkeyValue}
 		httputil.WriteJSONResponse(w, deps.Logger, http.StatusOK, response)
 	}
 }
 
-func handleSetDeleteVariables(ctx context.Context, deps HandlerDeps) http.HandlerFunc { //nolint:funlen
+// handleUpdateVariable applies command to a variable. Every command but CommandClear reads its value from the
+// {"data": ...} request payload. With ?dryRun=true the update is validated and previewed but not published. A "ttl"
+// next to the data schedules a revert that undoes the update once the TTL expires.
+func handleUpdateVariable(ctx context.Context, deps HandlerDeps, command valkey.CommandType) http.HandlerFunc { //nolint:funlen
 	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, deps.Config.Limits.VariableBodyMaxBytes)
 		defer r.Body.Close() //nolint:errcheck
+		logger := requestid.Logger(r.Context(), deps.Logger)
 
 		hubName := r.PathValue("hubName")
 		varName := r.PathValue("varName")
 		if hubName == "" || varName == "" {
-			http.Error(w, "hub and var name required", http.StatusBadRequest)
+			httputil.WriteProblem(w, logger, http.StatusBadRequest, httputil.CodeMissingParameter, "hub and var name required")
+			return
+		}
+		dryRun, err := dryRunRequested(r)
+		if err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+		decision, ok := authorize(w, r, deps, auth.ActionWrite, hubName, varName)
+		if !ok {
 			return
 		}
 
 		hubsVariables, err := deps.ConfigMapController.GetAllHubsToDataMap()
 		if err != nil {
-			httputil.WriteJSONResponse(w, deps.Logger, http.StatusInternalServerError, "failed to fetch manual variables")
+			httputil.WriteProblem(w, logger, http.StatusInternalServerError, httputil.CodeInternal, "failed to fetch manual variables")
 			return
 		}
 		if len(hubsVariables) == 0 {
-			httputil.WriteJSONResponse(w, deps.Logger, http.StatusNotFound, "no hubs with manual variables found")
+			httputil.WriteError(w, logger, manualvariables.ErrNoManualVariablesFound)
 			return
 		}
 
 		varType, err := manualvariables.GetVarType(hubName, varName, hubsVariables)
 		if err != nil {
-			status := http.StatusInternalServerError
-			var httpErr manualvariables.HTTPError
-			if errors.As(err, &httpErr) {
-				status = httpErr.HTTPStatus()
-			}
-			httputil.WriteJSONResponse(w, deps.Logger, status, err.Error())
+			httputil.WriteError(w, logger, err)
 			return
 		}
 
+		// The payload of clear is optional; it may only carry a ttl.
 		var raw map[string]json.RawMessage
-		if err = json.NewDecoder(r.Body).Decode(&raw); err != nil {
-			http.Error(w, "Invalid JSON format in request payload", http.StatusBadRequest)
-			return
-		}
-
-		if raw["data"] == nil {
-			http.Error(w, `Invalid request payload. expect {"data": any}`, http.StatusBadRequest)
+		if err = json.NewDecoder(r.Body).Decode(&raw); err != nil && (command != valkey.CommandClear || !errors.Is(err, io.EOF)) {
+			var mbe *http.MaxBytesError
+			if errors.As(err, &mbe) {
+				httputil.WriteProblem(w, logger, http.StatusRequestEntityTooLarge, httputil.CodeBodyTooLarge, "request body too large (max "+formatByteSize(mbe.Limit)+")")
+				return
+			}
+			httputil.WriteProblem(w, logger, http.StatusBadRequest, httputil.CodeInvalidJSON, "invalid JSON format in request payload")
 			return
 		}
 
-		command := valkey.CommandAdd
-		if r.Method == http.MethodDelete {
-			command = valkey.CommandDel
+		var data json.RawMessage
+		if command != valkey.CommandClear {
+			if raw["data"] == nil {
+				httputil.WriteProblem(w, logger, http.StatusBadRequest, httputil.CodeInvalidRequest, `invalid request payload: expected {"data": any}`)
+				return
+			}
+			data = raw["data"]
 		}
-
-		parser, err := valkey.GetParser(varType, command)
+		ttl, err := decodeTTL(raw["ttl"], deps.Config.Reverts.MaxTTL)
 		if err != nil {
-			http.Error(w, "Invalid request payload: "+err.Error(), http.StatusBadRequest)
+			httputil.WriteError(w, logger, err)
 			return
 		}
 
-		payload, err := parser(raw["data"])
+		ids, _ := requestid.FromContext(r.Context())
+		event, payload, err := newVariableEvent(hubName, varName, varType, command, data, ids.CorrelationID)
 		if err != nil {
-			http.Error(w, "Invalid request payload: "+stringutil.UpperFirst(err.Error()), http.StatusBadRequest)
+			httputil.WriteError(w, logger, err)
 			return
 		}
 
-		event, err := eventing.NewMdaiEvent(hubName, varName, string(varType), string(command), payload)
-		if err != nil {
-			http.Error(w, "Invalid request payload", http.StatusBadRequest)
-			return
+		ifMatch := r.Header.Get("If-Match")
+		var current any
+		var expected *int64
+		if ifMatch != "" {
+			version, err := valkey.Version(ctx, deps.ValkeyClient, hubName, varName)
+			if err != nil {
+				httputil.WriteError(w, logger, err)
+				return
+			}
+			expected = &version
+		}
+		if dryRun || ifMatch != "" || ttl > 0 {
+			current, err = valkey.GetValue(ctx, valkey.NewAdapter(deps.ValkeyClient, deps.Logger), varName, varType, hubName)
+			if err != nil {
+				httputil.WriteError(w, logger, err)
+				return
+			}
+		}
+		if ifMatch != "" {
+			if err := checkIfMatch(hubName, varName, varType, current, *expected, ifMatch); err != nil {
+				httputil.WriteError(w, logger, err)
+				return
+			}
 		}
 
 		subject := subjectFromVarsEvent(*event, varName)
+		caller, _ := auth.IdentityFromContext(r.Context())
 
-		deps.Logger.Info("Publishing MdaiEvent",
+		var pending *revert.Revert
+		if ttl > 0 {
+			scheduled, ok, err := newRevert(event, varName, varType, command, current, payload, caller.Name, ttl)
+			if err != nil {
+				httputil.WriteError(w, logger, err)
+				return
+			}
+			if ok {
+				pending = &scheduled
+			}
+		}
+
+		if dryRun {
+			preview, err := newVariablePreview(event, subject, varType, command, current, payload)
+			if err != nil {
+				httputil.WriteError(w, logger, err)
+				return
+			}
+			preview.Revert = pending
+			httputil.WriteJSONResponse(w, logger, http.StatusOK, preview)
+			return
+		}
+
+		store := revert.NewStore(deps.ValkeyClient)
+		if pending != nil {
+			if err := store.Add(ctx, *pending); err != nil {
+				logger.Error("Failed to schedule revert", zap.Error(err))
+				httputil.WriteProblem(w, logger, http.StatusInternalServerError, httputil.CodeInternal, "failed to schedule revert; nothing was published")
+				return
+			}
+		}
+
+		publishCtx := auditutils.WithFields(tracing.WithSpanFrom(ctx, r.Context()), auditFields(caller, decision, ids))
+
+		logger.Info("Publishing MdaiEvent",
 			zap.String("id", event.ID),
+			zap.String("caller", caller.Name),
 			zap.String("name", event.Name),
 			zap.String("source", event.Source),
 			zap.String("subject", subject.String()),
 		)
 
-		if _, err := nats.PublishEvents(ctx, deps.Logger, deps.EventPublisher, []adapter.EventPerSubject{{Event: *event, Subject: subject}}, deps.AuditAdapter); err != nil {
-			deps.Logger.Error("Failed to publish MdaiEvent", zap.Error(err))
-			http.Error(w, fmt.Sprintf("Failed to publish event: %v", err), http.StatusInternalServerError)
+		if err := publishVariableUpdate(publishCtx, logger, deps, *event, subject, hubName, varName, expected); err != nil {
+			logger.Error("Failed to publish MdaiEvent", zap.Error(err))
+			discardRevert(ctx, logger, store, pending)
+			var coded httputil.CodedError
+			if errors.As(err, &coded) {
+				httputil.WriteError(w, logger, err)
+				return
+			}
+			httputil.WriteProblem(w, logger, http.StatusInternalServerError, httputil.CodePublishFailed, fmt.Sprintf("failed to publish event: %v", err))
 			return
 		}
+		if pending != nil {
+			w.Header().Set(RevertIDHeader, pending.ID)
+		}
 
 		status := http.StatusOK
-		if r.Method == http.MethodPost {
+		if command == valkey.CommandAdd || command == valkey.CommandPush {
 			status = http.StatusCreated
 		}
 
-		httputil.WriteJSONResponse(w, deps.Logger, status, event)
+		httputil.WriteJSONResponse(w, logger, status, event)
 	}
 }
 
 func handleAuditEventsGet(ctx context.Context, deps HandlerDeps) http.HandlerFunc {
-	return func(w http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestid.Logger(r.Context(), deps.Logger)
 		eventsMap, err := deps.AuditAdapter.HandleEventsGet(ctx)
 		if err != nil {
-			deps.Logger.Error("failed to get events", zap.Error(err))
-			http.Error(w, "Unable to fetch history from Valkey", http.StatusInternalServerError)
+			logger.Error("failed to get events", zap.Error(err))
+			httputil.WriteProblem(w, logger, http.StatusInternalServerError, httputil.CodeInternal, "unable to fetch history from Valkey")
 			return
 		}
 
-		httputil.WriteJSONResponse(w, deps.Logger, http.StatusOK, eventsMap)
+		httputil.WriteJSONResponse(w, logger, http.StatusOK, eventsMap)
 	}
 }
 
 func handlePromAlertsPost(deps HandlerDeps) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		const maxBody = 10 << 20 // 10 MiB, TODO make this configurable
-		r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+		r.Body = http.MaxBytesReader(w, r.Body, deps.Config.Limits.AlertBodyMaxBytes)
 		defer r.Body.Close() //nolint:errcheck
+		logger := requestid.Logger(r.Context(), deps.Logger)
 
 		var msg webhook.Message
 		dec := json.NewDecoder(r.Body)
@@ -221,22 +347,25 @@ func handlePromAlertsPost(deps HandlerDeps) http.HandlerFunc {
 		if err := dec.Decode(&msg); err != nil {
 			var mbe *http.MaxBytesError
 			if errors.As(err, &mbe) {
-				http.Error(w, "request body too large (max 10MiB)", http.StatusRequestEntityTooLarge)
+				httputil.WriteProblem(w, logger, http.StatusRequestEntityTooLarge, httputil.CodeBodyTooLarge, "request body too large (max "+formatByteSize(mbe.Limit)+")")
 				return
 			}
-			deps.Logger.Error("Failed to decode Alertmanager JSON", zap.Error(err))
-			http.Error(w, "invalid Alertmanager payload", http.StatusBadRequest)
+			logger.Error("Failed to decode Alertmanager JSON", zap.Error(err))
+			httputil.WriteProblem(w, logger, http.StatusBadRequest, httputil.CodeInvalidJSON, "invalid Alertmanager payload")
 			return
 		}
 		// Ensure single JSON value (no trailing junk)
 		if err := dec.Decode(&struct{}{}); err != io.EOF {
-			http.Error(w, "request must contain a single JSON object", http.StatusBadRequest)
+			httputil.WriteProblem(w, logger, http.StatusBadRequest, httputil.CodeInvalidRequest, "request must contain a single JSON object")
 			return
 		}
 
-		deps.Logger.Debug("Received /alerts/alertmanager POST", zap.Any("msg", msg))
+		logger.Debug("Received /alerts/alertmanager POST", zap.Any("msg", msg))
+
+		ids, _ := requestid.FromContext(r.Context())
+		publishCtx := auditutils.WithFields(r.Context(), requestAuditFields(ids))
 
-		handlePrometheusAlerts(r.Context(), deps.Logger, w, *msg.Data, deps.EventPublisher, deps.AuditAdapter, deps.Deduper)
+		handlePrometheusAlerts(publishCtx, logger, w, *msg.Data, deps.EventPublisher, deps.AuditAdapter, deps.Deduper)
 	}
 }
 
@@ -248,31 +377,192 @@ func handlePrometheusAlerts(ctx context.Context, logger *zap.Logger, w http.Resp
 		zap.Int("alertCount", len(alertData.Alerts)))
 
 	wrappedAlertData := adapter.NewPromAlertWrapper(alertData, logger, deduper)
+	_, span := tracing.Tracer().Start(ctx, "PromAlertWrapper.ToMdaiEvents", trace.WithAttributes(
+		attribute.Int("mdai.alerts", len(alertData.Alerts)),
+	))
 	eventPerSubjects, skipped, err := wrappedAlertData.ToMdaiEvents()
+	span.SetAttributes(attribute.Int("mdai.events", len(eventPerSubjects)), attribute.Int("mdai.skipped", skipped))
+	tracing.End(span, err)
 	if err != nil {
 		logger.Error("Failed to adapt Prometheus Alert to MDAI Events", zap.Error(err))
-		http.Error(w, "Failed to adapt Prometheus Alert to MDAI Events", http.StatusInternalServerError)
+		httputil.WriteProblem(w, logger, http.StatusInternalServerError, httputil.CodeInternal, "failed to adapt Prometheus alert to MDAI events")
 		return
 	}
 
 	successCount, err := nats.PublishEvents(ctx, logger, p, eventPerSubjects, auditAdapter)
 	switch {
 	case err != nil:
-		w.WriteHeader(http.StatusAccepted)
-		_, _ = fmt.Fprintf(w, "Published %d/%d eventPerSubjects; some failed", successCount, len(eventPerSubjects))
-		return
+		response := httputil.PrometheusAlertResponse{
+			Message:    fmt.Sprintf("Published %d/%d events; some failed", successCount, len(eventPerSubjects)),
+			Total:      len(alertData.Alerts),
+			Successful: successCount,
+			Skipped:    skipped,
+			Failed:     len(eventPerSubjects) - successCount,
+		}
+
+		httputil.WriteJSONResponse(w, logger, http.StatusAccepted, response)
 	default:
 		response := httputil.PrometheusAlertResponse{
 			Message:    "Processed Prometheus alerts",
 			Total:      len(alertData.Alerts),
 			Successful: successCount,
 			Skipped:    skipped,
+			Failed:     0,
 		}
 
 		httputil.WriteJSONResponse(w, logger, http.StatusCreated, response)
 	}
 }
 
+// checkIfMatch compares the If-Match header of a write with the ETag of the current value and version of the
+// variable, as returned by GET, so a change made since the caller read the value is not silently overwritten. The
+// version moves on as soon as a write is published, so writes still in flight are seen too; publishVariableUpdate
+// makes sure the version did not move on between this check and the publish.
+func checkIfMatch(hubName, varName string, varType valkey.VariableType, current any, version int64, ifMatch string) error {
+	etag, err := valkey.ETag(varType, current, version)
+	if err != nil {
+		return err
+	}
+	if !httputil.ETagMatches(ifMatch, etag) {
+		return errChangedSinceRead(hubName, varName)
+	}
+	return nil
+}
+
+func errChangedSinceRead(hubName, varName string) error {
+	return httputil.NewError(http.StatusPreconditionFailed, httputil.CodePreconditionFailed, fmt.Sprintf("variable %s/%s changed since it was read", hubName, varName))
+}
+
+// publishVariableUpdate moves the version of a variable on and publishes event, an update of it. With expected set,
+// the version is compared and set in one step and the event is only published if it is still *expected, otherwise
+// a precondition failed CodedError is returned: of two writes checked against the same ETag, only one is published.
+func publishVariableUpdate(ctx context.Context, logger *zap.Logger, deps HandlerDeps, event eventing.MdaiEvent, subject eventing.MdaiEventSubject, hubName, varName string, expected *int64) error {
+	bumped, err := valkey.BumpVersion(ctx, deps.ValkeyClient, hubName, varName, expected)
+	if err != nil {
+		return fmt.Errorf("failed to update the version of %s/%s: %w", hubName, varName, err)
+	}
+	if !bumped {
+		return errChangedSinceRead(hubName, varName)
+	}
+	_, err = nats.PublishEvents(ctx, logger, deps.EventPublisher, []adapter.EventPerSubject{{Event: event, Subject: subject}}, deps.AuditAdapter)
+	return err
+}
+
+// newVariableEvent validates data for applying command to a variable of varType and builds the event to publish,
+// also returning the parsed payload. Errors are CodedErrors describing what is wrong with the request.
+func newVariableEvent(hubName, varName string, varType valkey.VariableType, command valkey.CommandType, data json.RawMessage, correlationID string) (*eventing.MdaiEvent, any, error) {
+	parser, err := valkey.GetParser(varType, command)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid request payload: %w", err)
+	}
+
+	payload, err := parser(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid request payload: %w", err)
+	}
+
+	event, err := eventing.NewMdaiEvent(hubName, varName, string(varType), string(command), payload)
+	if err != nil {
+		return nil, nil, httputil.NewError(http.StatusBadRequest, httputil.CodeInvalidRequest, "invalid request payload")
+	}
+	if correlationID != "" {
+		event.CorrelationID = correlationID
+	}
+	return event, payload, nil
+}
+
+// authorize consults deps.Authorizer for the caller of r and writes a 403 problem response when access is denied.
+func authorize(w http.ResponseWriter, r *http.Request, deps HandlerDeps, action, hubName, varName string) (auth.Decision, bool) {
+	decision, err := checkAccess(r, deps, action, hubName, varName)
+	if err != nil {
+		httputil.WriteError(w, requestid.Logger(r.Context(), deps.Logger), err)
+		return decision, false
+	}
+	return decision, true
+}
+
+// checkAccess consults deps.Authorizer for the caller of r. Denied access is reported as a forbidden CodedError.
+func checkAccess(r *http.Request, deps HandlerDeps, action, hubName, varName string) (auth.Decision, error) {
+	decision, err := decide(r, deps, deps.Authorizer, action, hubName, varName)
+	if err != nil || decision.Allowed {
+		return decision, err
+	}
+
+	identity, _ := auth.IdentityFromContext(r.Context())
+	requestid.Logger(r.Context(), deps.Logger).Warn("Denied variable access",
+		zap.String("caller", identity.Name),
+		zap.String("action", action),
+		zap.String("hubName", hubName),
+		zap.String("varName", varName),
+	)
+	return decision, httputil.NewError(http.StatusForbidden, httputil.CodeForbidden, fmt.Sprintf("caller %q may not %s variable %s/%s", identity.Name, action, hubName, varName))
+}
+
+// decide asks authorizer whether the caller of r may perform action on hubName/varName. A failure to decide is
+// reported as an internal CodedError.
+func decide(r *http.Request, deps HandlerDeps, authorizer auth.Authorizer, action, hubName, varName string) (auth.Decision, error) {
+	identity, authenticated := auth.IdentityFromContext(r.Context())
+	decision, err := authorizer.Authorize(r.Context(), identity, authenticated, action, hubName, varName)
+	if err != nil {
+		requestid.Logger(r.Context(), deps.Logger).Error("Failed to authorize variable access", zap.String("caller", identity.Name), zap.Error(err))
+		return decision, httputil.NewError(http.StatusInternalServerError, httputil.CodeInternal, "failed to authorize request")
+	}
+	return decision, nil
+}
+
+// accessFilter picks the variables the caller of a request may access among many, e.g. to list them. Decisions are
+// memoized for the request, see auth.Memo, and denials are not logged, since leaving out what the caller may not see
+// is expected.
+type accessFilter struct {
+	r          *http.Request
+	deps       HandlerDeps
+	authorizer *auth.Memo
+}
+
+func newAccessFilter(r *http.Request, deps HandlerDeps) *accessFilter {
+	return &accessFilter{r: r, deps: deps, authorizer: auth.NewMemo(deps.Authorizer)}
+}
+
+func (f *accessFilter) allowed(action, hubName, varName string) (auth.Decision, error) {
+	return decide(f.r, f.deps, f.authorizer, action, hubName, varName)
+}
+
+// readableVariables keeps those of variables of a hub, by name, that the caller may read.
+func (f *accessFilter) readableVariables(hubName string, variables map[string]string) (map[string]string, error) {
+	readable := make(map[string]string, len(variables))
+	for varName, varType := range variables {
+		decision, err := f.allowed(auth.ActionRead, hubName, varName)
+		if err != nil {
+			return nil, err
+		}
+		if decision.Allowed {
+			readable[varName] = varType
+		}
+	}
+	return readable, nil
+}
+
+// auditFields records who triggered a variable write, which authorization rule allowed it and the request behind it.
+func auditFields(caller auth.Identity, decision auth.Decision, ids requestid.IDs) map[string]string {
+	fields := requestAuditFields(ids)
+	fields["caller"] = caller.Name
+	if decision.Rule != "" {
+		fields["authz_decision"] = "allow"
+		fields["authz_rule"] = decision.Rule
+	}
+	return fields
+}
+
+// requestAuditFields ties audit entries to the HTTP request that produced them. The correlation ID is recorded from
+// the event itself.
+func requestAuditFields(ids requestid.IDs) map[string]string {
+	fields := make(map[string]string)
+	if ids.RequestID != "" {
+		fields["request_id"] = ids.RequestID
+	}
+	return fields
+}
+
 // subjectFromAlert creates a subject from a mdai event and variable key. Prefix has to be added later at eventing package.
 func subjectFromVarsEvent(event eventing.MdaiEvent, varkey string) eventing.MdaiEventSubject {
 	return eventing.MdaiEventSubject{
@@ -280,3 +570,19 @@ func subjectFromVarsEvent(event eventing.MdaiEvent, varkey string) eventing.Mdai
 		Path: config.SafeToken(event.HubName) + "." + config.SafeToken(varkey),
 	}
 }
+
+// formatByteSize renders a body limit for error messages, e.g. 10MiB or 1500B.
+func formatByteSize(n int64) string {
+	const (
+		kib = 1 << 10
+		mib = 1 << 20
+	)
+	switch {
+	case n >= mib && n%mib == 0:
+		return fmt.Sprintf("%dMiB", n/mib)
+	case n >= kib && n%kib == 0:
+		return fmt.Sprintf("%dKiB", n/kib)
+	default:
+		return fmt.Sprintf("%dB", n)
+	}
+}
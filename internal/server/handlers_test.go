@@ -2,11 +2,14 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path"
 	"slices"
 	"strings"
 	"testing"
@@ -15,12 +18,24 @@ import (
 	"github.com/mydecisive/mdai-data-core/audit"
 	"github.com/mydecisive/mdai-data-core/eventing"
 	datacorekube "github.com/mydecisive/mdai-data-core/kube"
+	"github.com/mydecisive/mdai-gateway/internal/auth"
+	"github.com/mydecisive/mdai-gateway/internal/config"
+	"github.com/mydecisive/mdai-gateway/internal/health"
+	"github.com/mydecisive/mdai-gateway/internal/httputil"
 	"github.com/mydecisive/mdai-gateway/internal/manualvariables"
+	"github.com/mydecisive/mdai-gateway/internal/metrics"
+	"github.com/mydecisive/mdai-gateway/internal/nats"
+	"github.com/mydecisive/mdai-gateway/internal/requestid"
+	"github.com/mydecisive/mdai-gateway/mocks"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"github.com/valkey-io/valkey-go"
 	valkeymock "github.com/valkey-io/valkey-go/mock"
 	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -81,11 +96,15 @@ func TestHandleListVariables(t *testing.T) {
 			out:    &manualvariables.ByHub{},
 			expected: &manualvariables.ByHub{
 				"mdaihub-sample": {
-					"data_boolean": "boolean",
-					"data_map":     "map",
-					"data_set":     "set",
-					"data_string":  "string",
-					"data_int":     "int",
+					"data_boolean":  "boolean",
+					"data_map":      "map",
+					"data_set":      "set",
+					"data_string":   "string",
+					"data_int":      "int",
+					"data_float":    "float",
+					"data_duration": "duration",
+					"data_json":     "json",
+					"data_list":     "list",
 				},
 			},
 		},
@@ -95,19 +114,23 @@ func TestHandleListVariables(t *testing.T) {
 			status: http.StatusOK,
 			out:    &map[string]string{},
 			expected: &map[string]string{
-				"data_boolean": "boolean",
-				"data_map":     "map",
-				"data_set":     "set",
-				"data_string":  "string",
-				"data_int":     "int",
+				"data_boolean":  "boolean",
+				"data_map":      "map",
+				"data_set":      "set",
+				"data_string":   "string",
+				"data_int":      "int",
+				"data_float":    "float",
+				"data_duration": "duration",
+				"data_json":     "json",
+				"data_list":     "list",
 			},
 		},
 		{
 			name:     "ListHub_NonExistent",
 			target:   "/variables/list/hub/nonexistent_hub",
 			status:   http.StatusNotFound,
-			out:      new(string),
-			expected: ptr("Hub not found"),
+			out:      &httputil.Problem{},
+			expected: ptr(httputil.NewProblem(http.StatusNotFound, httputil.CodeHubNotFound, "hub not found")),
 		},
 	}
 
@@ -131,6 +154,75 @@ func TestHandleListVariables(t *testing.T) {
 	}
 }
 
+func TestHandleListVariables_Authorization(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	newReaderAuth(t, &deps, []string{"mdaihub-sample"}, []string{"data_s*"})
+	mux := NewRouter(t.Context(), deps)
+
+	req := httptest.NewRequest(http.MethodGet, "/variables/list/hub/mdaihub-sample", http.NoBody)
+	req.Header.Set(auth.APIKeyHeader, "key-r")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.JSONEq(t, `{"data_set": "set", "data_string": "string"}`, rr.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/variables/list", http.NoBody)
+	req.Header.Set(auth.APIKeyHeader, "key-r")
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.JSONEq(t, `{"mdaihub-sample": {"data_set": "set", "data_string": "string"}}`, rr.Body.String())
+}
+
+// hubAuthorizer allows reading mdaihub-sample only, deciding per hub like RBAC does.
+type hubAuthorizer struct {
+	calls int
+}
+
+func (a *hubAuthorizer) HubScoped() bool {
+	return true
+}
+
+func (a *hubAuthorizer) Authorize(_ context.Context, _ auth.Identity, _ bool, _, hubName, _ string) (auth.Decision, error) {
+	a.calls++
+	return auth.Decision{Allowed: hubName == "mdaihub-sample", Rule: "hub"}, nil
+}
+
+func TestHandleListVariables_HubScopedAuthorizer(t *testing.T) {
+	clientset := newFakeClientset(t)
+	_, err := clientset.CoreV1().ConfigMaps("mdai").Create(t.Context(), &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "mdaihub-second-manual-variables",
+			Namespace: "mdai",
+			Labels: map[string]string{
+				datacorekube.ConfigMapTypeLabel: datacorekube.ManualEnvConfigMapType,
+				datacorekube.LabelMdaiHubName:   "mdaihub-second",
+			},
+		},
+		Data: map[string]string{"manual_filter": "set", "manual_severity": "int"},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	deps := setupMocks(t, clientset)
+	authorizer := &hubAuthorizer{calls: 0}
+	deps.Authorizer = authorizer
+	core, logs := observer.New(zap.WarnLevel)
+	deps.Logger = zap.New(core)
+	mux := NewRouter(t.Context(), deps)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/variables/list", http.NoBody))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var listed map[string]map[string]string
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &listed))
+	assert.Contains(t, listed, "mdaihub-sample")
+	assert.NotContains(t, listed, "mdaihub-second")
+	// The authorizer is asked once per hub, not once per variable.
+	assert.Equal(t, 2, authorizer.calls)
+	// Variables left out of a list are not logged as denied.
+	assert.Zero(t, logs.FilterMessage("Denied variable access").Len())
+}
+
 func TestHandleGetVariables(t *testing.T) {
 	getTests := []struct {
 		out       any
@@ -146,6 +238,22 @@ func TestHandleGetVariables(t *testing.T) {
 			name:     "Int",
 			target:   "/variables/values/hub/mdaihub-sample/var/data_int",
 			status:   http.StatusOK,
+			out:      &map[string]int{},
+			expected: &map[string]int{"data_int": 3},
+			valkey: func(t *testing.T, m *valkeymock.Client) {
+				t.Helper()
+				key := "variable/mdaihub-sample/data_int"
+				m.EXPECT().
+					Do(gomock.Any(), valkeymock.Match("GET", key)).
+					Return(valkeymock.Result(
+						valkeymock.ValkeyBlobString("3"),
+					))
+			},
+		},
+		{
+			name:     "IntRaw",
+			target:   "/variables/values/hub/mdaihub-sample/var/data_int?raw=true",
+			status:   http.StatusOK,
 			out:      &map[string]string{},
 			expected: &map[string]string{"data_int": "3"},
 			valkey: func(t *testing.T, m *valkeymock.Client) {
@@ -158,12 +266,28 @@ func TestHandleGetVariables(t *testing.T) {
 					))
 			},
 		},
+		{
+			name:     "IntInvalidStored",
+			target:   "/variables/values/hub/mdaihub-sample/var/data_int",
+			status:   http.StatusInternalServerError,
+			out:      &httputil.Problem{},
+			expected: ptr(httputil.NewProblem(http.StatusInternalServerError, httputil.CodeInvalidStoredValue, `variable mdaihub-sample/data_int: stored value "three" is not a valid int`)),
+			valkey: func(t *testing.T, m *valkeymock.Client) {
+				t.Helper()
+				key := "variable/mdaihub-sample/data_int"
+				m.EXPECT().
+					Do(gomock.Any(), valkeymock.Match("GET", key)).
+					Return(valkeymock.Result(
+						valkeymock.ValkeyBlobString("three"),
+					))
+			},
+		},
 		{
 			name:     "Boolean",
 			target:   "/variables/values/hub/mdaihub-sample/var/data_boolean",
 			status:   http.StatusOK,
-			out:      &map[string]string{},
-			expected: &map[string]string{"data_boolean": "true"},
+			out:      &map[string]bool{},
+			expected: &map[string]bool{"data_boolean": true},
 			valkey: func(t *testing.T, m *valkeymock.Client) {
 				t.Helper()
 				key := "variable/mdaihub-sample/data_boolean"
@@ -215,6 +339,25 @@ func TestHandleGetVariables(t *testing.T) {
 					))
 			},
 		},
+		{
+			name:     "List",
+			target:   "/variables/values/hub/mdaihub-sample/var/data_list",
+			status:   http.StatusOK,
+			out:      &map[string][]string{},
+			expected: &map[string][]string{"data_list": {"step_2", "step_1", "step_2"}},
+			valkey: func(t *testing.T, m *valkeymock.Client) {
+				t.Helper()
+				key := "variable/mdaihub-sample/data_list"
+				m.EXPECT().
+					Do(gomock.Any(), valkeymock.Match("LRANGE", key, "0", "-1")).
+					Return(valkeymock.Result(
+						valkeymock.ValkeyArray(
+							valkeymock.ValkeyBlobString("step_2"),
+							valkeymock.ValkeyBlobString("step_1"),
+							valkeymock.ValkeyBlobString("step_2")),
+					))
+			},
+		},
 		{
 			name:   "Map",
 			target: "/variables/values/hub/mdaihub-sample/var/data_map",
@@ -259,22 +402,22 @@ func TestHandleGetVariables(t *testing.T) {
 			name:     "NonExistentHub",
 			target:   "/variables/values/hub/nonexistent_hub/var/data_string",
 			status:   http.StatusNotFound,
-			out:      new(string),
-			expected: ptr("hub not found"),
+			out:      &httputil.Problem{},
+			expected: ptr(httputil.NewProblem(http.StatusNotFound, httputil.CodeHubNotFound, "hub not found")),
 		},
 		{
 			name:     "NonExistentVariable",
 			target:   "/variables/values/hub/mdaihub-sample/var/nonexistent_variable",
 			status:   http.StatusNotFound,
-			out:      new(string),
-			expected: ptr("variable not found"),
+			out:      &httputil.Problem{},
+			expected: ptr(httputil.NewProblem(http.StatusNotFound, httputil.CodeVariableNotFound, "variable not found")),
 		},
 		{
 			name:     "UnsupportedVariableType",
 			target:   "/variables/values/hub/mdaihub-sample/var/data_unsupported_type",
 			status:   http.StatusInternalServerError,
-			out:      new(string),
-			expected: ptr("unsupported variable type booleaninttstring"),
+			out:      &httputil.Problem{},
+			expected: ptr(httputil.NewProblem(http.StatusInternalServerError, httputil.CodeInternal, "internal error")),
 			cmprepare: func(t *testing.T, clientset kubernetes.Interface, cmController *datacorekube.ConfigMapController) {
 				t.Helper()
 
@@ -321,7 +464,12 @@ func TestHandleGetVariables(t *testing.T) {
 	for _, tt := range getTests {
 		t.Run(tt.name, func(t *testing.T) {
 			if tt.valkey != nil {
-				tt.valkey(t, deps.ValkeyClient.(*valkeymock.Client)) //nolint:forcetypeassert
+				mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+				tt.valkey(t, mockClient)
+				varName, _, _ := strings.Cut(path.Base(tt.target), "?")
+				mockClient.EXPECT().
+					Do(gomock.Any(), valkeymock.Match("GET", "gateway/variable-version/mdaihub-sample/"+varName)).
+					Return(valkeymock.Result(valkeymock.ValkeyNil()))
 			}
 			if tt.cmprepare != nil {
 				tt.cmprepare(t, clientset, deps.ConfigMapController)
@@ -341,12 +489,16 @@ func TestHandleGetVariables(t *testing.T) {
 			require.NoError(t, err)
 
 			switch out := tt.out.(type) {
-			case *string:
-				assert.Equal(t, *tt.expected.(*string), *out) //nolint:forcetypeassert
+			case *httputil.Problem:
+				assert.Equal(t, *tt.expected.(*httputil.Problem), *out) //nolint:forcetypeassert
 			case *map[string][]string:
 				assert.Equal(t, *tt.expected.(*map[string][]string), *out) //nolint:forcetypeassert
 			case *map[string]string:
 				assert.Equal(t, *tt.expected.(*map[string]string), *out) //nolint:forcetypeassert
+			case *map[string]int:
+				assert.Equal(t, *tt.expected.(*map[string]int), *out) //nolint:forcetypeassert
+			case *map[string]bool:
+				assert.Equal(t, *tt.expected.(*map[string]bool), *out) //nolint:forcetypeassert
 			case *map[string]map[string]string:
 				assert.Equal(t, *tt.expected.(*map[string]map[string]string), *out) //nolint:forcetypeassert
 			default:
@@ -370,6 +522,24 @@ func (XaddMatcher) String() string {
 	return "Wanted XADD to mdai_hub_event_history command"
 }
 
+// VersionBumpMatcher matches the bump of a variable version made before publishing an update of the variable.
+// Expected is the version the bump is compared with, empty for an unconditional bump.
+type VersionBumpMatcher struct {
+	Expected string
+}
+
+func (m VersionBumpMatcher) Matches(x any) bool {
+	if cmd, ok := x.(valkey.Completed); ok {
+		commands := cmd.Commands()
+		return len(commands) == 5 && commands[0] == "EVALSHA" && strings.HasPrefix(commands[3], "gateway/variable-version/") && commands[4] == m.Expected
+	}
+	return false
+}
+
+func (m VersionBumpMatcher) String() string {
+	return fmt.Sprintf("Wanted variable version bump expecting %q", m.Expected)
+}
+
 func TestHandleDeleteVariables(t *testing.T) {
 	deleteTests := []struct {
 		name string
@@ -411,7 +581,8 @@ func TestHandleDeleteVariables(t *testing.T) {
 			if !ok {
 				t.Fatal("ValkeyClient is not a *valkeymock.Client")
 			}
-			mockClient.EXPECT().Do(ctx, XaddMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
+			mockClient.EXPECT().Do(gomock.Any(), VersionBumpMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyInt64(1))).Times(1)
+			mockClient.EXPECT().Do(gomock.Any(), XaddMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
 
 			rr := httptest.NewRecorder()
 
@@ -476,7 +647,8 @@ func TestHandleSetVariables(t *testing.T) {
 			if !ok {
 				t.Fatal("ValkeyClient is not a *valkeymock.Client")
 			}
-			mockClient.EXPECT().Do(ctx, XaddMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
+			mockClient.EXPECT().Do(gomock.Any(), VersionBumpMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyInt64(1))).Times(1)
+			mockClient.EXPECT().Do(gomock.Any(), XaddMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
 
 			rr := httptest.NewRecorder()
 
@@ -500,6 +672,384 @@ func TestHandleSetVariables(t *testing.T) {
 	}
 }
 
+func TestHandleSetVariables_NormalizedTypes(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mux := NewRouter(t.Context(), deps)
+	mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	tests := []struct {
+		name string
+		body string
+		data string
+	}{
+		{
+			name: "float",
+			body: `{"data":2.50}`,
+			data: `"2.5"`,
+		},
+		{
+			name: "duration",
+			body: `{"data":"PT1H30M"}`,
+			data: `"1h30m0s"`,
+		},
+		{
+			name: "json",
+			body: `{"data":{ "threshold": 0.5 }}`,
+			data: `"{\"threshold\":0.5}"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient.EXPECT().Do(gomock.Any(), VersionBumpMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyInt64(1))).Times(1)
+			mockClient.EXPECT().Do(gomock.Any(), XaddMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
+
+			req := httptest.NewRequest(http.MethodPost, "/variables/hub/mdaihub-sample/var/data_"+tt.name, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+			require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+			var result eventing.MdaiEvent
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+			assert.JSONEq(t, fmt.Sprintf(`{"variableRef":%q,"dataType":%q,"operation":"add","data":%s}`, "data_"+tt.name, tt.name, tt.data), result.Payload)
+		})
+	}
+
+	t.Run("invalid duration", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/variables/hub/mdaihub-sample/var/data_duration", bytes.NewBufferString(`{"data":"P1M"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		assertProblem(t, rr, http.StatusBadRequest, httputil.CodeInvalidValue, `invalid request payload: invalid ISO 8601 duration "P1M": expected weeks or days and a time, e.g. P1DT12H`)
+	})
+}
+
+func TestHandlePushVariables(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mux := NewRouter(t.Context(), deps)
+	mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	mockClient.EXPECT().Do(gomock.Any(), VersionBumpMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyInt64(1))).Times(1)
+	mockClient.EXPECT().Do(gomock.Any(), XaddMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
+	req := httptest.NewRequest(http.MethodPost, "/variables/hub/mdaihub-sample/var/data_list/push", bytes.NewBufferString(`{"data":["step_2","step_1"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+	var result eventing.MdaiEvent
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.Equal(t, "var.push", result.Name)
+	assert.JSONEq(t, `{"variableRef":"data_list","dataType":"list","operation":"push","data":["step_2","step_1"]}`, result.Payload)
+
+	t.Run("add to list", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/variables/hub/mdaihub-sample/var/data_list", bytes.NewBufferString(`{"data":["step_3"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		assertProblem(t, rr, http.StatusBadRequest, httputil.CodeUnsupportedOperation, `invalid request payload: unsupported command "add" for variable type "list"`)
+	})
+}
+
+func TestHandleReplaceVariables(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mux := NewRouter(t.Context(), deps)
+	mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	replaceTests := []struct {
+		name string
+		body string
+	}{
+		{
+			name: "set",
+			body: `{"data":["service-a","service-b"]}`,
+		},
+		{
+			name: "map",
+			body: `{"data":{"attrib.111":"value.111"}}`,
+		},
+	}
+
+	for _, tt := range replaceTests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient.EXPECT().Do(gomock.Any(), VersionBumpMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyInt64(1))).Times(1)
+			mockClient.EXPECT().Do(gomock.Any(), XaddMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
+
+			req := httptest.NewRequest(http.MethodPut, "/variables/hub/mdaihub-sample/var/data_"+tt.name, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+			var result eventing.MdaiEvent
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+			assert.Equal(t, "var.replace", result.Name)
+			assert.JSONEq(t, fmt.Sprintf(`{"variableRef":%q,"dataType":%q,"operation":"replace","data":%v}`, "data_"+tt.name, tt.name, stringifyData(t, tt.body)), result.Payload)
+		})
+	}
+
+	t.Run("scalar", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/variables/hub/mdaihub-sample/var/data_string", bytes.NewBufferString(`{"data":"x"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		assertProblem(t, rr, http.StatusBadRequest, httputil.CodeUnsupportedOperation, `invalid request payload: unsupported command "replace" for variable type "string"`)
+	})
+}
+
+func TestHandleClearVariables(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mux := NewRouter(t.Context(), deps)
+	mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	for _, varType := range []string{"string", "boolean", "int", "set", "map"} {
+		t.Run(varType, func(t *testing.T) {
+			mockClient.EXPECT().Do(gomock.Any(), VersionBumpMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyInt64(1))).Times(1)
+			mockClient.EXPECT().Do(gomock.Any(), XaddMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
+
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/variables/hub/mdaihub-sample/var/data_"+varType+"/clear", http.NoBody))
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+			var result eventing.MdaiEvent
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+			assert.Equal(t, "var.clear", result.Name)
+			assert.JSONEq(t, fmt.Sprintf(`{"variableRef":%q,"dataType":%q,"operation":"clear","data":null}`, "data_"+varType, varType), result.Payload)
+		})
+	}
+}
+
+func TestHandleIncrementVariables(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mux := NewRouter(t.Context(), deps)
+	mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	tests := []struct {
+		name      string
+		path      string
+		body      string
+		operation string
+		data      string
+	}{
+		{
+			name:      "increment by default",
+			path:      "/variables/hub/mdaihub-sample/var/data_int/increment",
+			body:      `{"data":{}}`,
+			operation: "increment",
+			data:      `{"by":1}`,
+		},
+		{
+			name:      "decrement clamped",
+			path:      "/variables/hub/mdaihub-sample/var/data_int/decrement",
+			body:      `{"data":{"by":5,"min":0}}`,
+			operation: "decrement",
+			data:      `{"by":5,"min":0}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient.EXPECT().Do(gomock.Any(), VersionBumpMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyInt64(1))).Times(1)
+			mockClient.EXPECT().Do(gomock.Any(), XaddMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+			var result eventing.MdaiEvent
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+			assert.Equal(t, "var."+tt.operation, result.Name)
+			assert.JSONEq(t, fmt.Sprintf(`{"variableRef":"data_int","dataType":"int","operation":%q,"data":%s}`, tt.operation, tt.data), result.Payload)
+		})
+	}
+
+	t.Run("non-int variable", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/variables/hub/mdaihub-sample/var/data_string/increment", bytes.NewBufferString(`{"data":{}}`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		assertProblem(t, rr, http.StatusBadRequest, httputil.CodeUnsupportedOperation, `invalid request payload: unsupported command "increment" for variable type "string"`)
+	})
+}
+
+func TestHandleSetVariables_IfMatch(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mux := NewRouter(t.Context(), deps)
+	mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	expectMembers := func(members ...string) {
+		values := make([]valkey.ValkeyMessage, 0, len(members))
+		for _, member := range members {
+			values = append(values, valkeymock.ValkeyBlobString(member))
+		}
+		mockClient.EXPECT().
+			Do(gomock.Any(), valkeymock.Match("SMEMBERS", "variable/mdaihub-sample/data_set")).
+			Return(valkeymock.Result(valkeymock.ValkeyArray(values...))).Times(1)
+	}
+
+	expectVersion := func(version string) {
+		result := valkeymock.ValkeyNil()
+		if version != "" {
+			result = valkeymock.ValkeyBlobString(version)
+		}
+		mockClient.EXPECT().
+			Do(gomock.Any(), valkeymock.Match("GET", "gateway/variable-version/mdaihub-sample/data_set")).
+			Return(valkeymock.Result(result)).Times(1)
+	}
+	expectBump := func(expected string, version int64) {
+		mockClient.EXPECT().
+			Do(gomock.Any(), VersionBumpMatcher{Expected: expected}).
+			Return(valkeymock.Result(valkeymock.ValkeyInt64(version))).Times(1)
+	}
+
+	expectMembers("service-a", "service-b")
+	expectVersion("")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/variables/values/hub/mdaihub-sample/var/data_set", http.NoBody))
+	require.Equal(t, http.StatusOK, rr.Code)
+	etag := rr.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	newRequest := func(ifMatch string) *http.Request {
+		req := httptest.NewRequest(http.MethodPut, "/variables/hub/mdaihub-sample/var/data_set", bytes.NewBufferString(`{"data":["service-c"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", ifMatch)
+		return req
+	}
+
+	t.Run("unchanged", func(t *testing.T) {
+		expectVersion("0")
+		// Valkey returns set members in any order.
+		expectMembers("service-b", "service-a")
+		expectBump("0", 1)
+		mockClient.EXPECT().Do(gomock.Any(), XaddMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
+
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, newRequest(etag))
+		assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		expectVersion("")
+		expectMembers("service-a")
+		mockClient.EXPECT().Do(gomock.Any(), VersionBumpMatcher{Expected: "0"}).Times(0)
+		mockClient.EXPECT().Do(gomock.Any(), XaddMatcher{}).Times(0)
+
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, newRequest(etag))
+		assertProblem(t, rr, http.StatusPreconditionFailed, httputil.CodePreconditionFailed, "variable mdaihub-sample/data_set changed since it was read")
+	})
+
+	t.Run("written", func(t *testing.T) {
+		// A write was published since the read, but the operator has not applied it yet.
+		expectVersion("1")
+		expectMembers("service-a", "service-b")
+		mockClient.EXPECT().Do(gomock.Any(), VersionBumpMatcher{Expected: "1"}).Times(0)
+		mockClient.EXPECT().Do(gomock.Any(), XaddMatcher{}).Times(0)
+
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, newRequest(etag))
+		assertProblem(t, rr, http.StatusPreconditionFailed, httputil.CodePreconditionFailed, "variable mdaihub-sample/data_set changed since it was read")
+	})
+
+	t.Run("any", func(t *testing.T) {
+		expectVersion("3")
+		expectMembers()
+		expectBump("3", 4)
+		mockClient.EXPECT().Do(gomock.Any(), XaddMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
+
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, newRequest("*"))
+		assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	})
+
+	t.Run("in flight", func(t *testing.T) {
+		// Both writes are checked before either is published; only the first one moves the version on.
+		expectVersion("")
+		expectMembers("service-a", "service-b")
+		expectVersion("")
+		expectMembers("service-a", "service-b")
+		expectBump("0", 1)
+		expectBump("0", -1)
+		mockClient.EXPECT().Do(gomock.Any(), XaddMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
+
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, newRequest(etag))
+		assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		rr = httptest.NewRecorder()
+		mux.ServeHTTP(rr, newRequest(etag))
+		assertProblem(t, rr, http.StatusPreconditionFailed, httputil.CodePreconditionFailed, "variable mdaihub-sample/data_set changed since it was read")
+	})
+}
+
+func TestHandleSetVariables_DryRun(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mockPub := &mocks.MockPublisher{}
+	deps.EventPublisher = mockPub
+	mux := NewRouter(t.Context(), deps)
+	mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+	mockClient.EXPECT().Do(gomock.Any(), XaddMatcher{}).Times(0)
+
+	t.Run("set", func(t *testing.T) {
+		mockClient.EXPECT().
+			Do(gomock.Any(), valkeymock.Match("SMEMBERS", "variable/mdaihub-sample/data_set")).
+			Return(valkeymock.Result(valkeymock.ValkeyArray(valkeymock.ValkeyBlobString("service-b"), valkeymock.ValkeyBlobString("service-a")))).Times(1)
+
+		req := httptest.NewRequest(http.MethodDelete, "/variables/hub/mdaihub-sample/var/data_set?dryRun=true", bytes.NewBufferString(`{"data":["service-a"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var preview VariablePreview
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &preview))
+		assert.True(t, preview.DryRun)
+		assert.Equal(t, "var.mdaihub-sample.data_set", preview.Subject)
+		require.NotNil(t, preview.Event)
+		assert.Equal(t, "var.remove", preview.Event.Name)
+		assert.Equal(t, []any{"service-b", "service-a"}, preview.Before)
+		assert.Equal(t, []any{"service-b"}, preview.After)
+	})
+
+	t.Run("increment", func(t *testing.T) {
+		mockClient.EXPECT().
+			Do(gomock.Any(), valkeymock.Match("GET", "variable/mdaihub-sample/data_int")).
+			Return(valkeymock.Result(valkeymock.ValkeyBlobString("9"))).Times(1)
+
+		req := httptest.NewRequest(http.MethodPost, "/variables/hub/mdaihub-sample/var/data_int/increment?dryRun=1", bytes.NewBufferString(`{"data":{"by":5,"max":10}}`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var preview VariablePreview
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &preview))
+		assert.Equal(t, "9", preview.Before)
+		assert.Equal(t, "10", preview.After)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/variables/hub/mdaihub-sample/var/data_string?dryRun=maybe", bytes.NewBufferString(`{"data":"x"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		assertProblem(t, rr, http.StatusBadRequest, httputil.CodeInvalidRequest, "dryRun must be a boolean")
+	})
+
+	mockPub.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything, mock.Anything)
+}
+
 func TestHandleSetVariables_InvalidRequestPayload(t *testing.T) {
 	setTests := []struct {
 		name     string
@@ -509,42 +1059,42 @@ func TestHandleSetVariables_InvalidRequestPayload(t *testing.T) {
 		{
 			name:     "string",
 			body:     `{"data":true}`,
-			expected: "Invalid request payload: String expected\n",
+			expected: "invalid request payload: string expected",
 		},
 		{
 			name:     "boolean",
 			body:     `{"data":"true"}`,
-			expected: "Invalid request payload: Boolean expected\n",
+			expected: "invalid request payload: boolean expected",
 		},
 		{
 			name:     "int",
 			body:     `{"data":"123"}`,
-			expected: "Invalid request payload: Int expected\n",
+			expected: "invalid request payload: int expected",
 		},
 		{
 			name:     "int",
 			body:     `{"data":"12.3"}`,
-			expected: "Invalid request payload: Int expected\n",
+			expected: "invalid request payload: int expected",
 		},
 		{
 			name:     "set",
 			body:     `{"data":"set"}`,
-			expected: "Invalid request payload: List expected\n",
+			expected: "invalid request payload: list expected",
 		},
 		{
 			name:     "set",
 			body:     `{"data":[123]}`,
-			expected: "Invalid request payload: List expected\n",
+			expected: "invalid request payload: list expected",
 		},
 		{
 			name:     "map",
 			body:     `{"data":"map"}`,
-			expected: "Invalid request payload: Map expected\n",
+			expected: "invalid request payload: map expected",
 		},
 		{
 			name:     "map",
 			body:     `{"data": {"foo":123}}`,
-			expected: "Invalid request payload: Map expected\n",
+			expected: "invalid request payload: map expected",
 		},
 	}
 
@@ -561,8 +1111,7 @@ func TestHandleSetVariables_InvalidRequestPayload(t *testing.T) {
 
 			mux.ServeHTTP(rr, req)
 
-			assert.Equal(t, http.StatusBadRequest, rr.Code)
-			assert.Equal(t, tt.expected, rr.Body.String())
+			assertProblem(t, rr, http.StatusBadRequest, httputil.CodeInvalidValue, tt.expected)
 		})
 	}
 }
@@ -576,42 +1125,42 @@ func TestHandleDeleteVariables_InvalidRequestPayload(t *testing.T) {
 		{
 			name:     "string",
 			body:     `{"data":true}`,
-			expected: "Invalid request payload: String expected\n",
+			expected: "invalid request payload: string expected",
 		},
 		{
 			name:     "boolean",
 			body:     `{"data":"true"}`,
-			expected: "Invalid request payload: Boolean expected\n",
+			expected: "invalid request payload: boolean expected",
 		},
 		{
 			name:     "int",
 			body:     `{"data":"123"}`,
-			expected: "Invalid request payload: Int expected\n",
+			expected: "invalid request payload: int expected",
 		},
 		{
 			name:     "int",
 			body:     `{"data":12.3}`,
-			expected: "Invalid request payload: Int expected\n",
+			expected: "invalid request payload: int expected",
 		},
 		{
 			name:     "set",
 			body:     `{"data":"set"}`,
-			expected: "Invalid request payload: List expected\n",
+			expected: "invalid request payload: list expected",
 		},
 		{
 			name:     "set",
 			body:     `{"data":[123]}`,
-			expected: "Invalid request payload: List expected\n",
+			expected: "invalid request payload: list expected",
 		},
 		{
 			name:     "map",
 			body:     `{"data":"map"}`,
-			expected: "Invalid request payload: List expected\n",
+			expected: "invalid request payload: list expected",
 		},
 		{
 			name:     "map",
 			body:     `{"data": {"foo":123}}`,
-			expected: "Invalid request payload: List expected\n",
+			expected: "invalid request payload: list expected",
 		},
 	}
 
@@ -628,8 +1177,7 @@ func TestHandleDeleteVariables_InvalidRequestPayload(t *testing.T) {
 
 			mux.ServeHTTP(rr, req)
 
-			assert.Equal(t, http.StatusBadRequest, rr.Code)
-			assert.Equal(t, tt.expected, rr.Body.String())
+			assertProblem(t, rr, http.StatusBadRequest, httputil.CodeInvalidValue, tt.expected)
 		})
 	}
 }
@@ -754,8 +1302,7 @@ func TestAlerts_Failuers(t *testing.T) {
 	rr := httptest.NewRecorder()
 	mux.ServeHTTP(rr, req)
 
-	assert.Equal(t, http.StatusBadRequest, rr.Code)
-	assert.Equal(t, "invalid Alertmanager payload\n", rr.Body.String())
+	assertProblem(t, rr, http.StatusBadRequest, httputil.CodeInvalidJSON, "invalid Alertmanager payload")
 
 	// io.ReadAll failure
 	mux = NewRouter(t.Context(), deps)
@@ -765,8 +1312,7 @@ func TestAlerts_Failuers(t *testing.T) {
 	rr = httptest.NewRecorder()
 	mux.ServeHTTP(rr, req)
 
-	assert.Equal(t, http.StatusBadRequest, rr.Code)
-	assert.Equal(t, "invalid Alertmanager payload\n", rr.Body.String())
+	assertProblem(t, rr, http.StatusBadRequest, httputil.CodeInvalidJSON, "invalid Alertmanager payload")
 
 	// bad json
 	mux = NewRouter(t.Context(), deps)
@@ -776,8 +1322,7 @@ func TestAlerts_Failuers(t *testing.T) {
 	rr = httptest.NewRecorder()
 	mux.ServeHTTP(rr, req)
 
-	assert.Equal(t, http.StatusBadRequest, rr.Code)
-	assert.Equal(t, "invalid Alertmanager payload\n", rr.Body.String())
+	assertProblem(t, rr, http.StatusBadRequest, httputil.CodeInvalidJSON, "invalid Alertmanager payload")
 }
 
 func TestAlerts_NotAllowed(t *testing.T) {
@@ -842,8 +1387,7 @@ func TestAudit_Fail(t *testing.T) {
 	rr := httptest.NewRecorder()
 	mux.ServeHTTP(rr, req)
 
-	assert.Equal(t, http.StatusInternalServerError, rr.Code)
-	assert.Equal(t, "Unable to fetch history from Valkey\n", rr.Body.String())
+	assertProblem(t, rr, http.StatusInternalServerError, httputil.CodeInternal, "unable to fetch history from Valkey")
 }
 
 func TestAlets_TrailingJSON(t *testing.T) {
@@ -862,8 +1406,7 @@ func TestAlets_TrailingJSON(t *testing.T) {
 	rr := httptest.NewRecorder()
 	mux.ServeHTTP(rr, req)
 
-	assert.Equal(t, http.StatusBadRequest, rr.Code)
-	assert.Equal(t, "request must contain a single JSON object\n", rr.Body.String())
+	assertProblem(t, rr, http.StatusBadRequest, httputil.CodeInvalidRequest, "request must contain a single JSON object")
 }
 
 func TestAlerts_BodyTooLarge(t *testing.T) {
@@ -894,8 +1437,7 @@ func TestAlerts_BodyTooLarge(t *testing.T) {
 	rr := httptest.NewRecorder()
 	mux.ServeHTTP(rr, req)
 
-	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
-	assert.Equal(t, "request body too large (max 10MiB)\n", rr.Body.String())
+	assertProblem(t, rr, http.StatusRequestEntityTooLarge, httputil.CodeBodyTooLarge, "request body too large (max 10MiB)")
 }
 
 func TestAlerts_WrongContentType(t *testing.T) {
@@ -912,6 +1454,249 @@ func TestAlerts_WrongContentType(t *testing.T) {
 	rr := httptest.NewRecorder()
 	mux.ServeHTTP(rr, req)
 
-	assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
-	assert.Equal(t, "Content-Type header must be application/json\n", rr.Body.String())
+	assertProblem(t, rr, http.StatusUnsupportedMediaType, httputil.CodeUnsupportedMediaType, "Content-Type header must be application/json")
+}
+
+func TestHandleSetVariables_BodyTooLarge(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	deps.Config.Limits.VariableBodyMaxBytes = 16
+	mux := NewRouter(t.Context(), deps)
+
+	req := httptest.NewRequest(http.MethodPost, "/variables/hub/mdaihub-sample/var/data_string", bytes.NewBufferString(`{"data":"data_string_that_is_too_long"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	assertProblem(t, rr, http.StatusRequestEntityTooLarge, httputil.CodeBodyTooLarge, "request body too large (max 16B)")
+}
+
+func TestRouter_DisabledFeatures(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	deps.Config.Features.AuditAPI = false
+	deps.Config.Features.OpAMP = false
+	deps.Config.Features.Metrics = false
+	deps.OpAMPServer = nil
+	mux := NewRouter(t.Context(), deps)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/audit", http.NoBody),
+		httptest.NewRequest(http.MethodPost, "/opamp", http.NoBody),
+		httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody),
+	} {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNotFound, rr.Code, req.URL.Path)
+	}
+}
+
+func TestFormatByteSize(t *testing.T) {
+	assert.Equal(t, "10MiB", formatByteSize(10<<20))
+	assert.Equal(t, "4KiB", formatByteSize(4<<10))
+	assert.Equal(t, "1500B", formatByteSize(1500))
+}
+
+func TestRouter_RequireAuthForWrites(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	authenticator, err := auth.NewStaticAuthenticator(auth.CredentialsFile{})
+	require.NoError(t, err)
+	deps.Authenticator = authenticator
+	deps.Config.Auth.RequireForWrites = true
+	mux := NewRouter(t.Context(), deps)
+
+	req := httptest.NewRequest(http.MethodPost, "/variables/hub/mdaihub-sample/var/data_string", bytes.NewBufferString(`{"data":"x"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	// Reads stay open because they were not configured to require authentication.
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/variables/list", http.NoBody))
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+type XaddFieldsMatcher map[string]string
+
+func (m XaddFieldsMatcher) Matches(x any) bool {
+	cmd, ok := x.(valkey.Completed)
+	if !ok || !(XaddMatcher{}).Matches(x) {
+		return false
+	}
+	commands := cmd.Commands()
+	for key, value := range m {
+		idx := slices.Index(commands, key)
+		if idx < 0 || idx+1 >= len(commands) || commands[idx+1] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (m XaddFieldsMatcher) String() string {
+	return fmt.Sprintf("Wanted XADD to mdai_hub_event_history with fields %v", map[string]string(m))
+}
+
+func TestHandleSetVariables_Authorization(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	authenticator, err := auth.NewStaticAuthenticator(auth.CredentialsFile{
+		APIKeys: []auth.Credential{
+			{Identity: "team-a", Secret: "key-a"},
+			{Identity: "team-b", Secret: "key-b"},
+		},
+	})
+	require.NoError(t, err)
+	deps.Authenticator = authenticator
+	deps.Authorizer = auth.NewPolicy([]config.AuthRule{{
+		Name:       "team-a-sample",
+		Identities: []string{"team-a"},
+		Hubs:       []string{"mdaihub-*"},
+		Variables:  []string{"data_*"},
+		Actions:    []string{auth.ActionWrite},
+	}})
+	mux := NewRouter(t.Context(), deps)
+
+	newRequest := func(apiKey string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/variables/hub/mdaihub-sample/var/data_string", bytes.NewBufferString(`{"data":"x"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(auth.APIKeyHeader, apiKey)
+		return req
+	}
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, newRequest("key-b"))
+	assertProblem(t, rr, http.StatusForbidden, httputil.CodeForbidden, `caller "team-b" may not write variable mdaihub-sample/data_string`)
+
+	deps.ValkeyClient.(*valkeymock.Client).EXPECT(). //nolint:forcetypeassert
+								Do(gomock.Any(), VersionBumpMatcher{}).
+								Return(valkeymock.Result(valkeymock.ValkeyInt64(1))).Times(1)
+	deps.ValkeyClient.(*valkeymock.Client).EXPECT(). //nolint:forcetypeassert
+								Do(gomock.Any(), XaddFieldsMatcher{"caller": "team-a", "authz_decision": "allow", "authz_rule": "team-a-sample"}).
+								Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, newRequest("key-a"))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+}
+
+func TestHandleSetVariables_CorrelationID(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mux := NewRouter(t.Context(), deps)
+
+	deps.ValkeyClient.(*valkeymock.Client).EXPECT(). //nolint:forcetypeassert
+								Do(gomock.Any(), VersionBumpMatcher{}).
+								Return(valkeymock.Result(valkeymock.ValkeyInt64(1))).Times(1)
+	deps.ValkeyClient.(*valkeymock.Client).EXPECT(). //nolint:forcetypeassert
+								Do(gomock.Any(), XaddFieldsMatcher{"correlation_id": "ui-click-42", "request_id": "req-1"}).
+								Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
+
+	req := httptest.NewRequest(http.MethodPost, "/variables/hub/mdaihub-sample/var/data_string", bytes.NewBufferString(`{"data":"x"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(requestid.RequestIDHeader, "req-1")
+	req.Header.Set(requestid.CorrelationIDHeader, "ui-click-42")
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, "req-1", rr.Header().Get(requestid.RequestIDHeader))
+	assert.Equal(t, "ui-click-42", rr.Header().Get(requestid.CorrelationIDHeader))
+
+	var result eventing.MdaiEvent
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.Equal(t, "ui-click-42", result.CorrelationID)
+}
+
+func TestRouter_GeneratesRequestID(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mux := NewRouter(t.Context(), deps)
+
+	req := httptest.NewRequest(http.MethodGet, "/variables/list/hub/nonexistent_hub", http.NoBody)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	requestID := rr.Header().Get(requestid.RequestIDHeader)
+	assert.NotEmpty(t, requestID)
+	assert.Equal(t, requestID, rr.Header().Get(requestid.CorrelationIDHeader))
+}
+
+func TestRouter_Metrics(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mux := NewRouter(t.Context(), deps)
+
+	published := metrics.EventsPublished.WithLabelValues(eventing.ManualVariablesEventSource, "mdaihub-sample", metrics.ResultSuccess)
+	before := testutil.ToFloat64(published)
+
+	deps.ValkeyClient.(*valkeymock.Client).EXPECT(). //nolint:forcetypeassert
+								Do(gomock.Any(), VersionBumpMatcher{}).
+								Return(valkeymock.Result(valkeymock.ValkeyInt64(1))).Times(1)
+	deps.ValkeyClient.(*valkeymock.Client).EXPECT(). //nolint:forcetypeassert
+								Do(gomock.Any(), XaddMatcher{}).
+								Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
+	req := httptest.NewRequest(http.MethodPost, "/variables/hub/mdaihub-sample/var/data_string", bytes.NewBufferString(`{"data":"x"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusCreated, rr.Code)
+
+	assert.InDelta(t, before+1, testutil.ToFloat64(published), 0)
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `mdai_gateway_http_requests_total{code="201",method="POST",route="/variables/hub/{hubName}/var/{varName}"}`)
+}
+
+func TestRouter_Health(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	valkeyClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	rr := httptest.NewRecorder()
+	NewRouter(t.Context(), deps).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthz", http.NoBody))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, rr.Body.String())
+
+	valkeyClient.EXPECT().Do(gomock.Any(), valkeymock.Match("PING")).Return(valkeymock.Result(valkeymock.ValkeyString("PONG"))).Times(1)
+	rr = httptest.NewRecorder()
+	NewRouter(t.Context(), deps).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", http.NoBody))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{
+		"status": "ready",
+		"checks": {
+			"valkey": {"status": "ok", "required": true},
+			"nats": {"status": "ok", "required": true},
+			"configmaps": {"status": "ok", "required": true},
+			"opamp": {"status": "ok", "required": true}
+		}
+	}`, rr.Body.String())
+
+	require.NoError(t, deps.EventPublisher.(*nats.EventPublisher).Close()) //nolint:forcetypeassert
+	valkeyClient.EXPECT().Do(gomock.Any(), valkeymock.Match("PING")).Return(valkeymock.ErrorResult(errors.New("connection refused"))).Times(2)
+
+	rr = httptest.NewRecorder()
+	NewRouter(t.Context(), deps).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", http.NoBody))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	var report health.Report
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+	assert.Equal(t, health.StatusUnready, report.Status)
+	assert.Equal(t, health.CheckResult{Status: health.StatusError, Required: true, Error: "connection refused"}, report.Checks[config.HealthCheckValkey])
+	assert.Equal(t, health.StatusError, report.Checks[config.HealthCheckNATS].Status)
+
+	// Only OpAMP and the ConfigMap cache are required, so the outages are reported but tolerated.
+	deps.Config.Health.Required = []string{config.HealthCheckConfigMaps, config.HealthCheckOpAMP}
+	rr = httptest.NewRecorder()
+	NewRouter(t.Context(), deps).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", http.NoBody))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+	assert.Equal(t, health.StatusReady, report.Status)
+	assert.False(t, report.Checks[config.HealthCheckValkey].Required)
+	assert.Equal(t, health.StatusError, report.Checks[config.HealthCheckNATS].Status)
 }
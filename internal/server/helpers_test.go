@@ -4,15 +4,20 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/mydecisive/mdai-data-core/audit"
-	"github.com/mydecisive/mdai-data-core/eventing/publisher"
 	datacorekube "github.com/mydecisive/mdai-data-core/kube"
 	"github.com/mydecisive/mdai-gateway/internal/adapter"
+	"github.com/mydecisive/mdai-gateway/internal/auth"
+	"github.com/mydecisive/mdai-gateway/internal/config"
+	"github.com/mydecisive/mdai-gateway/internal/httputil"
+	"github.com/mydecisive/mdai-gateway/internal/nats"
 	"github.com/mydecisive/mdai-gateway/internal/opamp"
 	natsserver "github.com/nats-io/nats-server/v2/server"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	valkeymock "github.com/valkey-io/valkey-go/mock"
 	"go.uber.org/mock/gomock"
@@ -42,11 +47,15 @@ func newFakeClientset(t *testing.T) kubernetes.Interface { //nolint:ireturn
 			},
 		},
 		Data: map[string]string{
-			"data_boolean": "boolean",
-			"data_map":     "map",
-			"data_set":     "set",
-			"data_string":  "string",
-			"data_int":     "int",
+			"data_boolean":  "boolean",
+			"data_map":      "map",
+			"data_set":      "set",
+			"data_string":   "string",
+			"data_int":      "int",
+			"data_float":    "float",
+			"data_duration": "duration",
+			"data_json":     "json",
+			"data_list":     "list",
 		},
 	}
 
@@ -107,6 +116,26 @@ func (*errReader) Close() error {
 	return nil
 }
 
+// assertProblem checks that rr holds an application/problem+json response with the given status, code and detail.
+func assertProblem(t *testing.T, rr *httptest.ResponseRecorder, status int, code, detail string) {
+	t.Helper()
+
+	assert.Equal(t, status, rr.Code)
+	assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+
+	var problem httputil.Problem
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &problem))
+	assert.Equal(t, httputil.NewProblem(status, code, detail), problem)
+}
+
+// newRecord encodes v as it is stored in Valkey.
+func newRecord(t *testing.T, v any) string {
+	t.Helper()
+	record, err := json.Marshal(v)
+	require.NoError(t, err)
+	return string(record)
+}
+
 func ptr[T any](v T) *T {
 	return &v
 }
@@ -162,7 +191,7 @@ func setupMocks(t *testing.T, clientset kubernetes.Interface) HandlerDeps {
 
 	srv := runJetStream(t)
 	t.Cleanup(func() { srv.Shutdown() })
-	eventPublisher, err := publisher.NewPublisher(t.Context(), zap.NewNop(), publisherClientName)
+	eventPublisher, err := nats.NewEventPublisher(t.Context(), zap.NewNop(), publisherClientName)
 	require.NoError(t, err)
 	t.Cleanup(func() { _ = eventPublisher.Close() })
 
@@ -171,9 +200,11 @@ func setupMocks(t *testing.T, clientset kubernetes.Interface) HandlerDeps {
 	require.NotNil(t, cmController)
 	t.Cleanup(func() { cmController.Stop() })
 
-	opampServer, _ := opamp.NewOpAMPControlServer(zap.NewNop(), auditAdapter, eventPublisher)
+	cfg := config.Default()
+	opampServer, _ := opamp.NewOpAMPControlServer(zap.NewNop(), cfg.OpAMP, auditAdapter, eventPublisher)
 
 	deps := HandlerDeps{
+		Config:              cfg,
 		Logger:              zap.NewNop(),
 		ValkeyClient:        valkeyClient,
 		AuditAdapter:        auditAdapter,
@@ -181,6 +212,9 @@ func setupMocks(t *testing.T, clientset kubernetes.Interface) HandlerDeps {
 		ConfigMapController: cmController,
 		Deduper:             adapter.NewDeduper(),
 		OpAMPServer:         opampServer,
+		Authorizer:          auth.NewPolicy(nil),
+		VarWatcher:          eventPublisher,
+		StreamsDone:         nil,
 	}
 	return deps
 }
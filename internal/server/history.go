@@ -0,0 +1,288 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	auditutils "github.com/mydecisive/mdai-gateway/internal/audit"
+	"github.com/mydecisive/mdai-gateway/internal/auth"
+	"github.com/mydecisive/mdai-gateway/internal/httputil"
+	"github.com/mydecisive/mdai-gateway/internal/manualvariables"
+	"github.com/mydecisive/mdai-gateway/internal/requestid"
+	"github.com/mydecisive/mdai-gateway/internal/valkey"
+	"go.uber.org/zap"
+)
+
+// VariableHistoryEntry is a past change of a variable, as audited: the change, the caller that made it through the
+// API and the other fields audited with it, e.g. the request ID or the revert or schedule that made it.
+type VariableHistoryEntry struct {
+	VariableChange
+
+	Actor string            `json:"actor,omitempty"`
+	Audit map[string]string `json:"audit,omitempty"`
+
+	// streamID is the ID of the audit history entry of the change.
+	streamID string
+}
+
+// VariableHistory is a page of GET /variables/history/hub/{hubName}/var/{varName}, newest change first.
+type VariableHistory struct {
+	Changes []VariableHistoryEntry `json:"changes"`
+	// NextCursor is passed as ?cursor= to get the next, older page; it is empty on the last page.
+	NextCursor string `json:"nextCursor,omitempty"`
+	// Horizon is the time of the oldest entry of the audit history when older ones were trimmed by its retention.
+	Horizon *time.Time `json:"horizon,omitempty"`
+}
+
+// VariableValueAt is the response of GET /variables/history/hub/{hubName}/var/{varName}?at=: the value of the
+// variable at a past time, rebuilt from its history.
+type VariableValueAt struct {
+	Hub   string    `json:"hub"`
+	Var   string    `json:"var"`
+	Type  string    `json:"type"`
+	At    time.Time `json:"at"`
+	Value any       `json:"value"`
+	// LastEventID is the id of the last change before At, empty when the variable had not been changed yet.
+	LastEventID string `json:"lastEventId,omitempty"`
+	// Horizon is the time of the oldest entry of the audit history when older ones were trimmed by its retention.
+	Horizon *time.Time `json:"horizon,omitempty"`
+	// Incomplete is set when Value may be wrong because changes it depends on were trimmed from the audit history.
+	Incomplete bool `json:"incomplete,omitempty"`
+}
+
+// handleVariableHistory lists the changes of a variable recorded in the audit history, a page of at most ?limit=
+// changes at a time (limits.historyMaxEntries by default and at most), reading the audit history backwards only as far
+// as the page needs. With ?at= it instead returns the value the variable had at that time, replaying its changes up to
+// then.
+func handleVariableHistory(ctx context.Context, deps HandlerDeps) http.HandlerFunc { //nolint:funlen
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestid.Logger(r.Context(), deps.Logger)
+		hubName := r.PathValue("hubName")
+		varName := r.PathValue("varName")
+		if hubName == "" || varName == "" {
+			httputil.WriteProblem(w, logger, http.StatusBadRequest, httputil.CodeMissingParameter, "hub and var name required")
+			return
+		}
+		var at time.Time
+		if s := r.URL.Query().Get("at"); s != "" {
+			var err error
+			if at, err = time.Parse(time.RFC3339, s); err != nil {
+				httputil.WriteProblem(w, logger, http.StatusBadRequest, httputil.CodeInvalidRequest, "at must be an RFC 3339 timestamp, e.g. 2025-07-19T14:00:00Z")
+				return
+			}
+		}
+		limit := deps.Config.Limits.HistoryMaxEntries
+		if s := r.URL.Query().Get("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n <= 0 {
+				httputil.WriteProblem(w, logger, http.StatusBadRequest, httputil.CodeInvalidRequest, "limit must be a positive integer")
+				return
+			}
+			limit = min(n, limit)
+		}
+
+		cursor := r.URL.Query().Get("cursor")
+		if _, err := auditutils.StreamIDTime(cursor); cursor != "" && err != nil {
+			httputil.WriteProblem(w, logger, http.StatusBadRequest, httputil.CodeInvalidRequest, fmt.Sprintf("cursor %q is not a nextCursor of a history page", cursor))
+			return
+		}
+		if _, ok := authorize(w, r, deps, auth.ActionRead, hubName, varName); !ok {
+			return
+		}
+
+		varType, err := variableType(deps, hubName, varName)
+		if err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+		horizon, err := historyHorizon(ctx, r, deps)
+		if err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+
+		if !at.IsZero() {
+			changes, complete, err := changesToReplay(ctx, r, deps, hubName, varName, auditutils.TimeStreamID(at), horizon)
+			if err != nil {
+				httputil.WriteError(w, logger, err)
+				return
+			}
+			valueType, value, err := replayChanges(varType, changes)
+			if err != nil {
+				httputil.WriteError(w, logger, err)
+				return
+			}
+			typed, err := typedValue(hubName, varName, valueType, value)
+			if err != nil {
+				httputil.WriteError(w, logger, err)
+				return
+			}
+			response := VariableValueAt{
+				Hub:         hubName,
+				Var:         varName,
+				Type:        string(valueType),
+				At:          at,
+				Value:       typed,
+				LastEventID: "",
+				Horizon:     horizon,
+				Incomplete:  !complete,
+			}
+			if len(changes) > 0 {
+				response.LastEventID = changes[len(changes)-1].EventID
+			}
+			httputil.WriteJSONResponse(w, logger, http.StatusOK, response)
+			return
+		}
+
+		end := "+"
+		if cursor != "" {
+			end = "(" + cursor
+		}
+		changes, err := scanVariableChanges(ctx, r, deps, hubName, varName, end, func(changes []VariableHistoryEntry) bool {
+			return len(changes) > limit
+		})
+		if err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+
+		page := VariableHistory{Changes: changes, NextCursor: "", Horizon: horizon}
+		if len(changes) > limit {
+			page.Changes = changes[:limit]
+			page.NextCursor = changes[limit-1].streamID
+		}
+		httputil.WriteJSONResponse(w, logger, http.StatusOK, page)
+	}
+}
+
+// variableType returns the type of a manual variable of a hub.
+func variableType(deps HandlerDeps, hubName, varName string) (valkey.VariableType, error) {
+	hubsVariables, err := deps.ConfigMapController.GetAllHubsToDataMap()
+	if err != nil {
+		return "", httputil.NewError(http.StatusInternalServerError, httputil.CodeInternal, "failed to fetch manual variables")
+	}
+	if len(hubsVariables) == 0 {
+		return "", manualvariables.ErrNoManualVariablesFound
+	}
+	return manualvariables.GetVarType(hubName, varName, hubsVariables)
+}
+
+// historyHorizon returns the time of the oldest entry of the audit history when older ones were trimmed, see
+// auditutils.Horizon, or nil when none were.
+func historyHorizon(ctx context.Context, r *http.Request, deps HandlerDeps) (*time.Time, error) {
+	horizon, err := auditutils.Horizon(ctx, deps.ValkeyClient)
+	if err != nil {
+		requestid.Logger(r.Context(), deps.Logger).Error("Failed to read audit history horizon", zap.Error(err))
+		return nil, httputil.NewError(http.StatusInternalServerError, httputil.CodeInternal, "failed to read variable history")
+	}
+	if horizon.IsZero() {
+		return nil, nil //nolint:nilnil
+	}
+	return &horizon, nil
+}
+
+// scanVariableChanges reads the changes of a variable audited up to end, see auditutils.ScanHubVarEvents, newest first,
+// until done reports true for the changes read so far or the history is exhausted.
+func scanVariableChanges(ctx context.Context, r *http.Request, deps HandlerDeps, hubName, varName, end string, done func([]VariableHistoryEntry) bool) ([]VariableHistoryEntry, error) {
+	logger := requestid.Logger(r.Context(), deps.Logger)
+	var changes []VariableHistoryEntry
+	err := auditutils.ScanHubVarEvents(ctx, deps.ValkeyClient, hubName, end, func(event auditutils.AuditedEvent) bool {
+		change, err := newVariableChange(event.Event)
+		if err != nil {
+			logger.Warn("Skipping variable event", zap.String("id", event.Event.ID), zap.Error(err))
+			return true
+		}
+		if change.Var != varName {
+			return true
+		}
+		entry := VariableHistoryEntry{VariableChange: change, Actor: event.Fields["caller"], Audit: nil, streamID: event.StreamID}
+		audit := maps.Clone(event.Fields)
+		delete(audit, "caller")
+		if len(audit) > 0 {
+			entry.Audit = audit
+		}
+		changes = append(changes, entry)
+		return !done(changes)
+	})
+	if err != nil {
+		logger.Error("Failed to read variable history", zap.String("hubName", hubName), zap.String("varName", varName), zap.Error(err))
+		return nil, httputil.NewError(http.StatusInternalServerError, httputil.CodeInternal, "failed to read variable history")
+	}
+	return changes, nil
+}
+
+// changesToReplay reads the changes of a variable audited up to end, oldest first, back to the one its value at end
+// can be replayed from: the last one that overwrites its value or changes its type. When there is none the value is
+// replayed from a variable that was never set, which is only known to be complete, as reported, when no entry of the
+// audit history was trimmed, i.e. horizon is nil.
+func changesToReplay(ctx context.Context, r *http.Request, deps HandlerDeps, hubName, varName, end string, horizon *time.Time) ([]VariableHistoryEntry, bool, error) {
+	changes, err := scanVariableChanges(ctx, r, deps, hubName, varName, end, startsOver)
+	if err != nil {
+		return nil, false, err
+	}
+	complete := horizon == nil || startsOver(changes)
+	slices.Reverse(changes)
+	return changes, complete, nil
+}
+
+// startsOver reports whether changes, newest first, can be replayed without the changes before them: the oldest one
+// overwrites the value, or the one after it is to another type, which replayChanges starts over from.
+func startsOver(changes []VariableHistoryEntry) bool {
+	if len(changes) == 0 {
+		return false
+	}
+	oldest := changes[len(changes)-1]
+	if valkey.Overwrites(valkey.VariableType(oldest.Type), valkey.CommandType(oldest.Op)) {
+		return true
+	}
+	return len(changes) > 1 && changes[len(changes)-2].Type != oldest.Type
+}
+
+// replayChanges rebuilds the value of a variable by previewing its changes in order, starting from a variable that
+// was never set. A change to another type than the one before, after the variable was redefined, starts over. It
+// returns the type of the last change, varType when there is none, and the value as GetValue would have returned it.
+func replayChanges(varType valkey.VariableType, changes []VariableHistoryEntry) (valkey.VariableType, any, error) {
+	var value any
+	for _, change := range changes {
+		changeType := valkey.VariableType(change.Type)
+		if changeType != varType {
+			value = nil
+		}
+		varType = changeType
+
+		command := valkey.CommandType(change.Op)
+		data, err := json.Marshal(change.Data)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to replay event %s: %w", change.EventID, err)
+		}
+		payload, err := valkey.EventPayload(varType, command, data)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to replay event %s: %w", change.EventID, err)
+		}
+		if value, err = valkey.Preview(varType, command, value, payload); err != nil {
+			return "", nil, fmt.Errorf("failed to replay event %s: %w", change.EventID, err)
+		}
+	}
+	if value == nil {
+		value = emptyValue(varType)
+	}
+	return varType, value, nil
+}
+
+// emptyValue is the value GetValue returns for a variable of varType that is not set.
+func emptyValue(varType valkey.VariableType) any {
+	switch varType {
+	case valkey.VariableTypeSet, valkey.VariableTypeList:
+		return []string{}
+	case valkey.VariableTypeMap:
+		return map[string]string{}
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mydecisive/mdai-data-core/eventing"
+	"github.com/mydecisive/mdai-gateway/internal/httputil"
+	"github.com/mydecisive/mdai-gateway/internal/valkey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	valkeygo "github.com/valkey-io/valkey-go"
+	valkeymock "github.com/valkey-io/valkey-go/mock"
+	"go.uber.org/mock/gomock"
+)
+
+func newVariableEventFor(t *testing.T, varName string, varType valkey.VariableType, command valkey.CommandType, payload any) *eventing.MdaiEvent {
+	t.Helper()
+	event, err := eventing.NewMdaiEvent("mdaihub-sample", varName, string(varType), string(command), payload)
+	require.NoError(t, err)
+	return event
+}
+
+// expectHistoryScan expects the audit history to be read backwards from end, returning entries, newest first.
+func expectHistoryScan(client *valkeymock.Client, end string, entries ...valkeygo.ValkeyMessage) *gomock.Call {
+	return client.EXPECT().Do(gomock.Any(), valkeymock.Match("XREVRANGE", "mdai_hub_event_history", end, "-", "COUNT", "500")).
+		Return(valkeymock.Result(valkeymock.ValkeyArray(entries...)))
+}
+
+// expectHistoryHorizon expects the audit history info to be read, with the entries before firstID trimmed, or none
+// when firstID is empty.
+func expectHistoryHorizon(client *valkeymock.Client, firstID string) *gomock.Call {
+	info := map[string]valkeygo.ValkeyMessage{
+		"length":                  valkeymock.ValkeyInt64(10),
+		"entries-added":           valkeymock.ValkeyInt64(10),
+		"recorded-first-entry-id": valkeymock.ValkeyBlobString("1767225600000-0"),
+	}
+	if firstID != "" {
+		info["entries-added"] = valkeymock.ValkeyInt64(25)
+		info["recorded-first-entry-id"] = valkeymock.ValkeyBlobString(firstID)
+	}
+	return client.EXPECT().Do(gomock.Any(), valkeymock.Match("XINFO", "STREAM", "mdai_hub_event_history")).
+		Return(valkeymock.Result(valkeymock.ValkeyMap(info)))
+}
+
+func TestHandleVariableHistory(t *testing.T) {
+	deps := setupMocks(t, newFakeClientset(t))
+	mux := NewRouter(t.Context(), deps)
+
+	client := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	added := newVariableEventFor(t, "data_set", valkey.VariableTypeSet, valkey.CommandAdd, []string{"a", "b"})
+	other := newVariableEventFor(t, "data_string", valkey.VariableTypeStr, valkey.CommandAdd, "x")
+	removed := newVariableEventFor(t, "data_set", valkey.VariableTypeSet, valkey.CommandDel, []string{"a"})
+	removed.Timestamp = added.Timestamp.Add(time.Second)
+	expectHistoryHorizon(client, "").Times(2)
+	expectHistoryScan(client, "+",
+		historyEntry(removed, "caller", "bob", "request_id", "req-2"),
+		historyEntry(other),
+		historyEntry(added, "caller", "alice"),
+	)
+	// The second page is read from the cursor on.
+	expectHistoryScan(client, "("+strconv.FormatInt(removed.Timestamp.UnixMilli(), 10)+"-0",
+		historyEntry(other),
+		historyEntry(added, "caller", "alice"),
+	)
+
+	get := func(target string) VariableHistory {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, http.NoBody))
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var page VariableHistory
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &page))
+		return page
+	}
+
+	first := get("/variables/history/hub/mdaihub-sample/var/data_set?limit=1")
+	require.Len(t, first.Changes, 1)
+	assert.Equal(t, removed.ID, first.Changes[0].EventID)
+	assert.Equal(t, "remove", first.Changes[0].Op)
+	assert.Equal(t, []any{"a"}, first.Changes[0].Data)
+	assert.Equal(t, "bob", first.Changes[0].Actor)
+	assert.Equal(t, map[string]string{"request_id": "req-2"}, first.Changes[0].Audit)
+	assert.Equal(t, strconv.FormatInt(removed.Timestamp.UnixMilli(), 10)+"-0", first.NextCursor)
+	assert.Nil(t, first.Horizon)
+
+	second := get("/variables/history/hub/mdaihub-sample/var/data_set?cursor=" + first.NextCursor)
+	require.Len(t, second.Changes, 1)
+	assert.Equal(t, added.ID, second.Changes[0].EventID)
+	assert.Equal(t, "alice", second.Changes[0].Actor)
+	assert.Empty(t, second.NextCursor)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/variables/history/hub/mdaihub-sample/var/data_set?cursor="+removed.ID, http.NoBody))
+	assertProblem(t, rr, http.StatusBadRequest, httputil.CodeInvalidRequest, `cursor "`+removed.ID+`" is not a nextCursor of a history page`)
+}
+
+func TestHandleVariableHistoryAt(t *testing.T) {
+	deps := setupMocks(t, newFakeClientset(t))
+	mux := NewRouter(t.Context(), deps)
+	client := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	// 2026-01-02T00:00:00Z
+	const until = "1767312000000"
+	expectHistoryHorizon(client, "").Times(3)
+	expectHistoryScan(client, until,
+		historyEntry(newVariableEventFor(t, "data_int", valkey.VariableTypeInt, valkey.CommandIncrement, valkey.IntDelta{By: 4, Min: nil, Max: ptr(5)})),
+		historyEntry(newVariableEventFor(t, "data_int", valkey.VariableTypeInt, valkey.CommandAdd, "3")),
+		historyEntry(newVariableEventFor(t, "data_set", valkey.VariableTypeSet, valkey.CommandDel, []string{"a"})),
+		historyEntry(newVariableEventFor(t, "data_set", valkey.VariableTypeSet, valkey.CommandAdd, []string{"a", "b"})),
+	).Times(3)
+
+	get := func(varName string) VariableValueAt {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/variables/history/hub/mdaihub-sample/var/"+varName+"?at=2026-01-02T00:00:00Z", http.NoBody))
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var response VariableValueAt
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		return response
+	}
+
+	set := get("data_set")
+	assert.Equal(t, "set", set.Type)
+	assert.Equal(t, []any{"b"}, set.Value)
+	assert.NotEmpty(t, set.LastEventID)
+	assert.False(t, set.Incomplete)
+
+	assert.InDelta(t, float64(5), get("data_int").Value, 0)
+
+	never := get("data_boolean")
+	assert.Equal(t, "boolean", never.Type)
+	assert.Nil(t, never.Value)
+	assert.Empty(t, never.LastEventID)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/variables/history/hub/mdaihub-sample/var/data_set?at=yesterday", http.NoBody))
+	assertProblem(t, rr, http.StatusBadRequest, httputil.CodeInvalidRequest, "at must be an RFC 3339 timestamp, e.g. 2025-07-19T14:00:00Z")
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/variables/history/hub/mdaihub-sample/var/missing", http.NoBody))
+	assertProblem(t, rr, http.StatusNotFound, httputil.CodeVariableNotFound, "variable not found")
+}
+
+func TestHandleVariableHistoryAt_Trimmed(t *testing.T) {
+	deps := setupMocks(t, newFakeClientset(t))
+	mux := NewRouter(t.Context(), deps)
+	client := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	// The history before 2026-01-01T00:00:00Z was trimmed.
+	expectHistoryHorizon(client, "1767225600000-0").Times(3)
+	added := newVariableEventFor(t, "data_set", valkey.VariableTypeSet, valkey.CommandAdd, []string{"c"})
+	replaced := newVariableEventFor(t, "data_set", valkey.VariableTypeSet, valkey.CommandReplace, []string{"a", "b"})
+	// The scan stops at the replace, which the value is replayed from.
+	expectHistoryScan(client, "1767398400000", historyEntry(added), historyEntry(replaced), historyEntry(newVariableEventFor(t, "data_set", valkey.VariableTypeSet, valkey.CommandDel, []string{"z"})))
+	expectHistoryScan(client, "1767312000000", historyEntry(added))
+	expectHistoryScan(client, "1767139200000")
+
+	get := func(at string) VariableValueAt {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/variables/history/hub/mdaihub-sample/var/data_set?at="+at, http.NoBody))
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var response VariableValueAt
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		return response
+	}
+	horizon := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	complete := get("2026-01-03T00:00:00Z")
+	assert.Equal(t, []any{"a", "b", "c"}, complete.Value)
+	assert.Equal(t, &horizon, complete.Horizon)
+	assert.False(t, complete.Incomplete)
+
+	// Only an add is retained, the set may have held more before it.
+	partial := get("2026-01-02T00:00:00Z")
+	assert.Equal(t, []any{"c"}, partial.Value)
+	assert.True(t, partial.Incomplete)
+
+	before := get("2025-12-31T00:00:00Z")
+	assert.Empty(t, before.LastEventID)
+	assert.True(t, before.Incomplete)
+}
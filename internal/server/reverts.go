@@ -0,0 +1,258 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mydecisive/mdai-data-core/eventing"
+	auditutils "github.com/mydecisive/mdai-gateway/internal/audit"
+	"github.com/mydecisive/mdai-gateway/internal/auth"
+	"github.com/mydecisive/mdai-gateway/internal/duequeue"
+	"github.com/mydecisive/mdai-gateway/internal/httputil"
+	"github.com/mydecisive/mdai-gateway/internal/manualvariables"
+	"github.com/mydecisive/mdai-gateway/internal/requestid"
+	"github.com/mydecisive/mdai-gateway/internal/revert"
+	"github.com/mydecisive/mdai-gateway/internal/tracing"
+	"github.com/mydecisive/mdai-gateway/internal/valkey"
+	"go.uber.org/zap"
+)
+
+// RevertIDHeader identifies the revert scheduled by a write made with a TTL.
+const RevertIDHeader = "X-Revert-ID"
+
+// revertCancelledEventName names the audit entries of cancelled reverts, next to the var.<op> names of published
+// variable events.
+const revertCancelledEventName = "var.revert_cancelled"
+
+// parseTTL reads the optional "ttl" of a write, e.g. "2h". It returns 0 when there is none.
+func parseTTL(value string, maxTTL time.Duration) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, httputil.NewError(http.StatusBadRequest, httputil.CodeInvalidRequest, fmt.Sprintf("invalid ttl %q: expected a duration such as \"2h\"", value))
+	}
+	if ttl <= 0 || ttl > maxTTL {
+		return 0, httputil.NewError(http.StatusBadRequest, httputil.CodeInvalidRequest, fmt.Sprintf("ttl must be positive and at most %s, got %s", maxTTL, ttl))
+	}
+	return ttl, nil
+}
+
+// decodeTTL reads the "ttl" member of a single-variable write payload.
+func decodeTTL(raw json.RawMessage, maxTTL time.Duration) (time.Duration, error) {
+	if raw == nil {
+		return 0, nil
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return 0, httputil.NewError(http.StatusBadRequest, httputil.CodeInvalidRequest, `invalid ttl: expected a duration such as "2h"`)
+	}
+	return parseTTL(value, maxTTL)
+}
+
+// newRevert builds the revert undoing the write published with event, which applies command with payload to a
+// variable whose value was before. The bool is false when the write changes nothing, so there is nothing to revert.
+func newRevert(event *eventing.MdaiEvent, varName string, varType valkey.VariableType, command valkey.CommandType, before, payload any, caller string, ttl time.Duration) (revert.Revert, bool, error) {
+	inverse, ok, err := valkey.Inverse(varType, command, before, payload)
+	if err != nil {
+		return revert.Revert{}, false, fmt.Errorf("failed to compute revert: %w", err)
+	}
+	if !ok {
+		return revert.Revert{}, false, nil
+	}
+	now := time.Now().UTC()
+	return revert.Revert{
+		ID:            uuid.NewString(),
+		Hub:           event.HubName,
+		Var:           varName,
+		Op:            string(inverse.Command),
+		Data:          inverse.Data,
+		EventID:       event.ID,
+		CorrelationID: event.CorrelationID,
+		Caller:        caller,
+		CreatedAt:     now,
+		DueAt:         now.Add(ttl),
+	}, true, nil
+}
+
+// discardRevert removes the revert scheduled for a write that could not be published.
+func discardRevert(ctx context.Context, logger *zap.Logger, store *revert.Store, pending *revert.Revert) {
+	if pending == nil {
+		return
+	}
+	if _, err := store.Remove(ctx, pending.ID); err != nil {
+		logger.Error("Failed to remove the revert of an unpublished event", zap.String("revertId", pending.ID), zap.Error(err))
+	}
+}
+
+// handleListPendingReverts lists the pending reverts of the variables the caller may read, soonest first.
+func handleListPendingReverts(ctx context.Context, deps HandlerDeps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestid.Logger(r.Context(), deps.Logger)
+
+		reverts, err := revert.NewStore(deps.ValkeyClient).List(ctx)
+		if err != nil {
+			logger.Error("Failed to list pending reverts", zap.Error(err))
+			httputil.WriteProblem(w, logger, http.StatusInternalServerError, httputil.CodeInternal, "failed to list pending reverts")
+			return
+		}
+
+		hubName := r.URL.Query().Get("hub")
+		access := newAccessFilter(r, deps)
+		visible := make([]revert.Revert, 0, len(reverts))
+		for _, pending := range reverts {
+			if hubName != "" && pending.Hub != hubName {
+				continue
+			}
+			decision, err := access.allowed(auth.ActionRead, pending.Hub, pending.Var)
+			if err != nil {
+				httputil.WriteError(w, logger, err)
+				return
+			}
+			if !decision.Allowed {
+				continue
+			}
+			visible = append(visible, pending)
+		}
+		httputil.WriteJSONResponse(w, logger, http.StatusOK, visible)
+	}
+}
+
+// handleCancelPendingRevert removes a pending revert so the temporary write it belongs to is kept. The caller needs
+// write access to the variable.
+func handleCancelPendingRevert(ctx context.Context, deps HandlerDeps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestid.Logger(r.Context(), deps.Logger)
+		store := revert.NewStore(deps.ValkeyClient)
+		id := r.PathValue("revertId")
+
+		pending, err := store.Get(ctx, id)
+		if errors.Is(err, revert.ErrNotFound) {
+			httputil.WriteProblem(w, logger, http.StatusNotFound, httputil.CodeRevertNotFound, fmt.Sprintf("pending revert %q not found", id))
+			return
+		}
+		if err != nil {
+			logger.Error("Failed to get pending revert", zap.String("revertId", id), zap.Error(err))
+			httputil.WriteProblem(w, logger, http.StatusInternalServerError, httputil.CodeInternal, "failed to get pending revert")
+			return
+		}
+		decision, ok := authorize(w, r, deps, auth.ActionWrite, pending.Hub, pending.Var)
+		if !ok {
+			return
+		}
+
+		// Removing claims the revert, so it is not applied if it fell due in the meantime.
+		if pending, err = store.Remove(ctx, id); errors.Is(err, revert.ErrNotFound) {
+			httputil.WriteProblem(w, logger, http.StatusNotFound, httputil.CodeRevertNotFound, fmt.Sprintf("pending revert %q not found", id))
+			return
+		} else if err != nil {
+			logger.Error("Failed to cancel pending revert", zap.String("revertId", id), zap.Error(err))
+			httputil.WriteProblem(w, logger, http.StatusInternalServerError, httputil.CodeInternal, "failed to cancel pending revert")
+			return
+		}
+
+		caller, _ := auth.IdentityFromContext(r.Context())
+		ids, _ := requestid.FromContext(r.Context())
+		auditCtx := auditutils.WithFields(tracing.WithSpanFrom(ctx, r.Context()), auditFields(caller, decision, ids))
+		if err := auditutils.RecordAuditEntry(auditCtx, logger, deps.AuditAdapter, map[string]string{
+			"id":             uuid.NewString(),
+			"name":           revertCancelledEventName,
+			"timestamp":      time.Now().UTC().Format(time.RFC3339),
+			"correlation_id": pending.CorrelationID,
+			"hub_name":       pending.Hub,
+			"revert_id":      pending.ID,
+			"revert_of":      pending.EventID,
+		}); err != nil {
+			logger.Error("Failed to audit cancelled revert", zap.String("revertId", id), zap.Error(err))
+		}
+
+		logger.Info("Cancelled pending revert", zap.String("revertId", id), zap.String("caller", caller.Name))
+		httputil.WriteJSONResponse(w, logger, http.StatusOK, pending)
+	}
+}
+
+// Reverter applies due reverts every reverts.pollInterval.
+type Reverter struct {
+	*duequeue.Poller
+
+	deps  HandlerDeps
+	store *revert.Store
+}
+
+func NewReverter(deps HandlerDeps) *Reverter {
+	r := &Reverter{Poller: nil, deps: deps, store: revert.NewStore(deps.ValkeyClient)}
+	r.Poller = duequeue.NewPoller(deps.Config.Reverts.PollInterval, r.ApplyDue)
+	return r
+}
+
+// ApplyDue publishes the reverts due at now. Reverts failing to publish are retried on the next poll; reverts that no
+// longer fit their variable, e.g. because it was removed from the hub, are dropped.
+func (r *Reverter) ApplyDue(ctx context.Context, now time.Time) {
+	logger := r.deps.Logger
+	due, err := r.store.Due(ctx, now)
+	if err != nil {
+		logger.Error("Failed to claim due reverts", zap.Error(err))
+	}
+	for _, claim := range due {
+		err := r.apply(ctx, claim.Revert)
+		var coded httputil.CodedError
+		switch {
+		case err == nil:
+		case errors.As(err, &coded):
+			logger.Error("Dropping revert that no longer applies", zap.String("revertId", claim.ID), zap.String("hubName", claim.Hub), zap.String("varName", claim.Var), zap.Error(err))
+		default:
+			logger.Error("Failed to apply revert, retrying", zap.String("revertId", claim.ID), zap.Error(err))
+			if err := r.store.Retry(ctx, claim); err != nil {
+				logger.Error("Failed to reschedule revert", zap.String("revertId", claim.ID), zap.Error(err))
+			}
+			continue
+		}
+		if held, err := r.store.Done(ctx, claim); err != nil {
+			logger.Error("Failed to remove applied revert", zap.String("revertId", claim.ID), zap.Error(err))
+		} else if !held {
+			logger.Warn("Revert was cancelled or claimed again while being applied", zap.String("revertId", claim.ID))
+		}
+	}
+}
+
+func (r *Reverter) apply(ctx context.Context, pending revert.Revert) error {
+	ctx, span := tracing.Tracer().Start(ctx, "apply revert")
+	var err error
+	defer func() { tracing.End(span, err) }()
+
+	hubsVariables, err := r.deps.ConfigMapController.GetAllHubsToDataMap()
+	if err != nil {
+		return err
+	}
+	varType, err := manualvariables.GetVarType(pending.Hub, pending.Var, hubsVariables)
+	if err != nil {
+		return err
+	}
+	event, _, err := newVariableEvent(pending.Hub, pending.Var, varType, valkey.CommandType(pending.Op), pending.Data, pending.CorrelationID)
+	if err != nil {
+		return err
+	}
+	subject := subjectFromVarsEvent(*event, pending.Var)
+
+	logger := r.deps.Logger
+	logger.Info("Publishing revert",
+		zap.String("id", event.ID),
+		zap.String("revertId", pending.ID),
+		zap.String("revertOf", pending.EventID),
+		zap.String("name", event.Name),
+		zap.String("subject", subject.String()),
+	)
+	publishCtx := auditutils.WithFields(ctx, map[string]string{
+		"caller":    pending.Caller,
+		"revert_id": pending.ID,
+		"revert_of": pending.EventID,
+	})
+	err = publishVariableUpdate(publishCtx, logger, r.deps, *event, subject, pending.Hub, pending.Var, nil)
+	return err
+}
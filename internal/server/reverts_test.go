@@ -0,0 +1,261 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mydecisive/mdai-data-core/eventing"
+	"github.com/mydecisive/mdai-gateway/internal/duequeue"
+	"github.com/mydecisive/mdai-gateway/internal/duequeue/duequeuetest"
+	"github.com/mydecisive/mdai-gateway/internal/httputil"
+	"github.com/mydecisive/mdai-gateway/internal/requestid"
+	"github.com/mydecisive/mdai-gateway/internal/revert"
+	"github.com/mydecisive/mdai-gateway/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/valkey-io/valkey-go"
+	valkeymock "github.com/valkey-io/valkey-go/mock"
+	"go.uber.org/mock/gomock"
+)
+
+func TestHandleSetVariables_TTL(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mux := NewRouter(t.Context(), deps)
+	mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	t.Run("scheduled", func(t *testing.T) {
+		mockClient.EXPECT().
+			Do(gomock.Any(), valkeymock.Match("SMEMBERS", "variable/mdaihub-sample/data_set")).
+			Return(valkeymock.Result(valkeymock.ValkeyArray(valkeymock.ValkeyBlobString("service-a")))).Times(1)
+		var stored revert.Revert
+		duequeuetest.ExpectPut(mockClient, &stored)
+		mockClient.EXPECT().Do(gomock.Any(), VersionBumpMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyInt64(1))).Times(1)
+		mockClient.EXPECT().Do(gomock.Any(), XaddMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
+
+		req := httptest.NewRequest(http.MethodPost, "/variables/hub/mdaihub-sample/var/data_set", bytes.NewBufferString(`{"data":["service-a","noisy"],"ttl":"2h"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(requestid.CorrelationIDHeader, "incident-7")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+		var event eventing.MdaiEvent
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &event))
+		assert.Equal(t, stored.ID, rr.Header().Get(RevertIDHeader))
+		assert.Equal(t, "mdaihub-sample", stored.Hub)
+		assert.Equal(t, "data_set", stored.Var)
+		assert.Equal(t, "remove", stored.Op)
+		assert.JSONEq(t, `["noisy"]`, string(stored.Data))
+		assert.Equal(t, event.ID, stored.EventID)
+		assert.Equal(t, "incident-7", stored.CorrelationID)
+		assert.WithinDuration(t, time.Now().Add(2*time.Hour), stored.DueAt, time.Minute)
+	})
+
+	t.Run("nothing to revert", func(t *testing.T) {
+		mockClient.EXPECT().
+			Do(gomock.Any(), valkeymock.Match("SMEMBERS", "variable/mdaihub-sample/data_set")).
+			Return(valkeymock.Result(valkeymock.ValkeyArray(valkeymock.ValkeyBlobString("service-a")))).Times(1)
+		mockClient.EXPECT().Do(gomock.Any(), VersionBumpMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyInt64(1))).Times(1)
+		mockClient.EXPECT().Do(gomock.Any(), XaddMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
+
+		req := httptest.NewRequest(http.MethodPost, "/variables/hub/mdaihub-sample/var/data_set", bytes.NewBufferString(`{"data":["service-a"],"ttl":"2h"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		assert.Empty(t, rr.Header().Get(RevertIDHeader))
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		mockClient.EXPECT().
+			Do(gomock.Any(), valkeymock.Match("GET", "variable/mdaihub-sample/data_string")).
+			Return(valkeymock.Result(valkeymock.ValkeyBlobString("old"))).Times(1)
+		var stored revert.Revert
+		duequeuetest.ExpectPut(mockClient, &stored)
+		mockClient.EXPECT().Do(gomock.Any(), VersionBumpMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyInt64(1))).Times(1)
+		mockClient.EXPECT().Do(gomock.Any(), XaddMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
+
+		req := httptest.NewRequest(http.MethodPost, "/variables/hub/mdaihub-sample/var/data_string/clear", bytes.NewBufferString(`{"ttl":"30m"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		assert.Equal(t, "add", stored.Op)
+		assert.JSONEq(t, `"old"`, string(stored.Data))
+	})
+
+	for _, tt := range []struct {
+		name     string
+		ttl      string
+		expected string
+	}{
+		{name: "malformed", ttl: `"soon"`, expected: `invalid ttl "soon": expected a duration such as "2h"`},
+		{name: "not a string", ttl: `7200`, expected: `invalid ttl: expected a duration such as "2h"`},
+		{name: "too long", ttl: `"200h"`, expected: "ttl must be positive and at most 168h0m0s, got 200h0m0s"},
+		{name: "negative", ttl: `"-1h"`, expected: "ttl must be positive and at most 168h0m0s, got -1h0m0s"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient.EXPECT().Do(gomock.Any(), XaddMatcher{}).Times(0)
+
+			req := httptest.NewRequest(http.MethodPost, "/variables/hub/mdaihub-sample/var/data_string", bytes.NewBufferString(`{"data":"x","ttl":`+tt.ttl+`}`))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+			assertProblem(t, rr, http.StatusBadRequest, httputil.CodeInvalidRequest, tt.expected)
+		})
+	}
+}
+
+func TestHandleSetVariables_TTLPublishFailure(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mockPub := &mocks.MockPublisher{}
+	mockPub.On("Publish", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("nats down")).Once()
+	deps.EventPublisher = mockPub
+	mux := NewRouter(t.Context(), deps)
+	mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	mockClient.EXPECT().
+		Do(gomock.Any(), valkeymock.Match("GET", "variable/mdaihub-sample/data_string")).
+		Return(valkeymock.Result(valkeymock.ValkeyBlobString("old"))).Times(1)
+	var stored revert.Revert
+	duequeuetest.ExpectPut(mockClient, &stored)
+	mockClient.EXPECT().Do(gomock.Any(), VersionBumpMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyInt64(1))).Times(1)
+	mockClient.EXPECT().Do(gomock.Any(), XaddMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
+	// The revert of the unpublished write is removed again.
+	mockClient.EXPECT().Do(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, cmd valkey.Completed) valkey.ValkeyResult {
+		assert.Equal(t, "EVALSHA", cmd.Commands()[0])
+		return valkeymock.Result(valkeymock.ValkeyBlobString(newRecord(t, stored)))
+	}).Times(1)
+
+	req := httptest.NewRequest(http.MethodPost, "/variables/hub/mdaihub-sample/var/data_string", bytes.NewBufferString(`{"data":"new","ttl":"1h"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assertProblem(t, rr, http.StatusInternalServerError, httputil.CodePublishFailed, "failed to publish event: nats down")
+	assert.Empty(t, rr.Header().Get(RevertIDHeader))
+}
+
+func TestHandleListPendingReverts(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mux := NewRouter(t.Context(), deps)
+	mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	now := time.Now().UTC().Truncate(time.Second)
+	sample := revert.Revert{ID: "r1", Hub: "mdaihub-sample", Var: "data_set", Op: "remove", Data: json.RawMessage(`["noisy"]`), EventID: "e1", CorrelationID: "incident-7", Caller: "oncall", CreatedAt: now, DueAt: now.Add(time.Hour)}
+	other := revert.Revert{ID: "r2", Hub: "mdaihub-other", Var: "data_string", Op: "clear", Data: nil, EventID: "e2", CorrelationID: "c2", Caller: "", CreatedAt: now, DueAt: now.Add(time.Minute)}
+	mockClient.EXPECT().Do(gomock.Any(), valkeymock.Match("HVALS", "gateway/pending-reverts")).
+		Return(valkeymock.Result(valkeymock.ValkeyArray(valkeymock.ValkeyBlobString(newRecord(t, sample)), valkeymock.ValkeyBlobString(newRecord(t, other))))).Times(2)
+
+	for _, tt := range []struct {
+		target   string
+		expected []revert.Revert
+	}{
+		{target: "/variables/pending-reverts", expected: []revert.Revert{other, sample}},
+		{target: "/variables/pending-reverts?hub=mdaihub-sample", expected: []revert.Revert{sample}},
+	} {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.target, http.NoBody))
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var reverts []revert.Revert
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &reverts))
+		assert.Equal(t, tt.expected, reverts, tt.target)
+	}
+}
+
+func TestHandleCancelPendingRevert(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mux := NewRouter(t.Context(), deps)
+	mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	now := time.Now().UTC().Truncate(time.Second)
+	pending := revert.Revert{ID: "r1", Hub: "mdaihub-sample", Var: "data_set", Op: "remove", Data: json.RawMessage(`["noisy"]`), EventID: "e1", CorrelationID: "incident-7", Caller: "oncall", CreatedAt: now, DueAt: now.Add(time.Hour)}
+	record := newRecord(t, pending)
+
+	t.Run("pending", func(t *testing.T) {
+		mockClient.EXPECT().Do(gomock.Any(), valkeymock.Match("HGET", "gateway/pending-reverts", "r1")).Return(valkeymock.Result(valkeymock.ValkeyBlobString(record))).Times(1)
+		// The removal script returns the record it deleted.
+		mockClient.EXPECT().Do(gomock.Any(), duequeuetest.Script{"gateway/pending-reverts", "gateway/pending-reverts/due", "gateway/pending-reverts/claimed", "r1"}).Return(valkeymock.Result(valkeymock.ValkeyBlobString(record))).Times(1)
+		mockClient.EXPECT().
+			Do(gomock.Any(), XaddFieldsMatcher{"name": "var.revert_cancelled", "revert_id": "r1", "revert_of": "e1", "correlation_id": "incident-7"}).
+			Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
+
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/variables/pending-reverts/r1", http.NoBody))
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var cancelled revert.Revert
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &cancelled))
+		assert.Equal(t, pending, cancelled)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mockClient.EXPECT().Do(gomock.Any(), valkeymock.Match("HGET", "gateway/pending-reverts", "r2")).Return(valkeymock.Result(valkeymock.ValkeyNil())).Times(1)
+
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/variables/pending-reverts/r2", http.NoBody))
+		assertProblem(t, rr, http.StatusNotFound, httputil.CodeRevertNotFound, `pending revert "r2" not found`)
+	})
+}
+
+func TestReverter_ApplyDue(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mockPub := &mocks.MockPublisher{}
+	deps.EventPublisher = mockPub
+	mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	now := time.Now().UTC().Truncate(time.Second)
+	pending := revert.Revert{ID: "r1", Hub: "mdaihub-sample", Var: "data_set", Op: "remove", Data: json.RawMessage(`["noisy"]`), EventID: "e1", CorrelationID: "incident-7", Caller: "oncall", CreatedAt: now.Add(-time.Hour), DueAt: now}
+	dueMillis := strconv.FormatInt(now.UnixMilli(), 10)
+	until := strconv.FormatInt(now.Add(duequeue.Lease).UnixMilli(), 10)
+	// ZRANGEBYSCORE lists r1 and a script claims it.
+	expectDue := func() {
+		mockClient.EXPECT().Do(gomock.Any(), valkeymock.Match("ZRANGEBYSCORE", "gateway/pending-reverts/due", "-inf", dueMillis, "WITHSCORES")).
+			Return(valkeymock.Result(valkeymock.ValkeyArray(valkeymock.ValkeyBlobString("r1"), valkeymock.ValkeyBlobString(dueMillis)))).Times(1)
+		mockClient.EXPECT().Do(gomock.Any(), duequeuetest.Script{"gateway/pending-reverts", "gateway/pending-reverts/due", "gateway/pending-reverts/claimed", "r1", dueMillis, until}).
+			Return(valkeymock.Result(valkeymock.ValkeyArray(valkeymock.ValkeyBlobString(newRecord(t, pending)), valkeymock.ValkeyBlobString(dueMillis)))).Times(1)
+	}
+	subject := eventing.MdaiEventSubject{Type: eventing.VarEventType, Path: "mdaihub-sample.data_set"}
+
+	t.Run("published", func(t *testing.T) {
+		expectDue()
+		mockPub.On("Publish", mock.Anything, mock.MatchedBy(func(event eventing.MdaiEvent) bool {
+			return event.Name == "var.remove" && event.CorrelationID == "incident-7"
+		}), subject).Return(nil).Once()
+		mockClient.EXPECT().Do(gomock.Any(), VersionBumpMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyInt64(1))).Times(1)
+		mockClient.EXPECT().
+			Do(gomock.Any(), XaddFieldsMatcher{"revert_id": "r1", "revert_of": "e1", "caller": "oncall", "correlation_id": "incident-7"}).
+			Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
+		// The applied revert is removed while the claim is held.
+		mockClient.EXPECT().Do(gomock.Any(), duequeuetest.Script{"gateway/pending-reverts", "gateway/pending-reverts/due", "gateway/pending-reverts/claimed", "r1", until, ""}).
+			Return(valkeymock.Result(valkeymock.ValkeyInt64(1))).Times(1)
+
+		NewReverter(deps).ApplyDue(t.Context(), now)
+		mockPub.AssertExpectations(t)
+	})
+
+	t.Run("retried", func(t *testing.T) {
+		expectDue()
+		mockPub.On("Publish", mock.Anything, mock.Anything, subject).Return(errors.New("nats down")).Once()
+		mockClient.EXPECT().Do(gomock.Any(), VersionBumpMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyInt64(1))).Times(1)
+		mockClient.EXPECT().Do(gomock.Any(), XaddMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
+		// The claim is given up, making r1 due again at its due time.
+		mockClient.EXPECT().Do(gomock.Any(), duequeuetest.Script{"gateway/pending-reverts", "gateway/pending-reverts/due", "gateway/pending-reverts/claimed", "r1", until, dueMillis}).
+			Return(valkeymock.Result(valkeymock.ValkeyInt64(1))).Times(1)
+
+		NewReverter(deps).ApplyDue(t.Context(), now)
+	})
+}
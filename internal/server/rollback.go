@@ -0,0 +1,220 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mydecisive/mdai-data-core/eventing"
+	auditutils "github.com/mydecisive/mdai-gateway/internal/audit"
+	"github.com/mydecisive/mdai-gateway/internal/auth"
+	"github.com/mydecisive/mdai-gateway/internal/httputil"
+	"github.com/mydecisive/mdai-gateway/internal/requestid"
+	"github.com/mydecisive/mdai-gateway/internal/tracing"
+	"github.com/mydecisive/mdai-gateway/internal/valkey"
+	"go.uber.org/zap"
+)
+
+// maxAuditDelay bounds how long after it was created an event to roll back to is looked for in the audit history.
+// Events are audited right after they are published.
+const maxAuditDelay = time.Minute
+
+// RollbackRequest is the body of POST /variables/hub/{hubName}/var/{varName}/rollback. The state to restore is that
+// right after the audited change EventID or the one at time At; exactly one of them is given.
+type RollbackRequest struct {
+	EventID string     `json:"eventId,omitempty"`
+	At      *time.Time `json:"at,omitempty"`
+}
+
+// Rollback is the response of a rollback: the event that restores the state, nil when the variable already holds it,
+// and the value before and after the operator applies it.
+type Rollback struct {
+	DryRun bool `json:"dryRun,omitempty"`
+	// RestoredEventID is the last change of the restored state.
+	RestoredEventID string              `json:"restoredEventId,omitempty"`
+	Event           *eventing.MdaiEvent `json:"event,omitempty"`
+	Subject         string              `json:"subject,omitempty"`
+	Before          any                 `json:"before"`
+	After           any                 `json:"after"`
+}
+
+// handleRollbackVariable restores the state a variable had at an audited change or a past time, rebuilt from its
+// history like GET /variables/history with ?at=; it refuses with 409 when that state may be incomplete. The update is
+// computed from the current value, see valkey.Diff, and published with the request's correlation ID; its audit entry
+// records what it rolls back to. With ?dryRun=true the update is previewed instead.
+func handleRollbackVariable(ctx context.Context, deps HandlerDeps) http.HandlerFunc { //nolint:funlen
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, deps.Config.Limits.VariableBodyMaxBytes)
+		defer r.Body.Close() //nolint:errcheck
+		logger := requestid.Logger(r.Context(), deps.Logger)
+		hubName := r.PathValue("hubName")
+		varName := r.PathValue("varName")
+		if hubName == "" || varName == "" {
+			httputil.WriteProblem(w, logger, http.StatusBadRequest, httputil.CodeMissingParameter, "hub and var name required")
+			return
+		}
+		dryRun, err := dryRunRequested(r)
+		if err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+
+		var request RollbackRequest
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&request); err != nil {
+			var mbe *http.MaxBytesError
+			if errors.As(err, &mbe) {
+				httputil.WriteProblem(w, logger, http.StatusRequestEntityTooLarge, httputil.CodeBodyTooLarge, "request body too large (max "+formatByteSize(mbe.Limit)+")")
+				return
+			}
+			httputil.WriteProblem(w, logger, http.StatusBadRequest, httputil.CodeInvalidJSON, `invalid JSON format in request payload: expected {"eventId": string} or {"at": timestamp}`)
+			return
+		}
+		if (request.EventID == "") == (request.At == nil) {
+			httputil.WriteProblem(w, logger, http.StatusBadRequest, httputil.CodeInvalidRequest, "exactly one of eventId and at is required")
+			return
+		}
+
+		decision, ok := authorize(w, r, deps, auth.ActionWrite, hubName, varName)
+		if !ok {
+			return
+		}
+		varType, err := variableType(deps, hubName, varName)
+		if err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+
+		end := "+"
+		if request.At != nil {
+			end = auditutils.TimeStreamID(*request.At)
+		}
+		if request.EventID != "" {
+			if end, err = auditedChange(ctx, r, deps, hubName, varName, request.EventID); err != nil {
+				httputil.WriteError(w, logger, err)
+				return
+			}
+		}
+		horizon, err := historyHorizon(ctx, r, deps)
+		if err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+		changes, complete, err := changesToReplay(ctx, r, deps, hubName, varName, end, horizon)
+		if err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+		// Restoring a state that may miss changes trimmed from the history would publish a wrong value, e.g. remove
+		// every member of a set that was filled before its first retained change.
+		if len(changes) == 0 {
+			httputil.WriteProblem(w, logger, http.StatusConflict, httputil.CodeHistoryIncomplete, fmt.Sprintf("no change of variable %s/%s is audited by then, so its state is unknown", hubName, varName))
+			return
+		}
+		if !complete {
+			httputil.WriteProblem(w, logger, http.StatusConflict, httputil.CodeHistoryIncomplete, fmt.Sprintf("the state of variable %s/%s may depend on changes trimmed from the audit history before %s", hubName, varName, horizon.Format(time.RFC3339)))
+			return
+		}
+		targetType, target, err := replayChanges(varType, changes)
+		if err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+		if targetType != varType {
+			httputil.WriteProblem(w, logger, http.StatusBadRequest, httputil.CodeInvalidRequest, fmt.Sprintf("variable %s/%s was a %s then but is a %s now", hubName, varName, targetType, varType))
+			return
+		}
+
+		current, err := valkey.GetValue(ctx, valkey.NewAdapter(deps.ValkeyClient, deps.Logger), varName, varType, hubName)
+		if err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+		response := Rollback{DryRun: dryRun, RestoredEventID: changes[len(changes)-1].EventID, Event: nil, Subject: "", Before: current, After: current}
+		update, ok, err := valkey.Diff(varType, current, target)
+		if err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+		if !ok {
+			httputil.WriteJSONResponse(w, logger, http.StatusOK, response)
+			return
+		}
+
+		ids, _ := requestid.FromContext(r.Context())
+		event, payload, err := newVariableEvent(hubName, varName, varType, update.Command, update.Data, ids.CorrelationID)
+		if err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+		subject := subjectFromVarsEvent(*event, varName)
+		if response.After, err = valkey.Preview(varType, update.Command, current, payload); err != nil {
+			httputil.WriteError(w, logger, fmt.Errorf("failed to preview %s: %w", update.Command, err))
+			return
+		}
+		response.Event, response.Subject = event, subject.String()
+		if dryRun {
+			httputil.WriteJSONResponse(w, logger, http.StatusOK, response)
+			return
+		}
+
+		caller, _ := auth.IdentityFromContext(r.Context())
+		fields := auditFields(caller, decision, ids)
+		fields["rollback_to_event"] = response.RestoredEventID
+		if request.At != nil {
+			fields["rollback_to_time"] = request.At.UTC().Format(time.RFC3339)
+		}
+		publishCtx := auditutils.WithFields(tracing.WithSpanFrom(ctx, r.Context()), fields)
+
+		logger.Info("Publishing MdaiEvent",
+			zap.String("id", event.ID),
+			zap.String("caller", caller.Name),
+			zap.String("name", event.Name),
+			zap.String("source", event.Source),
+			zap.String("subject", subject.String()),
+			zap.String("rollbackToEvent", response.RestoredEventID),
+		)
+
+		if err := publishVariableUpdate(publishCtx, logger, deps, *event, subject, hubName, varName, nil); err != nil {
+			logger.Error("Failed to publish MdaiEvent", zap.Error(err))
+			httputil.WriteProblem(w, logger, http.StatusInternalServerError, httputil.CodePublishFailed, fmt.Sprintf("failed to publish event: %v", err))
+			return
+		}
+		httputil.WriteJSONResponse(w, logger, http.StatusOK, response)
+	}
+}
+
+// auditedChange returns the stream ID of the audit history entry of the change eventID of a variable. Event IDs are
+// time-ordered UUIDs, so only the entries added from when the event was created to maxAuditDelay later are read.
+func auditedChange(ctx context.Context, r *http.Request, deps HandlerDeps, hubName, varName, eventID string) (string, error) {
+	notFound := httputil.NewError(http.StatusNotFound, httputil.CodeEventNotFound, fmt.Sprintf("event %q is not a change of variable %s/%s", eventID, hubName, varName))
+	id, err := uuid.Parse(eventID)
+	if err != nil || id.Version() != 7 {
+		return "", notFound
+	}
+	created := time.Unix(id.Time().UnixTime())
+
+	var streamID string
+	err = auditutils.ScanVarEvents(ctx, deps.ValkeyClient, auditutils.TimeStreamID(created), auditutils.TimeStreamID(created.Add(maxAuditDelay)), func(event auditutils.AuditedEvent) bool {
+		if event.Event.ID != eventID {
+			return true
+		}
+		if change, err := newVariableChange(event.Event); err == nil && change.Hub == hubName && change.Var == varName {
+			streamID = event.StreamID
+		}
+		return false
+	})
+	if err != nil {
+		requestid.Logger(r.Context(), deps.Logger).Error("Failed to read variable history", zap.String("hubName", hubName), zap.String("varName", varName), zap.Error(err))
+		return "", httputil.NewError(http.StatusInternalServerError, httputil.CodeInternal, "failed to read variable history")
+	}
+	if streamID == "" {
+		return "", notFound
+	}
+	return streamID, nil
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mydecisive/mdai-gateway/internal/httputil"
+	"github.com/mydecisive/mdai-gateway/internal/requestid"
+	"github.com/mydecisive/mdai-gateway/internal/valkey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	valkeygo "github.com/valkey-io/valkey-go"
+	valkeymock "github.com/valkey-io/valkey-go/mock"
+	"go.uber.org/mock/gomock"
+)
+
+func newRollbackRequest(target, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, target, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+// expectAuditedChange expects the audit history to be read for the entry of eventID, from when the event was created
+// on.
+func expectAuditedChange(client *valkeymock.Client, eventID string, entries ...valkeygo.ValkeyMessage) *gomock.Call {
+	created := time.Unix(uuid.MustParse(eventID).Time().UnixTime())
+	start, end := strconv.FormatInt(created.UnixMilli(), 10), strconv.FormatInt(created.Add(time.Minute).UnixMilli(), 10)
+	return client.EXPECT().Do(gomock.Any(), valkeymock.Match("XRANGE", "mdai_hub_event_history", start, end, "COUNT", "500")).
+		Return(valkeymock.Result(valkeymock.ValkeyArray(entries...)))
+}
+
+func TestHandleRollbackVariable(t *testing.T) {
+	deps := setupMocks(t, newFakeClientset(t))
+	mux := NewRouter(t.Context(), deps)
+	client := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	added := newVariableEventFor(t, "data_set", valkey.VariableTypeSet, valkey.CommandAdd, []string{"a", "b"})
+	removed := newVariableEventFor(t, "data_set", valkey.VariableTypeSet, valkey.CommandDel, []string{"a"})
+	removed.Timestamp = added.Timestamp.Add(time.Second)
+	addedID := strconv.FormatInt(added.Timestamp.UnixMilli(), 10) + "-0"
+	expectAuditedChange(client, added.ID, historyEntry(added), historyEntry(removed)).Times(2)
+	expectHistoryHorizon(client, "").Times(2)
+	// The state is replayed from the event on.
+	expectHistoryScan(client, addedID, historyEntry(added)).Times(2)
+	client.EXPECT().Do(gomock.Any(), valkeymock.Match("SMEMBERS", "variable/mdaihub-sample/data_set")).
+		Return(valkeymock.Result(valkeymock.ValkeyArray(valkeymock.ValkeyBlobString("b"), valkeymock.ValkeyBlobString("c")))).Times(2)
+	client.EXPECT().Do(gomock.Any(), VersionBumpMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyInt64(1))).Times(1)
+	client.EXPECT().Do(gomock.Any(), XaddFieldsMatcher{"correlation_id": "undo-1", "rollback_to_event": added.ID}).
+		Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
+
+	body := `{"eventId": "` + added.ID + `"}`
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, newRollbackRequest("/variables/hub/mdaihub-sample/var/data_set/rollback?dryRun=true", body))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var preview Rollback
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &preview))
+	assert.True(t, preview.DryRun)
+	assert.Equal(t, added.ID, preview.RestoredEventID)
+	assert.Equal(t, []any{"b", "c"}, preview.Before)
+	assert.Equal(t, []any{"a", "b"}, preview.After)
+	require.NotNil(t, preview.Event)
+	assert.Equal(t, "var.replace", preview.Event.Name)
+
+	req := newRollbackRequest("/variables/hub/mdaihub-sample/var/data_set/rollback", body)
+	req.Header.Set(requestid.CorrelationIDHeader, "undo-1")
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var rollback Rollback
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &rollback))
+	assert.False(t, rollback.DryRun)
+	require.NotNil(t, rollback.Event)
+	assert.Equal(t, "undo-1", rollback.Event.CorrelationID)
+	assert.Equal(t, "var.mdaihub-sample.data_set", rollback.Subject)
+}
+
+func TestHandleRollbackVariableAt(t *testing.T) {
+	deps := setupMocks(t, newFakeClientset(t))
+	mux := NewRouter(t.Context(), deps)
+	client := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	// data_string was "foo" at 2026-01-02T00:00:00Z; it already is the second time.
+	set := newVariableEventFor(t, "data_string", valkey.VariableTypeStr, valkey.CommandAdd, "foo")
+	expectHistoryHorizon(client, "").Times(2)
+	expectHistoryScan(client, "1767312000000", historyEntry(set)).Times(2)
+	gomock.InOrder(
+		client.EXPECT().Do(gomock.Any(), valkeymock.Match("GET", "variable/mdaihub-sample/data_string")).
+			Return(valkeymock.Result(valkeymock.ValkeyBlobString("bar"))),
+		client.EXPECT().Do(gomock.Any(), valkeymock.Match("GET", "variable/mdaihub-sample/data_string")).
+			Return(valkeymock.Result(valkeymock.ValkeyBlobString("foo"))),
+	)
+	client.EXPECT().Do(gomock.Any(), VersionBumpMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyInt64(1))).Times(1)
+	client.EXPECT().Do(gomock.Any(), XaddFieldsMatcher{"rollback_to_event": set.ID, "rollback_to_time": "2026-01-02T00:00:00Z"}).
+		Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
+
+	body := `{"at": "2026-01-02T00:00:00Z"}`
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, newRollbackRequest("/variables/hub/mdaihub-sample/var/data_string/rollback", body))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var rollback Rollback
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &rollback))
+	assert.Equal(t, set.ID, rollback.RestoredEventID)
+	require.NotNil(t, rollback.Event)
+	assert.Equal(t, "var.add", rollback.Event.Name)
+	assert.Equal(t, "bar", rollback.Before)
+	assert.Equal(t, "foo", rollback.After)
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, newRollbackRequest("/variables/hub/mdaihub-sample/var/data_string/rollback", body))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.JSONEq(t, `{"restoredEventId": "`+set.ID+`", "before": "foo", "after": "foo"}`, rr.Body.String())
+}
+
+func TestHandleRollbackVariable_HistoryIncomplete(t *testing.T) {
+	deps := setupMocks(t, newFakeClientset(t))
+	mux := NewRouter(t.Context(), deps)
+	client := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	// Nothing is read or published: the set may have held members added before the history was trimmed.
+	client.EXPECT().Do(gomock.Any(), valkeymock.Match("SMEMBERS", "variable/mdaihub-sample/data_set")).Times(0)
+	client.EXPECT().Do(gomock.Any(), XaddMatcher{}).Times(0)
+	// The history before 2026-01-01T00:00:00Z was trimmed.
+	expectHistoryHorizon(client, "1767225600000-0").Times(2)
+
+	t.Run("at before any retained change", func(t *testing.T) {
+		expectHistoryScan(client, "1767139200000")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, newRollbackRequest("/variables/hub/mdaihub-sample/var/data_set/rollback", `{"at": "2025-12-31T00:00:00Z"}`))
+		assertProblem(t, rr, http.StatusConflict, httputil.CodeHistoryIncomplete, "no change of variable mdaihub-sample/data_set is audited by then, so its state is unknown")
+	})
+
+	t.Run("no change sets the whole value", func(t *testing.T) {
+		expectHistoryScan(client, "1767312000000",
+			historyEntry(newVariableEventFor(t, "data_set", valkey.VariableTypeSet, valkey.CommandAdd, []string{"a"})))
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, newRollbackRequest("/variables/hub/mdaihub-sample/var/data_set/rollback", `{"at": "2026-01-02T00:00:00Z"}`))
+		assertProblem(t, rr, http.StatusConflict, httputil.CodeHistoryIncomplete, "the state of variable mdaihub-sample/data_set may depend on changes trimmed from the audit history before 2026-01-01T00:00:00Z")
+	})
+}
+
+func TestHandleRollbackVariable_Invalid(t *testing.T) {
+	deps := setupMocks(t, newFakeClientset(t))
+	mux := NewRouter(t.Context(), deps)
+	client := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+	client.EXPECT().Do(gomock.Any(), XaddMatcher{}).Times(0)
+	other := newVariableEventFor(t, "data_int", valkey.VariableTypeInt, valkey.CommandAdd, 1)
+	missing := uuid.Must(uuid.NewV7()).String()
+	expectAuditedChange(client, other.ID, historyEntry(other)).Times(1)
+	expectAuditedChange(client, missing).Times(1)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+		detail string
+	}{
+		{
+			name:   "neither",
+			body:   `{}`,
+			status: http.StatusBadRequest,
+			code:   httputil.CodeInvalidRequest,
+			detail: "exactly one of eventId and at is required",
+		},
+		{
+			name:   "both",
+			body:   `{"eventId": "e1", "at": "2026-01-02T00:00:00Z"}`,
+			status: http.StatusBadRequest,
+			code:   httputil.CodeInvalidRequest,
+			detail: "exactly one of eventId and at is required",
+		},
+		{
+			name:   "invalid at",
+			body:   `{"at": "yesterday"}`,
+			status: http.StatusBadRequest,
+			code:   httputil.CodeInvalidJSON,
+			detail: `invalid JSON format in request payload: expected {"eventId": string} or {"at": timestamp}`,
+		},
+		{
+			name:   "unknown event",
+			body:   `{"eventId": "e1"}`,
+			status: http.StatusNotFound,
+			code:   httputil.CodeEventNotFound,
+			detail: `event "e1" is not a change of variable mdaihub-sample/data_set`,
+		},
+		{
+			name:   "event of another variable",
+			body:   `{"eventId": "` + other.ID + `"}`,
+			status: http.StatusNotFound,
+			code:   httputil.CodeEventNotFound,
+			detail: `event "` + other.ID + `" is not a change of variable mdaihub-sample/data_set`,
+		},
+		{
+			name:   "event not audited",
+			body:   `{"eventId": "` + missing + `"}`,
+			status: http.StatusNotFound,
+			code:   httputil.CodeEventNotFound,
+			detail: `event "` + missing + `" is not a change of variable mdaihub-sample/data_set`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, newRollbackRequest("/variables/hub/mdaihub-sample/var/data_set/rollback", tt.body))
+			assertProblem(t, rr, tt.status, tt.code, tt.detail)
+		})
+	}
+}
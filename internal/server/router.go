@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strings"
 
@@ -9,12 +10,21 @@ import (
 	"github.com/mydecisive/mdai-data-core/eventing/publisher"
 	datacorekube "github.com/mydecisive/mdai-data-core/kube"
 	"github.com/mydecisive/mdai-gateway/internal/adapter"
+	"github.com/mydecisive/mdai-gateway/internal/auth"
+	"github.com/mydecisive/mdai-gateway/internal/config"
+	"github.com/mydecisive/mdai-gateway/internal/health"
+	"github.com/mydecisive/mdai-gateway/internal/httputil"
+	"github.com/mydecisive/mdai-gateway/internal/metrics"
 	"github.com/mydecisive/mdai-gateway/internal/opamp"
+	"github.com/mydecisive/mdai-gateway/internal/requestid"
+	"github.com/mydecisive/mdai-gateway/internal/tracing"
+	gatewayvalkey "github.com/mydecisive/mdai-gateway/internal/valkey"
 	"github.com/valkey-io/valkey-go"
 	"go.uber.org/zap"
 )
 
 type HandlerDeps struct {
+	Config              config.Config
 	Logger              *zap.Logger
 	ValkeyClient        valkey.Client
 	AuditAdapter        *audit.AuditAdapter
@@ -22,27 +32,100 @@ type HandlerDeps struct {
 	ConfigMapController *datacorekube.ConfigMapController
 	Deduper             *adapter.Deduper
 	OpAMPServer         *opamp.OpAMPControlServer
+	// Authenticator identifies callers; nil leaves every route unauthenticated.
+	Authenticator auth.Authenticator
+	// Authorizer restricts variable access per identity.
+	Authorizer auth.Authorizer
+	// VarWatcher feeds GET /variables/watch; nil disables the route.
+	VarWatcher VarWatcher
+	// StreamsDone ends long-lived responses, such as watch streams, when it is closed on shutdown.
+	StreamsDone <-chan struct{}
 }
 
-func NewRouter(ctx context.Context, deps HandlerDeps) *http.ServeMux {
+func NewRouter(ctx context.Context, deps HandlerDeps) http.Handler {
 	router := http.NewServeMux()
 
-	router.HandleFunc("GET /audit", handleAuditEventsGet(ctx, deps))
-	router.Handle("POST /alerts/alertmanager", requireJSON(handlePromAlertsPost(deps)))
-	router.Handle("GET /variables/list", handleListAllVariables(ctx, deps))
-	router.Handle("GET /variables/list/hub/{hubName}", handleListHubVariables(ctx, deps))
-	router.Handle("GET /variables/values/hub/{hubName}/var/{varName}", handleGetVariables(ctx, deps))
-	router.Handle("POST /variables/hub/{hubName}/var/{varName}", handleSetDeleteVariables(ctx, deps))
-	router.Handle("DELETE /variables/hub/{hubName}/var/{varName}", handleSetDeleteVariables(ctx, deps))
-	router.Handle("POST /opamp", deps.OpAMPServer.HandlerFunc)
+	authCfg := deps.Config.Auth
+	reads := auth.Middleware(deps.Authenticator, authCfg.RequireForReads, deps.Logger)
+	writes := auth.Middleware(deps.Authenticator, authCfg.RequireForWrites, deps.Logger)
+	alerts := auth.Middleware(deps.Authenticator, authCfg.RequireForAlerts, deps.Logger)
 
-	return router
+	if deps.Config.Features.AuditAPI {
+		router.Handle("GET /audit", reads(handleAuditEventsGet(ctx, deps)))
+	}
+	router.Handle("POST /alerts/alertmanager", alerts(requireJSON(deps.Logger, handlePromAlertsPost(deps))))
+	router.Handle("GET /variables/list", reads(handleListAllVariables(ctx, deps)))
+	router.Handle("GET /variables/list/hub/{hubName}", reads(handleListHubVariables(ctx, deps)))
+	router.Handle("GET /variables/values", reads(handleGetAllValues(ctx, deps)))
+	router.Handle("GET /variables/values/hub/{hubName}", reads(handleGetHubValues(ctx, deps)))
+	router.Handle("GET /variables/values/hub/{hubName}/var/{varName}", reads(handleGetVariables(ctx, deps)))
+	router.Handle("POST /variables/hub/{hubName}/var/{varName}", writes(handleUpdateVariable(ctx, deps, gatewayvalkey.CommandAdd)))
+	router.Handle("PUT /variables/hub/{hubName}/var/{varName}", writes(handleUpdateVariable(ctx, deps, gatewayvalkey.CommandReplace)))
+	router.Handle("DELETE /variables/hub/{hubName}/var/{varName}", writes(handleUpdateVariable(ctx, deps, gatewayvalkey.CommandDel)))
+	router.Handle("POST /variables/hub/{hubName}/var/{varName}/clear", writes(handleUpdateVariable(ctx, deps, gatewayvalkey.CommandClear)))
+	router.Handle("POST /variables/hub/{hubName}/var/{varName}/push", writes(handleUpdateVariable(ctx, deps, gatewayvalkey.CommandPush)))
+	router.Handle("POST /variables/hub/{hubName}/var/{varName}/increment", writes(handleUpdateVariable(ctx, deps, gatewayvalkey.CommandIncrement)))
+	router.Handle("POST /variables/hub/{hubName}/var/{varName}/decrement", writes(handleUpdateVariable(ctx, deps, gatewayvalkey.CommandDecrement)))
+	router.Handle("POST /variables/hub/{hubName}/var/{varName}/rollback", writes(handleRollbackVariable(ctx, deps)))
+	router.Handle("POST /variables/batch", writes(handleBatchVariables(ctx, deps)))
+	router.Handle("GET /variables/history/hub/{hubName}/var/{varName}", reads(handleVariableHistory(ctx, deps)))
+	router.Handle("GET /variables/export/hub/{hubName}", reads(handleExportHub(ctx, deps)))
+	router.Handle("POST /variables/import/hub/{hubName}", writes(handleImportHub(ctx, deps)))
+	router.Handle("GET /variables/pending-reverts", reads(handleListPendingReverts(ctx, deps)))
+	router.Handle("DELETE /variables/pending-reverts/{revertId}", writes(handleCancelPendingRevert(ctx, deps)))
+	if deps.VarWatcher != nil {
+		router.Handle("GET /variables/watch", reads(handleWatchVariables(deps)))
+	}
+	router.Handle("POST /variables/schedules", writes(handleCreateSchedule(ctx, deps)))
+	router.Handle("GET /variables/schedules", reads(handleListSchedules(ctx, deps)))
+	router.Handle("GET /variables/schedules/{scheduleId}", reads(handleGetSchedule(ctx, deps)))
+	router.Handle("PUT /variables/schedules/{scheduleId}", writes(handleReplaceSchedule(ctx, deps)))
+	router.Handle("DELETE /variables/schedules/{scheduleId}", writes(handleDeleteSchedule(ctx, deps)))
+	if deps.Config.Features.OpAMP {
+		router.Handle("POST /opamp", deps.OpAMPServer.HandlerFunc)
+	}
+	if deps.Config.Features.Metrics {
+		router.Handle("GET /metrics", metrics.Handler())
+	}
+	router.Handle("GET /healthz", health.LivenessHandler(deps.Logger))
+	router.Handle("GET /readyz", health.NewReadiness(deps.Logger, deps.Config.Health.Timeout, deps.Config.Health.Required, readinessChecks(deps)...).Handler())
+
+	return requestid.Middleware(metrics.Middleware(tracing.Middleware(httputil.RecordRoute(router))))
+}
+
+// readinessChecks checks the dependencies in deps. The NATS check needs a publisher implementing health.Checker and
+// the OpAMP check is skipped when OpAMP is disabled.
+func readinessChecks(deps HandlerDeps) []health.Check {
+	checks := []health.Check{
+		{
+			Name: config.HealthCheckValkey,
+			Run: func(ctx context.Context) error {
+				return deps.ValkeyClient.Do(ctx, deps.ValkeyClient.B().Ping().Build()).Error()
+			},
+		},
+	}
+	if checker, ok := deps.EventPublisher.(health.Checker); ok {
+		checks = append(checks, health.Check{Name: config.HealthCheckNATS, Run: checker.CheckHealth})
+	}
+	checks = append(checks, health.Check{
+		Name: config.HealthCheckConfigMaps,
+		Run: func(context.Context) error {
+			if !deps.ConfigMapController.CmInformer.Informer().HasSynced() {
+				return errors.New("ConfigMap cache has not synced")
+			}
+			return nil
+		},
+	})
+	if deps.Config.Features.OpAMP {
+		checks = append(checks, health.Check{Name: config.HealthCheckOpAMP, Run: deps.OpAMPServer.CheckHealth})
+	}
+	return checks
 }
 
-func requireJSON(next http.Handler) http.Handler {
+func requireJSON(logger *zap.Logger, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
-			http.Error(w, "Content-Type header must be application/json", http.StatusUnsupportedMediaType)
+			httputil.WriteProblem(w, logger, http.StatusUnsupportedMediaType, httputil.CodeUnsupportedMediaType, "Content-Type header must be application/json")
 			return
 		}
 
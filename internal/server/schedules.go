@@ -0,0 +1,396 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	auditutils "github.com/mydecisive/mdai-gateway/internal/audit"
+	"github.com/mydecisive/mdai-gateway/internal/auth"
+	"github.com/mydecisive/mdai-gateway/internal/duequeue"
+	"github.com/mydecisive/mdai-gateway/internal/httputil"
+	"github.com/mydecisive/mdai-gateway/internal/manualvariables"
+	"github.com/mydecisive/mdai-gateway/internal/requestid"
+	"github.com/mydecisive/mdai-gateway/internal/schedule"
+	"github.com/mydecisive/mdai-gateway/internal/tracing"
+	"github.com/mydecisive/mdai-gateway/internal/valkey"
+	"go.uber.org/zap"
+)
+
+// Audit entry names of schedule changes, next to the var.<op> names of published variable events.
+const (
+	scheduleCreatedEventName  = "var.schedule_created"
+	scheduleReplacedEventName = "var.schedule_replaced"
+	scheduleDeletedEventName  = "var.schedule_deleted"
+)
+
+// ScheduleView is a schedule as returned by the API, with the time of its next transition.
+type ScheduleView struct {
+	schedule.Schedule
+	NextTransition *time.Time `json:"nextTransition,omitempty"`
+}
+
+func newScheduleView(s schedule.Schedule, now time.Time) ScheduleView {
+	view := ScheduleView{Schedule: s, NextTransition: nil}
+	if plan, err := s.Plan(); err == nil {
+		if next := plan.Next(now); !next.IsZero() {
+			next = next.UTC()
+			view.NextTransition = &next
+		}
+	}
+	return view
+}
+
+// decodeScheduleSpec reads the schedule declared in the body of r, writing a problem response when it is not valid
+// JSON.
+func decodeScheduleSpec(w http.ResponseWriter, r *http.Request, deps HandlerDeps) (schedule.Spec, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, deps.Config.Limits.VariableBodyMaxBytes)
+	logger := requestid.Logger(r.Context(), deps.Logger)
+
+	var spec schedule.Spec
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&spec); err != nil {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			httputil.WriteProblem(w, logger, http.StatusRequestEntityTooLarge, httputil.CodeBodyTooLarge, "request body too large (max "+formatByteSize(mbe.Limit)+")")
+			return schedule.Spec{}, false
+		}
+		httputil.WriteProblem(w, logger, http.StatusBadRequest, httputil.CodeInvalidJSON, "invalid JSON format in request payload: expected a schedule")
+		return schedule.Spec{}, false
+	}
+	return spec, true
+}
+
+// planSchedule validates spec and returns its plan. Errors are CodedErrors.
+func planSchedule(spec schedule.Spec) (*schedule.Plan, error) {
+	plan, err := spec.Plan()
+	if err != nil {
+		return nil, httputil.NewError(http.StatusBadRequest, httputil.CodeInvalidSchedule, err.Error())
+	}
+	return plan, nil
+}
+
+// checkScheduleUpdates makes sure every update of plan is valid for the variable of spec. Errors are CodedErrors.
+func checkScheduleUpdates(deps HandlerDeps, spec schedule.Spec, plan *schedule.Plan) error {
+	hubsVariables, err := deps.ConfigMapController.GetAllHubsToDataMap()
+	if err != nil {
+		return httputil.NewError(http.StatusInternalServerError, httputil.CodeInternal, "failed to fetch manual variables")
+	}
+	if len(hubsVariables) == 0 {
+		return manualvariables.ErrNoManualVariablesFound
+	}
+	varType, err := manualvariables.GetVarType(spec.Hub, spec.Var, hubsVariables)
+	if err != nil {
+		return err
+	}
+	for _, update := range plan.Updates() {
+		if _, _, err := newVariableEvent(spec.Hub, spec.Var, varType, update.Command, update.Data, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// auditScheduleChange records who created, replaced or deleted a schedule.
+func auditScheduleChange(ctx context.Context, r *http.Request, logger *zap.Logger, deps HandlerDeps, decision auth.Decision, name string, s schedule.Schedule) {
+	caller, _ := auth.IdentityFromContext(r.Context())
+	ids, _ := requestid.FromContext(r.Context())
+	auditCtx := auditutils.WithFields(tracing.WithSpanFrom(ctx, r.Context()), auditFields(caller, decision, ids))
+	if err := auditutils.RecordAuditEntry(auditCtx, logger, deps.AuditAdapter, map[string]string{
+		"id":          uuid.NewString(),
+		"name":        name,
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+		"hub_name":    s.Hub,
+		"schedule_id": s.ID,
+	}); err != nil {
+		logger.Error("Failed to audit schedule change", zap.String("scheduleId", s.ID), zap.String("name", name), zap.Error(err))
+	}
+}
+
+// getSchedule looks up the schedule named by the scheduleId path value, writing a problem response when there is none.
+func getSchedule(ctx context.Context, w http.ResponseWriter, r *http.Request, deps HandlerDeps, store *schedule.Store) (schedule.Schedule, bool) {
+	logger := requestid.Logger(r.Context(), deps.Logger)
+	id := r.PathValue("scheduleId")
+	s, err := store.Get(ctx, id)
+	if errors.Is(err, schedule.ErrNotFound) {
+		httputil.WriteProblem(w, logger, http.StatusNotFound, httputil.CodeScheduleNotFound, fmt.Sprintf("schedule %q not found", id))
+		return schedule.Schedule{}, false
+	}
+	if err != nil {
+		logger.Error("Failed to get schedule", zap.String("scheduleId", id), zap.Error(err))
+		httputil.WriteProblem(w, logger, http.StatusInternalServerError, httputil.CodeInternal, "failed to get schedule")
+		return schedule.Schedule{}, false
+	}
+	return s, true
+}
+
+// handleCreateSchedule stores a new schedule. The caller needs write access to its variable.
+func handleCreateSchedule(ctx context.Context, deps HandlerDeps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close() //nolint:errcheck
+		logger := requestid.Logger(r.Context(), deps.Logger)
+
+		spec, ok := decodeScheduleSpec(w, r, deps)
+		if !ok {
+			return
+		}
+		plan, err := planSchedule(spec)
+		if err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+		decision, ok := authorize(w, r, deps, auth.ActionWrite, spec.Hub, spec.Var)
+		if !ok {
+			return
+		}
+		if err := checkScheduleUpdates(deps, spec, plan); err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+
+		caller, _ := auth.IdentityFromContext(r.Context())
+		now := time.Now().UTC()
+		s := schedule.Schedule{
+			ID:        uuid.NewString(),
+			Spec:      spec,
+			Caller:    caller.Name,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if err := schedule.NewStore(deps.ValkeyClient).Put(ctx, s, plan.Next(now)); err != nil {
+			logger.Error("Failed to store schedule", zap.Error(err))
+			httputil.WriteProblem(w, logger, http.StatusInternalServerError, httputil.CodeInternal, "failed to store schedule")
+			return
+		}
+		auditScheduleChange(ctx, r, logger, deps, decision, scheduleCreatedEventName, s)
+
+		logger.Info("Created schedule", zap.String("scheduleId", s.ID), zap.String("hubName", s.Hub), zap.String("varName", s.Var), zap.String("caller", caller.Name))
+		httputil.WriteJSONResponse(w, logger, http.StatusCreated, newScheduleView(s, now))
+	}
+}
+
+// handleListSchedules lists the schedules of the variables the caller may read, oldest first.
+func handleListSchedules(ctx context.Context, deps HandlerDeps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestid.Logger(r.Context(), deps.Logger)
+
+		schedules, err := schedule.NewStore(deps.ValkeyClient).List(ctx)
+		if err != nil {
+			logger.Error("Failed to list schedules", zap.Error(err))
+			httputil.WriteProblem(w, logger, http.StatusInternalServerError, httputil.CodeInternal, "failed to list schedules")
+			return
+		}
+
+		hubName := r.URL.Query().Get("hub")
+		now := time.Now()
+		access := newAccessFilter(r, deps)
+		visible := make([]ScheduleView, 0, len(schedules))
+		for _, s := range schedules {
+			if hubName != "" && s.Hub != hubName {
+				continue
+			}
+			decision, err := access.allowed(auth.ActionRead, s.Hub, s.Var)
+			if err != nil {
+				httputil.WriteError(w, logger, err)
+				return
+			}
+			if !decision.Allowed {
+				continue
+			}
+			visible = append(visible, newScheduleView(s, now))
+		}
+		httputil.WriteJSONResponse(w, logger, http.StatusOK, visible)
+	}
+}
+
+// handleGetSchedule returns one schedule. The caller needs read access to its variable.
+func handleGetSchedule(ctx context.Context, deps HandlerDeps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestid.Logger(r.Context(), deps.Logger)
+		s, ok := getSchedule(ctx, w, r, deps, schedule.NewStore(deps.ValkeyClient))
+		if !ok {
+			return
+		}
+		if _, ok := authorize(w, r, deps, auth.ActionRead, s.Hub, s.Var); !ok {
+			return
+		}
+		httputil.WriteJSONResponse(w, logger, http.StatusOK, newScheduleView(s, time.Now()))
+	}
+}
+
+// handleReplaceSchedule replaces a schedule, keeping its ID. The caller needs write access to the variables of both the
+// old and the new schedule. Its next transition is computed afresh.
+func handleReplaceSchedule(ctx context.Context, deps HandlerDeps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close() //nolint:errcheck
+		logger := requestid.Logger(r.Context(), deps.Logger)
+		store := schedule.NewStore(deps.ValkeyClient)
+
+		existing, ok := getSchedule(ctx, w, r, deps, store)
+		if !ok {
+			return
+		}
+		if _, ok := authorize(w, r, deps, auth.ActionWrite, existing.Hub, existing.Var); !ok {
+			return
+		}
+		spec, ok := decodeScheduleSpec(w, r, deps)
+		if !ok {
+			return
+		}
+		plan, err := planSchedule(spec)
+		if err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+		decision, ok := authorize(w, r, deps, auth.ActionWrite, spec.Hub, spec.Var)
+		if !ok {
+			return
+		}
+		if err := checkScheduleUpdates(deps, spec, plan); err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+
+		caller, _ := auth.IdentityFromContext(r.Context())
+		now := time.Now().UTC()
+		s := schedule.Schedule{
+			ID:        existing.ID,
+			Spec:      spec,
+			Caller:    caller.Name,
+			CreatedAt: existing.CreatedAt,
+			UpdatedAt: now,
+		}
+		if err := store.Put(ctx, s, plan.Next(now)); err != nil {
+			logger.Error("Failed to store schedule", zap.String("scheduleId", s.ID), zap.Error(err))
+			httputil.WriteProblem(w, logger, http.StatusInternalServerError, httputil.CodeInternal, "failed to store schedule")
+			return
+		}
+		auditScheduleChange(ctx, r, logger, deps, decision, scheduleReplacedEventName, s)
+
+		logger.Info("Replaced schedule", zap.String("scheduleId", s.ID), zap.String("hubName", s.Hub), zap.String("varName", s.Var), zap.String("caller", caller.Name))
+		httputil.WriteJSONResponse(w, logger, http.StatusOK, newScheduleView(s, now))
+	}
+}
+
+// handleDeleteSchedule removes a schedule, so none of its transitions fire any more. The caller needs write access to
+// its variable.
+func handleDeleteSchedule(ctx context.Context, deps HandlerDeps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestid.Logger(r.Context(), deps.Logger)
+		store := schedule.NewStore(deps.ValkeyClient)
+
+		s, ok := getSchedule(ctx, w, r, deps, store)
+		if !ok {
+			return
+		}
+		decision, ok := authorize(w, r, deps, auth.ActionWrite, s.Hub, s.Var)
+		if !ok {
+			return
+		}
+		if err := store.Delete(ctx, s.ID); errors.Is(err, schedule.ErrNotFound) {
+			httputil.WriteProblem(w, logger, http.StatusNotFound, httputil.CodeScheduleNotFound, fmt.Sprintf("schedule %q not found", s.ID))
+			return
+		} else if err != nil {
+			logger.Error("Failed to delete schedule", zap.String("scheduleId", s.ID), zap.Error(err))
+			httputil.WriteProblem(w, logger, http.StatusInternalServerError, httputil.CodeInternal, "failed to delete schedule")
+			return
+		}
+		auditScheduleChange(ctx, r, logger, deps, decision, scheduleDeletedEventName, s)
+
+		caller, _ := auth.IdentityFromContext(r.Context())
+		logger.Info("Deleted schedule", zap.String("scheduleId", s.ID), zap.String("caller", caller.Name))
+		httputil.WriteJSONResponse(w, logger, http.StatusOK, s)
+	}
+}
+
+// Scheduler publishes the transitions of schedules as they come, checking every schedules.pollInterval.
+type Scheduler struct {
+	*duequeue.Poller
+
+	deps  HandlerDeps
+	store *schedule.Store
+}
+
+func NewScheduler(deps HandlerDeps) *Scheduler {
+	s := &Scheduler{Poller: nil, deps: deps, store: schedule.NewStore(deps.ValkeyClient)}
+	s.Poller = duequeue.NewPoller(deps.Config.Schedules.PollInterval, s.FireDue)
+	return s
+}
+
+// FireDue publishes the transitions due at now. When the gateway was down over several transitions of a schedule,
+// only the last of them is published. Transitions failing to publish are retried on the next poll; transitions that no
+// longer fit their variable, e.g. because it was removed from the hub, are skipped.
+func (s *Scheduler) FireDue(ctx context.Context, now time.Time) {
+	logger := s.deps.Logger
+	due, err := s.store.Due(ctx, now)
+	if err != nil {
+		logger.Error("Failed to claim due schedules", zap.Error(err))
+	}
+	for _, d := range due {
+		plan, err := d.Plan()
+		if err != nil {
+			// Left claimed, so it is logged again once the claim expires rather than on every poll.
+			logger.Error("Skipping invalid schedule", zap.String("scheduleId", d.ID), zap.Error(err))
+			continue
+		}
+		next := plan.Next(now)
+		if update, at, ok := plan.Latest(d.At.Add(-time.Millisecond), now); ok {
+			err = s.fire(ctx, d.Schedule, update.Command, update.Data, at)
+		}
+		var coded httputil.CodedError
+		switch {
+		case err == nil:
+		case errors.As(err, &coded):
+			logger.Error("Skipping schedule transition that no longer applies", zap.String("scheduleId", d.ID), zap.String("hubName", d.Hub), zap.String("varName", d.Var), zap.Error(err))
+		default:
+			logger.Error("Failed to fire schedule transition, retrying", zap.String("scheduleId", d.ID), zap.Error(err))
+			next = d.At
+		}
+		if held, err := s.store.Reschedule(ctx, d, next); err != nil {
+			logger.Error("Failed to reschedule schedule", zap.String("scheduleId", d.ID), zap.Error(err))
+		} else if !held {
+			logger.Warn("Schedule was changed or claimed again while its transition fired", zap.String("scheduleId", d.ID))
+		}
+	}
+}
+
+func (s *Scheduler) fire(ctx context.Context, sched schedule.Schedule, command valkey.CommandType, data json.RawMessage, at time.Time) error {
+	ctx, span := tracing.Tracer().Start(ctx, "fire schedule")
+	var err error
+	defer func() { tracing.End(span, err) }()
+
+	hubsVariables, err := s.deps.ConfigMapController.GetAllHubsToDataMap()
+	if err != nil {
+		return err
+	}
+	varType, err := manualvariables.GetVarType(sched.Hub, sched.Var, hubsVariables)
+	if err != nil {
+		return err
+	}
+	event, _, err := newVariableEvent(sched.Hub, sched.Var, varType, command, data, "")
+	if err != nil {
+		return err
+	}
+	subject := subjectFromVarsEvent(*event, sched.Var)
+
+	logger := s.deps.Logger
+	logger.Info("Publishing schedule transition",
+		zap.String("id", event.ID),
+		zap.String("scheduleId", sched.ID),
+		zap.Time("scheduledAt", at),
+		zap.String("name", event.Name),
+		zap.String("subject", subject.String()),
+	)
+	publishCtx := auditutils.WithFields(ctx, map[string]string{
+		"caller":       sched.Caller,
+		"schedule_id":  sched.ID,
+		"scheduled_at": at.UTC().Format(time.RFC3339),
+	})
+	err = publishVariableUpdate(publishCtx, logger, s.deps, *event, subject, sched.Hub, sched.Var, nil)
+	return err
+}
@@ -0,0 +1,302 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mydecisive/mdai-data-core/eventing"
+	"github.com/mydecisive/mdai-gateway/internal/duequeue"
+	"github.com/mydecisive/mdai-gateway/internal/duequeue/duequeuetest"
+	"github.com/mydecisive/mdai-gateway/internal/httputil"
+	"github.com/mydecisive/mdai-gateway/internal/schedule"
+	"github.com/mydecisive/mdai-gateway/internal/valkey"
+	"github.com/mydecisive/mdai-gateway/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	valkeymock "github.com/valkey-io/valkey-go/mock"
+	"go.uber.org/mock/gomock"
+)
+
+const businessHoursSchedule = `{
+	"name": "business-hours",
+	"hub": "mdaihub-sample",
+	"var": "data_int",
+	"timezone": "Europe/Berlin",
+	"window": {"days": ["mon", "tue", "wed", "thu", "fri"], "start": "09:00", "end": "18:00"},
+	"inside": {"op": "add", "data": 10},
+	"outside": {"op": "add", "data": 100}
+}`
+
+func newHourlySchedule(id, hub, varName string, createdAt time.Time) schedule.Schedule {
+	return schedule.Schedule{
+		ID: id,
+		Spec: schedule.Spec{
+			Name:     "",
+			Hub:      hub,
+			Var:      varName,
+			Timezone: "",
+			Window:   nil,
+			Inside:   nil,
+			Outside:  nil,
+			Transitions: []schedule.Transition{
+				{Cron: "0 * * * *", Update: valkey.Update{Command: valkey.CommandAdd, Data: json.RawMessage(`10`)}},
+			},
+		},
+		Caller:    "oncall",
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+	}
+}
+
+func TestHandleCreateSchedule(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mux := NewRouter(t.Context(), deps)
+	mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	t.Run("created", func(t *testing.T) {
+		var stored schedule.Schedule
+		duequeuetest.ExpectPut(mockClient, &stored)
+		mockClient.EXPECT().
+			Do(gomock.Any(), XaddFieldsMatcher{"name": "var.schedule_created", "hub_name": "mdaihub-sample"}).
+			Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
+
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/variables/schedules", bytes.NewBufferString(businessHoursSchedule)))
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+		var created ScheduleView
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+		assert.NotEmpty(t, created.ID)
+		assert.Equal(t, stored.ID, created.ID)
+		assert.Equal(t, "data_int", stored.Var)
+		assert.Equal(t, "Europe/Berlin", stored.Timezone)
+		assert.JSONEq(t, `100`, string(stored.Outside.Data))
+		require.NotNil(t, created.NextTransition)
+		assert.True(t, created.NextTransition.After(time.Now()))
+	})
+
+	for _, tt := range []struct {
+		name   string
+		body   string
+		status int
+		code   string
+		detail string
+	}{
+		{
+			name:   "malformed",
+			body:   `{"hub": "mdaihub-sample", "var": "data_int", "every": "monday"}`,
+			status: http.StatusBadRequest,
+			code:   httputil.CodeInvalidJSON,
+			detail: "invalid JSON format in request payload: expected a schedule",
+		},
+		{
+			name:   "unknown timezone",
+			body:   `{"hub": "mdaihub-sample", "var": "data_int", "timezone": "Mars/Olympus", "transitions": [{"cron": "0 9 * * *", "op": "add", "data": 1}]}`,
+			status: http.StatusBadRequest,
+			code:   httputil.CodeInvalidSchedule,
+			detail: `unknown timezone "Mars/Olympus"`,
+		},
+		{
+			name:   "unknown variable",
+			body:   `{"hub": "mdaihub-sample", "var": "missing", "transitions": [{"cron": "0 9 * * *", "op": "add", "data": 1}]}`,
+			status: http.StatusNotFound,
+			code:   httputil.CodeVariableNotFound,
+			detail: "variable not found",
+		},
+		{
+			name:   "invalid value",
+			body:   `{"hub": "mdaihub-sample", "var": "data_int", "transitions": [{"cron": "0 9 * * *", "op": "add", "data": "ten"}]}`,
+			status: http.StatusBadRequest,
+			code:   httputil.CodeInvalidValue,
+			detail: "invalid request payload: int expected",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/variables/schedules", bytes.NewBufferString(tt.body)))
+			assertProblem(t, rr, tt.status, tt.code, tt.detail)
+		})
+	}
+}
+
+func TestHandleListSchedules(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mux := NewRouter(t.Context(), deps)
+	mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	now := time.Now().UTC().Truncate(time.Second)
+	sample := newHourlySchedule("s1", "mdaihub-sample", "data_int", now.Add(-time.Hour))
+	other := newHourlySchedule("s2", "mdaihub-other", "data_int", now)
+	mockClient.EXPECT().Do(gomock.Any(), valkeymock.Match("HVALS", "gateway/schedules")).
+		Return(valkeymock.Result(valkeymock.ValkeyArray(valkeymock.ValkeyBlobString(newRecord(t, other)), valkeymock.ValkeyBlobString(newRecord(t, sample))))).Times(2)
+
+	for _, tt := range []struct {
+		target   string
+		expected []string
+	}{
+		{target: "/variables/schedules", expected: []string{"s1", "s2"}},
+		{target: "/variables/schedules?hub=mdaihub-sample", expected: []string{"s1"}},
+	} {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.target, http.NoBody))
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var schedules []ScheduleView
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &schedules))
+		ids := make([]string, len(schedules))
+		for i, s := range schedules {
+			ids[i] = s.ID
+			require.NotNil(t, s.NextTransition)
+		}
+		assert.Equal(t, tt.expected, ids, tt.target)
+	}
+}
+
+func TestHandleGetSchedule(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mux := NewRouter(t.Context(), deps)
+	mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	s := newHourlySchedule("s1", "mdaihub-sample", "data_int", time.Now().UTC().Truncate(time.Second))
+
+	t.Run("found", func(t *testing.T) {
+		mockClient.EXPECT().Do(gomock.Any(), valkeymock.Match("HGET", "gateway/schedules", "s1")).Return(valkeymock.Result(valkeymock.ValkeyBlobString(newRecord(t, s)))).Times(1)
+
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/variables/schedules/s1", http.NoBody))
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var view ScheduleView
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &view))
+		assert.Equal(t, s, view.Schedule)
+		require.NotNil(t, view.NextTransition)
+		assert.Equal(t, 0, view.NextTransition.Minute())
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mockClient.EXPECT().Do(gomock.Any(), valkeymock.Match("HGET", "gateway/schedules", "s2")).Return(valkeymock.Result(valkeymock.ValkeyNil())).Times(1)
+
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/variables/schedules/s2", http.NoBody))
+		assertProblem(t, rr, http.StatusNotFound, httputil.CodeScheduleNotFound, `schedule "s2" not found`)
+	})
+}
+
+func TestHandleReplaceSchedule(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mux := NewRouter(t.Context(), deps)
+	mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	existing := newHourlySchedule("s1", "mdaihub-sample", "data_int", time.Now().UTC().Add(-time.Hour).Truncate(time.Second))
+	mockClient.EXPECT().Do(gomock.Any(), valkeymock.Match("HGET", "gateway/schedules", "s1")).Return(valkeymock.Result(valkeymock.ValkeyBlobString(newRecord(t, existing)))).Times(1)
+	var stored schedule.Schedule
+	duequeuetest.ExpectPut(mockClient, &stored)
+	mockClient.EXPECT().
+		Do(gomock.Any(), XaddFieldsMatcher{"name": "var.schedule_replaced", "schedule_id": "s1"}).
+		Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPut, "/variables/schedules/s1", bytes.NewBufferString(businessHoursSchedule)))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	assert.Equal(t, "s1", stored.ID)
+	assert.Equal(t, "business-hours", stored.Name)
+	assert.Equal(t, existing.CreatedAt, stored.CreatedAt)
+	assert.True(t, stored.UpdatedAt.After(existing.CreatedAt))
+	assert.Empty(t, stored.Transitions)
+}
+
+func TestHandleDeleteSchedule(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mux := NewRouter(t.Context(), deps)
+	mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	s := newHourlySchedule("s1", "mdaihub-sample", "data_int", time.Now().UTC().Truncate(time.Second))
+	mockClient.EXPECT().Do(gomock.Any(), valkeymock.Match("HGET", "gateway/schedules", "s1")).Return(valkeymock.Result(valkeymock.ValkeyBlobString(newRecord(t, s)))).Times(1)
+	mockClient.EXPECT().Do(gomock.Any(), duequeuetest.Script{"gateway/schedules", "gateway/schedules/due", "gateway/schedules/claimed", "s1"}).
+		Return(valkeymock.Result(valkeymock.ValkeyBlobString(newRecord(t, s)))).Times(1)
+	mockClient.EXPECT().
+		Do(gomock.Any(), XaddFieldsMatcher{"name": "var.schedule_deleted", "schedule_id": "s1"}).
+		Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/variables/schedules/s1", http.NoBody))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var deleted schedule.Schedule
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &deleted))
+	assert.Equal(t, s, deleted)
+}
+
+func TestScheduler_FireDue(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mockPub := &mocks.MockPublisher{}
+	deps.EventPublisher = mockPub
+	mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	dueAt := time.Now().UTC().Truncate(time.Hour)
+	now := dueAt.Add(5 * time.Second)
+	s := newHourlySchedule("s1", "mdaihub-sample", "data_int", dueAt.Add(-24*time.Hour))
+	dueMillis := strconv.FormatInt(dueAt.UnixMilli(), 10)
+	until := strconv.FormatInt(now.Add(duequeue.Lease).UnixMilli(), 10)
+	nextMillis := strconv.FormatInt(dueAt.Add(time.Hour).UnixMilli(), 10)
+	keys := duequeuetest.Script{"gateway/schedules", "gateway/schedules/due", "gateway/schedules/claimed", "s1"}
+	// ZRANGEBYSCORE lists s1 and a script claims it, unless another replica did.
+	expectDue := func(claimed bool) {
+		mockClient.EXPECT().Do(gomock.Any(), valkeymock.Match("ZRANGEBYSCORE", "gateway/schedules/due", "-inf", strconv.FormatInt(now.UnixMilli(), 10), "WITHSCORES")).
+			Return(valkeymock.Result(valkeymock.ValkeyArray(valkeymock.ValkeyBlobString("s1"), valkeymock.ValkeyBlobString(dueMillis)))).Times(1)
+		reply := valkeymock.ValkeyNil()
+		if claimed {
+			reply = valkeymock.ValkeyArray(valkeymock.ValkeyBlobString(newRecord(t, s)), valkeymock.ValkeyBlobString(dueMillis))
+		}
+		mockClient.EXPECT().Do(gomock.Any(), append(keys, dueMillis, until)).Return(valkeymock.Result(reply)).Times(1)
+	}
+	subject := eventing.MdaiEventSubject{Type: eventing.VarEventType, Path: "mdaihub-sample.data_int"}
+
+	t.Run("published", func(t *testing.T) {
+		expectDue(true)
+		mockPub.On("Publish", mock.Anything, mock.MatchedBy(func(event eventing.MdaiEvent) bool {
+			return event.Name == "var.add"
+		}), subject).Return(nil).Once()
+		mockClient.EXPECT().Do(gomock.Any(), VersionBumpMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyInt64(1))).Times(1)
+		mockClient.EXPECT().
+			Do(gomock.Any(), XaddFieldsMatcher{"schedule_id": "s1", "scheduled_at": dueAt.Format(time.RFC3339), "caller": "oncall"}).
+			Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
+		// The claim is released at the next transition, if it is still held.
+		mockClient.EXPECT().Do(gomock.Any(), append(keys, until, nextMillis)).Return(valkeymock.Result(valkeymock.ValkeyInt64(1))).Times(1)
+
+		NewScheduler(deps).FireDue(t.Context(), now)
+		mockPub.AssertExpectations(t)
+	})
+
+	t.Run("claimed by another replica", func(t *testing.T) {
+		expectDue(false)
+
+		NewScheduler(deps).FireDue(t.Context(), now)
+		mockPub.AssertExpectations(t)
+	})
+
+	t.Run("retried", func(t *testing.T) {
+		expectDue(true)
+		mockPub.On("Publish", mock.Anything, mock.Anything, subject).Return(errors.New("nats down")).Once()
+		mockClient.EXPECT().Do(gomock.Any(), VersionBumpMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyInt64(1))).Times(1)
+		mockClient.EXPECT().Do(gomock.Any(), XaddMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(1)
+		mockClient.EXPECT().Do(gomock.Any(), append(keys, until, dueMillis)).Return(valkeymock.Result(valkeymock.ValkeyInt64(1))).Times(1)
+
+		NewScheduler(deps).FireDue(t.Context(), now)
+		mockPub.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,373 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mydecisive/mdai-gateway/internal/auth"
+	"github.com/mydecisive/mdai-gateway/internal/httputil"
+	"github.com/mydecisive/mdai-gateway/internal/manualvariables"
+	"github.com/mydecisive/mdai-gateway/internal/requestid"
+	"github.com/mydecisive/mdai-gateway/internal/valkey"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// SnapshotVersion is the version of the Snapshot document written by export and accepted by import.
+const SnapshotVersion = 1
+
+const yamlContentType = "application/yaml"
+
+// Snapshot is the document of GET /variables/export/hub/{hubName} and POST /variables/import/hub/{hubName}: the
+// variables of a hub with their types and values, the values in the JSON types of their variables.
+type Snapshot struct {
+	Version    int                         `json:"version"    yaml:"version"`
+	Hub        string                      `json:"hub"        yaml:"hub"`
+	ExportedAt time.Time                   `json:"exportedAt" yaml:"exportedAt"`
+	Variables  map[string]SnapshotVariable `json:"variables"  yaml:"variables"`
+	// Errors lists the variables left out of an export because their stored value could not be read as their type. It
+	// is ignored on import.
+	Errors map[string]string `json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+type SnapshotVariable struct {
+	Type  valkey.VariableType `json:"type"  yaml:"type"`
+	Value any                 `json:"value" yaml:"value"`
+}
+
+// handleExportHub returns a Snapshot of the variables of a hub the caller may read, as JSON or, with ?format=yaml or
+// an Accept header asking for it, as YAML.
+func handleExportHub(ctx context.Context, deps HandlerDeps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestid.Logger(r.Context(), deps.Logger)
+		hubName := r.PathValue("hubName")
+		if hubName == "" {
+			httputil.WriteProblem(w, logger, http.StatusBadRequest, httputil.CodeMissingParameter, "hub name required")
+			return
+		}
+		asYAML, err := yamlRequested(r)
+		if err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+
+		hubVariables, err := hubVariableTypes(deps, hubName)
+		if err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+		values, valueErrors, err := readableValues(ctx, r, deps, newAccessFilter(r, deps), hubName, hubVariables, false)
+		if err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+
+		snapshot := Snapshot{
+			Version:    SnapshotVersion,
+			Hub:        hubName,
+			ExportedAt: time.Now().UTC(),
+			Variables:  make(map[string]SnapshotVariable, len(values)),
+			Errors:     valueErrors,
+		}
+		for varName, value := range values {
+			snapshot.Variables[varName] = SnapshotVariable{Type: valkey.VariableType(hubVariables[varName]), Value: value}
+		}
+		if !asYAML {
+			httputil.WriteJSONResponse(w, logger, http.StatusOK, snapshot)
+			return
+		}
+		writeYAMLSnapshot(w, logger, snapshot)
+	}
+}
+
+// handleImportHub makes the variables of a hub hold the values of a Snapshot, which may have been exported from
+// another hub. Variables missing from the snapshot are left alone. Every variable of the snapshot must be defined in
+// the hub with the same type and be writable by the caller, or nothing is published. The update each changed variable
+// needs is computed from its current value, see valkey.Diff, and the events are published in variable name order with
+// the request's correlation ID; the response is that of a batch. ?dryRun=true previews the updates instead.
+func handleImportHub(ctx context.Context, deps HandlerDeps) http.HandlerFunc { //nolint:funlen
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, deps.Config.Limits.VariableBodyMaxBytes)
+		defer r.Body.Close() //nolint:errcheck
+		logger := requestid.Logger(r.Context(), deps.Logger)
+		hubName := r.PathValue("hubName")
+		if hubName == "" {
+			httputil.WriteProblem(w, logger, http.StatusBadRequest, httputil.CodeMissingParameter, "hub name required")
+			return
+		}
+		dryRun, err := dryRunRequested(r)
+		if err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+
+		snapshot, err := decodeSnapshot(r)
+		if err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+
+		varNames := slices.Sorted(maps.Keys(snapshot.Variables))
+		access := newAccessFilter(r, deps)
+		decisions := make(map[string]auth.Decision, len(varNames))
+		var denied []string
+		for _, varName := range varNames {
+			decision, err := access.allowed(auth.ActionWrite, hubName, varName)
+			if err != nil {
+				httputil.WriteError(w, logger, err)
+				return
+			}
+			if !decision.Allowed {
+				denied = append(denied, varName)
+			}
+			decisions[varName] = decision
+		}
+		if len(denied) > 0 {
+			httputil.WriteProblem(w, logger, http.StatusForbidden, httputil.CodeForbidden, "not allowed to write "+strings.Join(denied, ", "))
+			return
+		}
+
+		hubVariables, err := hubVariableTypes(deps, hubName)
+		if err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+		varTypes := make(map[string]valkey.VariableType, len(varNames))
+		desired := make(map[string]any, len(varNames))
+		for _, varName := range varNames {
+			variable := snapshot.Variables[varName]
+			varType, ok := hubVariables[varName]
+			if !ok {
+				httputil.WriteProblem(w, logger, http.StatusBadRequest, httputil.CodeInvalidSnapshot, fmt.Sprintf("variable %s is not defined in hub %s", varName, hubName))
+				return
+			}
+			if variable.Type != valkey.VariableType(varType) {
+				httputil.WriteProblem(w, logger, http.StatusBadRequest, httputil.CodeInvalidSnapshot, fmt.Sprintf("variable %s is a %s in the snapshot but a %s in hub %s", varName, variable.Type, varType, hubName))
+				return
+			}
+			value, err := snapshotValue(variable)
+			if err != nil {
+				httputil.WriteProblem(w, logger, http.StatusBadRequest, httputil.CodeInvalidSnapshot, fmt.Sprintf("variable %s: %s", varName, httputil.ProblemFromError(err).Detail))
+				return
+			}
+			varTypes[varName] = variable.Type
+			desired[varName] = value
+		}
+
+		current, err := valkey.NewAdapter(deps.ValkeyClient, deps.Logger).GetValues(ctx, hubName, varTypes)
+		if err != nil {
+			logger.Error("Failed to read variable values", zap.String("hubName", hubName), zap.Error(err))
+			httputil.WriteProblem(w, logger, http.StatusInternalServerError, httputil.CodeInternal, "failed to read variable values")
+			return
+		}
+
+		ids, _ := requestid.FromContext(r.Context())
+		var updates []batchUpdate
+		for _, varName := range varNames {
+			update, err := newImportUpdate(hubName, varName, varTypes[varName], current[varName], desired[varName], ids.CorrelationID)
+			if err != nil {
+				httputil.WriteError(w, logger, err)
+				return
+			}
+			if update.event == nil {
+				continue
+			}
+			update.decision = decisions[varName]
+			updates = append(updates, update)
+		}
+
+		response := BatchResponse{
+			CorrelationID: ids.CorrelationID,
+			Successful:    0,
+			Failed:        0,
+			Results:       make([]BatchResult, 0, len(updates)),
+			DryRun:        dryRun,
+		}
+		if dryRun {
+			for i, update := range updates {
+				response.Results = append(response.Results, newBatchResult(i, update, BatchStatusValidated))
+				response.Successful++
+			}
+			httputil.WriteJSONResponse(w, logger, http.StatusOK, response)
+			return
+		}
+		if len(updates) == 0 {
+			httputil.WriteJSONResponse(w, logger, http.StatusOK, response)
+			return
+		}
+
+		publishUpdates(ctx, r, deps, updates, &response)
+
+		status := http.StatusCreated
+		if response.Failed > 0 {
+			status = http.StatusAccepted
+		}
+		httputil.WriteJSONResponse(w, logger, status, response)
+	}
+}
+
+// newImportUpdate builds the update that turns the current value of a variable into desired, both as GetValue
+// returns them, previewing it. The update has no event when the variable already holds desired.
+func newImportUpdate(hubName, varName string, varType valkey.VariableType, current, desired any, correlationID string) (batchUpdate, error) {
+	diff, ok, err := valkey.Diff(varType, current, desired)
+	if err != nil {
+		return batchUpdate{}, fmt.Errorf("variable %s/%s: %w", hubName, varName, err)
+	}
+	if !ok {
+		return batchUpdate{}, nil
+	}
+	event, payload, err := newVariableEvent(hubName, varName, varType, diff.Command, diff.Data, correlationID)
+	if err != nil {
+		return batchUpdate{}, err
+	}
+	after, err := valkey.Preview(varType, diff.Command, current, payload)
+	if err != nil {
+		return batchUpdate{}, fmt.Errorf("failed to preview %s/%s: %w", hubName, varName, err)
+	}
+	return batchUpdate{
+		entry:    BatchEntry{Hub: hubName, Var: varName, Op: string(diff.Command), Data: diff.Data, TTL: ""},
+		varType:  varType,
+		payload:  payload,
+		event:    event,
+		decision: auth.Decision{},
+		ttl:      0,
+		before:   current,
+		after:    after,
+		revert:   nil,
+	}, nil
+}
+
+// snapshotValue validates the value of a snapshot variable and converts it to the shape GetValue returns. A null
+// value stands for a variable that is not set.
+func snapshotValue(variable SnapshotVariable) (any, error) {
+	command := valkey.CommandAdd
+	switch variable.Type {
+	case valkey.VariableTypeSet, valkey.VariableTypeMap, valkey.VariableTypeList:
+		command = valkey.CommandReplace
+	default:
+		if variable.Value == nil {
+			return "", nil
+		}
+	}
+	parser, err := valkey.GetParser(variable.Type, command)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(variable.Value)
+	if err != nil {
+		return nil, httputil.NewError(http.StatusBadRequest, httputil.CodeInvalidValue, "value is not representable as JSON")
+	}
+	return parser(data)
+}
+
+// hubVariableTypes returns the manual variables of a hub with their types.
+func hubVariableTypes(deps HandlerDeps, hubName string) (map[string]string, error) {
+	hubsVariables, err := deps.ConfigMapController.GetAllHubsToDataMap()
+	if err != nil {
+		return nil, httputil.NewError(http.StatusInternalServerError, httputil.CodeInternal, "failed to fetch manual variables")
+	}
+	if len(hubsVariables) == 0 {
+		return nil, manualvariables.ErrNoManualVariablesFound
+	}
+	hubVariables, ok := hubsVariables[hubName]
+	if !ok {
+		return nil, manualvariables.ErrHubNotFound
+	}
+	return hubVariables, nil
+}
+
+// decodeSnapshot reads the Snapshot in the body of r, as YAML when its Content-Type says so and as JSON otherwise.
+func decodeSnapshot(r *http.Request) (Snapshot, error) {
+	var snapshot Snapshot
+	var err error
+	if isYAML(r.Header.Get("Content-Type")) {
+		dec := yaml.NewDecoder(r.Body)
+		dec.KnownFields(true)
+		err = dec.Decode(&snapshot)
+	} else {
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		dec.UseNumber()
+		err = dec.Decode(&snapshot)
+	}
+	if err != nil {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			return Snapshot{}, httputil.NewError(http.StatusRequestEntityTooLarge, httputil.CodeBodyTooLarge, "request body too large (max "+formatByteSize(mbe.Limit)+")")
+		}
+		if errors.Is(err, io.EOF) {
+			return Snapshot{}, httputil.NewError(http.StatusBadRequest, httputil.CodeInvalidSnapshot, "snapshot required")
+		}
+		return Snapshot{}, httputil.NewError(http.StatusBadRequest, httputil.CodeInvalidSnapshot, "invalid snapshot: expected a {version, hub, variables} document as exported")
+	}
+	if snapshot.Version != SnapshotVersion {
+		return Snapshot{}, httputil.NewError(http.StatusBadRequest, httputil.CodeInvalidSnapshot, fmt.Sprintf("unsupported snapshot version %d, expected %d", snapshot.Version, SnapshotVersion))
+	}
+	return snapshot, nil
+}
+
+// yamlRequested reports whether r asks for YAML with ?format=yaml or, without a format, its Accept header.
+func yamlRequested(r *http.Request) (bool, error) {
+	switch r.URL.Query().Get("format") {
+	case "yaml":
+		return true, nil
+	case "json":
+		return false, nil
+	case "":
+		for accepted := range strings.SplitSeq(r.Header.Get("Accept"), ",") {
+			if isYAML(accepted) {
+				return true, nil
+			}
+		}
+		return false, nil
+	default:
+		return false, httputil.NewError(http.StatusBadRequest, httputil.CodeInvalidRequest, "format must be json or yaml")
+	}
+}
+
+func isYAML(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == yamlContentType || mediaType == "application/x-yaml" || mediaType == "text/yaml"
+}
+
+// writeYAMLSnapshot writes snapshot as YAML. JSON object values are decoded first, as YAML would write their raw
+// bytes as binary.
+func writeYAMLSnapshot(w http.ResponseWriter, logger *zap.Logger, snapshot Snapshot) {
+	for varName, variable := range snapshot.Variables {
+		object, ok := variable.Value.(json.RawMessage)
+		if !ok {
+			continue
+		}
+		var value map[string]any
+		if err := json.Unmarshal(object, &value); err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+		variable.Value = value
+		snapshot.Variables[varName] = variable
+	}
+
+	out, err := yaml.Marshal(snapshot)
+	if err != nil {
+		logger.Error("Failed to encode snapshot", zap.Error(err))
+		httputil.WriteProblem(w, logger, http.StatusInternalServerError, httputil.CodeInternal, "failed to encode snapshot")
+		return
+	}
+	w.Header().Set("Content-Type", yamlContentType)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(out); err != nil {
+		logger.Error("Failed to write response", zap.Error(err))
+	}
+}
@@ -0,0 +1,260 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mydecisive/mdai-gateway/internal/auth"
+	"github.com/mydecisive/mdai-gateway/internal/httputil"
+	"github.com/mydecisive/mdai-gateway/internal/requestid"
+	"github.com/mydecisive/mdai-gateway/internal/valkey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	valkeygo "github.com/valkey-io/valkey-go"
+	valkeymock "github.com/valkey-io/valkey-go/mock"
+	"go.uber.org/mock/gomock"
+	"gopkg.in/yaml.v3"
+)
+
+func newImportRequest(target, contentType, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, target, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", contentType)
+	return req
+}
+
+func TestHandleExportHub(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	newReaderAuth(t, &deps, []string{"mdaihub-sample"}, []string{"data_int", "data_json", "data_set"})
+	mux := NewRouter(t.Context(), deps)
+	mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	mockClient.EXPECT().DoMulti(gomock.Any(),
+		valkeymock.Match("GET", "variable/mdaihub-sample/data_int"),
+		valkeymock.Match("GET", "variable/mdaihub-sample/data_json"),
+		valkeymock.Match("SMEMBERS", "variable/mdaihub-sample/data_set"),
+	).Return([]valkeygo.ValkeyResult{
+		valkeymock.Result(valkeymock.ValkeyBlobString("3")),
+		valkeymock.Result(valkeymock.ValkeyBlobString(`{"threshold":0.5}`)),
+		valkeymock.Result(valkeymock.ValkeyArray(valkeymock.ValkeyBlobString("service-a"))),
+	}).Times(2)
+
+	req := httptest.NewRequest(http.MethodGet, "/variables/export/hub/mdaihub-sample", http.NoBody)
+	req.Header.Set(auth.APIKeyHeader, "key-r")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var snapshot map[string]any
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &snapshot))
+	assert.NotEmpty(t, snapshot["exportedAt"])
+	delete(snapshot, "exportedAt")
+	assert.Equal(t, map[string]any{
+		"version": float64(SnapshotVersion),
+		"hub":     "mdaihub-sample",
+		"variables": map[string]any{
+			"data_int":  map[string]any{"type": "int", "value": float64(3)},
+			"data_json": map[string]any{"type": "json", "value": map[string]any{"threshold": 0.5}},
+			"data_set":  map[string]any{"type": "set", "value": []any{"service-a"}},
+		},
+	}, snapshot)
+
+	req = httptest.NewRequest(http.MethodGet, "/variables/export/hub/mdaihub-sample", http.NoBody)
+	req.Header.Set(auth.APIKeyHeader, "key-r")
+	req.Header.Set("Accept", "application/yaml")
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, "application/yaml", rr.Header().Get("Content-Type"))
+
+	var fromYAML Snapshot
+	require.NoError(t, yaml.Unmarshal(rr.Body.Bytes(), &fromYAML))
+	assert.Equal(t, "mdaihub-sample", fromYAML.Hub)
+	assert.Equal(t, SnapshotVariable{Type: valkey.VariableTypeJSON, Value: map[string]any{"threshold": 0.5}}, fromYAML.Variables["data_json"])
+	assert.Equal(t, SnapshotVariable{Type: valkey.VariableTypeInt, Value: 3}, fromYAML.Variables["data_int"])
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/variables/export/hub/mdaihub-sample?format=xml", http.NoBody))
+	assertProblem(t, rr, http.StatusBadRequest, httputil.CodeInvalidRequest, "format must be json or yaml")
+}
+
+func TestHandleExportHub_InvalidStoredValue(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	newReaderAuth(t, &deps, []string{"mdaihub-sample"}, []string{"data_int", "data_string"})
+	mux := NewRouter(t.Context(), deps)
+	mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	mockClient.EXPECT().DoMulti(gomock.Any(),
+		valkeymock.Match("GET", "variable/mdaihub-sample/data_int"),
+		valkeymock.Match("GET", "variable/mdaihub-sample/data_string"),
+	).Return([]valkeygo.ValkeyResult{
+		valkeymock.Result(valkeymock.ValkeyBlobString("three")),
+		valkeymock.Result(valkeymock.ValkeyBlobString("foo")),
+	}).Times(1)
+
+	req := httptest.NewRequest(http.MethodGet, "/variables/export/hub/mdaihub-sample", http.NoBody)
+	req.Header.Set(auth.APIKeyHeader, "key-r")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var snapshot Snapshot
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &snapshot))
+	assert.Equal(t, map[string]SnapshotVariable{"data_string": {Type: valkey.VariableTypeStr, Value: "foo"}}, snapshot.Variables)
+	assert.Equal(t, map[string]string{"data_int": `variable mdaihub-sample/data_int: stored value "three" is not a valid int`}, snapshot.Errors)
+}
+
+func TestHandleImportHub(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mux := NewRouter(t.Context(), deps)
+	mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	mockClient.EXPECT().DoMulti(gomock.Any(),
+		valkeymock.Match("GET", "variable/mdaihub-sample/data_int"),
+		valkeymock.Match("SMEMBERS", "variable/mdaihub-sample/data_set"),
+		valkeymock.Match("GET", "variable/mdaihub-sample/data_string"),
+	).Return([]valkeygo.ValkeyResult{
+		valkeymock.Result(valkeymock.ValkeyBlobString("3")),
+		valkeymock.Result(valkeymock.ValkeyArray(valkeymock.ValkeyBlobString("service-a"))),
+		valkeymock.Result(valkeymock.ValkeyBlobString("foo")),
+	}).Times(2)
+	// Only the two variables that differ are published.
+	mockClient.EXPECT().Do(gomock.Any(), VersionBumpMatcher{}).Return(valkeymock.Result(valkeymock.ValkeyInt64(1))).Times(2)
+	mockClient.EXPECT().Do(gomock.Any(), XaddFieldsMatcher{"correlation_id": "copy-1"}).
+		Return(valkeymock.Result(valkeymock.ValkeyString(""))).Times(2)
+
+	body := `{
+		"version": 1,
+		"hub": "mdaihub-staging",
+		"exportedAt": "2026-10-01T12:00:00Z",
+		"variables": {
+			"data_int": {"type": "int", "value": 3},
+			"data_set": {"type": "set", "value": ["service-a", "service-b"]},
+			"data_string": {"type": "string", "value": null}
+		}
+	}`
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, newImportRequest("/variables/import/hub/mdaihub-sample?dryRun=true", "application/json", body))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var preview BatchResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &preview))
+	assert.True(t, preview.DryRun)
+	require.Len(t, preview.Results, 2)
+	assert.Equal(t, "data_set", preview.Results[0].Var)
+	assert.Equal(t, "add", preview.Results[0].Op)
+	assert.Equal(t, BatchStatusValidated, preview.Results[0].Status)
+	assert.Equal(t, []any{"service-a", "service-b"}, preview.Results[0].After)
+	assert.Equal(t, "data_string", preview.Results[1].Var)
+	assert.Equal(t, "clear", preview.Results[1].Op)
+
+	req := newImportRequest("/variables/import/hub/mdaihub-sample", "application/json", body)
+	req.Header.Set(requestid.CorrelationIDHeader, "copy-1")
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	var response BatchResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, "copy-1", response.CorrelationID)
+	assert.Equal(t, 2, response.Successful)
+	for _, result := range response.Results {
+		assert.Equal(t, BatchStatusPublished, result.Status)
+		require.NotNil(t, result.Event)
+		assert.Equal(t, "copy-1", result.Event.CorrelationID)
+	}
+}
+
+func TestHandleImportHub_YAML(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mux := NewRouter(t.Context(), deps)
+	mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	mockClient.EXPECT().Do(gomock.Any(), valkeymock.Match("HGETALL", "variable/mdaihub-sample/data_map")).
+		Return(valkeymock.Result(valkeymock.ValkeyMap(map[string]valkeygo.ValkeyMessage{"k1": valkeymock.ValkeyBlobString("v1")}))).Times(1)
+
+	body := "version: 1\nhub: mdaihub-sample\nvariables:\n  data_map:\n    type: map\n    value: {k1: v1}\n"
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, newImportRequest("/variables/import/hub/mdaihub-sample", "application/yaml", body))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.JSONEq(t, `{"correlationId": "`+rr.Header().Get(requestid.CorrelationIDHeader)+`", "successful": 0, "failed": 0, "results": []}`, rr.Body.String())
+}
+
+func TestHandleImportHub_Invalid(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mux := NewRouter(t.Context(), deps)
+
+	// Nothing is published or audited when the snapshot is invalid.
+	deps.ValkeyClient.(*valkeymock.Client).EXPECT().Do(gomock.Any(), XaddMatcher{}).Times(0) //nolint:forcetypeassert
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		status int
+		code   string
+		detail string
+	}{
+		{
+			name:   "not a snapshot",
+			body:   `[]`,
+			status: http.StatusBadRequest,
+			code:   httputil.CodeInvalidSnapshot,
+			detail: "invalid snapshot: expected a {version, hub, variables} document as exported",
+		},
+		{
+			name:   "unsupported version",
+			body:   `{"version": 2, "variables": {}}`,
+			status: http.StatusBadRequest,
+			code:   httputil.CodeInvalidSnapshot,
+			detail: "unsupported snapshot version 2, expected 1",
+		},
+		{
+			name:   "undefined variable",
+			body:   `{"version": 1, "variables": {"missing": {"type": "string", "value": "x"}}}`,
+			status: http.StatusBadRequest,
+			code:   httputil.CodeInvalidSnapshot,
+			detail: "variable missing is not defined in hub mdaihub-sample",
+		},
+		{
+			name:   "type mismatch",
+			body:   `{"version": 1, "variables": {"data_int": {"type": "string", "value": "3"}}}`,
+			status: http.StatusBadRequest,
+			code:   httputil.CodeInvalidSnapshot,
+			detail: "variable data_int is a string in the snapshot but a int in hub mdaihub-sample",
+		},
+		{
+			name:   "invalid value",
+			body:   `{"version": 1, "variables": {"data_int": {"type": "int", "value": "three"}}}`,
+			status: http.StatusBadRequest,
+			code:   httputil.CodeInvalidSnapshot,
+			detail: "variable data_int: int expected",
+		},
+		{
+			name:   "unknown hub",
+			target: "/variables/import/hub/nonexistent_hub",
+			body:   `{"version": 1, "variables": {}}`,
+			status: http.StatusNotFound,
+			code:   httputil.CodeHubNotFound,
+			detail: "hub not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := tt.target
+			if target == "" {
+				target = "/variables/import/hub/mdaihub-sample"
+			}
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, newImportRequest(target, "application/json", tt.body))
+			assertProblem(t, rr, tt.status, tt.code, tt.detail)
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/mydecisive/mdai-gateway/internal/httputil"
+	"github.com/mydecisive/mdai-gateway/internal/manualvariables"
+	"github.com/mydecisive/mdai-gateway/internal/requestid"
+	"github.com/mydecisive/mdai-gateway/internal/valkey"
+	"go.uber.org/zap"
+)
+
+// HubValues is the response of GET /variables/values/hub/{hubName}. Variables whose stored value could not be read as
+// their type are left out of Values and listed in Errors instead.
+type HubValues struct {
+	Values map[string]any    `json:"values"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// HubValuesPage is a page of GET /variables/values: the variable values of hubs, taken in hub name order. Errors
+// lists by hub the variables left out, like HubValues.Errors.
+type HubValuesPage struct {
+	Hubs   map[string]map[string]any    `json:"hubs"`
+	Errors map[string]map[string]string `json:"errors,omitempty"`
+	// NextCursor is passed as ?cursor= to get the next page; it is empty on the last page.
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// handleGetHubValues returns the values of all variables of a hub the caller may read, in the shape of GET
+// /variables/values/hub/{hubName}/var/{varName} for each, read from Valkey in one pipeline.
+func handleGetHubValues(ctx context.Context, deps HandlerDeps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestid.Logger(r.Context(), deps.Logger)
+		hubName := r.PathValue("hubName")
+		if hubName == "" {
+			httputil.WriteProblem(w, logger, http.StatusBadRequest, httputil.CodeMissingParameter, "hub name required")
+			return
+		}
+		raw, err := boolQuery(r, "raw")
+		if err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+
+		hubVariables, err := hubVariableTypes(deps, hubName)
+		if err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+
+		values, valueErrors, err := readableValues(ctx, r, deps, newAccessFilter(r, deps), hubName, hubVariables, raw)
+		if err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+		httputil.WriteJSONResponse(w, logger, http.StatusOK, HubValues{Values: values, Errors: valueErrors})
+	}
+}
+
+// handleGetAllValues returns the variable values of every hub, like handleGetHubValues, a page of at most ?limit=
+// hubs at a time (limits.valuesPageMaxHubs by default and at most).
+func handleGetAllValues(ctx context.Context, deps HandlerDeps) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestid.Logger(r.Context(), deps.Logger)
+
+		limit := deps.Config.Limits.ValuesPageMaxHubs
+		if s := r.URL.Query().Get("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n <= 0 {
+				httputil.WriteProblem(w, logger, http.StatusBadRequest, httputil.CodeInvalidRequest, "limit must be a positive integer")
+				return
+			}
+			limit = min(n, limit)
+		}
+		raw, err := boolQuery(r, "raw")
+		if err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+
+		hubsVariables, err := deps.ConfigMapController.GetAllHubsToDataMap()
+		if err != nil {
+			httputil.WriteProblem(w, logger, http.StatusInternalServerError, httputil.CodeInternal, "failed to fetch manual variables")
+			return
+		}
+		if len(hubsVariables) == 0 {
+			httputil.WriteError(w, logger, manualvariables.ErrNoManualVariablesFound)
+			return
+		}
+
+		// The cursor is the last hub of the previous page, so hubs added or removed in between do not shift pages.
+		hubNames := slices.Sorted(maps.Keys(hubsVariables))
+		start, found := slices.BinarySearch(hubNames, r.URL.Query().Get("cursor"))
+		if found {
+			start++
+		}
+		end := min(start+limit, len(hubNames))
+
+		page := HubValuesPage{Hubs: make(map[string]map[string]any, end-start), Errors: nil, NextCursor: ""}
+		access := newAccessFilter(r, deps)
+		for _, hubName := range hubNames[start:end] {
+			values, valueErrors, err := readableValues(ctx, r, deps, access, hubName, hubsVariables[hubName], raw)
+			if err != nil {
+				httputil.WriteError(w, logger, err)
+				return
+			}
+			page.Hubs[hubName] = values
+			if len(valueErrors) > 0 {
+				if page.Errors == nil {
+					page.Errors = make(map[string]map[string]string)
+				}
+				page.Errors[hubName] = valueErrors
+			}
+		}
+		if end < len(hubNames) {
+			page.NextCursor = hubNames[end-1]
+		}
+		httputil.WriteJSONResponse(w, logger, http.StatusOK, page)
+	}
+}
+
+// readableValues reads the values of those of variables of a hub the caller may read, as told by access, converted by typedValue unless
+// raw is set. A value that does not convert is left out and its error returned by variable name, so one bad value
+// does not fail the whole read.
+func readableValues(ctx context.Context, r *http.Request, deps HandlerDeps, access *accessFilter, hubName string, variables map[string]string, raw bool) (map[string]any, map[string]string, error) {
+	readableTypes, err := access.readableVariables(hubName, variables)
+	if err != nil {
+		return nil, nil, err
+	}
+	readable := make(map[string]valkey.VariableType, len(readableTypes))
+	for varName, varType := range readableTypes {
+		readable[varName] = valkey.VariableType(varType)
+	}
+
+	logger := requestid.Logger(r.Context(), deps.Logger)
+	values, err := valkey.NewAdapter(deps.ValkeyClient, deps.Logger).GetValues(ctx, hubName, readable)
+	if err != nil {
+		logger.Error("Failed to read variable values", zap.String("hubName", hubName), zap.Error(err))
+		return nil, nil, httputil.NewError(http.StatusInternalServerError, httputil.CodeInternal, "failed to read variable values")
+	}
+	if raw {
+		return values, nil, nil
+	}
+	var valueErrors map[string]string
+	for varName, value := range values {
+		typed, err := typedValue(hubName, varName, readable[varName], value)
+		if err != nil {
+			logger.Warn("Skipping invalid stored value", zap.String("hubName", hubName), zap.String("varName", varName), zap.Error(err))
+			if valueErrors == nil {
+				valueErrors = make(map[string]string)
+			}
+			valueErrors[varName] = err.Error()
+			delete(values, varName)
+			continue
+		}
+		values[varName] = typed
+	}
+	return values, valueErrors, nil
+}
+
+// typedValue converts a value read from Valkey to the JSON type of its variable, see valkey.Typed. A stored value that
+// does not parse as that type is reported rather than passed on as a string.
+func typedValue(hubName, varName string, varType valkey.VariableType, value any) (any, error) {
+	typed, err := valkey.Typed(varType, value)
+	if err != nil {
+		return nil, httputil.NewError(http.StatusInternalServerError, httputil.CodeInvalidStoredValue, fmt.Sprintf("variable %s/%s: %v", hubName, varName, err))
+	}
+	return typed, nil
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	datacorekube "github.com/mydecisive/mdai-data-core/kube"
+	"github.com/mydecisive/mdai-gateway/internal/auth"
+	"github.com/mydecisive/mdai-gateway/internal/config"
+	"github.com/mydecisive/mdai-gateway/internal/httputil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valkey-io/valkey-go"
+	valkeymock "github.com/valkey-io/valkey-go/mock"
+	"go.uber.org/mock/gomock"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newReaderAuth(t *testing.T, deps *HandlerDeps, hubs, variables []string) {
+	t.Helper()
+	authenticator, err := auth.NewStaticAuthenticator(auth.CredentialsFile{
+		APIKeys: []auth.Credential{{Identity: "reader", Secret: "key-r"}},
+	})
+	require.NoError(t, err)
+	deps.Authenticator = authenticator
+	deps.Authorizer = auth.NewPolicy([]config.AuthRule{{
+		Name:       "reader",
+		Identities: []string{"reader"},
+		Hubs:       hubs,
+		Variables:  variables,
+		Actions:    []string{auth.ActionRead},
+	}})
+}
+
+func TestHandleGetHubValues(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	mux := NewRouter(t.Context(), deps)
+	mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	mockClient.EXPECT().DoMulti(gomock.Any(),
+		valkeymock.Match("GET", "variable/mdaihub-sample/data_boolean"),
+		valkeymock.Match("GET", "variable/mdaihub-sample/data_duration"),
+		valkeymock.Match("GET", "variable/mdaihub-sample/data_float"),
+		valkeymock.Match("GET", "variable/mdaihub-sample/data_int"),
+		valkeymock.Match("GET", "variable/mdaihub-sample/data_json"),
+		valkeymock.Match("LRANGE", "variable/mdaihub-sample/data_list", "0", "-1"),
+		valkeymock.Match("HGETALL", "variable/mdaihub-sample/data_map"),
+		valkeymock.Match("SMEMBERS", "variable/mdaihub-sample/data_set"),
+		valkeymock.Match("GET", "variable/mdaihub-sample/data_string"),
+	).Return([]valkey.ValkeyResult{
+		valkeymock.Result(valkeymock.ValkeyBlobString("true")),
+		valkeymock.Result(valkeymock.ValkeyBlobString("1h30m0s")),
+		valkeymock.Result(valkeymock.ValkeyBlobString("0.25")),
+		valkeymock.Result(valkeymock.ValkeyBlobString("3")),
+		valkeymock.Result(valkeymock.ValkeyBlobString(`{"threshold":0.5}`)),
+		valkeymock.Result(valkeymock.ValkeyArray(valkeymock.ValkeyBlobString("b"), valkeymock.ValkeyBlobString("a"))),
+		valkeymock.Result(valkeymock.ValkeyMap(map[string]valkey.ValkeyMessage{"k1": valkeymock.ValkeyBlobString("v1")})),
+		valkeymock.Result(valkeymock.ValkeyArray(valkeymock.ValkeyBlobString("service-a"))),
+		valkeymock.Result(valkeymock.ValkeyNil()),
+	}).Times(1)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/variables/values/hub/mdaihub-sample", http.NoBody))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.JSONEq(t, `{"values": {
+		"data_boolean": true,
+		"data_duration": "1h30m0s",
+		"data_float": 0.25,
+		"data_int": 3,
+		"data_json": {"threshold": 0.5},
+		"data_list": ["b", "a"],
+		"data_map": {"k1": "v1"},
+		"data_set": ["service-a"],
+		"data_string": ""
+	}}`, rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/variables/values/hub/nonexistent_hub", http.NoBody))
+	assertProblem(t, rr, http.StatusNotFound, httputil.CodeHubNotFound, "hub not found")
+}
+
+func TestHandleGetHubValues_Authorization(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	newReaderAuth(t, &deps, []string{"mdaihub-sample"}, []string{"data_s*"})
+	mux := NewRouter(t.Context(), deps)
+	mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	mockClient.EXPECT().DoMulti(gomock.Any(),
+		valkeymock.Match("SMEMBERS", "variable/mdaihub-sample/data_set"),
+		valkeymock.Match("GET", "variable/mdaihub-sample/data_string"),
+	).Return([]valkey.ValkeyResult{
+		valkeymock.Result(valkeymock.ValkeyArray()),
+		valkeymock.Result(valkeymock.ValkeyBlobString("foo")),
+	}).Times(1)
+
+	req := httptest.NewRequest(http.MethodGet, "/variables/values/hub/mdaihub-sample?raw=true", http.NoBody)
+	req.Header.Set(auth.APIKeyHeader, "key-r")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.JSONEq(t, `{"values": {"data_set": [], "data_string": "foo"}}`, rr.Body.String())
+}
+
+func TestHandleGetHubValues_InvalidStoredValue(t *testing.T) {
+	clientset := newFakeClientset(t)
+	deps := setupMocks(t, clientset)
+	newReaderAuth(t, &deps, []string{"mdaihub-sample"}, []string{"data_int", "data_string"})
+	mux := NewRouter(t.Context(), deps)
+	mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	mockClient.EXPECT().DoMulti(gomock.Any(),
+		valkeymock.Match("GET", "variable/mdaihub-sample/data_int"),
+		valkeymock.Match("GET", "variable/mdaihub-sample/data_string"),
+	).Return([]valkey.ValkeyResult{
+		valkeymock.Result(valkeymock.ValkeyBlobString("three")),
+		valkeymock.Result(valkeymock.ValkeyBlobString("foo")),
+	}).Times(1)
+
+	// The other values are still returned.
+	req := httptest.NewRequest(http.MethodGet, "/variables/values/hub/mdaihub-sample", http.NoBody)
+	req.Header.Set(auth.APIKeyHeader, "key-r")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.JSONEq(t, `{
+		"values": {"data_string": "foo"},
+		"errors": {"data_int": "variable mdaihub-sample/data_int: stored value \"three\" is not a valid int"}
+	}`, rr.Body.String())
+}
+
+func TestHandleGetAllValues(t *testing.T) {
+	clientset := newFakeClientset(t)
+	_, err := clientset.CoreV1().ConfigMaps("mdai").Create(t.Context(), &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "mdaihub-second-manual-variables",
+			Namespace: "mdai",
+			Labels: map[string]string{
+				datacorekube.ConfigMapTypeLabel: datacorekube.ManualEnvConfigMapType,
+				datacorekube.LabelMdaiHubName:   "mdaihub-second",
+			},
+		},
+		Data: map[string]string{"manual_filter": "set"},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	deps := setupMocks(t, clientset)
+	// Nothing of the first hub is readable, so its page needs no Valkey reads.
+	newReaderAuth(t, &deps, []string{"mdaihub-second"}, []string{"*"})
+	mux := NewRouter(t.Context(), deps)
+	mockClient := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+
+	get := func(target string) HubValuesPage {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, target, http.NoBody)
+		req.Header.Set(auth.APIKeyHeader, "key-r")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var page HubValuesPage
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &page))
+		return page
+	}
+
+	first := get("/variables/values?limit=1")
+	assert.Equal(t, HubValuesPage{Hubs: map[string]map[string]any{"mdaihub-sample": {}}, Errors: nil, NextCursor: "mdaihub-sample"}, first)
+
+	mockClient.EXPECT().Do(gomock.Any(), valkeymock.Match("SMEMBERS", "variable/mdaihub-second/manual_filter")).
+		Return(valkeymock.Result(valkeymock.ValkeyArray(valkeymock.ValkeyBlobString("noisy-service")))).Times(1)
+	second := get("/variables/values?limit=1&cursor=" + first.NextCursor)
+	assert.Equal(t, HubValuesPage{Hubs: map[string]map[string]any{"mdaihub-second": {"manual_filter": []any{"noisy-service"}}}, Errors: nil, NextCursor: ""}, second)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/variables/values?limit=0", http.NoBody))
+	assertProblem(t, rr, http.StatusBadRequest, httputil.CodeInvalidRequest, "limit must be a positive integer")
+}
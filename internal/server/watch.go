@@ -0,0 +1,266 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mydecisive/mdai-data-core/eventing"
+	auditutils "github.com/mydecisive/mdai-gateway/internal/audit"
+	"github.com/mydecisive/mdai-gateway/internal/auth"
+	"github.com/mydecisive/mdai-gateway/internal/httputil"
+	"github.com/mydecisive/mdai-gateway/internal/requestid"
+	"go.uber.org/zap"
+)
+
+// LastEventIDHeader is sent by EventSource clients when they reconnect, carrying the id of the last event they got.
+const LastEventIDHeader = "Last-Event-ID"
+
+// maxReplayedEvents is how many missed events a reconnecting client is sent at most; one that missed more is told to
+// start over from the current values instead.
+const maxReplayedEvents = 1000
+
+// watchHeartbeatInterval is how often an idle watch stream sends a comment, so proxies do not time it out.
+const watchHeartbeatInterval = 15 * time.Second
+
+// VarWatcher streams published variable events, see nats.EventPublisher.WatchVars.
+type VarWatcher interface {
+	WatchVars(ctx context.Context, hubName, varName string) (<-chan eventing.MdaiEvent, error)
+}
+
+// VariableChange is the data of an event of GET /variables/watch.
+type VariableChange struct {
+	EventID       string    `json:"eventId"`
+	Hub           string    `json:"hub"`
+	Var           string    `json:"var"`
+	Type          string    `json:"type"`
+	Op            string    `json:"op"`
+	Data          any       `json:"data,omitempty"`
+	Source        string    `json:"source"`
+	CorrelationID string    `json:"correlationId,omitempty"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+func newVariableChange(event eventing.MdaiEvent) (VariableChange, error) {
+	var payload eventing.VariablesActionPayload
+	if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
+		return VariableChange{}, fmt.Errorf("failed to decode payload of event %s: %w", event.ID, err)
+	}
+	return VariableChange{
+		EventID:       event.ID,
+		Hub:           event.HubName,
+		Var:           payload.VariableRef,
+		Type:          payload.DataType,
+		Op:            payload.Operation,
+		Data:          payload.Data,
+		Source:        event.Source,
+		CorrelationID: event.CorrelationID,
+		Timestamp:     event.Timestamp,
+	}, nil
+}
+
+// lastEventID reads where a reconnecting client left off, from the Last-Event-ID header or, for clients that cannot
+// set headers on their first connection, the lastEventId query parameter. Event IDs are time-ordered UUIDs, so the
+// time the event was created is returned too. The ID is empty when there is none.
+func lastEventID(r *http.Request) (string, time.Time, error) {
+	value := r.Header.Get(LastEventIDHeader)
+	if value == "" {
+		value = r.URL.Query().Get("lastEventId")
+	}
+	if value == "" {
+		return "", time.Time{}, nil
+	}
+	id, err := uuid.Parse(value)
+	if err != nil || id.Version() != 7 {
+		return "", time.Time{}, httputil.NewError(http.StatusBadRequest, httputil.CodeInvalidRequest, fmt.Sprintf("invalid last event ID %q: expected the id of an event sent by this stream", value))
+	}
+	return value, time.Unix(id.Time().UnixTime()), nil
+}
+
+// watchStream writes variable events as Server-Sent Events, leaving out those the caller may not read.
+type watchStream struct {
+	w                http.ResponseWriter
+	r                *http.Request
+	deps             HandlerDeps
+	hubName, varName string
+	// readable caches access decisions per variable for the lifetime of the stream.
+	readable map[string]bool
+}
+
+// watches reports whether a change is of the hub or variable the stream is limited to, if any.
+func (s *watchStream) watches(change VariableChange) bool {
+	// Subjects are sanitized, so distinct names may share one.
+	return (s.hubName == "" || change.Hub == s.hubName) && (s.varName == "" || change.Var == s.varName)
+}
+
+// missedEvents reads the events audited after the one with ID lastID, created at lastTime, that the stream watches.
+func (s *watchStream) missedEvents(ctx context.Context, lastID string, lastTime time.Time) ([]eventing.MdaiEvent, error) {
+	var missed []eventing.MdaiEvent
+	tooMany := false
+	err := auditutils.ScanVarEvents(ctx, s.deps.ValkeyClient, auditutils.TimeStreamID(lastTime), "+", func(event auditutils.AuditedEvent) bool {
+		if event.Event.ID == lastID {
+			// Events audited in the same millisecond before it were sent already.
+			missed = missed[:0]
+			return true
+		}
+		// Events that cannot be decoded are replayed, so send logs them.
+		if change, err := newVariableChange(event.Event); err == nil && !s.watches(change) {
+			return true
+		}
+		if len(missed) == maxReplayedEvents {
+			tooMany = true
+			return false
+		}
+		missed = append(missed, event.Event)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if tooMany {
+		return nil, httputil.NewError(http.StatusGone, httputil.CodeTooManyMissedEvents, fmt.Sprintf(
+			"more than %d changes were missed since event %s: read the current values and watch again without a last event ID", maxReplayedEvents, lastID))
+	}
+	return missed, nil
+}
+
+func (s *watchStream) send(event eventing.MdaiEvent) error {
+	logger := requestid.Logger(s.r.Context(), s.deps.Logger)
+	change, err := newVariableChange(event)
+	if err != nil {
+		logger.Warn("Skipping variable event", zap.String("id", event.ID), zap.Error(err))
+		return nil
+	}
+	if !s.watches(change) {
+		return nil
+	}
+	key := change.Hub + "/" + change.Var
+	allowed, seen := s.readable[key]
+	if !seen {
+		_, err := checkAccess(s.r, s.deps, auth.ActionRead, change.Hub, change.Var)
+		allowed = err == nil
+		s.readable[key] = allowed
+	}
+	if !allowed {
+		return nil
+	}
+	data, err := json.Marshal(change)
+	if err != nil {
+		logger.Warn("Skipping variable event", zap.String("id", event.ID), zap.Error(err))
+		return nil
+	}
+	_, err = fmt.Fprintf(s.w, "id: %s\ndata: %s\n\n", event.ID, data)
+	return err
+}
+
+// handleWatchVariables streams the changes of the variables the caller may read as Server-Sent Events, optionally
+// only those of one hub or variable. A client reconnecting with the id of the last event it got is first sent the
+// events it missed, as recorded in the audit history, or 410 when it missed more than maxReplayedEvents.
+func handleWatchVariables(deps HandlerDeps) http.HandlerFunc { //nolint:funlen
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := requestid.Logger(r.Context(), deps.Logger)
+
+		hubName := r.URL.Query().Get("hub")
+		varName := r.URL.Query().Get("var")
+		if varName != "" && hubName == "" {
+			httputil.WriteProblem(w, logger, http.StatusBadRequest, httputil.CodeMissingParameter, "hub is required when watching a variable")
+			return
+		}
+		lastID, lastTime, err := lastEventID(r)
+		if err != nil {
+			httputil.WriteError(w, logger, err)
+			return
+		}
+		if varName != "" {
+			if _, ok := authorize(w, r, deps, auth.ActionRead, hubName, varName); !ok {
+				return
+			}
+		}
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		if deps.StreamsDone != nil {
+			go func() {
+				select {
+				case <-deps.StreamsDone:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+		}
+
+		// Subscribe before reading the history, so no event falls in between.
+		events, err := deps.VarWatcher.WatchVars(ctx, hubName, varName)
+		if err != nil {
+			logger.Error("Failed to watch variables", zap.Error(err))
+			httputil.WriteProblem(w, logger, http.StatusInternalServerError, httputil.CodeInternal, "failed to watch variables")
+			return
+		}
+		stream := &watchStream{w: w, r: r, deps: deps, hubName: hubName, varName: varName, readable: make(map[string]bool)}
+		var missed []eventing.MdaiEvent
+		if lastID != "" {
+			if missed, err = stream.missedEvents(ctx, lastID, lastTime); err != nil {
+				var coded httputil.CodedError
+				if errors.As(err, &coded) {
+					httputil.WriteError(w, logger, err)
+					return
+				}
+				logger.Error("Failed to read missed variable events", zap.Error(err))
+				httputil.WriteProblem(w, logger, http.StatusInternalServerError, httputil.CodeInternal, "failed to read missed variable events")
+				return
+			}
+		}
+
+		rc := http.NewResponseController(w)
+		// The stream outlives http.writeTimeout.
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			logger.Warn("Failed to lift the write deadline of a watch stream", zap.Error(err))
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		replayed := make(map[string]bool, len(missed))
+		for _, event := range missed {
+			if err := stream.send(event); err != nil {
+				return
+			}
+			replayed[event.ID] = true
+		}
+		if err := rc.Flush(); err != nil {
+			logger.Error("Watch stream does not support flushing", zap.Error(err))
+			return
+		}
+
+		heartbeat := time.NewTicker(watchHeartbeatInterval)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+					return
+				}
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				if replayed[event.ID] {
+					continue
+				}
+				if err := stream.send(event); err != nil {
+					return
+				}
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mydecisive/mdai-data-core/eventing"
+	"github.com/mydecisive/mdai-gateway/internal/httputil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valkey-io/valkey-go"
+	valkeymock "github.com/valkey-io/valkey-go/mock"
+	"go.uber.org/mock/gomock"
+)
+
+func openWatch(t *testing.T, deps HandlerDeps, target, lastEventID string) *bufio.Reader {
+	t.Helper()
+	srv := httptest.NewServer(NewRouter(t.Context(), deps))
+	t.Cleanup(srv.Close)
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, srv.URL+target, http.NoBody)
+	require.NoError(t, err)
+	if lastEventID != "" {
+		req.Header.Set(LastEventIDHeader, lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	return bufio.NewReader(resp.Body)
+}
+
+// nextChange reads the next event of a watch stream, skipping comments.
+func nextChange(t *testing.T, stream *bufio.Reader) (string, VariableChange) {
+	t.Helper()
+	var id string
+	var change VariableChange
+	for {
+		line, err := stream.ReadString('\n')
+		require.NoError(t, err)
+		switch line = strings.TrimSuffix(line, "\n"); {
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &change))
+		case line == "" && id != "":
+			return id, change
+		}
+	}
+}
+
+func publishVariableEvent(t *testing.T, deps HandlerDeps, varName, value string) *eventing.MdaiEvent {
+	t.Helper()
+	event, err := eventing.NewMdaiEvent("mdaihub-sample", varName, "string", "set", value)
+	require.NoError(t, err)
+	require.NoError(t, deps.EventPublisher.Publish(t.Context(), *event, eventing.MdaiEventSubject{Type: eventing.VarEventType, Path: "mdaihub-sample." + varName}))
+	return event
+}
+
+func historyEntry(event *eventing.MdaiEvent, auditFields ...string) valkey.ValkeyMessage {
+	fields := append([]string{
+		"id", event.ID, "name", event.Name, "timestamp", event.Timestamp.Format(time.RFC3339), "payload", event.Payload,
+		"source", event.Source, "hub_name", event.HubName, "publish_success", "true",
+	}, auditFields...)
+	values := make([]valkey.ValkeyMessage, len(fields))
+	for i, field := range fields {
+		values[i] = valkeymock.ValkeyBlobString(field)
+	}
+	return valkeymock.ValkeyArray(valkeymock.ValkeyBlobString(strconv.FormatInt(event.Timestamp.UnixMilli(), 10)+"-0"), valkeymock.ValkeyArray(values...))
+}
+
+func TestHandleWatchVariables(t *testing.T) {
+	deps := setupMocks(t, newFakeClientset(t))
+	stream := openWatch(t, deps, "/variables/watch?hub=mdaihub-sample&var=data_string", "")
+
+	publishVariableEvent(t, deps, "data_int", "ignored")
+	event := publishVariableEvent(t, deps, "data_string", "on")
+
+	id, change := nextChange(t, stream)
+	assert.Equal(t, event.ID, id)
+	assert.Equal(t, VariableChange{
+		EventID:       event.ID,
+		Hub:           "mdaihub-sample",
+		Var:           "data_string",
+		Type:          "string",
+		Op:            "set",
+		Data:          "on",
+		Source:        eventing.ManualVariablesEventSource,
+		CorrelationID: event.CorrelationID,
+		Timestamp:     event.Timestamp,
+	}, change)
+}
+
+func TestHandleWatchVariablesResume(t *testing.T) {
+	deps := setupMocks(t, newFakeClientset(t))
+
+	seen, err := eventing.NewMdaiEvent("mdaihub-sample", "data_string", "string", "set", "seen")
+	require.NoError(t, err)
+	otherVar, err := eventing.NewMdaiEvent("mdaihub-sample", "data_int", "int", "set", 1)
+	require.NoError(t, err)
+	missed, err := eventing.NewMdaiEvent("mdaihub-sample", "data_string", "string", "set", "missed")
+	require.NoError(t, err)
+	since := strconv.FormatInt(seen.Timestamp.UnixMilli(), 10)
+	client := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+	client.EXPECT().Do(gomock.Any(), valkeymock.Match("XRANGE", "mdai_hub_event_history", since, "+", "COUNT", "500")).
+		Return(valkeymock.Result(valkeymock.ValkeyArray(historyEntry(seen), historyEntry(otherVar), historyEntry(missed))))
+
+	stream := openWatch(t, deps, "/variables/watch?hub=mdaihub-sample&var=data_string", seen.ID)
+
+	id, change := nextChange(t, stream)
+	assert.Equal(t, missed.ID, id)
+	assert.Equal(t, "missed", change.Data)
+
+	live := publishVariableEvent(t, deps, "data_string", "live")
+	id, _ = nextChange(t, stream)
+	assert.Equal(t, live.ID, id)
+}
+
+func TestHandleWatchVariablesTooManyMissed(t *testing.T) {
+	deps := setupMocks(t, newFakeClientset(t))
+
+	seen, err := eventing.NewMdaiEvent("mdaihub-sample", "data_string", "string", "set", "seen")
+	require.NoError(t, err)
+	// Changes of other variables do not count, so the replay reads on past the first batch.
+	client := deps.ValkeyClient.(*valkeymock.Client) //nolint:forcetypeassert
+	start := strconv.FormatInt(seen.Timestamp.UnixMilli(), 10)
+	var batch []valkey.ValkeyMessage
+	for i := range 500 + maxReplayedEvents + 1 {
+		varName := "data_string"
+		if i < 500 {
+			varName = "data_int"
+		}
+		event, err := eventing.NewMdaiEvent("mdaihub-sample", varName, "string", "set", "missed")
+		require.NoError(t, err)
+		event.Timestamp = seen.Timestamp.Add(time.Duration(i+1) * time.Millisecond)
+		batch = append(batch, historyEntry(event))
+		if len(batch) == 500 || i == 500+maxReplayedEvents {
+			client.EXPECT().Do(gomock.Any(), valkeymock.Match("XRANGE", "mdai_hub_event_history", start, "+", "COUNT", "500")).
+				Return(valkeymock.Result(valkeymock.ValkeyArray(batch...)))
+			start = "(" + strconv.FormatInt(event.Timestamp.UnixMilli(), 10) + "-0"
+			batch = nil
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/variables/watch?hub=mdaihub-sample&var=data_string", http.NoBody)
+	req.Header.Set(LastEventIDHeader, seen.ID)
+	rr := httptest.NewRecorder()
+	NewRouter(t.Context(), deps).ServeHTTP(rr, req)
+	assertProblem(t, rr, http.StatusGone, httputil.CodeTooManyMissedEvents,
+		"more than 1000 changes were missed since event "+seen.ID+": read the current values and watch again without a last event ID")
+}
+
+func TestHandleWatchVariablesBadRequest(t *testing.T) {
+	deps := setupMocks(t, newFakeClientset(t))
+	mux := NewRouter(t.Context(), deps)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/variables/watch?var=data_string", http.NoBody))
+	assertProblem(t, rr, http.StatusBadRequest, httputil.CodeMissingParameter, "hub is required when watching a variable")
+
+	v4 := uuid.NewString()
+	req := httptest.NewRequest(http.MethodGet, "/variables/watch", http.NoBody)
+	req.Header.Set(LastEventIDHeader, v4)
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assertProblem(t, rr, http.StatusBadRequest, httputil.CodeInvalidRequest, `invalid last event ID "`+v4+`": expected the id of an event sent by this stream`)
+}
@@ -0,0 +1,183 @@
+package tlsutil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mydecisive/mdai-gateway/internal/config"
+	"go.uber.org/zap"
+)
+
+// ClientAuthType maps the configured client certificate mode to its crypto/tls equivalent.
+func ClientAuthType(mode string) (tls.ClientAuthType, error) {
+	switch mode {
+	case config.ClientAuthNone:
+		return tls.NoClientCert, nil
+	case config.ClientAuthRequest:
+		return tls.VerifyClientCertIfGiven, nil
+	case config.ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("unknown client auth mode %q", mode)
+	}
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Reloader serves the certificate, key and client CA bundle from mounted files and reloads them when they change,
+// so rotated Secrets are picked up without restarting the gateway.
+type Reloader struct {
+	logger     *zap.Logger
+	cfg        config.TLS
+	clientAuth tls.ClientAuthType
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	stamps    map[string]fileStamp
+}
+
+// NewReloader loads the configured files once and fails if any of them is missing or invalid.
+func NewReloader(logger *zap.Logger, cfg config.TLS) (*Reloader, error) {
+	clientAuth, err := ClientAuthType(cfg.ClientAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reloader{
+		logger:     logger,
+		cfg:        cfg,
+		clientAuth: clientAuth,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the certificate, key and client CA bundle from disk and swaps them in atomically.
+func (r *Reloader) Reload() error {
+	stamps, err := r.statFiles()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("load TLS key pair: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("read client CA file: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in client CA file %s", r.cfg.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.stamps = stamps
+	return nil
+}
+
+// Run polls the files every cfg.ReloadInterval until ctx is done. A failed reload keeps serving the previous
+// certificates, since a rotation may be observed halfway through.
+func (r *Reloader) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed, err := r.changed()
+		if err != nil {
+			r.logger.Warn("Failed to check TLS files for changes", zap.Error(err))
+			continue
+		}
+		if !changed {
+			continue
+		}
+		if err := r.Reload(); err != nil {
+			r.logger.Error("Failed to reload TLS certificates, keeping the previous ones", zap.Error(err))
+			continue
+		}
+		r.logger.Info("Reloaded TLS certificates")
+	}
+}
+
+// TLSConfig returns a server configuration that always hands out the most recently loaded certificates.
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				ClientCAs:    r.clientCAs,
+				ClientAuth:   r.clientAuth,
+				// The OpAMP WebSocket transport upgrades HTTP/1.1 connections.
+				NextProtos: []string{"http/1.1"},
+			}, nil
+		},
+	}
+}
+
+func (r *Reloader) files() []string {
+	files := []string{r.cfg.CertFile, r.cfg.KeyFile}
+	if r.cfg.ClientCAFile != "" {
+		files = append(files, r.cfg.ClientCAFile)
+	}
+	return files
+}
+
+func (r *Reloader) statFiles() (map[string]fileStamp, error) {
+	stamps := make(map[string]fileStamp)
+	var errs []error
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		stamps[file] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+	return stamps, errors.Join(errs...)
+}
+
+func (r *Reloader) changed() (bool, error) {
+	stamps, err := r.statFiles()
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for file, stamp := range stamps {
+		if prev := r.stamps[file]; !prev.modTime.Equal(stamp.modTime) || prev.size != stamp.size {
+			return true, nil
+		}
+	}
+	return false, nil
+}
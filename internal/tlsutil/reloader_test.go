@@ -0,0 +1,241 @@
+package tlsutil
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mydecisive/mdai-gateway/internal/auth"
+	"github.com/mydecisive/mdai-gateway/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key signed by ca. Server certificates are valid for 127.0.0.1.
+func (ca testCA) issue(t *testing.T, commonName string, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"mdai"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+}
+
+type tlsFixture struct {
+	serverCA testCA
+	clientCA testCA
+	cfg      config.TLS
+}
+
+func newTLSFixture(t *testing.T, clientAuth string) tlsFixture {
+	t.Helper()
+
+	dir := t.TempDir()
+	fixture := tlsFixture{
+		serverCA: newTestCA(t, "server-ca"),
+		clientCA: newTestCA(t, "client-ca"),
+		cfg: config.TLS{
+			CertFile:       filepath.Join(dir, "tls.crt"),
+			KeyFile:        filepath.Join(dir, "tls.key"),
+			ClientCAFile:   filepath.Join(dir, "ca.crt"),
+			ClientAuth:     clientAuth,
+			ReloadInterval: 10 * time.Millisecond,
+		},
+	}
+	fixture.rotateServerCert(t, fixture.serverCA)
+	writeFile(t, fixture.cfg.ClientCAFile, fixture.clientCA.pem)
+	return fixture
+}
+
+func (f tlsFixture) rotateServerCert(t *testing.T, ca testCA) {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, "mdai-gateway", x509.ExtKeyUsageServerAuth)
+	writeFile(t, f.cfg.CertFile, certPEM)
+	writeFile(t, f.cfg.KeyFile, keyPEM)
+}
+
+func (f tlsFixture) client(t *testing.T, serverCA testCA, clientCert *tls.Certificate) *http.Client {
+	t.Helper()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(serverCA.cert)
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: roots}
+	if clientCert != nil {
+		// Always present the certificate, even when its issuer is not among the CAs the server asks for.
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return clientCert, nil
+		}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig, DisableKeepAlives: true}}
+}
+
+func (f tlsFixture) clientCert(t *testing.T, commonName string) *tls.Certificate {
+	t.Helper()
+	certPEM, keyPEM := f.clientCA.issue(t, commonName, x509.ExtKeyUsageClientAuth)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	return &cert
+}
+
+// serveTLS serves a handler echoing the caller identity behind a TLS listener using the reloader.
+func serveTLS(t *testing.T, reloader *Reloader) string {
+	t.Helper()
+
+	ln, err := (&net.ListenConfig{}).Listen(t.Context(), "tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	handler := auth.Middleware(auth.ClientCertificateAuthenticator{}, false, zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, _ := auth.IdentityFromContext(r.Context())
+		_, _ = io.WriteString(w, identity.Name)
+	}))
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: time.Second}
+	go func() { _ = srv.Serve(tls.NewListener(ln, reloader.TLSConfig())) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	return "https://" + ln.Addr().String()
+}
+
+func get(t *testing.T, client *http.Client, url string) (string, error) {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, url, http.NoBody)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestReloader_MutualTLS(t *testing.T) {
+	fixture := newTLSFixture(t, config.ClientAuthRequest)
+	reloader, err := NewReloader(zap.NewNop(), fixture.cfg)
+	require.NoError(t, err)
+	url := serveTLS(t, reloader)
+
+	body, err := get(t, fixture.client(t, fixture.serverCA, fixture.clientCert(t, "otel-collector")), url)
+	require.NoError(t, err)
+	assert.Equal(t, "otel-collector", body)
+
+	// Without a certificate the request is served anonymously in "request" mode.
+	body, err = get(t, fixture.client(t, fixture.serverCA, nil), url)
+	require.NoError(t, err)
+	assert.Empty(t, body)
+
+	// Certificates from an unknown CA are rejected during the handshake.
+	untrusted := newTestCA(t, "untrusted")
+	certPEM, keyPEM := untrusted.issue(t, "intruder", x509.ExtKeyUsageClientAuth)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	_, err = get(t, fixture.client(t, fixture.serverCA, &cert), url)
+	require.Error(t, err)
+}
+
+func TestReloader_RequireClientCert(t *testing.T) {
+	fixture := newTLSFixture(t, config.ClientAuthRequire)
+	reloader, err := NewReloader(zap.NewNop(), fixture.cfg)
+	require.NoError(t, err)
+	url := serveTLS(t, reloader)
+
+	_, err = get(t, fixture.client(t, fixture.serverCA, nil), url)
+	require.Error(t, err)
+}
+
+func TestReloader_HotReload(t *testing.T) {
+	fixture := newTLSFixture(t, config.ClientAuthNone)
+	reloader, err := NewReloader(zap.NewNop(), fixture.cfg)
+	require.NoError(t, err)
+	url := serveTLS(t, reloader)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go reloader.Run(ctx)
+
+	_, err = get(t, fixture.client(t, fixture.serverCA, nil), url)
+	require.NoError(t, err)
+
+	// Rotate to a certificate issued by a different CA; clients trusting only the new CA succeed once reloaded.
+	rotatedCA := newTestCA(t, "rotated-ca")
+	fixture.rotateServerCert(t, rotatedCA)
+	require.Eventually(t, func() bool {
+		_, err := get(t, fixture.client(t, rotatedCA, nil), url)
+		return err == nil
+	}, 5*time.Second, 20*time.Millisecond)
+
+	_, err = get(t, fixture.client(t, fixture.serverCA, nil), url)
+	require.Error(t, err)
+}
+
+func TestReloader_InvalidFiles(t *testing.T) {
+	fixture := newTLSFixture(t, config.ClientAuthRequest)
+	writeFile(t, fixture.cfg.ClientCAFile, []byte("not a certificate"))
+
+	_, err := NewReloader(zap.NewNop(), fixture.cfg)
+	require.ErrorContains(t, err, "no certificates found in client CA file")
+
+	fixture.cfg.KeyFile = filepath.Join(t.TempDir(), "missing.key")
+	_, err = NewReloader(zap.NewNop(), fixture.cfg)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,83 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"strconv"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const (
+	instrumentationName = "github.com/mydecisive/mdai-gateway"
+
+	sdkDisabledEnvVar          = "OTEL_SDK_DISABLED"
+	exporterOtlpEndpointEnvVar = "OTEL_EXPORTER_OTLP_ENDPOINT"
+)
+
+// Tracer returns the tracer for gateway spans. Spans are dropped until Setup installs a tracer provider.
+func Tracer() trace.Tracer { //nolint:ireturn
+	return otel.Tracer(instrumentationName)
+}
+
+// Setup installs the W3C trace context propagator and, unless OTEL_SDK_DISABLED is set or no OTLP endpoint is
+// configured, a tracer provider exporting over OTLP/HTTP. The exporter honours the standard OTEL_EXPORTER_OTLP_*
+// variables. The returned function flushes pending spans.
+func Setup(ctx context.Context, logger *zap.Logger, serviceName string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	noop := func(context.Context) error { return nil }
+
+	if disabled, _ := strconv.ParseBool(os.Getenv(sdkDisabledEnvVar)); disabled {
+		logger.Info("Tracing is disabled")
+		return noop, nil
+	}
+	if os.Getenv(exporterOtlpEndpointEnvVar) == "" {
+		logger.Info("No OTLP endpoint is defined, tracing is disabled")
+		return noop, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return noop, err
+	}
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES take precedence over the default service name.
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(serviceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return noop, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	logger.Info("Tracing is enabled")
+	return provider.Shutdown, nil
+}
+
+// WithSpanFrom returns ctx carrying the span of from. Handlers publish with a long-lived context that is not
+// cancelled with the request, but the published events should still belong to the request's trace.
+func WithSpanFrom(ctx, from context.Context) context.Context {
+	return trace.ContextWithSpan(ctx, trace.SpanFromContext(from))
+}
+
+// End records err on span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
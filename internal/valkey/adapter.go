@@ -0,0 +1,108 @@
+package valkey
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	datacore "github.com/mydecisive/mdai-data-core/variables"
+	valkeygo "github.com/valkey-io/valkey-go"
+	"go.uber.org/zap"
+)
+
+// variableKeyPrefix is the prefix of the keys variables are stored under, as written by the operator.
+const variableKeyPrefix = "variable/"
+
+// variableKey returns the key a variable is stored under. The data-core adapter composes the same key but does not
+// export it.
+func variableKey(hubName, varName string) string {
+	return variableKeyPrefix + hubName + "/" + varName
+}
+
+// Adapter reads variable values for GetValue. It adds lists to the data-core adapter, which has no reader for them.
+type Adapter struct {
+	*datacore.ValkeyAdapter
+
+	client valkeygo.Client
+}
+
+var _ kvAdapter = (*Adapter)(nil)
+
+func NewAdapter(client valkeygo.Client, logger *zap.Logger) *Adapter {
+	return &Adapter{ValkeyAdapter: datacore.NewValkeyAdapter(client, logger), client: client}
+}
+
+// GetList returns the elements of a list variable in order, or none when it does not exist.
+func (a *Adapter) GetList(ctx context.Context, variableKey string, hubName string) ([]string, error) {
+	cmd, _ := a.readCommand(hubName, variableKey, VariableTypeList)
+	return a.client.Do(ctx, cmd).AsStrSlice()
+}
+
+// GetValues reads the values of the variables of a hub, given with their types, in a single pipeline. Values are
+// returned as GetValue returns them; variables of unsupported types are left out.
+func (a *Adapter) GetValues(ctx context.Context, hubName string, variables map[string]VariableType) (map[string]any, error) {
+	names := make([]string, 0, len(variables))
+	cmds := make(valkeygo.Commands, 0, len(variables))
+	for _, name := range slices.Sorted(maps.Keys(variables)) {
+		if cmd, ok := a.readCommand(hubName, name, variables[name]); ok {
+			names = append(names, name)
+			cmds = append(cmds, cmd)
+		}
+	}
+
+	values := make(map[string]any, len(names))
+	var results []valkeygo.ValkeyResult
+	switch len(cmds) {
+	case 0:
+		return values, nil
+	case 1:
+		// A single read needs no pipeline.
+		results = []valkeygo.ValkeyResult{a.client.Do(ctx, cmds[0])}
+	default:
+		results = a.client.DoMulti(ctx, cmds...)
+	}
+	for i, result := range results {
+		value, err := readValue(variables[names[i]], result)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read variable %s/%s: %w", hubName, names[i], err)
+		}
+		values[names[i]] = value
+	}
+	return values, nil
+}
+
+// readCommand builds the command reading the value of a variable of type varType, reporting false when the type is
+// not supported.
+func (a *Adapter) readCommand(hubName, varName string, varType VariableType) (valkeygo.Completed, bool) {
+	key := variableKey(hubName, varName)
+	switch varType {
+	case VariableTypeSet:
+		return a.client.B().Smembers().Key(key).Build(), true
+	case VariableTypeMap:
+		return a.client.B().Hgetall().Key(key).Build(), true
+	case VariableTypeList:
+		return a.client.B().Lrange().Key(key).Start(0).Stop(-1).Build(), true
+	case VariableTypeStr, VariableTypeInt, VariableTypeBool, VariableTypeFloat, VariableTypeDuration, VariableTypeJSON:
+		return a.client.B().Get().Key(key).Build(), true
+	default:
+		return valkeygo.Completed{}, false
+	}
+}
+
+// readValue decodes the reply to readCommand: collections as []string or map[string]string and scalars as their
+// string form, empty when the variable does not exist.
+func readValue(varType VariableType, result valkeygo.ValkeyResult) (any, error) {
+	switch varType {
+	case VariableTypeSet, VariableTypeList:
+		return result.AsStrSlice()
+	case VariableTypeMap:
+		return result.AsStrMap()
+	default:
+		value, err := result.ToString()
+		if valkeygo.IsValkeyNil(err) {
+			return "", nil
+		}
+		return value, err
+	}
+}
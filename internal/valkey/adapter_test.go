@@ -0,0 +1,58 @@
+package valkey
+
+import (
+	"testing"
+
+	datacore "github.com/mydecisive/mdai-data-core/variables"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	valkeygo "github.com/valkey-io/valkey-go"
+	valkeymock "github.com/valkey-io/valkey-go/mock"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+)
+
+func TestVariableKey(t *testing.T) {
+	// The data-core adapter writes variables under the key the gateway reads them from.
+	written := datacore.NewValkeyAdapter(valkeymock.NewClient(gomock.NewController(t)), zap.NewNop()).SetString("data_string", "mdaihub-sample", "on")
+	assert.Equal(t, variableKey("mdaihub-sample", "data_string"), written.Commands()[1])
+}
+
+func TestAdapterGetList(t *testing.T) {
+	client := valkeymock.NewClient(gomock.NewController(t))
+	client.EXPECT().Do(gomock.Any(), valkeymock.Match("LRANGE", "variable/hub/foo_list", "0", "-1")).
+		Return(valkeymock.Result(valkeymock.ValkeyArray(
+			valkeymock.ValkeyBlobString("b"), valkeymock.ValkeyBlobString("a"), valkeymock.ValkeyBlobString("b"),
+		)))
+	client.EXPECT().Do(gomock.Any(), valkeymock.Match("LRANGE", "variable/hub/missing", "0", "-1")).
+		Return(valkeymock.Result(valkeymock.ValkeyArray()))
+
+	a := NewAdapter(client, zap.NewNop())
+	elements, err := a.GetList(t.Context(), "foo_list", "hub")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b", "a", "b"}, elements)
+
+	elements, err = a.GetList(t.Context(), "missing", "hub")
+	require.NoError(t, err)
+	assert.Empty(t, elements)
+}
+
+func TestAdapterGetValues(t *testing.T) {
+	client := valkeymock.NewClient(gomock.NewController(t))
+	client.EXPECT().DoMulti(gomock.Any(),
+		valkeymock.Match("GET", "variable/hub/a_int"),
+		valkeymock.Match("SMEMBERS", "variable/hub/b_set"),
+	).Return([]valkeygo.ValkeyResult{
+		valkeymock.Result(valkeymock.ValkeyNil()),
+		valkeymock.Result(valkeymock.ValkeyArray(valkeymock.ValkeyBlobString("x"))),
+	})
+
+	a := NewAdapter(client, zap.NewNop())
+	values, err := a.GetValues(t.Context(), "hub", map[string]VariableType{"b_set": VariableTypeSet, "a_int": VariableTypeInt, "c_other": "other"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"a_int": "", "b_set": []string{"x"}}, values)
+
+	values, err = a.GetValues(t.Context(), "hub", nil)
+	require.NoError(t, err)
+	assert.Empty(t, values)
+}
@@ -0,0 +1,55 @@
+package valkey
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// isoDuration matches the ISO 8601 durations of a fixed length: weeks, or days and a time. Years and months are left
+// out because their length varies.
+var isoDuration = regexp.MustCompile(`^P(?:(\d+)W|(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:[.,]\d+)?)S)?)?)$`)
+
+var errDurationRange = errors.New("duration out of range")
+
+// readDuration reads a non-negative duration in Go (1h30m) or ISO 8601 (PT1H30M, P1DT12H, P2W) form.
+func readDuration(s string) (time.Duration, error) {
+	if !strings.HasPrefix(s, "P") {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q: expected Go (1h30m) or ISO 8601 (PT1H30M) form", s)
+		}
+		if d < 0 {
+			return 0, errors.New("duration must not be negative")
+		}
+		return d, nil
+	}
+
+	m := isoDuration.FindStringSubmatch(s)
+	if m == nil || strings.HasSuffix(s, "P") || strings.HasSuffix(s, "T") {
+		return 0, fmt.Errorf("invalid ISO 8601 duration %q: expected weeks or days and a time, e.g. P1DT12H", s)
+	}
+	total := time.Duration(0)
+	for i, unit := range []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute} {
+		if m[i+1] == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(m[i+1], 10, 64)
+		if err != nil || n > int64((math.MaxInt64-total)/unit) {
+			return 0, errDurationRange
+		}
+		total += time.Duration(n) * unit
+	}
+	if m[5] != "" {
+		seconds, err := time.ParseDuration(strings.Replace(m[5], ",", ".", 1) + "s")
+		if err != nil || seconds > math.MaxInt64-total {
+			return 0, errDurationRange
+		}
+		total += seconds
+	}
+	return total, nil
+}
@@ -0,0 +1,43 @@
+package valkey
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadDuration(t *testing.T) {
+	valid := map[string]time.Duration{
+		"1h30m":      90 * time.Minute,
+		"0s":         0,
+		"PT1H30M":    90 * time.Minute,
+		"PT0.25S":    250 * time.Millisecond,
+		"PT1,5S":     1500 * time.Millisecond,
+		"P1DT12H":    36 * time.Hour,
+		"P2W":        14 * 24 * time.Hour,
+		"P3D":        72 * time.Hour,
+		"PT36H":      36 * time.Hour,
+		"PT1M0.001S": time.Minute + time.Millisecond,
+	}
+	for s, expected := range valid {
+		d, err := readDuration(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, expected, d, s)
+	}
+
+	invalid := map[string]string{
+		"-5m":                  "duration must not be negative",
+		"90":                   `invalid duration "90": expected Go (1h30m) or ISO 8601 (PT1H30M) form`,
+		"P":                    `invalid ISO 8601 duration "P": expected weeks or days and a time, e.g. P1DT12H`,
+		"P1DT":                 `invalid ISO 8601 duration "P1DT": expected weeks or days and a time, e.g. P1DT12H`,
+		"P1Y":                  `invalid ISO 8601 duration "P1Y": expected weeks or days and a time, e.g. P1DT12H`,
+		"P1W2D":                `invalid ISO 8601 duration "P1W2D": expected weeks or days and a time, e.g. P1DT12H`,
+		"P999999999999999999D": "duration out of range",
+	}
+	for s, expected := range invalid {
+		_, err := readDuration(s)
+		require.EqualError(t, err, expected, s)
+	}
+}
@@ -0,0 +1,221 @@
+package valkey
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+)
+
+// Update is a command with its request data, in the shape GetParser accepts.
+type Update struct {
+	Command CommandType     `json:"op"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// Inverse returns the update that undoes applying command with payload to before, as returned by GetValue. It is
+// computed from the difference between before and the Preview of the update, so it only undoes what the update
+// changed: reverting an added set member removes that member and leaves members added since alone. The bool is false
+// when the update changes nothing.
+func Inverse(varType VariableType, command CommandType, before any, payload any) (Update, bool, error) {
+	after, err := Preview(varType, command, before, payload)
+	if err != nil {
+		return Update{}, false, err
+	}
+	if varType == VariableTypeInt && (command == CommandIncrement || command == CommandDecrement) {
+		return inverseIntDelta(before, after)
+	}
+	return Diff(varType, after, before)
+}
+
+// Diff returns the update that turns current into desired, both in the shape GetValue returns. It prefers adding or
+// removing the members or entries that differ, falling back to replacing or clearing the whole variable. The bool is
+// false when current already equals desired.
+func Diff(varType VariableType, current, desired any) (Update, bool, error) {
+	switch varType {
+	case VariableTypeSet:
+		members, _ := current.([]string)
+		target, _ := desired.([]string)
+		return inverseSet(target, members)
+	case VariableTypeMap:
+		entries, _ := current.(map[string]string)
+		target, _ := desired.(map[string]string)
+		return inverseMap(target, entries)
+	case VariableTypeList:
+		elements, _ := current.([]string)
+		target, _ := desired.([]string)
+		return inverseList(target, elements)
+	case VariableTypeJSON:
+		value, _ := current.(string)
+		if target, _ := desired.(string); jsonEqual(value, target) {
+			return Update{}, false, nil
+		}
+		return inverseScalar(varType, desired, value)
+	case VariableTypeStr, VariableTypeInt, VariableTypeBool, VariableTypeFloat, VariableTypeDuration:
+		value, _ := current.(string)
+		return inverseScalar(varType, desired, value)
+	default:
+		return Update{}, false, fmt.Errorf("%w %s", errUnsupportedVariableType, varType)
+	}
+}
+
+// jsonEqual reports whether two JSON documents hold the same value, whatever the order of their object keys. Values
+// that are not JSON, such as the empty value of a variable that is not set, are only equal to themselves.
+func jsonEqual(a, b string) bool {
+	if a == b {
+		return true
+	}
+	var left, right any
+	if json.Unmarshal([]byte(a), &left) != nil || json.Unmarshal([]byte(b), &right) != nil {
+		return false
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+func inverseSet(before, after []string) (Update, bool, error) {
+	var added, removed []string
+	for _, member := range after {
+		if !slices.Contains(before, member) {
+			added = append(added, member)
+		}
+	}
+	for _, member := range before {
+		if !slices.Contains(after, member) {
+			removed = append(removed, member)
+		}
+	}
+	slices.Sort(removed)
+
+	switch {
+	case len(added) == 0 && len(removed) == 0:
+		return Update{}, false, nil
+	case len(removed) == 0:
+		return newUpdate(CommandDel, added)
+	case len(added) == 0:
+		return newUpdate(CommandAdd, removed)
+	default:
+		return newUpdate(CommandReplace, slices.Sorted(slices.Values(before)))
+	}
+}
+
+func inverseMap(before, after map[string]string) (Update, bool, error) {
+	var added []string
+	restored := make(map[string]string)
+	for key, value := range after {
+		if old, ok := before[key]; !ok {
+			added = append(added, key)
+		} else if old != value {
+			restored[key] = old
+		}
+	}
+	for key, value := range before {
+		if _, ok := after[key]; !ok {
+			restored[key] = value
+		}
+	}
+	slices.Sort(added)
+
+	switch {
+	case len(added) == 0 && len(restored) == 0:
+		return Update{}, false, nil
+	case len(restored) == 0:
+		return newUpdate(CommandDel, added)
+	case len(added) == 0:
+		return newUpdate(CommandAdd, restored)
+	default:
+		return newUpdate(CommandReplace, maps.Clone(before))
+	}
+}
+
+// inverseList removes pushed elements the list did not hold before. Any other change is undone by restoring the
+// whole list, since elements may repeat and their order matters.
+func inverseList(before, after []string) (Update, bool, error) {
+	switch {
+	case slices.Equal(before, after):
+		return Update{}, false, nil
+	case len(before) == 0:
+		return newUpdate(CommandClear, nil)
+	}
+	if len(after) > len(before) && slices.Equal(after[:len(before)], before) {
+		pushed := after[len(before):]
+		if !slices.ContainsFunc(pushed, func(element string) bool { return slices.Contains(before, element) }) {
+			return newUpdate(CommandDel, slices.Compact(slices.Sorted(slices.Values(pushed))))
+		}
+	}
+	return newUpdate(CommandReplace, slices.Clone(before))
+}
+
+// inverseScalar restores the previous value with add, or deletes a variable that did not exist before.
+func inverseScalar(varType VariableType, before, after any) (Update, bool, error) {
+	previous, _ := before.(string)
+	if previous == after {
+		return Update{}, false, nil
+	}
+	if previous == "" {
+		return newUpdate(CommandClear, nil)
+	}
+	switch varType {
+	case VariableTypeInt:
+		v, err := strconv.Atoi(previous)
+		if err != nil {
+			return Update{}, false, fmt.Errorf("current value %q is not an int", previous)
+		}
+		return newUpdate(CommandAdd, v)
+	case VariableTypeBool:
+		v, err := strconv.ParseBool(previous)
+		if err != nil {
+			return Update{}, false, fmt.Errorf("current value %q is not a boolean", previous)
+		}
+		return newUpdate(CommandAdd, v)
+	case VariableTypeFloat:
+		v, err := strconv.ParseFloat(previous, 64)
+		if err != nil {
+			return Update{}, false, fmt.Errorf("current value %q is not a float", previous)
+		}
+		return newUpdate(CommandAdd, v)
+	case VariableTypeJSON:
+		if !json.Valid([]byte(previous)) {
+			return Update{}, false, fmt.Errorf("current value %q is not JSON", previous)
+		}
+		return newUpdate(CommandAdd, json.RawMessage(previous))
+	default:
+		return newUpdate(CommandAdd, previous)
+	}
+}
+
+// inverseIntDelta undoes the change actually applied, after clamping, with the opposite relative command.
+func inverseIntDelta(before, after any) (Update, bool, error) {
+	previous := 0
+	if s, _ := before.(string); s != "" {
+		var err error
+		if previous, err = strconv.Atoi(s); err != nil {
+			return Update{}, false, fmt.Errorf("current value %q is not an int", s)
+		}
+	}
+	next, err := strconv.Atoi(after.(string)) //nolint:forcetypeassert
+	if err != nil {
+		return Update{}, false, err
+	}
+
+	switch diff := next - previous; {
+	case diff > 0:
+		return newUpdate(CommandDecrement, IntDelta{By: diff, Min: nil, Max: nil})
+	case diff < 0:
+		return newUpdate(CommandIncrement, IntDelta{By: -diff, Min: nil, Max: nil})
+	default:
+		return Update{}, false, nil
+	}
+}
+
+func newUpdate(command CommandType, data any) (Update, bool, error) {
+	if data == nil {
+		return Update{Command: command, Data: nil}, true, nil
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Update{}, false, err
+	}
+	return Update{Command: command, Data: raw}, true, nil
+}
@@ -0,0 +1,302 @@
+package valkey
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInverse(t *testing.T) {
+	testCases := []struct {
+		before       any
+		payload      any
+		name         string
+		varType      VariableType
+		command      CommandType
+		expectedOp   CommandType
+		expectedData string
+		noop         bool
+	}{
+		{
+			name:         "SetAdd",
+			varType:      VariableTypeSet,
+			command:      CommandAdd,
+			before:       []string{"a"},
+			payload:      []string{"a", "b"},
+			expectedOp:   CommandDel,
+			expectedData: `["b"]`,
+		},
+		{
+			name:    "SetAddPresent",
+			varType: VariableTypeSet,
+			command: CommandAdd,
+			before:  []string{"a"},
+			payload: []string{"a"},
+			noop:    true,
+		},
+		{
+			name:         "SetRemove",
+			varType:      VariableTypeSet,
+			command:      CommandDel,
+			before:       []string{"a", "b"},
+			payload:      []string{"b", "c"},
+			expectedOp:   CommandAdd,
+			expectedData: `["b"]`,
+		},
+		{
+			name:         "SetReplace",
+			varType:      VariableTypeSet,
+			command:      CommandReplace,
+			before:       []string{"b", "a"},
+			payload:      []string{"c"},
+			expectedOp:   CommandReplace,
+			expectedData: `["a","b"]`,
+		},
+		{
+			name:       "SetReplaceEmpty",
+			varType:    VariableTypeSet,
+			command:    CommandReplace,
+			before:     []string{},
+			payload:    []string{"c"},
+			expectedOp: CommandDel,
+
+			expectedData: `["c"]`,
+		},
+		{
+			name:         "MapAddNewKey",
+			varType:      VariableTypeMap,
+			command:      CommandAdd,
+			before:       map[string]string{"k1": "v1"},
+			payload:      map[string]string{"k2": "v2"},
+			expectedOp:   CommandDel,
+			expectedData: `["k2"]`,
+		},
+		{
+			name:         "MapAddOverwrite",
+			varType:      VariableTypeMap,
+			command:      CommandAdd,
+			before:       map[string]string{"k1": "v1"},
+			payload:      map[string]string{"k1": "new"},
+			expectedOp:   CommandAdd,
+			expectedData: `{"k1":"v1"}`,
+		},
+		{
+			name:         "MapAddNewAndOverwrite",
+			varType:      VariableTypeMap,
+			command:      CommandAdd,
+			before:       map[string]string{"k1": "v1"},
+			payload:      map[string]string{"k1": "new", "k2": "v2"},
+			expectedOp:   CommandReplace,
+			expectedData: `{"k1":"v1"}`,
+		},
+		{
+			name:         "MapRemove",
+			varType:      VariableTypeMap,
+			command:      CommandDel,
+			before:       map[string]string{"k1": "v1", "k2": "v2"},
+			payload:      []string{"k1"},
+			expectedOp:   CommandAdd,
+			expectedData: `{"k1":"v1"}`,
+		},
+		{
+			name:         "StringAdd",
+			varType:      VariableTypeStr,
+			command:      CommandAdd,
+			before:       "old",
+			payload:      "new",
+			expectedOp:   CommandAdd,
+			expectedData: `"old"`,
+		},
+		{
+			name:       "StringAddMissing",
+			varType:    VariableTypeStr,
+			command:    CommandAdd,
+			before:     "",
+			payload:    "new",
+			expectedOp: CommandClear,
+		},
+		{
+			name:         "IntAdd",
+			varType:      VariableTypeInt,
+			command:      CommandAdd,
+			before:       "3",
+			payload:      "7",
+			expectedOp:   CommandAdd,
+			expectedData: `3`,
+		},
+		{
+			name:         "BoolClear",
+			varType:      VariableTypeBool,
+			command:      CommandClear,
+			before:       "true",
+			payload:      nil,
+			expectedOp:   CommandAdd,
+			expectedData: `true`,
+		},
+		{
+			name:         "IntIncrementClamped",
+			varType:      VariableTypeInt,
+			command:      CommandIncrement,
+			before:       "8",
+			payload:      IntDelta{By: 5, Max: ptr(10)},
+			expectedOp:   CommandDecrement,
+			expectedData: `{"by":2}`,
+		},
+		{
+			name:         "IntDecrement",
+			varType:      VariableTypeInt,
+			command:      CommandDecrement,
+			before:       "8",
+			payload:      IntDelta{By: 5},
+			expectedOp:   CommandIncrement,
+			expectedData: `{"by":5}`,
+		},
+		{
+			name:    "IntIncrementAtMax",
+			varType: VariableTypeInt,
+			command: CommandIncrement,
+			before:  "10",
+			payload: IntDelta{By: 1, Max: ptr(10)},
+			noop:    true,
+		},
+		{
+			name:         "ListPushNew",
+			varType:      VariableTypeList,
+			command:      CommandPush,
+			before:       []string{"a"},
+			payload:      []string{"c", "b", "c"},
+			expectedOp:   CommandDel,
+			expectedData: `["b","c"]`,
+		},
+		{
+			name:         "ListPushPresent",
+			varType:      VariableTypeList,
+			command:      CommandPush,
+			before:       []string{"a", "b"},
+			payload:      []string{"a"},
+			expectedOp:   CommandReplace,
+			expectedData: `["a","b"]`,
+		},
+		{
+			name:       "ListPushMissing",
+			varType:    VariableTypeList,
+			command:    CommandPush,
+			before:     []string{},
+			payload:    []string{"a"},
+			expectedOp: CommandClear,
+		},
+		{
+			name:         "ListRemove",
+			varType:      VariableTypeList,
+			command:      CommandDel,
+			before:       []string{"b", "a", "b"},
+			payload:      []string{"b"},
+			expectedOp:   CommandReplace,
+			expectedData: `["b","a","b"]`,
+		},
+		{
+			name:    "ListRemoveAbsent",
+			varType: VariableTypeList,
+			command: CommandDel,
+			before:  []string{"a"},
+			payload: []string{"b"},
+			noop:    true,
+		},
+		{
+			name:         "FloatAdd",
+			varType:      VariableTypeFloat,
+			command:      CommandAdd,
+			before:       "0.5",
+			payload:      "0.25",
+			expectedOp:   CommandAdd,
+			expectedData: `0.5`,
+		},
+		{
+			name:         "DurationClear",
+			varType:      VariableTypeDuration,
+			command:      CommandClear,
+			before:       "1h30m0s",
+			payload:      nil,
+			expectedOp:   CommandAdd,
+			expectedData: `"1h30m0s"`,
+		},
+		{
+			name:         "JSONAdd",
+			varType:      VariableTypeJSON,
+			command:      CommandAdd,
+			before:       `{"threshold":0.5}`,
+			payload:      `{"threshold":0.75}`,
+			expectedOp:   CommandAdd,
+			expectedData: `{"threshold":0.5}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			update, ok, err := Inverse(tc.varType, tc.command, tc.before, tc.payload)
+			require.NoError(t, err)
+			require.Equal(t, !tc.noop, ok)
+			if tc.noop {
+				return
+			}
+			assert.Equal(t, tc.expectedOp, update.Command)
+			if tc.expectedData == "" {
+				assert.Nil(t, update.Data)
+				return
+			}
+			assert.JSONEq(t, tc.expectedData, string(update.Data))
+
+			// The inverse must be accepted like request data.
+			parser, err := GetParser(tc.varType, update.Command)
+			require.NoError(t, err)
+			_, err = parser(json.RawMessage(update.Data))
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	testCases := []struct {
+		current      any
+		desired      any
+		name         string
+		varType      VariableType
+		expectedOp   CommandType
+		expectedData string
+		noop         bool
+	}{
+		{name: "SetAdd", varType: VariableTypeSet, current: []string{"a"}, desired: []string{"a", "b"}, expectedOp: CommandAdd, expectedData: `["b"]`},
+		{name: "SetReplace", varType: VariableTypeSet, current: []string{"a"}, desired: []string{"b"}, expectedOp: CommandReplace, expectedData: `["b"]`},
+		{name: "SetEqual", varType: VariableTypeSet, current: []string{"b", "a"}, desired: []string{"a", "b"}, noop: true},
+		{name: "MapRemove", varType: VariableTypeMap, current: map[string]string{"k": "v", "x": "y"}, desired: map[string]string{"k": "v"}, expectedOp: CommandDel, expectedData: `["x"]`},
+		{name: "MapClear", varType: VariableTypeMap, current: map[string]string{"k": "v"}, desired: map[string]string(nil), expectedOp: CommandDel, expectedData: `["k"]`},
+		{name: "ListReplace", varType: VariableTypeList, current: []string{"a"}, desired: []string{"b", "a"}, expectedOp: CommandReplace, expectedData: `["b", "a"]`},
+		{name: "IntAdd", varType: VariableTypeInt, current: "", desired: "3", expectedOp: CommandAdd, expectedData: `3`},
+		{name: "StringClear", varType: VariableTypeStr, current: "foo", desired: "", expectedOp: CommandClear},
+		{name: "BoolEqual", varType: VariableTypeBool, current: "true", desired: "true", noop: true},
+		{name: "JSONReordered", varType: VariableTypeJSON, current: `{"b":[1,{"y":2,"x":1}],"a":1.0}`, desired: `{"a":1,"b":[1,{"x":1,"y":2}]}`, noop: true},
+		{name: "JSONChanged", varType: VariableTypeJSON, current: `{"b":2,"a":1}`, desired: `{"a":1,"b":3}`, expectedOp: CommandAdd, expectedData: `{"a":1,"b":3}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			update, ok, err := Diff(tc.varType, tc.current, tc.desired)
+			require.NoError(t, err)
+			require.Equal(t, !tc.noop, ok)
+			if tc.noop {
+				return
+			}
+			assert.Equal(t, tc.expectedOp, update.Command)
+			if tc.expectedData == "" {
+				assert.Nil(t, update.Data)
+				return
+			}
+			assert.JSONEq(t, tc.expectedData, string(update.Data))
+		})
+	}
+
+	_, _, err := Diff(VariableType("queue"), nil, nil)
+	require.ErrorIs(t, err, errUnsupportedVariableType)
+}
@@ -0,0 +1,203 @@
+package valkey
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+)
+
+// Preview computes the value a variable would have after the operator applies command with payload, as parsed by
+// GetParser, to current, as returned by GetValue. Set members are returned sorted.
+func Preview(varType VariableType, command CommandType, current any, payload any) (any, error) {
+	switch varType {
+	case VariableTypeSet:
+		return previewSet(command, current, payload)
+	case VariableTypeMap:
+		return previewMap(command, current, payload)
+	case VariableTypeList:
+		return previewList(command, current, payload)
+	case VariableTypeInt:
+		if command == CommandIncrement || command == CommandDecrement {
+			return previewIntDelta(command, current, payload)
+		}
+		return previewScalar(varType, command, payload)
+	case VariableTypeStr, VariableTypeBool, VariableTypeFloat, VariableTypeDuration, VariableTypeJSON:
+		return previewScalar(varType, command, payload)
+	default:
+		return nil, fmt.Errorf("%w %s", errUnsupportedVariableType, varType)
+	}
+}
+
+// Overwrites reports whether command gives a variable of varType a value that does not depend on its current one, so
+// the changes before it need not be replayed.
+func Overwrites(varType VariableType, command CommandType) bool {
+	switch varType {
+	case VariableTypeSet, VariableTypeMap, VariableTypeList:
+		return command == CommandReplace || command == CommandClear
+	default:
+		return command != CommandIncrement && command != CommandDecrement
+	}
+}
+
+// EventPayload decodes the data of the payload of a published variable event, which holds the payload as GetParser
+// returned it, back into the payload Preview takes, so past events can be replayed.
+func EventPayload(varType VariableType, command CommandType, data json.RawMessage) (any, error) {
+	var (
+		payload any
+		err     error
+	)
+	switch {
+	case command == CommandClear:
+		return nil, nil //nolint:nilnil
+	case command == CommandIncrement || command == CommandDecrement:
+		var delta IntDelta
+		err = json.Unmarshal(data, &delta)
+		payload = delta
+	case varType == VariableTypeMap && command != CommandDel:
+		var entries map[string]string
+		err = json.Unmarshal(data, &entries)
+		payload = entries
+	case varType == VariableTypeSet || varType == VariableTypeMap || varType == VariableTypeList:
+		var elements []string
+		err = json.Unmarshal(data, &elements)
+		payload = elements
+	default:
+		var value string
+		err = json.Unmarshal(data, &value)
+		payload = value
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid data of %s event on variable type %q: %w", command, varType, err)
+	}
+	return payload, nil
+}
+
+func previewSet(command CommandType, current any, payload any) (any, error) {
+	members, _ := current.([]string)
+	elements, _ := payload.([]string)
+
+	result := make(map[string]struct{}, len(members)+len(elements))
+	switch command {
+	case CommandAdd:
+		for _, member := range slices.Concat(members, elements) {
+			result[member] = struct{}{}
+		}
+	case CommandDel:
+		for _, member := range members {
+			result[member] = struct{}{}
+		}
+		for _, element := range elements {
+			delete(result, element)
+		}
+	case CommandReplace:
+		for _, element := range elements {
+			result[element] = struct{}{}
+		}
+	case CommandClear:
+	default:
+		return nil, unsupportedPreview(VariableTypeSet, command)
+	}
+	members = slices.AppendSeq(make([]string, 0, len(result)), maps.Keys(result))
+	slices.Sort(members)
+	return members, nil
+}
+
+func previewMap(command CommandType, current any, payload any) (any, error) {
+	entries, _ := current.(map[string]string)
+
+	result := maps.Clone(entries)
+	if result == nil {
+		result = map[string]string{}
+	}
+	switch command {
+	case CommandAdd:
+		added, _ := payload.(map[string]string)
+		maps.Copy(result, added)
+	case CommandDel:
+		keys, _ := payload.([]string)
+		for _, key := range keys {
+			delete(result, key)
+		}
+	case CommandReplace:
+		replaced, _ := payload.(map[string]string)
+		result = maps.Clone(replaced)
+		if result == nil {
+			result = map[string]string{}
+		}
+	case CommandClear:
+		clear(result)
+	default:
+		return nil, unsupportedPreview(VariableTypeMap, command)
+	}
+	return result, nil
+}
+
+// previewList removes every occurrence of the elements given to remove.
+func previewList(command CommandType, current any, payload any) (any, error) {
+	elements, _ := current.([]string)
+	given, _ := payload.([]string)
+
+	result := make([]string, 0, len(elements)+len(given))
+	switch command {
+	case CommandPush:
+		result = append(append(result, elements...), given...)
+	case CommandDel:
+		for _, element := range elements {
+			if !slices.Contains(given, element) {
+				result = append(result, element)
+			}
+		}
+	case CommandReplace:
+		result = append(result, given...)
+	case CommandClear:
+	default:
+		return nil, unsupportedPreview(VariableTypeList, command)
+	}
+	return result, nil
+}
+
+// previewScalar treats remove like the operator does: the variable is deleted whatever its value.
+func previewScalar(varType VariableType, command CommandType, payload any) (any, error) {
+	switch command {
+	case CommandAdd:
+		return payload, nil
+	case CommandDel, CommandClear:
+		return "", nil
+	default:
+		return nil, unsupportedPreview(varType, command)
+	}
+}
+
+// previewIntDelta treats a missing value as 0, like INCRBY does.
+func previewIntDelta(command CommandType, current any, payload any) (any, error) {
+	delta, ok := payload.(IntDelta)
+	if !ok {
+		return nil, fmt.Errorf("unexpected %s payload %T", command, payload)
+	}
+	value := 0
+	if s, _ := current.(string); s != "" {
+		var err error
+		if value, err = strconv.Atoi(s); err != nil {
+			return nil, fmt.Errorf("current value %q is not an int", s)
+		}
+	}
+
+	if command == CommandIncrement {
+		value += delta.By
+	} else {
+		value -= delta.By
+	}
+	if delta.Min != nil {
+		value = max(value, *delta.Min)
+	}
+	if delta.Max != nil {
+		value = min(value, *delta.Max)
+	}
+	return strconv.Itoa(value), nil
+}
+
+func unsupportedPreview(varType VariableType, command CommandType) error {
+	return fmt.Errorf("no preview for command %q on variable type %q", command, varType)
+}
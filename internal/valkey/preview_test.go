@@ -0,0 +1,237 @@
+package valkey
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreview(t *testing.T) {
+	testCases := []struct {
+		current  any
+		payload  any
+		expected any
+		name     string
+		varType  VariableType
+		command  CommandType
+	}{
+		{
+			name:     "SetAdd",
+			varType:  VariableTypeSet,
+			command:  CommandAdd,
+			current:  []string{"c", "a"},
+			payload:  []string{"b", "a"},
+			expected: []string{"a", "b", "c"},
+		},
+		{
+			name:     "SetRemove",
+			varType:  VariableTypeSet,
+			command:  CommandDel,
+			current:  []string{"a", "b"},
+			payload:  []string{"b", "x"},
+			expected: []string{"a"},
+		},
+		{
+			name:     "SetReplace",
+			varType:  VariableTypeSet,
+			command:  CommandReplace,
+			current:  []string{"a"},
+			payload:  []string{"y", "x"},
+			expected: []string{"x", "y"},
+		},
+		{
+			name:     "SetClear",
+			varType:  VariableTypeSet,
+			command:  CommandClear,
+			current:  []string{"a"},
+			payload:  nil,
+			expected: []string{},
+		},
+		{
+			name:     "MapAdd",
+			varType:  VariableTypeMap,
+			command:  CommandAdd,
+			current:  map[string]string{"k1": "v1", "k2": "v2"},
+			payload:  map[string]string{"k2": "new", "k3": "v3"},
+			expected: map[string]string{"k1": "v1", "k2": "new", "k3": "v3"},
+		},
+		{
+			name:     "MapRemove",
+			varType:  VariableTypeMap,
+			command:  CommandDel,
+			current:  map[string]string{"k1": "v1", "k2": "v2"},
+			payload:  []string{"k1"},
+			expected: map[string]string{"k2": "v2"},
+		},
+		{
+			name:     "MapReplace",
+			varType:  VariableTypeMap,
+			command:  CommandReplace,
+			current:  map[string]string{"k1": "v1"},
+			payload:  map[string]string{"k2": "v2"},
+			expected: map[string]string{"k2": "v2"},
+		},
+		{
+			name:     "MapClear",
+			varType:  VariableTypeMap,
+			command:  CommandClear,
+			current:  map[string]string{"k1": "v1"},
+			payload:  nil,
+			expected: map[string]string{},
+		},
+		{
+			name:     "StringAdd",
+			varType:  VariableTypeStr,
+			command:  CommandAdd,
+			current:  "old",
+			payload:  "new",
+			expected: "new",
+		},
+		{
+			name:     "StringRemove",
+			varType:  VariableTypeStr,
+			command:  CommandDel,
+			current:  "old",
+			payload:  "other",
+			expected: "",
+		},
+		{
+			name:     "IntIncrementMissing",
+			varType:  VariableTypeInt,
+			command:  CommandIncrement,
+			current:  "",
+			payload:  IntDelta{By: 2},
+			expected: "2",
+		},
+		{
+			name:     "IntIncrementClamped",
+			varType:  VariableTypeInt,
+			command:  CommandIncrement,
+			current:  "9",
+			payload:  IntDelta{By: 5, Max: ptr(10)},
+			expected: "10",
+		},
+		{
+			name:     "IntDecrementClamped",
+			varType:  VariableTypeInt,
+			command:  CommandDecrement,
+			current:  "3",
+			payload:  IntDelta{By: 5, Min: ptr(0)},
+			expected: "0",
+		},
+		{
+			name:     "ListPush",
+			varType:  VariableTypeList,
+			command:  CommandPush,
+			current:  []string{"b", "a"},
+			payload:  []string{"a", "c"},
+			expected: []string{"b", "a", "a", "c"},
+		},
+		{
+			name:     "ListRemove",
+			varType:  VariableTypeList,
+			command:  CommandDel,
+			current:  []string{"a", "b", "a", "c"},
+			payload:  []string{"a", "x"},
+			expected: []string{"b", "c"},
+		},
+		{
+			name:     "ListReplaceMissing",
+			varType:  VariableTypeList,
+			command:  CommandReplace,
+			current:  []string{},
+			payload:  []string{"b", "a"},
+			expected: []string{"b", "a"},
+		},
+		{
+			name:     "ListClear",
+			varType:  VariableTypeList,
+			command:  CommandClear,
+			current:  []string{"a"},
+			payload:  nil,
+			expected: []string{},
+		},
+		{
+			name:     "FloatAdd",
+			varType:  VariableTypeFloat,
+			command:  CommandAdd,
+			current:  "0.5",
+			payload:  "0.25",
+			expected: "0.25",
+		},
+		{
+			name:     "JSONClear",
+			varType:  VariableTypeJSON,
+			command:  CommandClear,
+			current:  `{"a":1}`,
+			payload:  nil,
+			expected: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := Preview(tc.varType, tc.command, tc.current, tc.payload)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+
+	t.Run("IntIncrementNotAnInt", func(t *testing.T) {
+		_, err := Preview(VariableTypeInt, CommandIncrement, "abc", IntDelta{By: 1})
+		require.EqualError(t, err, `current value "abc" is not an int`)
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		_, err := Preview(VariableTypeStr, CommandReplace, "", "x")
+		require.EqualError(t, err, `no preview for command "replace" on variable type "string"`)
+	})
+}
+
+func TestEventPayload(t *testing.T) {
+	testCases := []struct {
+		expected any
+		name     string
+		data     string
+		varType  VariableType
+		command  CommandType
+	}{
+		{name: "SetAdd", varType: VariableTypeSet, command: CommandAdd, data: `["a"]`, expected: []string{"a"}},
+		{name: "MapAdd", varType: VariableTypeMap, command: CommandAdd, data: `{"k":"v"}`, expected: map[string]string{"k": "v"}},
+		{name: "MapRemove", varType: VariableTypeMap, command: CommandDel, data: `["k"]`, expected: []string{"k"}},
+		{name: "ListPush", varType: VariableTypeList, command: CommandPush, data: `["a","a"]`, expected: []string{"a", "a"}},
+		{name: "IntAdd", varType: VariableTypeInt, command: CommandAdd, data: `"3"`, expected: "3"},
+		{name: "IntIncrement", varType: VariableTypeInt, command: CommandIncrement, data: `{"by":2,"max":10}`, expected: IntDelta{By: 2, Min: nil, Max: ptr(10)}},
+		{name: "JSONAdd", varType: VariableTypeJSON, command: CommandAdd, data: `"{\"a\":1}"`, expected: `{"a":1}`},
+		{name: "Clear", varType: VariableTypeSet, command: CommandClear, data: `null`, expected: nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			payload, err := EventPayload(tc.varType, tc.command, json.RawMessage(tc.data))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, payload)
+
+			// A replayed event has the effect of the original payload.
+			if tc.command != CommandClear {
+				_, err = Preview(tc.varType, tc.command, nil, payload)
+				require.NoError(t, err)
+			}
+		})
+	}
+
+	_, err := EventPayload(VariableTypeSet, CommandAdd, json.RawMessage(`{"a":1}`))
+	require.Error(t, err)
+}
+
+func TestOverwrites(t *testing.T) {
+	assert.True(t, Overwrites(VariableTypeSet, CommandReplace))
+	assert.True(t, Overwrites(VariableTypeMap, CommandClear))
+	assert.False(t, Overwrites(VariableTypeSet, CommandAdd))
+	assert.False(t, Overwrites(VariableTypeList, CommandPush))
+	assert.True(t, Overwrites(VariableTypeStr, CommandAdd))
+	assert.True(t, Overwrites(VariableTypeInt, CommandAdd))
+	assert.False(t, Overwrites(VariableTypeInt, CommandIncrement))
+}
@@ -1,11 +1,18 @@
 package valkey
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"slices"
 	"strconv"
+
+	"github.com/mydecisive/mdai-gateway/internal/httputil"
 )
 
 type (
@@ -19,20 +26,62 @@ const (
 	VariableTypeBool VariableType = "boolean"
 	VariableTypeInt  VariableType = "int"
 	VariableTypeStr  VariableType = "string"
+	// VariableTypeFloat, VariableTypeDuration and VariableTypeJSON are stored as strings like VariableTypeInt: a float
+	// in its shortest decimal form, a duration in Go form (1h30m0s) and a JSON object compacted.
+	VariableTypeFloat    VariableType = "float"
+	VariableTypeDuration VariableType = "duration"
+	VariableTypeJSON     VariableType = "json"
+	// VariableTypeList is an ordered list of strings, which may repeat.
+	VariableTypeList VariableType = "list"
 
 	CommandAdd CommandType = "add"
 	CommandDel CommandType = "remove"
+	// CommandReplace sets a set or map to exactly the given elements.
+	CommandReplace CommandType = "replace"
+	// CommandClear empties a variable; it takes no data.
+	CommandClear CommandType = "clear"
+	// CommandIncrement and CommandDecrement change an int variable by an IntDelta, so concurrent changes do not
+	// overwrite each other the way a client-side read-modify-write would.
+	CommandIncrement CommandType = "increment"
+	CommandDecrement CommandType = "decrement"
+	// CommandPush appends elements to the end of a list.
+	CommandPush CommandType = "push"
 )
 
+// IntDelta is the data of CommandIncrement and CommandDecrement. By defaults to 1; the result is clamped to Min and
+// Max when they are set.
+type IntDelta struct {
+	By  int  `json:"by"`
+	Min *int `json:"min,omitempty"`
+	Max *int `json:"max,omitempty"`
+}
+
 var errUnsupportedVariableType = errors.New("unsupported variable type")
 
+// ValidationError reports a request that does not fit the variable type, either because the type or command is not
+// supported or because the value has the wrong shape. It is always the client's fault.
+type ValidationError struct {
+	Code string
+	Msg  string
+	Err  error
+}
+
+func (e ValidationError) Error() string     { return e.Msg }
+func (e ValidationError) Unwrap() error     { return e.Err }
+func (e ValidationError) HTTPStatus() int   { return http.StatusBadRequest }
+func (e ValidationError) ErrorCode() string { return e.Code }
+
+func invalidValue(msg string) error {
+	return ValidationError{Code: httputil.CodeInvalidValue, Msg: msg, Err: nil}
+}
+
 type ParseFn func(json.RawMessage) (any, error)
 
 func unmarshalTo[T any](errMsg string) ParseFn {
 	return func(data json.RawMessage) (any, error) {
 		var v T
 		if err := json.Unmarshal(data, &v); err != nil {
-			return nil, errors.New(errMsg)
+			return nil, invalidValue(errMsg)
 		}
 
 		return v, nil
@@ -43,26 +92,87 @@ func unmarshalToAndTransform[T any](errMsg string, transform func(T) any) ParseF
 	return func(data json.RawMessage) (any, error) {
 		var v T
 		if err := json.Unmarshal(data, &v); err != nil {
-			return nil, errors.New(errMsg)
+			return nil, invalidValue(errMsg)
 		}
 
 		return transform(v), nil
 	}
 }
 
+// noData accepts a missing or null value, for commands that take no data.
+func noData(data json.RawMessage) (any, error) {
+	if len(data) > 0 && string(data) != "null" {
+		return nil, invalidValue("no data expected")
+	}
+	return nil, nil //nolint:nilnil
+}
+
+func parseIntDelta(data json.RawMessage) (any, error) {
+	delta := IntDelta{By: 1, Min: nil, Max: nil}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&delta); err != nil {
+		return nil, invalidValue(`object expected: {"by": int, "min": int, "max": int}`)
+	}
+	if delta.By <= 0 {
+		return nil, invalidValue("by must be positive")
+	}
+	if delta.Min != nil && delta.Max != nil && *delta.Min > *delta.Max {
+		return nil, invalidValue("min must not be greater than max")
+	}
+	return delta, nil
+}
+
+func parseFloat(data json.RawMessage) (any, error) {
+	var v float64
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, invalidValue("float expected")
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64), nil
+}
+
+func parseDuration(data json.RawMessage) (any, error) {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, invalidValue(`duration expected, e.g. "1h30m" or "PT1H30M"`)
+	}
+	d, err := readDuration(s)
+	if err != nil {
+		return nil, invalidValue(err.Error())
+	}
+	return d.String(), nil
+}
+
+func parseJSONObject(data json.RawMessage) (any, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil || object == nil {
+		return nil, invalidValue("JSON object expected")
+	}
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, data); err != nil {
+		return nil, invalidValue("JSON object expected")
+	}
+	return compacted.String(), nil
+}
+
 func GetParser(varType VariableType, command CommandType) (ParseFn, error) {
 	parsers := map[VariableType]map[CommandType]ParseFn{
 		VariableTypeSet: {
-			CommandAdd: unmarshalTo[[]string]("list expected"),
-			CommandDel: unmarshalTo[[]string]("list expected"),
+			CommandAdd:     unmarshalTo[[]string]("list expected"),
+			CommandDel:     unmarshalTo[[]string]("list expected"),
+			CommandReplace: unmarshalTo[[]string]("list expected"),
+			CommandClear:   noData,
 		},
 		VariableTypeMap: {
-			CommandAdd: unmarshalTo[map[string]string]("map expected"),
-			CommandDel: unmarshalTo[[]string]("list expected"),
+			CommandAdd:     unmarshalTo[map[string]string]("map expected"),
+			CommandDel:     unmarshalTo[[]string]("list expected"),
+			CommandReplace: unmarshalTo[map[string]string]("map expected"),
+			CommandClear:   noData,
 		},
 		VariableTypeStr: {
-			CommandAdd: unmarshalTo[string]("string expected"),
-			CommandDel: unmarshalTo[string]("string expected"),
+			CommandAdd:   unmarshalTo[string]("string expected"),
+			CommandDel:   unmarshalTo[string]("string expected"),
+			CommandClear: noData,
 		},
 		VariableTypeInt: {
 			CommandAdd: unmarshalToAndTransform[int]("int expected", func(v int) any {
@@ -71,6 +181,9 @@ func GetParser(varType VariableType, command CommandType) (ParseFn, error) {
 			CommandDel: unmarshalToAndTransform[int]("int expected", func(v int) any {
 				return strconv.Itoa(v)
 			}),
+			CommandClear:     noData,
+			CommandIncrement: parseIntDelta,
+			CommandDecrement: parseIntDelta,
 		},
 		VariableTypeBool: {
 			CommandAdd: unmarshalToAndTransform[bool]("boolean expected", func(v bool) any {
@@ -79,36 +192,81 @@ func GetParser(varType VariableType, command CommandType) (ParseFn, error) {
 			CommandDel: unmarshalToAndTransform[bool]("boolean expected", func(v bool) any {
 				return strconv.FormatBool(v)
 			}),
+			CommandClear: noData,
+		},
+		VariableTypeFloat: {
+			CommandAdd:   parseFloat,
+			CommandDel:   parseFloat,
+			CommandClear: noData,
+		},
+		VariableTypeDuration: {
+			CommandAdd:   parseDuration,
+			CommandDel:   parseDuration,
+			CommandClear: noData,
+		},
+		VariableTypeJSON: {
+			CommandAdd:   parseJSONObject,
+			CommandDel:   parseJSONObject,
+			CommandClear: noData,
+		},
+		VariableTypeList: {
+			CommandPush:    unmarshalTo[[]string]("list expected"),
+			CommandDel:     unmarshalTo[[]string]("list expected"),
+			CommandReplace: unmarshalTo[[]string]("list expected"),
+			CommandClear:   noData,
 		},
 	}
 
 	commands, ok := parsers[varType]
 	if !ok {
-		return nil, fmt.Errorf("%w %q", errUnsupportedVariableType, varType)
+		return nil, ValidationError{
+			Code: httputil.CodeUnsupportedVariableType,
+			Msg:  fmt.Sprintf("%s %q", errUnsupportedVariableType, varType),
+			Err:  errUnsupportedVariableType,
+		}
 	}
 	parser, ok := commands[command]
 	if !ok {
-		return nil, fmt.Errorf("unsupported command %q for variable type %q", command, varType)
+		return nil, ValidationError{
+			Code: httputil.CodeUnsupportedOperation,
+			Msg:  fmt.Sprintf("unsupported command %q for variable type %q", command, varType),
+			Err:  nil,
+		}
 	}
 	return parser, nil
 }
 
+// kvAdapter reads variable values, see Adapter.
 type kvAdapter interface {
-	GetSetAsStringSlice(ctx context.Context, variableKey string, hubName string) ([]string, error)
-	GetMap(ctx context.Context, variableKey string, hubName string) (map[string]string, error)
-	GetString(ctx context.Context, variableKey string, hubName string) (string, bool, error)
+	GetValues(ctx context.Context, hubName string, variables map[string]VariableType) (map[string]any, error)
+	GetList(ctx context.Context, variableKey string, hubName string) ([]string, error)
 }
 
+// GetValue reads the value of a variable as GetValues does: collections as []string or map[string]string and
+// scalars as their string form, empty when the variable does not exist.
 func GetValue(ctx context.Context, a kvAdapter, varRef string, varType VariableType, hubName string) (any, error) {
-	switch varType {
-	case VariableTypeSet:
-		return a.GetSetAsStringSlice(ctx, varRef, hubName)
-	case VariableTypeMap:
-		return a.GetMap(ctx, varRef, hubName)
-	case VariableTypeStr, VariableTypeInt, VariableTypeBool:
-		v, _, err := a.GetString(ctx, varRef, hubName)
-		return v, err
-	default:
+	values, err := a.GetValues(ctx, hubName, map[string]VariableType{varRef: varType})
+	if err != nil {
+		return nil, err
+	}
+	value, ok := values[varRef]
+	if !ok {
 		return nil, fmt.Errorf("%w %s", errUnsupportedVariableType, varType)
 	}
+	return value, nil
+}
+
+// ETag derives a strong entity tag from a variable value as returned by GetValue and its Version, so it changes both
+// when a write is applied and when one is published. Set members are sorted first because Valkey returns them in no
+// particular order.
+func ETag(varType VariableType, value any, version int64) (string, error) {
+	if members, ok := value.([]string); ok && varType == VariableTypeSet {
+		value = slices.Sorted(slices.Values(members))
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(strconv.AppendInt(append(data, '\n'), version, 10))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
 }
@@ -2,12 +2,16 @@ package valkey
 
 import (
 	"encoding/json"
+	"net/http"
 	"testing"
 
-	"github.com/mydecisive/mdai-gateway/mocks"
+	"github.com/mydecisive/mdai-gateway/internal/httputil"
 	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	valkeygo "github.com/valkey-io/valkey-go"
+	valkeymock "github.com/valkey-io/valkey-go/mock"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
 )
 
 func TestGetParser(t *testing.T) {
@@ -76,6 +80,270 @@ func TestGetParser(t *testing.T) {
 			expectErr:      true,
 			expectedErrMsg: "int expected",
 		},
+		{
+			name:          "StringAdd ValidString",
+			varType:       VariableTypeStr,
+			command:       CommandAdd,
+			inputJSON:     json.RawMessage(`"value"`),
+			expectErr:     false,
+			expectedValue: "value",
+		},
+		{
+			name:          "SetRemove ValidList",
+			varType:       VariableTypeSet,
+			command:       CommandDel,
+			inputJSON:     json.RawMessage(`["a"]`),
+			expectErr:     false,
+			expectedValue: []string{"a"},
+		},
+		{
+			name:          "MapRemove ValidKeys",
+			varType:       VariableTypeMap,
+			command:       CommandDel,
+			inputJSON:     json.RawMessage(`["key1"]`),
+			expectErr:     false,
+			expectedValue: []string{"key1"},
+		},
+		{
+			name:           "MapRemove Map",
+			varType:        VariableTypeMap,
+			command:        CommandDel,
+			inputJSON:      json.RawMessage(`{"key1":"val1"}`),
+			expectErr:      true,
+			expectedErrMsg: "list expected",
+		},
+		{
+			name:          "SetReplace ValidList",
+			varType:       VariableTypeSet,
+			command:       CommandReplace,
+			inputJSON:     json.RawMessage(`["a", "b"]`),
+			expectErr:     false,
+			expectedValue: []string{"a", "b"},
+		},
+		{
+			name:          "SetReplace EmptyList",
+			varType:       VariableTypeSet,
+			command:       CommandReplace,
+			inputJSON:     json.RawMessage(`[]`),
+			expectErr:     false,
+			expectedValue: []string{},
+		},
+		{
+			name:           "SetReplace InvalidJSON",
+			varType:        VariableTypeSet,
+			command:        CommandReplace,
+			inputJSON:      json.RawMessage(`{"a":"b"}`),
+			expectErr:      true,
+			expectedErrMsg: "list expected",
+		},
+		{
+			name:          "MapReplace ValidMap",
+			varType:       VariableTypeMap,
+			command:       CommandReplace,
+			inputJSON:     json.RawMessage(`{"key1":"val1","key2":"val2"}`),
+			expectErr:     false,
+			expectedValue: map[string]string{"key1": "val1", "key2": "val2"},
+		},
+		{
+			name:           "MapReplace InvalidJSON",
+			varType:        VariableTypeMap,
+			command:        CommandReplace,
+			inputJSON:      json.RawMessage(`["key1"]`),
+			expectErr:      true,
+			expectedErrMsg: "map expected",
+		},
+		{
+			name:          "SetClear NoData",
+			varType:       VariableTypeSet,
+			command:       CommandClear,
+			inputJSON:     nil,
+			expectErr:     false,
+			expectedValue: nil,
+		},
+		{
+			name:          "MapClear Null",
+			varType:       VariableTypeMap,
+			command:       CommandClear,
+			inputJSON:     json.RawMessage(`null`),
+			expectErr:     false,
+			expectedValue: nil,
+		},
+		{
+			name:          "StringClear NoData",
+			varType:       VariableTypeStr,
+			command:       CommandClear,
+			inputJSON:     nil,
+			expectErr:     false,
+			expectedValue: nil,
+		},
+		{
+			name:          "IntClear NoData",
+			varType:       VariableTypeInt,
+			command:       CommandClear,
+			inputJSON:     nil,
+			expectErr:     false,
+			expectedValue: nil,
+		},
+		{
+			name:          "IntIncrement Default",
+			varType:       VariableTypeInt,
+			command:       CommandIncrement,
+			inputJSON:     json.RawMessage(`{}`),
+			expectErr:     false,
+			expectedValue: IntDelta{By: 1, Min: nil, Max: nil},
+		},
+		{
+			name:          "IntIncrement Clamped",
+			varType:       VariableTypeInt,
+			command:       CommandIncrement,
+			inputJSON:     json.RawMessage(`{"by": 5, "max": 100}`),
+			expectErr:     false,
+			expectedValue: IntDelta{By: 5, Min: nil, Max: ptr(100)},
+		},
+		{
+			name:          "IntDecrement Clamped",
+			varType:       VariableTypeInt,
+			command:       CommandDecrement,
+			inputJSON:     json.RawMessage(`{"by": 2, "min": -10, "max": 10}`),
+			expectErr:     false,
+			expectedValue: IntDelta{By: 2, Min: ptr(-10), Max: ptr(10)},
+		},
+		{
+			name:           "IntDecrement NotPositive",
+			varType:        VariableTypeInt,
+			command:        CommandDecrement,
+			inputJSON:      json.RawMessage(`{"by": 0}`),
+			expectErr:      true,
+			expectedErrMsg: "by must be positive",
+		},
+		{
+			name:           "IntIncrement MinAboveMax",
+			varType:        VariableTypeInt,
+			command:        CommandIncrement,
+			inputJSON:      json.RawMessage(`{"min": 5, "max": 1}`),
+			expectErr:      true,
+			expectedErrMsg: "min must not be greater than max",
+		},
+		{
+			name:           "IntIncrement Number",
+			varType:        VariableTypeInt,
+			command:        CommandIncrement,
+			inputJSON:      json.RawMessage(`3`),
+			expectErr:      true,
+			expectedErrMsg: `object expected: {"by": int, "min": int, "max": int}`,
+		},
+		{
+			name:           "IntIncrement UnknownField",
+			varType:        VariableTypeInt,
+			command:        CommandIncrement,
+			inputJSON:      json.RawMessage(`{"step": 3}`),
+			expectErr:      true,
+			expectedErrMsg: `object expected: {"by": int, "min": int, "max": int}`,
+		},
+		{
+			name:           "BoolClear WithData",
+			varType:        VariableTypeBool,
+			command:        CommandClear,
+			inputJSON:      json.RawMessage(`true`),
+			expectErr:      true,
+			expectedErrMsg: "no data expected",
+		},
+		{
+			name:          "FloatAdd ValidFloat",
+			varType:       VariableTypeFloat,
+			command:       CommandAdd,
+			inputJSON:     json.RawMessage(`0.25`),
+			expectErr:     false,
+			expectedValue: "0.25",
+		},
+		{
+			name:          "FloatAdd Integer",
+			varType:       VariableTypeFloat,
+			command:       CommandAdd,
+			inputJSON:     json.RawMessage(`1e3`),
+			expectErr:     false,
+			expectedValue: "1000",
+		},
+		{
+			name:           "FloatAdd String",
+			varType:        VariableTypeFloat,
+			command:        CommandAdd,
+			inputJSON:      json.RawMessage(`"0.25"`),
+			expectErr:      true,
+			expectedErrMsg: "float expected",
+		},
+		{
+			name:          "DurationAdd Go",
+			varType:       VariableTypeDuration,
+			command:       CommandAdd,
+			inputJSON:     json.RawMessage(`"90m"`),
+			expectErr:     false,
+			expectedValue: "1h30m0s",
+		},
+		{
+			name:          "DurationAdd ISO",
+			varType:       VariableTypeDuration,
+			command:       CommandAdd,
+			inputJSON:     json.RawMessage(`"P1DT0.5S"`),
+			expectErr:     false,
+			expectedValue: "24h0m0.5s",
+		},
+		{
+			name:           "DurationAdd Number",
+			varType:        VariableTypeDuration,
+			command:        CommandAdd,
+			inputJSON:      json.RawMessage(`60`),
+			expectErr:      true,
+			expectedErrMsg: `duration expected, e.g. "1h30m" or "PT1H30M"`,
+		},
+		{
+			name:           "DurationAdd Invalid",
+			varType:        VariableTypeDuration,
+			command:        CommandAdd,
+			inputJSON:      json.RawMessage(`"soon"`),
+			expectErr:      true,
+			expectedErrMsg: `invalid duration "soon": expected Go (1h30m) or ISO 8601 (PT1H30M) form`,
+		},
+		{
+			name:          "JSONAdd Object",
+			varType:       VariableTypeJSON,
+			command:       CommandAdd,
+			inputJSON:     json.RawMessage(`{ "threshold": 0.5, "services": ["a", "b"] }`),
+			expectErr:     false,
+			expectedValue: `{"threshold":0.5,"services":["a","b"]}`,
+		},
+		{
+			name:           "JSONAdd Array",
+			varType:        VariableTypeJSON,
+			command:        CommandAdd,
+			inputJSON:      json.RawMessage(`["a"]`),
+			expectErr:      true,
+			expectedErrMsg: "JSON object expected",
+		},
+		{
+			name:           "JSONAdd Null",
+			varType:        VariableTypeJSON,
+			command:        CommandAdd,
+			inputJSON:      json.RawMessage(`null`),
+			expectErr:      true,
+			expectedErrMsg: "JSON object expected",
+		},
+		{
+			name:          "ListPush ValidList",
+			varType:       VariableTypeList,
+			command:       CommandPush,
+			inputJSON:     json.RawMessage(`["b", "a", "b"]`),
+			expectErr:     false,
+			expectedValue: []string{"b", "a", "b"},
+		},
+		{
+			name:           "ListRemove String",
+			varType:        VariableTypeList,
+			command:        CommandDel,
+			inputJSON:      json.RawMessage(`"a"`),
+			expectErr:      true,
+			expectedErrMsg: "list expected",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -86,6 +354,10 @@ func TestGetParser(t *testing.T) {
 			actualValue, err := parser(tc.inputJSON)
 			if tc.expectErr {
 				assert.Equal(t, tc.expectedErrMsg, err.Error())
+				var validationErr ValidationError
+				require.ErrorAs(t, err, &validationErr)
+				assert.Equal(t, httputil.CodeInvalidValue, validationErr.ErrorCode())
+				assert.Equal(t, http.StatusBadRequest, validationErr.HTTPStatus())
 			}
 			assert.Equal(t, tc.expectedValue, actualValue)
 		})
@@ -93,110 +365,163 @@ func TestGetParser(t *testing.T) {
 
 	t.Run("UnsupportedVariableType", func(t *testing.T) {
 		_, err := GetParser("invalid-type", CommandAdd)
-		require.Error(t, err)
+		require.ErrorIs(t, err, errUnsupportedVariableType)
+		var validationErr ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		assert.Equal(t, httputil.CodeUnsupportedVariableType, validationErr.ErrorCode())
+	})
+
+	t.Run("ReplaceScalar", func(t *testing.T) {
+		for _, varType := range []VariableType{VariableTypeStr, VariableTypeInt, VariableTypeBool, VariableTypeFloat, VariableTypeDuration, VariableTypeJSON} {
+			_, err := GetParser(varType, CommandReplace)
+			var validationErr ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			assert.Equal(t, httputil.CodeUnsupportedOperation, validationErr.ErrorCode(), varType)
+		}
+	})
+
+	t.Run("IncrementNonInt", func(t *testing.T) {
+		for _, varType := range []VariableType{VariableTypeStr, VariableTypeBool, VariableTypeSet, VariableTypeMap, VariableTypeFloat, VariableTypeList} {
+			for _, command := range []CommandType{CommandIncrement, CommandDecrement} {
+				_, err := GetParser(varType, command)
+				var validationErr ValidationError
+				require.ErrorAs(t, err, &validationErr)
+				assert.Equal(t, httputil.CodeUnsupportedOperation, validationErr.ErrorCode(), varType)
+			}
+		}
 	})
 
 	t.Run("UnsupportedCommand", func(t *testing.T) {
 		_, err := GetParser(VariableTypeSet, "invalid-command")
-		require.Error(t, err)
+		require.EqualError(t, err, `unsupported command "invalid-command" for variable type "set"`)
+		var validationErr ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		assert.Equal(t, httputil.CodeUnsupportedOperation, validationErr.ErrorCode())
 	})
 }
 
+func TestETag(t *testing.T) {
+	setETag, err := ETag(VariableTypeSet, []string{"b", "a"}, 0)
+	require.NoError(t, err)
+	sortedETag, err := ETag(VariableTypeSet, []string{"a", "b"}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, sortedETag, setETag)
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, setETag)
+
+	otherETag, err := ETag(VariableTypeSet, []string{"a"}, 0)
+	require.NoError(t, err)
+	assert.NotEqual(t, setETag, otherETag)
+
+	listETag, err := ETag(VariableTypeList, []string{"b", "a"}, 0)
+	require.NoError(t, err)
+	reorderedListETag, err := ETag(VariableTypeList, []string{"a", "b"}, 0)
+	require.NoError(t, err)
+	assert.NotEqual(t, listETag, reorderedListETag)
+
+	mapETag, err := ETag(VariableTypeMap, map[string]string{"k1": "v1", "k2": "v2"}, 0)
+	require.NoError(t, err)
+	sameMapETag, err := ETag(VariableTypeMap, map[string]string{"k2": "v2", "k1": "v1"}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, mapETag, sameMapETag)
+
+	nextETag, err := ETag(VariableTypeMap, map[string]string{"k1": "v1", "k2": "v2"}, 1)
+	require.NoError(t, err)
+	assert.NotEqual(t, mapETag, nextETag)
+}
+
 func TestGetValue(t *testing.T) {
 	tests := []struct {
-		name      string
-		key       string
-		varType   VariableType
-		hubName   string
-		mockSetup func(m *mocks.MockKVAdapter)
-		expected  any
-		expectErr bool
+		name     string
+		key      string
+		varType  VariableType
+		command  []string
+		reply    valkeygo.ValkeyMessage
+		expected any
 	}{
 		{
-			name:    "set value",
-			key:     "foo",
-			varType: "set",
-			hubName: "hub",
-			mockSetup: func(m *mocks.MockKVAdapter) {
-				m.On("GetSetAsStringSlice", mock.Anything, "foo", "hub").
-					Return([]string{"foo", "bar"}, nil).Once()
-			},
-			expected:  []string{"foo", "bar"},
-			expectErr: false,
-		},
-		{
-			name:    "map value",
-			key:     "foo",
-			varType: "map",
-			hubName: "hub",
-			mockSetup: func(m *mocks.MockKVAdapter) {
-				m.On("GetMap", mock.Anything, "foo", "hub").
-					Return(map[string]string{"foo": "bar"}, nil).Once()
-			},
-			expected:  map[string]string{"foo": "bar"},
-			expectErr: false,
-		},
-		{
-			name:    "string value",
-			key:     "foo_string",
-			varType: "string",
-			hubName: "hub",
-			mockSetup: func(m *mocks.MockKVAdapter) {
-				m.On("GetString", mock.Anything, "foo_string", "hub").
-					Return("bar", true, nil).Once()
-			},
-			expected:  "bar",
-			expectErr: false,
-		},
-		{
-			name:    "boolean value",
-			key:     "foo_bool",
-			varType: "boolean",
-			hubName: "hub",
-			mockSetup: func(m *mocks.MockKVAdapter) {
-				m.On("GetString", mock.Anything, "foo_bool", "hub").
-					Return("true", true, nil).Once()
-			},
-			expected:  "true",
-			expectErr: false,
-		},
-		{
-			name:    "int value",
-			key:     "foo_int",
-			varType: "int",
-			hubName: "hub",
-			mockSetup: func(m *mocks.MockKVAdapter) {
-				m.On("GetString", mock.Anything, "foo_int", "hub").
-					Return("999", true, nil).Once()
-			},
-			expected:  "999",
-			expectErr: false,
-		},
-		{
-			name:      "invalid value",
-			key:       "foo_invalid",
-			varType:   "invalid",
-			hubName:   "hub",
-			mockSetup: func(m *mocks.MockKVAdapter) {},
-			expected:  nil,
-			expectErr: true,
+			name:     "set value",
+			key:      "foo",
+			varType:  "set",
+			command:  []string{"SMEMBERS", "variable/hub/foo"},
+			reply:    valkeymock.ValkeyArray(valkeymock.ValkeyBlobString("foo"), valkeymock.ValkeyBlobString("bar")),
+			expected: []string{"foo", "bar"},
+		},
+		{
+			name:     "map value",
+			key:      "foo",
+			varType:  "map",
+			command:  []string{"HGETALL", "variable/hub/foo"},
+			reply:    valkeymock.ValkeyMap(map[string]valkeygo.ValkeyMessage{"foo": valkeymock.ValkeyBlobString("bar")}),
+			expected: map[string]string{"foo": "bar"},
+		},
+		{
+			name:     "string value",
+			key:      "foo_string",
+			varType:  "string",
+			command:  []string{"GET", "variable/hub/foo_string"},
+			reply:    valkeymock.ValkeyBlobString("bar"),
+			expected: "bar",
+		},
+		{
+			name:     "missing string value",
+			key:      "foo_string",
+			varType:  "string",
+			command:  []string{"GET", "variable/hub/foo_string"},
+			reply:    valkeymock.ValkeyNil(),
+			expected: "",
+		},
+		{
+			name:     "boolean value",
+			key:      "foo_bool",
+			varType:  "boolean",
+			command:  []string{"GET", "variable/hub/foo_bool"},
+			reply:    valkeymock.ValkeyBlobString("true"),
+			expected: "true",
+		},
+		{
+			name:     "int value",
+			key:      "foo_int",
+			varType:  "int",
+			command:  []string{"GET", "variable/hub/foo_int"},
+			reply:    valkeymock.ValkeyBlobString("999"),
+			expected: "999",
+		},
+		{
+			name:     "list value",
+			key:      "foo_list",
+			varType:  "list",
+			command:  []string{"LRANGE", "variable/hub/foo_list", "0", "-1"},
+			reply:    valkeymock.ValkeyArray(valkeymock.ValkeyBlobString("b"), valkeymock.ValkeyBlobString("a"), valkeymock.ValkeyBlobString("b")),
+			expected: []string{"b", "a", "b"},
+		},
+		{
+			name:     "float value",
+			key:      "foo_float",
+			varType:  "float",
+			command:  []string{"GET", "variable/hub/foo_float"},
+			reply:    valkeymock.ValkeyBlobString("0.25"),
+			expected: "0.25",
 		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			mockKV := &mocks.MockKVAdapter{}
-			tc.mockSetup(mockKV)
-			t.Cleanup(func() { mockKV.AssertExpectations(t) })
-
-			val, err := GetValue(t.Context(), mockKV, tc.key, tc.varType, tc.hubName)
+			client := valkeymock.NewClient(gomock.NewController(t))
+			client.EXPECT().Do(gomock.Any(), valkeymock.Match(tc.command...)).Return(valkeymock.Result(tc.reply))
 
-			if tc.expectErr {
-				require.Error(t, err)
-			} else {
-				require.NoError(t, err)
-				assert.Equal(t, tc.expected, val)
-			}
+			val, err := GetValue(t.Context(), NewAdapter(client, zap.NewNop()), tc.key, tc.varType, "hub")
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, val)
 		})
 	}
+
+	t.Run("invalid value", func(t *testing.T) {
+		client := valkeymock.NewClient(gomock.NewController(t))
+		_, err := GetValue(t.Context(), NewAdapter(client, zap.NewNop()), "foo_invalid", "invalid", "hub")
+		require.ErrorIs(t, err, errUnsupportedVariableType)
+	})
+}
+
+func ptr[T any](v T) *T {
+	return &v
 }
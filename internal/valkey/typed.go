@@ -0,0 +1,66 @@
+package valkey
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// StoredValueError reports a value in Valkey that does not parse as the type its variable is declared with.
+type StoredValueError struct {
+	Type  VariableType
+	Value string
+}
+
+func (e StoredValueError) Error() string {
+	return fmt.Sprintf("stored value %q is not a valid %s", e.Value, e.Type)
+}
+
+// Typed converts a value as returned by GetValue to the JSON type matching varType, the way writes accept it: ints and
+// floats become numbers, booleans booleans and JSON objects objects. Other values are returned as they are. Valkey does
+// not tell a missing string from an empty one, so a missing int, float, boolean, duration or JSON object is nil.
+func Typed(varType VariableType, value any) (any, error) {
+	s, ok := value.(string)
+	if !ok || varType == VariableTypeStr {
+		return value, nil
+	}
+	if s == "" {
+		return nil, nil //nolint:nilnil
+	}
+
+	invalid := StoredValueError{Type: varType, Value: s}
+	switch varType {
+	case VariableTypeInt:
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, invalid
+		}
+		return v, nil
+	case VariableTypeFloat:
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsInf(v, 0) || math.IsNaN(v) {
+			return nil, invalid
+		}
+		return v, nil
+	case VariableTypeBool:
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, invalid
+		}
+		return v, nil
+	case VariableTypeDuration:
+		if _, err := readDuration(s); err != nil {
+			return nil, invalid
+		}
+		return s, nil
+	case VariableTypeJSON:
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(s), &object); err != nil || object == nil {
+			return nil, invalid
+		}
+		return json.RawMessage(s), nil
+	default:
+		return value, nil
+	}
+}
@@ -0,0 +1,51 @@
+package valkey
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTyped(t *testing.T) {
+	testCases := []struct {
+		value    any
+		expected any
+		name     string
+		varType  VariableType
+	}{
+		{name: "Int", varType: VariableTypeInt, value: "-12", expected: int64(-12)},
+		{name: "Float", varType: VariableTypeFloat, value: "0.25", expected: 0.25},
+		{name: "Bool", varType: VariableTypeBool, value: "true", expected: true},
+		{name: "Duration", varType: VariableTypeDuration, value: "1h30m0s", expected: "1h30m0s"},
+		{name: "JSON", varType: VariableTypeJSON, value: `{"a":1}`, expected: json.RawMessage(`{"a":1}`)},
+		{name: "String", varType: VariableTypeStr, value: "123", expected: "123"},
+		{name: "EmptyString", varType: VariableTypeStr, value: "", expected: ""},
+		{name: "MissingInt", varType: VariableTypeInt, value: "", expected: nil},
+		{name: "Set", varType: VariableTypeSet, value: []string{"a"}, expected: []string{"a"}},
+		{name: "Map", varType: VariableTypeMap, value: map[string]string{"k": "v"}, expected: map[string]string{"k": "v"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := Typed(tc.varType, tc.value)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+
+	invalid := map[VariableType]string{
+		VariableTypeInt:      "1.5",
+		VariableTypeFloat:    "NaN",
+		VariableTypeBool:     "yes",
+		VariableTypeDuration: "soon",
+		VariableTypeJSON:     `["a"]`,
+	}
+	for varType, value := range invalid {
+		_, err := Typed(varType, value)
+		require.ErrorIs(t, err, StoredValueError{Type: varType, Value: value}, varType)
+	}
+	_, err := Typed(VariableTypeInt, "abc")
+	require.EqualError(t, err, `stored value "abc" is not a valid int`)
+}
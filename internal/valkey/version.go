@@ -0,0 +1,50 @@
+package valkey
+
+import (
+	"context"
+	"strconv"
+
+	valkeygo "github.com/valkey-io/valkey-go"
+)
+
+// versionKeyPrefix is the prefix of the keys the gateway counts the writes to each variable under, see Version.
+const versionKeyPrefix = "gateway/variable-version/"
+
+// bumpVersionScript increments the version at KEYS[1] and returns it, unless ARGV[1] is set and the version is not
+// ARGV[1] any more, in which case it returns -1. A missing version is 0.
+var bumpVersionScript = valkeygo.NewLuaScript(`
+local version = tonumber(redis.call('GET', KEYS[1]) or '0')
+if ARGV[1] ~= '' and version ~= tonumber(ARGV[1]) then
+	return -1
+end
+return redis.call('INCR', KEYS[1])`)
+
+func versionKey(hubName, varName string) string {
+	return versionKeyPrefix + hubName + "/" + varName
+}
+
+// Version returns how many writes to a variable the gateway published or is publishing. Unlike the value, which the
+// operator updates once it applies a write, it moves on before the write is published, so ETag folds it in for
+// If-Match to see writes still in flight.
+func Version(ctx context.Context, client valkeygo.Client, hubName, varName string) (int64, error) {
+	version, err := client.Do(ctx, client.B().Get().Key(versionKey(hubName, varName)).Build()).AsInt64()
+	if valkeygo.IsValkeyNil(err) {
+		return 0, nil
+	}
+	return version, err
+}
+
+// BumpVersion moves the version of a variable on before a write to it is published. When expected is not nil it
+// does so only if the version is still *expected, reporting false otherwise, so of two writes checked against the
+// same version only one is published.
+func BumpVersion(ctx context.Context, client valkeygo.Client, hubName, varName string, expected *int64) (bool, error) {
+	arg := ""
+	if expected != nil {
+		arg = strconv.FormatInt(*expected, 10)
+	}
+	version, err := bumpVersionScript.Exec(ctx, client, []string{versionKey(hubName, varName)}, []string{arg}).AsInt64()
+	if err != nil {
+		return false, err
+	}
+	return version >= 0, nil
+}
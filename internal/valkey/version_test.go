@@ -0,0 +1,48 @@
+package valkey
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	valkeygo "github.com/valkey-io/valkey-go"
+	valkeymock "github.com/valkey-io/valkey-go/mock"
+	"go.uber.org/mock/gomock"
+)
+
+// bumpVersion matches the script of BumpVersion run with the given arguments.
+func bumpVersion(args ...string) any {
+	return gomock.Cond(func(cmd valkeygo.Completed) bool {
+		commands := cmd.Commands()
+		return commands[0] == "EVALSHA" && slices.Equal(commands[2:], append([]string{"1", "gateway/variable-version/hub/foo"}, args...))
+	})
+}
+
+func TestVersion(t *testing.T) {
+	client := valkeymock.NewClient(gomock.NewController(t))
+	client.EXPECT().Do(gomock.Any(), valkeymock.Match("GET", "gateway/variable-version/hub/foo")).Return(valkeymock.Result(valkeymock.ValkeyNil()))
+	client.EXPECT().Do(gomock.Any(), valkeymock.Match("GET", "gateway/variable-version/hub/foo")).Return(valkeymock.Result(valkeymock.ValkeyBlobString("3")))
+
+	version, err := Version(t.Context(), client, "hub", "foo")
+	require.NoError(t, err)
+	assert.Zero(t, version)
+	version, err = Version(t.Context(), client, "hub", "foo")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), version)
+}
+
+func TestBumpVersion(t *testing.T) {
+	client := valkeymock.NewClient(gomock.NewController(t))
+	client.EXPECT().Do(gomock.Any(), bumpVersion("")).Return(valkeymock.Result(valkeymock.ValkeyInt64(4)))
+	client.EXPECT().Do(gomock.Any(), bumpVersion("3")).Return(valkeymock.Result(valkeymock.ValkeyInt64(-1)))
+
+	bumped, err := BumpVersion(t.Context(), client, "hub", "foo", nil)
+	require.NoError(t, err)
+	assert.True(t, bumped)
+
+	expected := int64(3)
+	bumped, err = BumpVersion(t.Context(), client, "hub", "foo", &expected)
+	require.NoError(t, err)
+	assert.False(t, bumped)
+}